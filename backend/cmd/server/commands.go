@@ -0,0 +1,202 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/TangTangChu/AnzuImg/backend/internal/model"
+	"github.com/TangTangChu/AnzuImg/backend/internal/service"
+)
+
+// runCommand 执行命令行维护子命令，返回进程退出码
+func runCommand(maint *service.MaintenanceService, args []string) int {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	switch args[0] {
+	case "migrate-storage":
+		fs := flag.NewFlagSet("migrate-storage", flag.ExitOnError)
+		from := fs.String("from", "", "source storage type (local|cloud|webdav|sftp|http)")
+		to := fs.String("to", "", "target storage type (local|cloud|webdav|sftp|http)")
+		deleteSource := fs.Bool("delete-source", false, "delete source files after a verified copy")
+		_ = fs.Parse(args[1:])
+
+		job, err := maint.CreateStorageMigration(service.StorageMigrationParams{
+			From:         *from,
+			To:           *to,
+			DeleteSource: *deleteSource,
+		})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "create job failed: %v\n", err)
+			return 2
+		}
+		fmt.Printf("created job %s\n", job.ID)
+		return runJob(ctx, maint, job.ID)
+	case "scrub-storage":
+		fs := flag.NewFlagSet("scrub-storage", flag.ExitOnError)
+		backend := fs.String("backend", "", "storage type to scrub (local|cloud|webdav|sftp|http), defaults to the configured storage")
+		orphans := fs.String("orphans", service.ScrubOrphanReport, "what to do with orphaned objects (report|quarantine|delete)")
+		minAge := fs.Int("orphan-min-age", 24, "only treat objects older than this many hours as orphans")
+		_ = fs.Parse(args[1:])
+
+		job, err := maint.CreateStorageScrub(service.StorageScrubParams{
+			Backend:           *backend,
+			Orphans:           *orphans,
+			OrphanMinAgeHours: *minAge,
+		})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "create job failed: %v\n", err)
+			return 2
+		}
+		fmt.Printf("created job %s\n", job.ID)
+		code := runJob(ctx, maint, job.ID)
+		if code != 130 {
+			printScrubReport(maint, job.ID, "")
+		}
+		return code
+	case "scrub-report":
+		fs := flag.NewFlagSet("scrub-report", flag.ExitOnError)
+		kind := fs.String("kind", "", "only show findings of this kind (missing|corrupt|orphan)")
+		_ = fs.Parse(args[1:])
+		if fs.NArg() < 1 {
+			fmt.Fprintln(os.Stderr, "usage: scrub-report [--kind missing|corrupt|orphan] <job-id>")
+			return 2
+		}
+		if _, err := maint.GetJob(fs.Arg(0)); err != nil {
+			fmt.Fprintf(os.Stderr, "get job failed: %v\n", err)
+			return 1
+		}
+		return printScrubReport(maint, fs.Arg(0), *kind)
+	case "backfill-thumbnails":
+		fs := flag.NewFlagSet("backfill-thumbnails", flag.ExitOnError)
+		pendingMinAge := fs.Int("pending-min-age", 60, "regenerate thumbnails still pending after this many minutes")
+		_ = fs.Parse(args[1:])
+
+		job, err := maint.CreateThumbnailBackfill(service.ThumbnailBackfillParams{
+			PendingMinAgeMinutes: *pendingMinAge,
+		})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "create job failed: %v\n", err)
+			return 2
+		}
+		fmt.Printf("created job %s\n", job.ID)
+		return runJob(ctx, maint, job.ID)
+	case "regenerate-thumbnails":
+		fs := flag.NewFlagSet("regenerate-thumbnails", flag.ExitOnError)
+		hash := fs.String("hash", "", "regenerate thumbnails of a single image")
+		tag := fs.String("tag", "", "regenerate thumbnails of images with this tag")
+		all := fs.Bool("all", false, "regenerate thumbnails of the whole library")
+		missingOnly := fs.Bool("missing-only", false, "only generate sizes that do not exist yet")
+		_ = fs.Parse(args[1:])
+
+		job, err := maint.CreateThumbnailRegenerate(service.ThumbnailRegenerateParams{
+			Hash:        *hash,
+			Tag:         *tag,
+			All:         *all,
+			MissingOnly: *missingOnly,
+		})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "create job failed: %v\n", err)
+			fmt.Fprintln(os.Stderr, "usage: regenerate-thumbnails (--hash H | --tag T | --all) [--missing-only]")
+			return 2
+		}
+		fmt.Printf("created job %s\n", job.ID)
+		return runJob(ctx, maint, job.ID)
+	case "resume-job":
+		if len(args) < 2 {
+			fmt.Fprintln(os.Stderr, "usage: resume-job <job-id>")
+			return 2
+		}
+		return runJob(ctx, maint, args[1])
+	case "jobs":
+		jobs, err := maint.ListJobs(50)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "list jobs failed: %v\n", err)
+			return 1
+		}
+		for _, j := range jobs {
+			printJob(&j)
+		}
+		return 0
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q (available: migrate-storage, scrub-storage, scrub-report, backfill-thumbnails, regenerate-thumbnails, resume-job, jobs)\n", args[0])
+		return 2
+	}
+}
+
+func runJob(ctx context.Context, maint *service.MaintenanceService, id string) int {
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(5 * time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if j, err := maint.GetJob(id); err == nil {
+					fmt.Printf("progress: %d/%d, failed=%d\n", j.Processed, j.Total, j.Failed)
+				}
+			}
+		}
+	}()
+	_, err := maint.Run(ctx, id)
+	close(done)
+	if j, getErr := maint.GetJob(id); getErr == nil {
+		printJob(j)
+	}
+	switch {
+	case errors.Is(err, service.ErrJobCancelled):
+		fmt.Printf("job cancelled, resume with: resume-job %s\n", id)
+		return 130
+	case err != nil:
+		fmt.Fprintf(os.Stderr, "job failed: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+func printJob(j *model.MaintenanceJob) {
+	fmt.Printf("%s  %-18s %-10s processed=%d/%d failed=%d params=%s\n",
+		j.ID, j.Kind, j.Status, j.Processed, j.Total, j.Failed, string(j.Params))
+	if j.LastError != "" {
+		fmt.Printf("  last error: %s\n", j.LastError)
+	}
+}
+
+// printScrubReport 输出巡检任务的统计与全部问题
+func printScrubReport(maint *service.MaintenanceService, id, kind string) int {
+	summary, err := maint.ScrubSummary(id)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "load report failed: %v\n", err)
+		return 1
+	}
+	fmt.Printf("missing=%d corrupt=%d orphan=%d\n",
+		summary[model.ScrubFindingMissing], summary[model.ScrubFindingCorrupt], summary[model.ScrubFindingOrphan])
+	for page := 1; ; page++ {
+		findings, _, err := maint.ListScrubFindings(id, kind, page, 200)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "load report failed: %v\n", err)
+			return 1
+		}
+		for _, f := range findings {
+			fmt.Printf("%-8s %-6s %s", f.Kind, f.Backend, f.Path)
+			if f.Action != "" {
+				fmt.Printf(" [%s]", f.Action)
+			}
+			if f.Detail != "" {
+				fmt.Printf(" (%s)", f.Detail)
+			}
+			fmt.Println()
+		}
+		if len(findings) < 200 {
+			return 0
+		}
+	}
+}
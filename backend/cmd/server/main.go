@@ -100,7 +100,21 @@ ALTER TABLE images ADD COLUMN IF NOT EXISTS video_codec VARCHAR(64);
 ALTER TABLE images ADD COLUMN IF NOT EXISTS video_bitrate BIGINT NOT NULL DEFAULT 0;
 ALTER TABLE images ADD COLUMN IF NOT EXISTS audio_codec VARCHAR(64);
 ALTER TABLE images ADD COLUMN IF NOT EXISTS audio_bitrate BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE images ADD COLUMN IF NOT EXISTS storage_backend VARCHAR(32) NOT NULL DEFAULT '';
+CREATE INDEX IF NOT EXISTS idx_images_storage_backend ON images(storage_backend);
 CREATE INDEX IF NOT EXISTS idx_images_uploaded_by_token_id ON images(uploaded_by_token_id);
+ALTER TABLE images ADD COLUMN IF NOT EXISTS thumbnail_status VARCHAR(16) NOT NULL DEFAULT '';
+CREATE INDEX IF NOT EXISTS idx_images_thumbnail_status ON images(thumbnail_status);
+CREATE INDEX IF NOT EXISTS idx_images_description_fts ON images USING GIN(to_tsvector('simple', COALESCE(description, '')));
+CREATE INDEX IF NOT EXISTS idx_images_mime_type ON images(mime_type varchar_pattern_ops);
+CREATE INDEX IF NOT EXISTS idx_images_created_at_id ON images(created_at, id);
+CREATE INDEX IF NOT EXISTS idx_images_size_id ON images(size, id);
+CREATE INDEX IF NOT EXISTS idx_images_file_name_id ON images(file_name, id);
+CREATE INDEX IF NOT EXISTS idx_images_width_id ON images((COALESCE(width, 0)), id);
+CREATE INDEX IF NOT EXISTS idx_images_height_id ON images((COALESCE(height, 0)), id);
+CREATE INDEX IF NOT EXISTS idx_images_duration_id ON images(duration_seconds, id);
+ALTER TABLE images ADD COLUMN IF NOT EXISTS visibility VARCHAR(16) NOT NULL DEFAULT 'public';
+CREATE INDEX IF NOT EXISTS idx_images_visibility ON images(visibility);
 `
 		if err := tx.Exec(alterImagesTable).Error; err != nil {
 			return fmt.Errorf("alter images table failed: %w", err)
@@ -120,11 +134,63 @@ CREATE TABLE IF NOT EXISTS upload_tasks (
 );
 CREATE INDEX IF NOT EXISTS idx_upload_tasks_status ON upload_tasks(status);
 CREATE INDEX IF NOT EXISTS idx_upload_tasks_created_at ON upload_tasks(created_at);
+ALTER TABLE upload_tasks ADD COLUMN IF NOT EXISTS payload JSONB;
+ALTER TABLE upload_tasks ADD COLUMN IF NOT EXISTS attempts INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE upload_tasks ADD COLUMN IF NOT EXISTS next_attempt_at TIMESTAMPTZ NOT NULL DEFAULT NOW();
+ALTER TABLE upload_tasks ADD COLUMN IF NOT EXISTS claimed_at TIMESTAMPTZ;
+CREATE INDEX IF NOT EXISTS idx_upload_tasks_status_next_attempt ON upload_tasks(status, next_attempt_at);
+ALTER TABLE upload_tasks ADD COLUMN IF NOT EXISTS uploaded_by_token_id BIGINT;
+CREATE INDEX IF NOT EXISTS idx_upload_tasks_uploaded_by_token_id ON upload_tasks(uploaded_by_token_id);
+CREATE INDEX IF NOT EXISTS idx_upload_tasks_completed_at ON upload_tasks(completed_at);
+ALTER TABLE upload_tasks ADD COLUMN IF NOT EXISTS stage VARCHAR(32);
 `
 		if err := tx.Exec(createUploadTasksTable).Error; err != nil {
 			return fmt.Errorf("create upload_tasks table failed: %w", err)
 		}
 
+		createWebhookDeliveriesTable := `
+CREATE TABLE IF NOT EXISTS webhook_deliveries (
+    id               BIGSERIAL PRIMARY KEY,
+    task_id          VARCHAR(36)   NOT NULL REFERENCES upload_tasks(id) ON DELETE CASCADE,
+    event            VARCHAR(64)   NOT NULL,
+    url              VARCHAR(2048) NOT NULL,
+    payload          JSONB         NOT NULL,
+    status           VARCHAR(16)   NOT NULL,
+    attempts         INTEGER       NOT NULL DEFAULT 0,
+    next_attempt_at  TIMESTAMPTZ   NOT NULL DEFAULT NOW(),
+    claimed_at       TIMESTAMPTZ,
+    last_status_code INTEGER,
+    last_error       TEXT,
+    created_at       TIMESTAMPTZ   NOT NULL DEFAULT NOW(),
+    updated_at       TIMESTAMPTZ   NOT NULL DEFAULT NOW(),
+    delivered_at     TIMESTAMPTZ
+);
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_task_id ON webhook_deliveries(task_id);
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_status_next_attempt ON webhook_deliveries(status, next_attempt_at);
+`
+		if err := tx.Exec(createWebhookDeliveriesTable).Error; err != nil {
+			return fmt.Errorf("create webhook_deliveries table failed: %w", err)
+		}
+
+		createResumableUploadsTable := `
+CREATE TABLE IF NOT EXISTS resumable_uploads (
+    id                   VARCHAR(36) PRIMARY KEY,
+    file_name            VARCHAR(255),
+    size                 BIGINT      NOT NULL,
+    upload_offset        BIGINT      NOT NULL DEFAULT 0,
+    options              JSONB,
+    uploaded_by_token_id BIGINT,
+    created_at           TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at           TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    expires_at           TIMESTAMPTZ NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_resumable_uploads_expires_at ON resumable_uploads(expires_at);
+CREATE INDEX IF NOT EXISTS idx_resumable_uploads_uploaded_by_token_id ON resumable_uploads(uploaded_by_token_id);
+`
+		if err := tx.Exec(createResumableUploadsTable).Error; err != nil {
+			return fmt.Errorf("create resumable_uploads table failed: %w", err)
+		}
+
 		createRoutesTable := `
 CREATE TABLE IF NOT EXISTS image_routes (
     id         BIGSERIAL PRIMARY KEY,
@@ -133,11 +199,164 @@ CREATE TABLE IF NOT EXISTS image_routes (
     created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
 );
 CREATE INDEX IF NOT EXISTS idx_image_routes_image_id ON image_routes(image_id);
+CREATE INDEX IF NOT EXISTS idx_image_routes_created_at_id ON image_routes(created_at, id);
+ALTER TABLE image_routes ALTER COLUMN image_id DROP NOT NULL;
+ALTER TABLE image_routes ADD COLUMN IF NOT EXISTS redirect_to VARCHAR(255) NOT NULL DEFAULT '';
+ALTER TABLE image_routes ADD COLUMN IF NOT EXISTS expires_at TIMESTAMPTZ;
+ALTER TABLE image_routes ADD COLUMN IF NOT EXISTS content_disposition VARCHAR(16) NOT NULL DEFAULT '';
+ALTER TABLE image_routes ADD COLUMN IF NOT EXISTS download_filename VARCHAR(255) NOT NULL DEFAULT '';
+ALTER TABLE image_routes ADD COLUMN IF NOT EXISTS updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW();
+CREATE TABLE IF NOT EXISTS image_route_histories (
+    id          BIGSERIAL PRIMARY KEY,
+    route_id    BIGINT NOT NULL REFERENCES image_routes(id) ON DELETE CASCADE,
+    image_hash  VARCHAR(64) NOT NULL DEFAULT '',
+    redirect_to VARCHAR(255) NOT NULL DEFAULT '',
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS idx_image_route_histories_route_created_at_id ON image_route_histories(route_id, created_at, id);
 `
 		if err := tx.Exec(createRoutesTable).Error; err != nil {
 			return fmt.Errorf("create image_routes table failed: %w", err)
 		}
 
+		createImageVariantsTable := `
+CREATE TABLE IF NOT EXISTS image_variants (
+    id               BIGSERIAL PRIMARY KEY,
+    image_id         BIGINT NOT NULL REFERENCES images(id) ON DELETE CASCADE,
+    variant_key      VARCHAR(255) NOT NULL UNIQUE,
+    storage_path     VARCHAR(512) NOT NULL,
+    mime_type        VARCHAR(64),
+    size             BIGINT NOT NULL DEFAULT 0,
+    last_accessed_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    created_at       TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS idx_image_variants_image_id ON image_variants(image_id);
+CREATE INDEX IF NOT EXISTS idx_image_variants_last_accessed_at ON image_variants(last_accessed_at);
+`
+		if err := tx.Exec(createImageVariantsTable).Error; err != nil {
+			return fmt.Errorf("create image_variants table failed: %w", err)
+		}
+
+		createImageReplicasTable := `
+CREATE TABLE IF NOT EXISTS image_replicas (
+    id         BIGSERIAL PRIMARY KEY,
+    image_id   BIGINT NOT NULL REFERENCES images(id) ON DELETE CASCADE,
+    backend    VARCHAR(32) NOT NULL,
+    status     VARCHAR(16) NOT NULL,
+    last_error TEXT,
+    checked_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE (image_id, backend)
+);
+CREATE INDEX IF NOT EXISTS idx_image_replicas_status ON image_replicas(status);
+`
+		if err := tx.Exec(createImageReplicasTable).Error; err != nil {
+			return fmt.Errorf("create image_replicas table failed: %w", err)
+		}
+
+		createAlbumsTable := `
+CREATE TABLE IF NOT EXISTS albums (
+    id             BIGSERIAL PRIMARY KEY,
+    title          VARCHAR(255) NOT NULL,
+    description    TEXT,
+    cover_image_id BIGINT REFERENCES images(id) ON DELETE SET NULL,
+    created_at     TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at     TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS idx_albums_created_at_id ON albums(created_at, id);
+CREATE TABLE IF NOT EXISTS album_images (
+    album_id   BIGINT  NOT NULL REFERENCES albums(id) ON DELETE CASCADE,
+    image_id   BIGINT  NOT NULL REFERENCES images(id) ON DELETE CASCADE,
+    position   INTEGER NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (album_id, image_id)
+);
+CREATE INDEX IF NOT EXISTS idx_album_images_album_position ON album_images(album_id, position);
+CREATE INDEX IF NOT EXISTS idx_album_images_image_id ON album_images(image_id);
+`
+		if err := tx.Exec(createAlbumsTable).Error; err != nil {
+			return fmt.Errorf("create albums table failed: %w", err)
+		}
+
+		createShareLinksTable := `
+CREATE TABLE IF NOT EXISTS share_links (
+    id            BIGSERIAL PRIMARY KEY,
+    token         VARCHAR(64) NOT NULL UNIQUE,
+    image_id      BIGINT REFERENCES images(id) ON DELETE CASCADE,
+    album_id      BIGINT REFERENCES albums(id) ON DELETE CASCADE,
+    note          VARCHAR(255),
+    password_hash TEXT,
+    expires_at    TIMESTAMPTZ,
+    max_views     BIGINT NOT NULL DEFAULT 0,
+    view_count    BIGINT NOT NULL DEFAULT 0,
+    revoked_at    TIMESTAMPTZ,
+    created_at    TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at    TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    CHECK ((image_id IS NULL) <> (album_id IS NULL))
+);
+CREATE INDEX IF NOT EXISTS idx_share_links_created_at_id ON share_links(created_at, id);
+CREATE INDEX IF NOT EXISTS idx_share_links_image_id ON share_links(image_id);
+CREATE INDEX IF NOT EXISTS idx_share_links_album_id ON share_links(album_id);
+CREATE TABLE IF NOT EXISTS share_link_accesses (
+    id            BIGSERIAL PRIMARY KEY,
+    share_link_id BIGINT NOT NULL REFERENCES share_links(id) ON DELETE CASCADE,
+    path          VARCHAR(512),
+    ip_address    VARCHAR(45),
+    user_agent    VARCHAR(512),
+    result        VARCHAR(32),
+    created_at    TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS idx_share_link_accesses_link_created_at_id ON share_link_accesses(share_link_id, created_at, id);
+`
+		if err := tx.Exec(createShareLinksTable).Error; err != nil {
+			return fmt.Errorf("create share_links table failed: %w", err)
+		}
+
+		createMaintenanceJobsTable := `
+CREATE TABLE IF NOT EXISTS maintenance_jobs (
+    id           VARCHAR(36) PRIMARY KEY,
+    kind         VARCHAR(32) NOT NULL,
+    status       VARCHAR(32) NOT NULL,
+    params       JSONB,
+    last_id      BIGINT NOT NULL DEFAULT 0,
+    total        BIGINT NOT NULL DEFAULT 0,
+    processed    BIGINT NOT NULL DEFAULT 0,
+    failed       BIGINT NOT NULL DEFAULT 0,
+    last_error   TEXT,
+    created_at   TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at   TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    started_at   TIMESTAMPTZ,
+    completed_at TIMESTAMPTZ
+);
+CREATE INDEX IF NOT EXISTS idx_maintenance_jobs_kind ON maintenance_jobs(kind);
+CREATE INDEX IF NOT EXISTS idx_maintenance_jobs_status ON maintenance_jobs(status);
+ALTER TABLE maintenance_jobs ADD COLUMN IF NOT EXISTS stage VARCHAR(32) NOT NULL DEFAULT '';
+ALTER TABLE maintenance_jobs ADD COLUMN IF NOT EXISTS last_key TEXT NOT NULL DEFAULT '';
+`
+		if err := tx.Exec(createMaintenanceJobsTable).Error; err != nil {
+			return fmt.Errorf("create maintenance_jobs table failed: %w", err)
+		}
+
+		createScrubFindingsTable := `
+CREATE TABLE IF NOT EXISTS scrub_findings (
+    id         BIGSERIAL PRIMARY KEY,
+    job_id     VARCHAR(36)  NOT NULL REFERENCES maintenance_jobs(id) ON DELETE CASCADE,
+    kind       VARCHAR(16)  NOT NULL,
+    backend    VARCHAR(32)  NOT NULL,
+    path       VARCHAR(512) NOT NULL,
+    image_id   BIGINT,
+    size       BIGINT       NOT NULL DEFAULT 0,
+    detail     TEXT,
+    action     VARCHAR(16),
+    created_at TIMESTAMPTZ  NOT NULL DEFAULT NOW(),
+    UNIQUE(job_id, path)
+);
+CREATE INDEX IF NOT EXISTS idx_scrub_findings_job_kind ON scrub_findings(job_id, kind);
+`
+		if err := tx.Exec(createScrubFindingsTable).Error; err != nil {
+			return fmt.Errorf("create scrub_findings table failed: %w", err)
+		}
+
 		createUsersTable := `
 CREATE TABLE IF NOT EXISTS users (
     id            BIGSERIAL PRIMARY KEY,
@@ -212,6 +431,7 @@ CREATE TABLE IF NOT EXISTS security_event_logs (
 	created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
 );
 CREATE INDEX IF NOT EXISTS idx_security_event_logs_created_at ON security_event_logs(created_at);
+CREATE INDEX IF NOT EXISTS idx_security_event_logs_created_at_id ON security_event_logs(created_at, id);
 CREATE INDEX IF NOT EXISTS idx_security_event_logs_action ON security_event_logs(action);
 CREATE INDEX IF NOT EXISTS idx_security_event_logs_ip_created ON security_event_logs(ip_address, created_at);
 CREATE INDEX IF NOT EXISTS idx_security_event_logs_user_created ON security_event_logs(username, created_at);
@@ -283,6 +503,7 @@ CREATE TABLE IF NOT EXISTS api_token_logs (
 );
 CREATE INDEX IF NOT EXISTS idx_api_token_logs_token_id ON api_token_logs(token_id);
 CREATE INDEX IF NOT EXISTS idx_api_token_logs_created_at ON api_token_logs(created_at);
+CREATE INDEX IF NOT EXISTS idx_api_token_logs_created_at_id ON api_token_logs(created_at, id);
 `
 		if err := tx.Exec(createAPITokenLogsTable).Error; err != nil {
 			return fmt.Errorf("create api_token_logs table failed: %w", err)
@@ -299,6 +520,7 @@ CREATE TABLE IF NOT EXISTS app_logs (
 	ip_address VARCHAR(45)
 );
 CREATE INDEX IF NOT EXISTS idx_app_logs_created_at ON app_logs(created_at);
+CREATE INDEX IF NOT EXISTS idx_app_logs_created_at_id ON app_logs(created_at, id);
 CREATE INDEX IF NOT EXISTS idx_app_logs_level_created ON app_logs(level, created_at);
 CREATE INDEX IF NOT EXISTS idx_app_logs_module_created ON app_logs(module, created_at);
 `
@@ -317,6 +539,10 @@ func main() {
 	cfg := config.Load()
 	log := logger.Register("main")
 
+	if _, err := config.ParseThumbnailPresets(os.Getenv("ANZUIMG_THUMBNAIL_SIZES")); err != nil {
+		log.Fatalf("invalid ANZUIMG_THUMBNAIL_SIZES: %v", err)
+	}
+
 	if err := ensureDatabase(cfg, log); err != nil {
 		log.Fatalf("ensure database failed: %v", err)
 	}
@@ -334,6 +560,14 @@ func main() {
 		log.Fatalf("ensure tables failed: %v", err)
 	}
 
+	maint := service.NewMaintenanceService(cfg, db)
+	if err := maint.BackfillImageStorageBackend(); err != nil {
+		log.Fatalf("backfill image storage backend failed: %v", err)
+	}
+	if len(os.Args) > 1 {
+		os.Exit(runCommand(maint, os.Args[1:]))
+	}
+
 	settings := service.NewSettingsService(cfg, db)
 	hub := service.NewLogStreamHub()
 	applyAppLogSinks(cfg, db, hub, log)
@@ -372,6 +606,15 @@ func main() {
 					log.Errorf("clean token logs failed: %v", err)
 				}
 			}
+			if d := cfg.UploadTaskRetentionDays; d > 0 {
+				cutoff := time.Now().AddDate(0, 0, -d)
+				if _, err := service.CleanupUploadTasksBefore(cfg, db, cutoff); err != nil {
+					log.Errorf("clean upload tasks failed: %v", err)
+				}
+			}
+			if _, err := service.NewResumableUploadService(cfg, db).CleanupExpired(); err != nil {
+				log.Errorf("clean expired resumable uploads failed: %v", err)
+			}
 		}
 		runCleanup()
 		for {
@@ -386,7 +629,7 @@ func main() {
 	}(cleanupCtx)
 
 	gin.SetMode(gin.ReleaseMode)
-	r, err := httpserver.NewRouter(cfg, db, settings, hub)
+	r, err := httpserver.NewRouter(cfg, db, settings, hub, maint)
 	if err != nil {
 		log.Fatalf("init router failed: %v", err)
 	}
@@ -22,6 +22,30 @@ type Config struct {
 
 	StorageBase string
 	StorageType string
+	// 副本存储类型列表,主存储写入成功后同步写入各副本;读取主存储失败时回退到副本
+	StorageReplicas []string
+	// 副本修复间隔(分钟),0 表示不自动修复
+	StorageRepairIntervalMin int
+	// 完整性巡检隔离孤立对象的本地目录
+	ScrubQuarantineDir string
+	// 断点续传暂存分片的本地目录与未完成上传的保留时长(小时)
+	ResumableUploadDir      string
+	ResumableUploadTTLHours int
+	// 上传任务暂存文件的本地目录、单个任务的最大执行次数与已结束任务的保留天数
+	UploadTaskDir           string
+	UploadTaskMaxAttempts   int
+	UploadTaskRetentionDays int
+
+	// 上传任务结束时推送的全局 Webhook 地址、HMAC 签名密钥、最大投递次数,
+	// 以及是否允许投递到私网地址
+	WebhookURLs         []string
+	WebhookSecret       string
+	WebhookMaxAttempts  int
+	WebhookAllowPrivate bool
+
+	// 私有媒体签名链接的 HMAC 密钥与最长有效期(秒),密钥为空时无法生成签名链接,私有媒体也无法访问
+	SignedURLSecret    string
+	SignedURLMaxTTLSec int
 
 	APIPrefix string
 
@@ -44,6 +68,32 @@ type Config struct {
 	CloudAccessKey string
 	CloudSecretKey string
 	CloudUseSSL    bool
+	// 云存储分发方式:redirect 重定向到公开地址,presign 重定向到预签名地址,proxy 由服务端代理
+	CloudDeliveryMode  string
+	CloudPresignTTLSec int
+
+	// WebDAV 存储,PublicURL 非空时 /i 请求重定向到公开地址,否则由服务端代理
+	WebDAVURL       string
+	WebDAVUsername  string
+	WebDAVPassword  string
+	WebDAVPublicURL string
+
+	// SFTP 存储
+	SFTPAddr           string
+	SFTPUsername       string
+	SFTPPassword       string
+	SFTPPrivateKeyFile string
+	SFTPKnownHostsFile string
+	// 未配置 KnownHostsFile 时必须显式开启才会跳过主机密钥校验
+	SFTPInsecureIgnoreHostKey bool
+	SFTPBasePath              string
+
+	// 通用 HTTP PUT/GET 存储,URL 可携带查询参数(如 Azure Blob 的 SAS 令牌),
+	// PutHeaders 为上传时附加的 "Key: Value" 请求头
+	HTTPStorageURL        string
+	HTTPStorageToken      string
+	HTTPStoragePutHeaders []string
+	HTTPStoragePublicURL  string
 
 	// 是否允许 Web 端修改运行时配置；为 false 时 Settings 写接口拒绝
 	AllowWebConfig bool
@@ -51,6 +101,9 @@ type Config struct {
 	// 应用日志文件输出目录,路径本身不允许 Web 改
 	LogFileDir string
 
+	// 命名缩略图规格，来自 ANZUIMG_THUMBNAIL_SIZES
+	thumbnailPresets []ThumbnailPreset
+
 	// 运行期可热改的快照
 	effective atomic.Pointer[Effective]
 }
@@ -68,6 +121,11 @@ type Effective struct {
 	MaxUploadFileBytes int64
 	MaxUploadFiles     int
 
+	// 后台处理并发与队列
+	UploadWorkers      int // 异步上传任务 worker 数
+	ThumbnailWorkers   int // 缩略图生成 worker 数
+	ThumbnailQueueSize int // 等待生成的缩略图上限，超出时标记为 skipped 由补齐任务处理
+
 	// 会话与令牌生存期
 	SessionExpirationHours int
 	APITokenTTLHours       int // 0 = 永不过期
@@ -109,6 +167,19 @@ type Effective struct {
 	URLFetchTimeoutSeconds int
 	URLFetchMaxBytes       int64
 	URLFetchAllowPrivate   bool
+
+	// 媒体处理
+	VariantCacheMaxBytes  int64 // 派生文件缓存上限,0 表示不缓存
+	AutoFormatEnabled     bool  // 按 Accept 头自动输出 AVIF/WebP
+	AutoFormatAVIFQuality int
+	AutoFormatAVIFEffort  int
+	AutoFormatWebPQuality int
+	AutoFormatWebPEffort  int
+
+	// 媒体分发
+	RouteCacheMaxAgeSeconds int    // 路由地址的 Cache-Control max-age,0 表示 no-cache
+	RouteAllowedChars       string // 路由每段允许的字符,正则字符类内容
+	RouteMaxDepth           int    // 路由按 / 分隔的最大段数
 }
 
 type PasswordPolicy struct {
@@ -243,6 +314,10 @@ func DefaultEffective() *Effective {
 		MaxUploadFileBytes: getEnvInt64MB("ANZUIMG_MAX_UPLOAD_FILE_MB", 60),
 		MaxUploadFiles:     getEnvInt("ANZUIMG_MAX_UPLOAD_FILES", 20),
 
+		UploadWorkers:      getEnvInt("ANZUIMG_UPLOAD_WORKERS", 2),
+		ThumbnailWorkers:   getEnvInt("ANZUIMG_THUMBNAIL_WORKERS", 2),
+		ThumbnailQueueSize: getEnvInt("ANZUIMG_THUMBNAIL_QUEUE_SIZE", 64),
+
 		SessionExpirationHours: getEnvInt("ANZUIMG_SESSION_EXPIRATION_HOURS", 8),
 		APITokenTTLHours:       getEnvInt("ANZUIMG_API_TOKEN_TTL_HOURS", 0),
 
@@ -280,6 +355,17 @@ func DefaultEffective() *Effective {
 		URLFetchTimeoutSeconds: getEnvInt("ANZUIMG_URL_FETCH_TIMEOUT_SEC", 15),
 		URLFetchMaxBytes:       getEnvInt64MB("ANZUIMG_URL_FETCH_MAX_MB", 60),
 		URLFetchAllowPrivate:   getEnvBool("ANZUIMG_URL_FETCH_ALLOW_PRIVATE", false),
+
+		VariantCacheMaxBytes:  getEnvInt64MB("ANZUIMG_VARIANT_CACHE_MAX_MB", 2048),
+		AutoFormatEnabled:     getEnvBool("ANZUIMG_AUTO_FORMAT_ENABLED", false),
+		AutoFormatAVIFQuality: getEnvInt("ANZUIMG_AUTO_FORMAT_AVIF_QUALITY", 50),
+		AutoFormatAVIFEffort:  getEnvInt("ANZUIMG_AUTO_FORMAT_AVIF_EFFORT", 4),
+		AutoFormatWebPQuality: getEnvInt("ANZUIMG_AUTO_FORMAT_WEBP_QUALITY", 80),
+		AutoFormatWebPEffort:  getEnvInt("ANZUIMG_AUTO_FORMAT_WEBP_EFFORT", 4),
+
+		RouteCacheMaxAgeSeconds: getEnvInt("ANZUIMG_ROUTE_CACHE_MAX_AGE_SEC", 300),
+		RouteAllowedChars:       getEnv("ANZUIMG_ROUTE_ALLOWED_CHARS", `^/\p{C}`),
+		RouteMaxDepth:           getEnvInt("ANZUIMG_ROUTE_MAX_DEPTH", 8),
 	}
 }
 
@@ -314,6 +400,23 @@ func Load() *Config {
 		StorageBase: getEnv("ANZUIMG_STORAGE_BASE", "./data/images"),
 		StorageType: getEnv("ANZUIMG_STORAGE_TYPE", "local"),
 
+		StorageReplicas:          getEnvList(nil, "ANZUIMG_STORAGE_REPLICAS"),
+		StorageRepairIntervalMin: getEnvInt("ANZUIMG_STORAGE_REPAIR_INTERVAL_MIN", 60),
+		ScrubQuarantineDir:       getEnv("ANZUIMG_SCRUB_QUARANTINE_DIR", "./data/quarantine"),
+		ResumableUploadDir:       getEnv("ANZUIMG_RESUMABLE_UPLOAD_DIR", "./data/uploads"),
+		ResumableUploadTTLHours:  getEnvInt("ANZUIMG_RESUMABLE_UPLOAD_TTL_HOURS", 24),
+		UploadTaskDir:            getEnv("ANZUIMG_UPLOAD_TASK_DIR", "./data/tasks"),
+		UploadTaskMaxAttempts:    getEnvInt("ANZUIMG_UPLOAD_TASK_MAX_ATTEMPTS", 3),
+		UploadTaskRetentionDays:  getEnvInt("ANZUIMG_UPLOAD_TASK_RETENTION_DAYS", 7),
+
+		WebhookURLs:         getEnvList(nil, "ANZUIMG_WEBHOOK_URLS"),
+		WebhookSecret:       getEnv("ANZUIMG_WEBHOOK_SECRET", ""),
+		WebhookMaxAttempts:  getEnvInt("ANZUIMG_WEBHOOK_MAX_ATTEMPTS", 6),
+		WebhookAllowPrivate: getEnvBool("ANZUIMG_WEBHOOK_ALLOW_PRIVATE", false),
+
+		SignedURLSecret:    getEnv("ANZUIMG_SIGNED_URL_SECRET", ""),
+		SignedURLMaxTTLSec: getEnvInt("ANZUIMG_SIGNED_URL_MAX_TTL_SEC", 604800),
+
 		APIPrefix: normalizeAPIPrefix(getEnv("ANZUIMG_API_PREFIX", "")),
 
 		TrustedProxies:      trustedProxies,
@@ -333,9 +436,34 @@ func Load() *Config {
 		CloudSecretKey: getEnv("ANZUIMG_CLOUD_SECRET_KEY", ""),
 		CloudUseSSL:    getEnvBool("ANZUIMG_CLOUD_USE_SSL", true),
 
+		CloudDeliveryMode:  strings.ToLower(getEnv("ANZUIMG_CLOUD_DELIVERY_MODE", "redirect")),
+		CloudPresignTTLSec: getEnvInt("ANZUIMG_CLOUD_PRESIGN_TTL_SEC", 3600),
+
+		WebDAVURL:       getEnv("ANZUIMG_WEBDAV_URL", ""),
+		WebDAVUsername:  getEnv("ANZUIMG_WEBDAV_USERNAME", ""),
+		WebDAVPassword:  getEnv("ANZUIMG_WEBDAV_PASSWORD", ""),
+		WebDAVPublicURL: getEnv("ANZUIMG_WEBDAV_PUBLIC_URL", ""),
+
+		SFTPAddr:                  getEnv("ANZUIMG_SFTP_ADDR", ""),
+		SFTPUsername:              getEnv("ANZUIMG_SFTP_USERNAME", ""),
+		SFTPPassword:              getEnv("ANZUIMG_SFTP_PASSWORD", ""),
+		SFTPPrivateKeyFile:        getEnv("ANZUIMG_SFTP_PRIVATE_KEY_FILE", ""),
+		SFTPKnownHostsFile:        getEnv("ANZUIMG_SFTP_KNOWN_HOSTS_FILE", ""),
+		SFTPInsecureIgnoreHostKey: getEnvBool("ANZUIMG_SFTP_INSECURE_IGNORE_HOST_KEY", false),
+		SFTPBasePath:              getEnv("ANZUIMG_SFTP_BASE_PATH", "anzuimg"),
+
+		HTTPStorageURL:        getEnv("ANZUIMG_HTTP_STORAGE_URL", ""),
+		HTTPStorageToken:      getEnv("ANZUIMG_HTTP_STORAGE_TOKEN", ""),
+		HTTPStoragePutHeaders: getEnvList(nil, "ANZUIMG_HTTP_STORAGE_PUT_HEADERS"),
+		HTTPStoragePublicURL:  getEnv("ANZUIMG_HTTP_STORAGE_PUBLIC_URL", ""),
+
 		AllowWebConfig: getEnvBool("ANZUIMG_ALLOW_WEB_CONFIG", true),
 		LogFileDir:     getEnv("ANZUIMG_LOG_FILE_DIR", "./data/logs"),
 	}
+	// 格式错误时使用默认规格，启动时由 main 校验并报错
+	if presets, err := ParseThumbnailPresets(getEnv("ANZUIMG_THUMBNAIL_SIZES", "")); err == nil {
+		c.thumbnailPresets = presets
+	}
 	c.ReplaceEffective(DefaultEffective())
 	return c
 }
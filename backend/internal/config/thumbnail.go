@@ -0,0 +1,94 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// DefaultThumbnailPreset 是 /i/:hash/thumbnail 不带 size 参数时使用的规格，总会存在
+const DefaultThumbnailPreset = "default"
+
+const maxThumbnailDimension = 4096
+
+var thumbnailPresetNamePattern = regexp.MustCompile(`^[a-z0-9_-]{1,32}$`)
+
+// ThumbnailPreset 是一个命名的缩略图规格，图片按 Format 编码，视频封面固定为 JPEG
+type ThumbnailPreset struct {
+	Name   string `json:"name"`
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+	Format string `json:"format"` // webp、avif 或 jpeg
+}
+
+func defaultThumbnailPresets() []ThumbnailPreset {
+	return []ThumbnailPreset{{Name: DefaultThumbnailPreset, Width: 800, Height: 800, Format: "webp"}}
+}
+
+// ParseThumbnailPresets 解析 ANZUIMG_THUMBNAIL_SIZES，格式为逗号分隔的 name:WIDTHxHEIGHT[:format]，
+// 例如 default:800x800:webp,small:320x320,large:1600x1600:avif。未配置 default 时补上 800x800 WebP。
+func ParseThumbnailPresets(raw string) ([]ThumbnailPreset, error) {
+	var presets []ThumbnailPreset
+	seen := map[string]bool{}
+	for _, item := range splitCSV(raw) {
+		parts := strings.Split(item, ":")
+		if len(parts) < 2 || len(parts) > 3 {
+			return nil, fmt.Errorf("invalid thumbnail size %q, want name:WIDTHxHEIGHT[:format]", item)
+		}
+		name := strings.ToLower(strings.TrimSpace(parts[0]))
+		if !thumbnailPresetNamePattern.MatchString(name) {
+			return nil, fmt.Errorf("invalid thumbnail size name %q", parts[0])
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("duplicate thumbnail size %q", name)
+		}
+		w, h, ok := strings.Cut(strings.ToLower(strings.TrimSpace(parts[1])), "x")
+		if !ok {
+			return nil, fmt.Errorf("invalid thumbnail dimensions %q", parts[1])
+		}
+		width, errW := strconv.Atoi(w)
+		height, errH := strconv.Atoi(h)
+		if errW != nil || errH != nil || width <= 0 || height <= 0 || width > maxThumbnailDimension || height > maxThumbnailDimension {
+			return nil, fmt.Errorf("invalid thumbnail dimensions %q", parts[1])
+		}
+		format := "webp"
+		if len(parts) == 3 {
+			format = strings.ToLower(strings.TrimSpace(parts[2]))
+		}
+		switch format {
+		case "webp", "avif":
+		case "jpeg", "jpg":
+			format = "jpeg"
+		default:
+			return nil, fmt.Errorf("unsupported thumbnail format %q", parts[2])
+		}
+		seen[name] = true
+		presets = append(presets, ThumbnailPreset{Name: name, Width: width, Height: height, Format: format})
+	}
+	if !seen[DefaultThumbnailPreset] {
+		presets = append(defaultThumbnailPresets(), presets...)
+	}
+	return presets, nil
+}
+
+// ThumbnailPreset 按名称查找缩略图规格，名称为空时返回 default
+func (c *Config) ThumbnailPreset(name string) (ThumbnailPreset, bool) {
+	if name == "" {
+		name = DefaultThumbnailPreset
+	}
+	for _, p := range c.ThumbnailPresets() {
+		if p.Name == name {
+			return p, true
+		}
+	}
+	return ThumbnailPreset{}, false
+}
+
+// ThumbnailPresets 返回配置的全部缩略图规格，default 总在其中
+func (c *Config) ThumbnailPresets() []ThumbnailPreset {
+	if c == nil || len(c.thumbnailPresets) == 0 {
+		return defaultThumbnailPresets()
+	}
+	return c.thumbnailPresets
+}
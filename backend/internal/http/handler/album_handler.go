@@ -0,0 +1,256 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/TangTangChu/AnzuImg/backend/internal/http/response"
+	"github.com/TangTangChu/AnzuImg/backend/internal/service"
+)
+
+const maxAlbumBatchSize = 500
+
+type albumRequest struct {
+	Title       *string `json:"title"`
+	Description *string `json:"description"`
+	CoverHash   *string `json:"cover_hash"`
+}
+
+func (r albumRequest) input() service.AlbumInput {
+	return service.AlbumInput{Title: r.Title, Description: r.Description, CoverHash: r.CoverHash}
+}
+
+type albumImagesRequest struct {
+	Hashes   []string `json:"hashes"`
+	Position *int     `json:"position"`
+}
+
+func (h *ImageHandler) writeAlbumError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, service.ErrAlbumNotFound):
+		response.WriteErrorCode(c, http.StatusNotFound, "album_not_found", "album not found")
+	case errors.Is(err, service.ErrAlbumImageNotFound):
+		response.WriteErrorCode(c, http.StatusBadRequest, "image_not_found", err.Error())
+	case errors.Is(err, service.ErrInvalidAlbum):
+		response.WriteErrorCode(c, http.StatusBadRequest, "invalid_album", err.Error())
+	default:
+		response.WriteErrorCode(c, http.StatusInternalServerError, "album_request_failed", "album request failed")
+	}
+}
+
+func albumIDParam(c *gin.Context) (uint64, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil || id == 0 {
+		response.WriteErrorCode(c, http.StatusNotFound, "album_not_found", "album not found")
+		return 0, false
+	}
+	return id, true
+}
+
+// bindAlbumHashes 读取请求体中的图片哈希，为空或超过上限时已写入 400 响应
+func bindAlbumHashes(c *gin.Context) (albumImagesRequest, bool) {
+	var req albumImagesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.WriteErrorCode(c, http.StatusBadRequest, "invalid_request", "invalid request body")
+		return req, false
+	}
+	req.Hashes = trimNonEmpty(req.Hashes)
+	if len(req.Hashes) == 0 {
+		response.WriteErrorCode(c, http.StatusBadRequest, "hashes_required", "hashes is required")
+		return req, false
+	}
+	if len(req.Hashes) > maxAlbumBatchSize {
+		response.WriteErrorCode(c, http.StatusBadRequest, "too_many_images", "at most 500 hashes per request")
+		return req, false
+	}
+	return req, true
+}
+
+// GET /api/v1/albums?page=&page_size=，带 cursor 时使用游标分页
+func (h *ImageHandler) ListAlbums(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 || pageSize > 100 {
+		pageSize = 20
+	}
+
+	cursor, useCursor, ok := cursorParam(c)
+	if !ok {
+		return
+	}
+	if useCursor {
+		result, err := h.svc.ListAlbumsByCursor(cursor, pageSize)
+		if err != nil {
+			h.writeAlbumError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, result)
+		return
+	}
+
+	albums, total, err := h.svc.ListAlbums(page, pageSize)
+	if err != nil {
+		h.writeAlbumError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"data":  albums,
+		"total": total,
+		"page":  page,
+		"size":  pageSize,
+	})
+}
+
+// POST /api/v1/albums
+// json: title 必填，description、cover_hash 可选
+func (h *ImageHandler) CreateAlbum(c *gin.Context) {
+	var req albumRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.WriteErrorCode(c, http.StatusBadRequest, "invalid_request", "invalid request body")
+		return
+	}
+	album, err := h.svc.CreateAlbum(req.input())
+	if err != nil {
+		h.writeAlbumError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, album)
+}
+
+// GET /api/v1/albums/:id
+func (h *ImageHandler) GetAlbum(c *gin.Context) {
+	id, ok := albumIDParam(c)
+	if !ok {
+		return
+	}
+	album, err := h.svc.GetAlbum(id)
+	if err != nil {
+		h.writeAlbumError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, album)
+}
+
+// PATCH /api/v1/albums/:id
+// json: 只修改出现的字段，cover_hash 传空字符串恢复默认封面
+func (h *ImageHandler) UpdateAlbum(c *gin.Context) {
+	id, ok := albumIDParam(c)
+	if !ok {
+		return
+	}
+	var req albumRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.WriteErrorCode(c, http.StatusBadRequest, "invalid_request", "invalid request body")
+		return
+	}
+	album, err := h.svc.UpdateAlbum(id, req.input())
+	if err != nil {
+		h.writeAlbumError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, album)
+}
+
+// DELETE /api/v1/albums/:id
+func (h *ImageHandler) DeleteAlbum(c *gin.Context) {
+	id, ok := albumIDParam(c)
+	if !ok {
+		return
+	}
+	if err := h.svc.DeleteAlbum(id); err != nil {
+		h.writeAlbumError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// GET /api/v1/albums/:id/images?tag=&file_name=&page=&page_size=
+func (h *ImageHandler) ListAlbumImages(c *gin.Context) {
+	id, ok := albumIDParam(c)
+	if !ok {
+		return
+	}
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 || pageSize > 100 {
+		pageSize = 20
+	}
+
+	images, total, err := h.svc.ListAlbumImages(id, page, pageSize, c.Query("tag"), c.Query("file_name"))
+	if err != nil {
+		h.writeAlbumError(c, err)
+		return
+	}
+	h.recordListLog(c, "album_image_list")
+	c.JSON(http.StatusOK, gin.H{
+		"data":  images,
+		"total": total,
+		"page":  page,
+		"size":  pageSize,
+	})
+}
+
+// POST /api/v1/albums/:id/images
+// json: hashes 最多 500 个，position 可选，省略时追加到末尾
+func (h *ImageHandler) AddAlbumImages(c *gin.Context) {
+	id, ok := albumIDParam(c)
+	if !ok {
+		return
+	}
+	req, ok := bindAlbumHashes(c)
+	if !ok {
+		return
+	}
+	added, err := h.svc.AddAlbumImages(id, req.Hashes, req.Position)
+	if err != nil {
+		h.writeAlbumError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"added": added})
+}
+
+// POST /api/v1/albums/:id/images/remove
+// json: hashes 最多 500 个
+func (h *ImageHandler) RemoveAlbumImages(c *gin.Context) {
+	id, ok := albumIDParam(c)
+	if !ok {
+		return
+	}
+	req, ok := bindAlbumHashes(c)
+	if !ok {
+		return
+	}
+	removed, err := h.svc.RemoveAlbumImages(id, req.Hashes)
+	if err != nil {
+		h.writeAlbumError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"removed": removed})
+}
+
+// PUT /api/v1/albums/:id/images/order
+// json: hashes 按新顺序排列，未列出的图片保持相对顺序排在其后
+func (h *ImageHandler) ReorderAlbumImages(c *gin.Context) {
+	id, ok := albumIDParam(c)
+	if !ok {
+		return
+	}
+	req, ok := bindAlbumHashes(c)
+	if !ok {
+		return
+	}
+	if err := h.svc.ReorderAlbumImages(id, req.Hashes); err != nil {
+		h.writeAlbumError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,291 @@
+package handler
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/TangTangChu/AnzuImg/backend/internal/http/response"
+	"github.com/TangTangChu/AnzuImg/backend/internal/model"
+	"github.com/TangTangChu/AnzuImg/backend/internal/service"
+)
+
+const (
+	// 哈希地址的内容永远不变
+	immutableCacheControl = "public, max-age=31536000, immutable"
+	thumbnailCacheControl = "public, max-age=86400"
+	// 协商格式尚未生成时先返回原图，只短暂缓存以便稍后拿到更优格式
+	pendingVariantCacheControl = "public, max-age=60"
+	// 分享链接随时可能撤销或用尽次数，不允许缓存
+	shareCacheControl = "private, no-store"
+	// 私有媒体只允许浏览器缓存，每次使用前都要重新校验签名
+	privateCacheControl = "private, no-cache"
+)
+
+// serveImage 输出原图或其派生结果，统一处理缓存头、条件请求与 Range。
+// cacheControl 为空表示按哈希访问，内容不变，使用 immutable 与 Last-Modified；
+// 路由或分享链接可能改指或失效，由调用方给出缓存策略，且不使用 Last-Modified。
+func (h *ImageHandler) serveImage(c *gin.Context, img *model.Image, loc *service.MediaLocation, transform *service.TransformOptions, cacheControl string) {
+	lastModified := time.Time{}
+	if cacheControl == "" {
+		cacheControl = immutableCacheControl
+		lastModified = img.CreatedAt
+	}
+
+	format := h.negotiateFormat(c, img)
+	if transform != nil {
+		if transform.Format == "" {
+			transform.Format = format
+		}
+		setCacheHeaders(c, h.svc.TransformVariantKey(img, *transform), lastModified, cacheControl)
+		if checkNotModified(c, lastModified) {
+			return
+		}
+		h.serveTransformed(c, img, *transform, lastModified)
+		return
+	}
+
+	if variant := h.svc.AutoFormatVariant(c.Request.Context(), img, format); variant != nil {
+		setCacheHeaders(c, variant.Key, lastModified, cacheControl)
+		if checkNotModified(c, lastModified) {
+			return
+		}
+		serveMediaBytes(c, variant.Data, variant.MimeType, lastModified)
+		return
+	}
+	if format != "" && cacheControl == immutableCacheControl {
+		cacheControl = pendingVariantCacheControl
+	}
+
+	setCacheHeaders(c, img.Hash, lastModified, cacheControl)
+	if checkNotModified(c, lastModified) {
+		return
+	}
+	if img.MimeType == "image/svg+xml" && c.Writer.Header().Get("Content-Disposition") == "" {
+		c.Header("Content-Disposition", "attachment")
+	}
+	h.serveLocation(c, loc, img.MimeType)
+}
+
+// serveLocation 按存储的分发方式输出文件：本地直出、重定向或代理
+func (h *ImageHandler) serveLocation(c *gin.Context, loc *service.MediaLocation, mimeType string) {
+	switch {
+	case loc.Proxy:
+		h.proxyRemote(c, loc, mimeType)
+	case loc.RedirectURL != "":
+		if loc.RedirectTTL > 0 {
+			// 预签名地址会过期，重定向只在有效期的一半内可被缓存
+			c.Header("Cache-Control", fmt.Sprintf("private, max-age=%d", int(loc.RedirectTTL.Seconds())/2))
+		}
+		c.Redirect(http.StatusFound, loc.RedirectURL)
+	default:
+		serveLocalMedia(c, loc.LocalPath, mimeType)
+	}
+}
+
+// proxyRemote 代理输出远端对象，Range 透传给存储后端
+func (h *ImageHandler) proxyRemote(c *gin.Context, loc *service.MediaLocation, mimeType string) {
+	rangeHeader := c.GetHeader("Range")
+	if rangeHeader != "" && !ifRangeMatches(c) {
+		rangeHeader = ""
+	}
+
+	stream, err := h.svc.OpenRemote(c.Request.Context(), loc, rangeHeader)
+	if err != nil {
+		clearCacheHeaders(c)
+		if errors.Is(err, service.ErrInvalidRange) {
+			response.WriteErrorCode(c, http.StatusRequestedRangeNotSatisfiable, "invalid_range", "requested range not satisfiable")
+			return
+		}
+		response.WriteErrorCode(c, http.StatusBadGateway, "storage_unavailable", "failed to read from storage")
+		return
+	}
+	if stream.LocalPath != "" {
+		serveLocalMedia(c, stream.LocalPath, mimeType)
+		return
+	}
+	defer stream.Body.Close()
+
+	header := c.Writer.Header()
+	if mimeType != "" {
+		header.Set("Content-Type", mimeType)
+	}
+	header.Set("Accept-Ranges", "bytes")
+	if stream.ContentLength >= 0 {
+		header.Set("Content-Length", strconv.FormatInt(stream.ContentLength, 10))
+	}
+	status := http.StatusOK
+	if stream.ContentRange != "" {
+		header.Set("Content-Range", stream.ContentRange)
+		status = http.StatusPartialContent
+	}
+	c.Status(status)
+	if c.Request.Method == http.MethodHead {
+		return
+	}
+	_, _ = io.Copy(c.Writer, stream.Body)
+}
+
+// ifRangeMatches 判断 If-Range 是否仍指向当前内容，不匹配时应返回完整内容
+func ifRangeMatches(c *gin.Context) bool {
+	ifRange := c.GetHeader("If-Range")
+	if ifRange == "" {
+		return true
+	}
+	if strings.HasPrefix(ifRange, `"`) {
+		return ifRange == c.Writer.Header().Get("ETag")
+	}
+	lastModified := c.Writer.Header().Get("Last-Modified")
+	return lastModified != "" && ifRange == lastModified
+}
+
+func (h *ImageHandler) routeCacheControl() string {
+	maxAge := h.svc.Config().Effective().RouteCacheMaxAgeSeconds
+	if maxAge <= 0 {
+		return "no-cache"
+	}
+	return fmt.Sprintf("public, max-age=%d", maxAge)
+}
+
+// negotiateFormat 在开启自动格式时根据 Accept 选择输出格式，并标记响应随 Accept 变化
+func (h *ImageHandler) negotiateFormat(c *gin.Context, img *model.Image) string {
+	if !h.svc.AutoFormatActive() || !service.IsImageFile(img.MimeType) || img.MimeType == "image/svg+xml" {
+		return ""
+	}
+	c.Writer.Header().Add("Vary", "Accept")
+	return service.NegotiateFormat(c.GetHeader("Accept"), img.MimeType)
+}
+
+// serveTransformed 输出按需变换后的图片
+func (h *ImageHandler) serveTransformed(c *gin.Context, img *model.Image, opts service.TransformOptions, lastModified time.Time) {
+	variant, err := h.svc.TransformImage(c.Request.Context(), img, opts)
+	if err != nil {
+		clearCacheHeaders(c)
+		switch {
+		case errors.Is(err, service.ErrTransformUnsupported):
+			response.WriteErrorCode(c, http.StatusUnprocessableEntity, "transform_unsupported", "transform not supported for this media")
+		case errors.Is(err, service.ErrTransformBusy):
+			c.Header("Retry-After", "5")
+			response.WriteErrorCode(c, http.StatusServiceUnavailable, "transform_busy", "too many concurrent transforms")
+		default:
+			response.WriteErrorCode(c, http.StatusInternalServerError, "transform_failed", "failed to transform image")
+		}
+		return
+	}
+	serveMediaBytes(c, variant.Data, variant.MimeType, lastModified)
+}
+
+// setCacheHeaders 写入强 ETag、Last-Modified 与 Cache-Control。
+// 内容以哈希寻址，ETag 直接取原图哈希或派生文件名。
+func setCacheHeaders(c *gin.Context, etagKey string, lastModified time.Time, cacheControl string) {
+	c.Header("ETag", `"`+etagKey+`"`)
+	if !lastModified.IsZero() {
+		c.Header("Last-Modified", lastModified.UTC().Format(http.TimeFormat))
+	}
+	c.Header("Cache-Control", cacheControl)
+}
+
+// clearCacheHeaders 撤销已写入的缓存头，错误响应不应被缓存
+func clearCacheHeaders(c *gin.Context) {
+	h := c.Writer.Header()
+	h.Del("ETag")
+	h.Del("Last-Modified")
+	h.Set("Cache-Control", "no-store")
+}
+
+// checkNotModified 按 If-None-Match / If-Modified-Since 判断是否可返回 304，
+// 命中时直接写出响应。需在 setCacheHeaders 之后调用。
+func checkNotModified(c *gin.Context, lastModified time.Time) bool {
+	if c.Request.Method != http.MethodGet && c.Request.Method != http.MethodHead {
+		return false
+	}
+
+	matched := false
+	if inm := c.GetHeader("If-None-Match"); inm != "" {
+		// If-None-Match 存在时忽略 If-Modified-Since
+		matched = etagListMatches(inm, c.Writer.Header().Get("ETag"))
+	} else if ims := c.GetHeader("If-Modified-Since"); ims != "" && !lastModified.IsZero() {
+		if t, err := http.ParseTime(ims); err == nil {
+			matched = !lastModified.Truncate(time.Second).After(t)
+		}
+	}
+	if !matched {
+		return false
+	}
+
+	h := c.Writer.Header()
+	h.Del("Content-Type")
+	h.Del("Content-Length")
+	h.Del("Content-Disposition")
+	c.Status(http.StatusNotModified)
+	return true
+}
+
+// etagListMatches 使用弱比较判断 If-None-Match 是否命中
+func etagListMatches(header, etag string) bool {
+	if etag == "" {
+		return false
+	}
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" {
+			return true
+		}
+		if strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// serveLocalMedia 输出本地文件，支持 Range 与条件请求
+func serveLocalMedia(c *gin.Context, absPath, mimeType string) {
+	f, err := os.Open(absPath)
+	if err != nil {
+		clearCacheHeaders(c)
+		response.WriteErrorCode(c, http.StatusNotFound, "file_not_found", "file not found")
+		return
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil || info.IsDir() {
+		clearCacheHeaders(c)
+		response.WriteErrorCode(c, http.StatusNotFound, "file_not_found", "file not found")
+		return
+	}
+
+	if mimeType != "" {
+		c.Header("Content-Type", mimeType)
+	}
+	// 304 已由 checkNotModified 处理，这里的 modtime 仅用于 If-Range；
+	// 不使用文件 mtime，避免路由重新指向旧文件时误判未修改
+	http.ServeContent(c.Writer, c.Request, "", lastModifiedHeader(c), f)
+}
+
+// serveMediaBytes 输出内存中的内容，支持 Range
+func serveMediaBytes(c *gin.Context, data []byte, mimeType string, lastModified time.Time) {
+	if mimeType != "" {
+		c.Header("Content-Type", mimeType)
+	}
+	http.ServeContent(c.Writer, c.Request, "", lastModified, bytes.NewReader(data))
+}
+
+// lastModifiedHeader 解析已写入的 Last-Modified，未写入时返回零值
+func lastModifiedHeader(c *gin.Context) time.Time {
+	if v := c.Writer.Header().Get("Last-Modified"); v != "" {
+		if t, err := http.ParseTime(v); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
@@ -1,14 +1,15 @@
 package handler
 
 import (
-	"bytes"
 	"encoding/json"
 	"errors"
 	"io"
 	"net/http"
+	"path"
 	"path/filepath"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
@@ -23,6 +24,7 @@ import (
 type ImageHandler struct {
 	svc        *service.ImageService
 	urlFetcher *service.URLFetcher
+	resumable  *service.ResumableUploadService
 }
 
 var allowedUploadMIMETypes = map[string]struct{}{
@@ -77,33 +79,83 @@ func mediaDimensionsAllowed(width, height int) bool {
 	return int64(width)*int64(height) <= maxMediaPixels
 }
 
-func detectUploadMIMEAndDimensions(buf []byte) (mimeType string, width, height int) {
-	mimeType, width, height, err := service.InspectImage(bytes.NewReader(buf))
+func detectUploadMIMEAndDimensions(staged *service.StagedUpload) (mimeType string, width, height int) {
+	f, err := staged.Open()
+	if err != nil {
+		return "application/octet-stream", 0, 0
+	}
+	defer f.Close()
+
+	mimeType, width, height, err = service.InspectImage(f)
 	if err == nil {
 		return mimeType, width, height
 	}
 
-	detected := http.DetectContentType(buf)
+	// http.DetectContentType 最多只看前 512 字节
+	head := make([]byte, 512)
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return "application/octet-stream", 0, 0
+	}
+	n, _ := io.ReadFull(f, head)
+	detected := http.DetectContentType(head[:n])
 	if idx := strings.Index(detected, ";"); idx >= 0 {
 		detected = strings.TrimSpace(detected[:idx])
 	}
 
-	if detected == "application/octet-stream" && len(buf) > 0 {
-		return "application/octet-stream", 0, 0
-	}
-
 	return detected, 0, 0
 }
 
+// clientUploadResult 是批量上传中单个文件成功时的结果，client_index 对应请求中的位置
+type clientUploadResult struct {
+	ClientIndex int `json:"client_index"`
+	service.UploadResponse
+	SourceURL string `json:"source_url,omitempty"`
+}
+
+// recordUploadLog 为 Token 上传写入 api_token_logs，会话上传不记录
+func (h *ImageHandler) recordUploadLog(c *gin.Context, token *model.APIToken, imageHash string) {
+	if token == nil {
+		return
+	}
+	tokenSvc := service.NewAPITokenService(h.svc.Config(), h.svc.DB())
+	_ = tokenSvc.RecordLog(&model.APITokenLog{
+		TokenID:   token.ID,
+		TokenName: token.Name,
+		TokenType: token.NormalizedType(),
+		Action:    "image_upload",
+		Method:    c.Request.Method,
+		Path:      c.Request.URL.Path,
+		IPAddress: middleware.ClientIP(c),
+		UserAgent: c.Request.UserAgent(),
+		ImageHash: imageHash,
+	})
+}
+
 func NewImageHandler(cfg *config.Config, db *gorm.DB) *ImageHandler {
 	return &ImageHandler{
 		svc:        service.NewImageService(cfg, db),
 		urlFetcher: service.NewURLFetcher(cfg),
+		resumable:  service.NewResumableUploadService(cfg, db),
 	}
 }
 
+// ApplyWorkerSettings 在配置重载后调整后台上传与缩略图 worker 数
+func (h *ImageHandler) ApplyWorkerSettings(eff *config.Effective) {
+	h.svc.ApplyWorkerSettings(eff)
+}
+
+// Service 返回图片服务，供路由挂载依赖它的中间件
+func (h *ImageHandler) Service() *service.ImageService {
+	return h.svc
+}
+
+// ThumbnailPool 返回图片服务的缩略图 worker 池
+func (h *ImageHandler) ThumbnailPool() *service.ThumbnailPool {
+	return h.svc.Thumbnails()
+}
+
 // POST /api/v1/images
-// form-data: file=<file> (can be multiple), route=<optional>, description=<optional>, tags=<optional>
+// form-data: file=<file> (can be multiple), route=<optional>, description=<optional>, tags=<optional>, visibility=<optional>
 func (h *ImageHandler) Upload(c *gin.Context) {
 	var uploaderToken *model.APIToken
 	if v, ok := c.Get("api_token"); ok {
@@ -135,6 +187,12 @@ func (h *ImageHandler) Upload(c *gin.Context) {
 
 	files := form.File["file"]
 
+	visibility := strings.TrimSpace(c.PostForm("visibility"))
+	if visibility != "" && !service.ValidVisibility(visibility) {
+		response.WriteErrorCode(c, http.StatusBadRequest, "invalid_visibility", "visibility must be public, unlisted or private")
+		return
+	}
+
 	// 文件数量限制
 	maxFiles := 20
 	if h.svc != nil {
@@ -204,6 +262,10 @@ func (h *ImageHandler) Upload(c *gin.Context) {
 			}
 		}
 	}
+	if err := h.svc.ValidateRoutes(routes); err != nil {
+		response.WriteErrorCode(c, http.StatusBadRequest, "invalid_route", err.Error())
+		return
+	}
 	type FileMetadata struct {
 		Description string   `json:"description"`
 		Tags        []string `json:"tags"`
@@ -220,8 +282,15 @@ func (h *ImageHandler) Upload(c *gin.Context) {
 		}
 	}
 
-	var results []gin.H
+	var results []any
 	remainingTotal := maxTotal
+	// 暂存文件在请求结束时统一清理
+	var staged []*service.StagedUpload
+	defer func() {
+		for _, u := range staged {
+			u.Remove()
+		}
+	}()
 	appendUploadError := func(clientIndex int, fileName, code, message string) {
 		results = append(results, gin.H{
 			"client_index": clientIndex,
@@ -257,27 +326,24 @@ func (h *ImageHandler) Upload(c *gin.Context) {
 			continue
 		}
 
-		reader := io.Reader(f)
-		if maxPerFile > 0 {
-			reader = io.LimitReader(f, maxPerFile+1)
-		}
-		buf, err := io.ReadAll(reader)
+		upload, err := service.StageUpload(f, maxPerFile)
 		f.Close()
 		if err != nil {
-			appendUploadError(clientIndex, fileHeader.Filename, "file_read_failed", "read file failed")
-			continue
-		}
-		if maxPerFile > 0 && int64(len(buf)) > maxPerFile {
-			appendUploadError(clientIndex, fileHeader.Filename, "file_too_large", "file too large")
+			if errors.Is(err, service.ErrUploadTooLarge) {
+				appendUploadError(clientIndex, fileHeader.Filename, "file_too_large", "file too large")
+			} else {
+				appendUploadError(clientIndex, fileHeader.Filename, "file_read_failed", "read file failed")
+			}
 			continue
 		}
-		if remainingTotal > 0 && int64(len(buf)) > remainingTotal {
+		staged = append(staged, upload)
+		if remainingTotal > 0 && upload.Size > remainingTotal {
 			appendUploadError(clientIndex, fileHeader.Filename, "upload_total_too_large", "total upload size exceeds limit")
 			continue
 		}
-		remainingTotal -= int64(len(buf))
+		remainingTotal -= upload.Size
 
-		mimeType, width, height := detectUploadMIMEAndDimensions(buf)
+		mimeType, width, height := detectUploadMIMEAndDimensions(upload)
 
 		if _, allowed := allowedUploadMIMETypes[mimeType]; !allowed {
 			appendUploadError(clientIndex, fileHeader.Filename, "unsupported_file_type", "unsupported file type: "+mimeType)
@@ -336,7 +402,7 @@ func (h *ImageHandler) Upload(c *gin.Context) {
 		}
 
 		convertCurrent := convert && service.IsImageFile(mimeType)
-		res, err := h.svc.Upload(c.Request.Context(), buf, finalFileName, currentRoutes, currentDesc, currentTags, mimeType, width, height, convertCurrent, targetFormat, quality, effort, uploadedByTokenID, uploadedByTokenName, uploadedByTokenType)
+		res, err := h.svc.Upload(c.Request.Context(), upload, finalFileName, currentRoutes, currentDesc, currentTags, visibility, mimeType, width, height, convertCurrent, targetFormat, quality, effort, uploadedByTokenID, uploadedByTokenName, uploadedByTokenType)
 		if err != nil {
 			appendUploadError(clientIndex, fileHeader.Filename, "upload_failed", "upload failed")
 			continue
@@ -357,30 +423,7 @@ func (h *ImageHandler) Upload(c *gin.Context) {
 			})
 		}
 
-		results = append(results, gin.H{
-			"client_index":     clientIndex,
-			"hash":             res.Image.Hash,
-			"file_name":        res.Image.FileName,
-			"size":             res.Image.Size,
-			"mime":             res.Image.MimeType,
-			"path":             res.Image.Path,
-			"width":            res.Image.Width,
-			"height":           res.Image.Height,
-			"duration_seconds": res.Image.DurationSeconds,
-			"video_codec":      res.Image.VideoCodec,
-			"video_bitrate":    res.Image.VideoBitrate,
-			"audio_codec":      res.Image.AudioCodec,
-			"audio_bitrate":    res.Image.AudioBitrate,
-			"description":      res.Image.Description,
-			"tags":             res.Image.Tags,
-			"created_at":       res.Image.CreatedAt,
-			"updated_at":       res.Image.UpdatedAt,
-			"reused":           res.Reused,
-			"url":              res.HashURL,
-			"route":            res.Route,
-			"route_url":        res.RouteURL,
-			"success":          true,
-		})
+		results = append(results, clientUploadResult{ClientIndex: clientIndex, UploadResponse: res.Response()})
 	}
 
 	for i, urlSrc := range urlSources {
@@ -421,13 +464,15 @@ func (h *ImageHandler) Upload(c *gin.Context) {
 			continue
 		}
 
-		if maxPerFile > 0 && int64(len(fetchRes.Body)) > maxPerFile {
+		staged = append(staged, fetchRes.Upload)
+
+		if maxPerFile > 0 && fetchRes.Upload.Size > maxPerFile {
 			appendUploadError(clientIndex, rawURL, "file_too_large", "file too large")
 			continue
 		}
-		remainingTotal -= int64(len(fetchRes.Body))
+		remainingTotal -= fetchRes.Upload.Size
 
-		mimeType, width, height := detectUploadMIMEAndDimensions(fetchRes.Body)
+		mimeType, width, height := detectUploadMIMEAndDimensions(fetchRes.Upload)
 		if _, allowed := allowedUploadMIMETypes[mimeType]; !allowed {
 			appendUploadError(clientIndex, rawURL, "unsupported_file_type", "unsupported file type: "+mimeType)
 			continue
@@ -464,7 +509,7 @@ func (h *ImageHandler) Upload(c *gin.Context) {
 		}
 
 		convertCurrent := convert && service.IsImageFile(mimeType)
-		res, err := h.svc.Upload(c.Request.Context(), fetchRes.Body, finalFileName, urlSrc.Routes, urlSrc.Description, urlSrc.Tags, mimeType, width, height, convertCurrent, targetFormat, quality, effort, uploadedByTokenID, uploadedByTokenName, uploadedByTokenType)
+		res, err := h.svc.Upload(c.Request.Context(), fetchRes.Upload, finalFileName, urlSrc.Routes, urlSrc.Description, urlSrc.Tags, visibility, mimeType, width, height, convertCurrent, targetFormat, quality, effort, uploadedByTokenID, uploadedByTokenName, uploadedByTokenType)
 		if err != nil {
 			appendUploadError(clientIndex, rawURL, "upload_failed", "upload failed")
 			continue
@@ -485,30 +530,10 @@ func (h *ImageHandler) Upload(c *gin.Context) {
 			})
 		}
 
-		results = append(results, gin.H{
-			"client_index":     clientIndex,
-			"hash":             res.Image.Hash,
-			"file_name":        res.Image.FileName,
-			"size":             res.Image.Size,
-			"mime":             res.Image.MimeType,
-			"path":             res.Image.Path,
-			"width":            res.Image.Width,
-			"height":           res.Image.Height,
-			"duration_seconds": res.Image.DurationSeconds,
-			"video_codec":      res.Image.VideoCodec,
-			"video_bitrate":    res.Image.VideoBitrate,
-			"audio_codec":      res.Image.AudioCodec,
-			"audio_bitrate":    res.Image.AudioBitrate,
-			"description":      res.Image.Description,
-			"tags":             res.Image.Tags,
-			"created_at":       res.Image.CreatedAt,
-			"updated_at":       res.Image.UpdatedAt,
-			"reused":           res.Reused,
-			"url":              res.HashURL,
-			"route":            res.Route,
-			"route_url":        res.RouteURL,
-			"source_url":       fetchRes.FinalURL,
-			"success":          true,
+		results = append(results, clientUploadResult{
+			ClientIndex:    clientIndex,
+			UploadResponse: res.Response(),
+			SourceURL:      fetchRes.FinalURL,
 		})
 	}
 
@@ -558,22 +583,25 @@ func (h *ImageHandler) UploadTask(c *gin.Context) {
 		response.WriteErrorCode(c, http.StatusBadRequest, "file_open_failed", "open file failed")
 		return
 	}
-	reader := io.Reader(f)
-	if maxPerFile > 0 {
-		reader = io.LimitReader(f, maxPerFile+1)
-	}
-	buf, err := io.ReadAll(reader)
+	upload, err := service.StageUpload(f, maxPerFile)
 	f.Close()
 	if err != nil {
+		if errors.Is(err, service.ErrUploadTooLarge) {
+			response.WriteErrorCode(c, http.StatusBadRequest, "file_too_large", "file too large")
+			return
+		}
 		response.WriteErrorCode(c, http.StatusBadRequest, "file_read_failed", "read file failed")
 		return
 	}
-	if maxPerFile > 0 && int64(len(buf)) > maxPerFile {
-		response.WriteErrorCode(c, http.StatusBadRequest, "file_too_large", "file too large")
-		return
-	}
+	// 成功入队后暂存文件交由任务删除
+	enqueued := false
+	defer func() {
+		if !enqueued {
+			upload.Remove()
+		}
+	}()
 
-	mimeType, width, height := detectUploadMIMEAndDimensions(buf)
+	mimeType, width, height := detectUploadMIMEAndDimensions(upload)
 	if _, allowed := allowedUploadMIMETypes[mimeType]; !allowed {
 		response.WriteErrorCode(c, http.StatusBadRequest, "unsupported_file_type", "unsupported file type: "+mimeType)
 		return
@@ -626,12 +654,27 @@ func (h *ImageHandler) UploadTask(c *gin.Context) {
 			}
 		}
 	}
+	if err := h.svc.ValidateRoutes(routes); err != nil {
+		response.WriteErrorCode(c, http.StatusBadRequest, "invalid_route", err.Error())
+		return
+	}
 
 	convert, _ := strconv.ParseBool(c.PostForm("convert"))
 	targetFormat := c.PostForm("target_format")
 	quality, _ := strconv.Atoi(c.PostForm("quality"))
 	effort, _ := strconv.Atoi(c.PostForm("effort"))
 
+	visibility := strings.TrimSpace(c.PostForm("visibility"))
+	if visibility != "" && !service.ValidVisibility(visibility) {
+		response.WriteErrorCode(c, http.StatusBadRequest, "invalid_visibility", "visibility must be public, unlisted or private")
+		return
+	}
+
+	callbackURL := strings.TrimSpace(c.PostForm("callback_url"))
+	if callbackURL != "" && !h.validateCallbackURL(c, callbackURL) {
+		return
+	}
+
 	var uploadedByTokenID *uint
 	var uploadedByTokenName string
 	var uploadedByTokenType string
@@ -641,12 +684,14 @@ func (h *ImageHandler) UploadTask(c *gin.Context) {
 		uploadedByTokenType = uploaderToken.NormalizedType()
 	}
 
+	enqueued = true
 	task, err := h.svc.EnqueueUploadTask(service.UploadTaskInput{
-		Buf:                 buf,
+		Staged:              upload,
 		FileName:            finalFileName,
 		Routes:              routes,
 		Description:         c.PostForm("description"),
 		Tags:                tags,
+		Visibility:          visibility,
 		MimeType:            mimeType,
 		Width:               width,
 		Height:              height,
@@ -661,6 +706,7 @@ func (h *ImageHandler) UploadTask(c *gin.Context) {
 		RequestPath:         c.Request.URL.Path,
 		IPAddress:           middleware.ClientIP(c),
 		UserAgent:           c.Request.UserAgent(),
+		CallbackURL:         callbackURL,
 	})
 	if err != nil {
 		response.WriteErrorCode(c, http.StatusInternalServerError, "enqueue_upload_failed", "failed to enqueue upload")
@@ -670,6 +716,22 @@ func (h *ImageHandler) UploadTask(c *gin.Context) {
 	c.JSON(http.StatusAccepted, task)
 }
 
+// validateCallbackURL 校验回调地址，不合法时写入错误响应并返回 false
+func (h *ImageHandler) validateCallbackURL(c *gin.Context, callbackURL string) bool {
+	err := h.svc.Webhooks().ValidateCallbackURL(callbackURL)
+	switch {
+	case err == nil:
+		return true
+	case errors.Is(err, service.ErrWebhookNotConfigured):
+		response.WriteErrorCode(c, http.StatusBadRequest, "webhook_not_configured", "callbacks require ANZUIMG_WEBHOOK_SECRET")
+	case errors.Is(err, service.ErrURLBlocked):
+		response.WriteErrorCode(c, http.StatusBadRequest, "callback_url_blocked", "callback url target address not allowed")
+	default:
+		response.WriteErrorCode(c, http.StatusBadRequest, "invalid_callback_url", "invalid callback url")
+	}
+	return false
+}
+
 // GET /api/v1/images/tasks/:id
 func (h *ImageHandler) GetUploadTask(c *gin.Context) {
 	id := strings.TrimSpace(c.Param("id"))
@@ -678,19 +740,31 @@ func (h *ImageHandler) GetUploadTask(c *gin.Context) {
 		return
 	}
 
-	task, err := h.svc.GetUploadTask(id)
+	task, err := h.svc.GetUploadTask(id, uploaderTokenID(uploaderTokenFromContext(c)))
 	if err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			response.WriteErrorCode(c, http.StatusNotFound, "task_not_found", "task not found")
-			return
-		}
-		response.WriteErrorCode(c, http.StatusInternalServerError, "get_upload_task_failed", "failed to get upload task")
+		h.writeUploadTaskError(c, err)
 		return
 	}
 
 	c.JSON(http.StatusOK, task)
 }
 
+// GET /api/v1/images/tasks/:id/deliveries
+func (h *ImageHandler) ListUploadTaskDeliveries(c *gin.Context) {
+	id := strings.TrimSpace(c.Param("id"))
+	if _, err := h.svc.GetUploadTask(id, uploaderTokenID(uploaderTokenFromContext(c))); err != nil {
+		h.writeUploadTaskError(c, err)
+		return
+	}
+
+	deliveries, err := h.svc.Webhooks().ListDeliveries(id)
+	if err != nil {
+		response.WriteErrorCode(c, http.StatusInternalServerError, "list_deliveries_failed", "failed to list webhook deliveries")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": deliveries})
+}
+
 func classifyURLFetchError(err error) (string, string) {
 	switch {
 	case errors.Is(err, service.ErrURLInvalid):
@@ -708,64 +782,91 @@ func classifyURLFetchError(err error) (string, string) {
 func (h *ImageHandler) GetByHash(c *gin.Context) {
 	hashStr := c.Param("hash")
 
-	img, absPath, err := h.svc.ResolveByHash(c.Request.Context(), hashStr)
+	transform, err := service.ParseTransformOptions(c.Request.URL.Query())
 	if err != nil {
-		response.WriteErrorCode(c, http.StatusNotFound, "image_not_found", "image not found")
+		response.WriteErrorCode(c, http.StatusBadRequest, "invalid_transform", err.Error())
 		return
 	}
 
-	if strings.HasPrefix(absPath, "http://") || strings.HasPrefix(absPath, "https://") {
-		c.Redirect(http.StatusFound, absPath)
+	img, loc, err := h.svc.ResolveByHash(c.Request.Context(), hashStr)
+	if err != nil {
+		response.WriteErrorCode(c, http.StatusNotFound, "image_not_found", "image not found")
 		return
 	}
-	if img.MimeType == "image/svg+xml" {
-		c.Header("Content-Disposition", "attachment")
+
+	cacheControl := ""
+	if middleware.IsPrivateImage(c) {
+		cacheControl = privateCacheControl
 	}
-	serveLocalMedia(c, absPath, img.MimeType)
+	h.serveImage(c, img, loc, transform, cacheControl)
 }
 
 // GET /i/:hash/thumbnail
 func (h *ImageHandler) GetThumbnailByHash(c *gin.Context) {
-	hashStr := c.Param("hash")
+	cacheControl := thumbnailCacheControl
+	if middleware.IsPrivateImage(c) {
+		cacheControl = privateCacheControl
+	}
+	h.serveThumbnail(c, c.Param("hash"), cacheControl)
+}
 
-	absPath, mimeType, err := h.svc.ResolveThumbnailByHash(c.Request.Context(), hashStr)
+// serveThumbnail 输出缩略图，缩略图可能稍后才生成，ETag 取实际文件名，且不使用 immutable
+func (h *ImageHandler) serveThumbnail(c *gin.Context, hashStr, cacheControl string) {
+	loc, mimeType, err := h.svc.ResolveThumbnailByHash(c.Request.Context(), hashStr, c.Query("size"))
 	if err != nil {
+		if errors.Is(err, service.ErrUnknownThumbnailSize) {
+			response.WriteErrorCode(c, http.StatusBadRequest, "invalid_thumbnail_size", "unknown thumbnail size")
+			return
+		}
 		response.WriteErrorCode(c, http.StatusNotFound, "thumbnail_not_found", "thumbnail not found")
 		return
 	}
 
-	if strings.HasPrefix(absPath, "http://") || strings.HasPrefix(absPath, "https://") {
-		c.Redirect(http.StatusFound, absPath)
+	setCacheHeaders(c, path.Base(loc.RelPath), time.Time{}, cacheControl)
+	if checkNotModified(c, time.Time{}) {
 		return
 	}
-	serveLocalMedia(c, absPath, mimeType)
+	h.serveLocation(c, loc, mimeType)
 }
 
-// GET /i/r/:route
+// GET /i/r/*route
 func (h *ImageHandler) GetByRoute(c *gin.Context) {
-	routeStr := c.Param("route")
+	routeStr := strings.TrimPrefix(c.Param("route"), "/")
 
-	img, absPath, err := h.svc.ResolveByRoute(c.Request.Context(), routeStr)
+	transform, err := service.ParseTransformOptions(c.Request.URL.Query())
 	if err != nil {
-		response.WriteErrorCode(c, http.StatusNotFound, "route_not_found", "route not found")
+		response.WriteErrorCode(c, http.StatusBadRequest, "invalid_transform", err.Error())
 		return
 	}
 
-	if strings.HasPrefix(absPath, "http://") || strings.HasPrefix(absPath, "https://") {
-		c.Redirect(http.StatusFound, absPath)
+	route, img, loc, err := h.svc.ResolveByRoute(c.Request.Context(), routeStr)
+	if err != nil {
+		if errors.Is(err, service.ErrRouteExpired) {
+			response.WriteErrorCode(c, http.StatusGone, "route_expired", "route has expired")
+			return
+		}
+		response.WriteErrorCode(c, http.StatusNotFound, "route_not_found", "route not found")
 		return
 	}
-	if img.MimeType == "image/svg+xml" {
-		c.Header("Content-Disposition", "attachment")
+	if img == nil {
+		// 重定向目标可能随时改变，跳转不缓存；保留查询参数以便变换与签名继续生效
+		target := service.RoutePath(route.RedirectTo)
+		if c.Request.URL.RawQuery != "" {
+			target += "?" + c.Request.URL.RawQuery
+		}
+		c.Header("Cache-Control", "no-cache")
+		c.Redirect(http.StatusFound, target)
+		return
 	}
-	serveLocalMedia(c, absPath, img.MimeType)
-}
 
-func serveLocalMedia(c *gin.Context, absPath, mimeType string) {
-	if mimeType != "" {
-		c.Header("Content-Type", mimeType)
+	cacheControl := h.routeCacheControl()
+	if middleware.IsPrivateImage(c) {
+		cacheControl = privateCacheControl
 	}
-	c.File(absPath)
+	if disposition := service.RouteContentDisposition(route, img); disposition != "" {
+		c.Header("Content-Disposition", disposition)
+	}
+	h.serveImage(c, img, loc, transform, cacheControl)
 }
 
 // GET /api/v1/images
@@ -782,27 +883,28 @@ func (h *ImageHandler) List(c *gin.Context) {
 		pageSize = 20
 	}
 
+	cursor, useCursor, ok := cursorParam(c)
+	if !ok {
+		return
+	}
+	if useCursor {
+		result, err := h.svc.ListImagesByCursor(cursor, pageSize, tag, fileName)
+		if err != nil {
+			response.WriteErrorCode(c, http.StatusInternalServerError, "list_images_failed", "failed to list images")
+			return
+		}
+		h.recordListLog(c, "image_list")
+		c.JSON(http.StatusOK, result)
+		return
+	}
+
 	images, total, err := h.svc.ListImages(page, pageSize, tag, fileName)
 	if err != nil {
 		response.WriteErrorCode(c, http.StatusInternalServerError, "list_images_failed", "failed to list images")
 		return
 	}
 
-	if v, ok := c.Get("api_token"); ok {
-		if token, ok2 := v.(*model.APIToken); ok2 && token != nil {
-			tokenSvc := service.NewAPITokenService(h.svc.Config(), h.svc.DB())
-			_ = tokenSvc.RecordLog(&model.APITokenLog{
-				TokenID:   token.ID,
-				TokenName: token.Name,
-				TokenType: token.NormalizedType(),
-				Action:    "image_list",
-				Method:    c.Request.Method,
-				Path:      c.Request.URL.RequestURI(),
-				IPAddress: middleware.ClientIP(c),
-				UserAgent: c.Request.UserAgent(),
-			})
-		}
-	}
+	h.recordListLog(c, "image_list")
 
 	c.JSON(http.StatusOK, gin.H{
 		"data":  images,
@@ -812,6 +914,52 @@ func (h *ImageHandler) List(c *gin.Context) {
 	})
 }
 
+// GET /api/v1/images/search
+// 参数见 service.ParseImageSearch，翻页时把 next_cursor 作为 cursor 传回，其他参数保持不变
+func (h *ImageHandler) Search(c *gin.Context) {
+	search, err := service.ParseImageSearch(c.Request.URL.Query())
+	if err != nil {
+		response.WriteErrorCode(c, http.StatusBadRequest, "invalid_search", err.Error())
+		return
+	}
+
+	page, err := h.svc.SearchImages(c.Request.Context(), search)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidSearch) {
+			response.WriteErrorCode(c, http.StatusBadRequest, "invalid_search", err.Error())
+			return
+		}
+		response.WriteErrorCode(c, http.StatusInternalServerError, "search_images_failed", "failed to search images")
+		return
+	}
+
+	h.recordListLog(c, "image_search")
+	c.JSON(http.StatusOK, page)
+}
+
+// recordListLog 为 Token 查询图片列表写入 api_token_logs，会话访问不记录
+func (h *ImageHandler) recordListLog(c *gin.Context, action string) {
+	v, ok := c.Get("api_token")
+	if !ok {
+		return
+	}
+	token, ok := v.(*model.APIToken)
+	if !ok || token == nil {
+		return
+	}
+	tokenSvc := service.NewAPITokenService(h.svc.Config(), h.svc.DB())
+	_ = tokenSvc.RecordLog(&model.APITokenLog{
+		TokenID:   token.ID,
+		TokenName: token.Name,
+		TokenType: token.NormalizedType(),
+		Action:    action,
+		Method:    c.Request.Method,
+		Path:      c.Request.URL.RequestURI(),
+		IPAddress: middleware.ClientIP(c),
+		UserAgent: c.Request.UserAgent(),
+	})
+}
+
 // GET /api/v1/tags
 func (h *ImageHandler) ListTags(c *gin.Context) {
 	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "200"))
@@ -839,6 +987,10 @@ func (h *ImageHandler) Delete(c *gin.Context) {
 	}
 
 	if err := h.svc.DeleteImage(c.Request.Context(), hash); err != nil {
+		if errors.Is(err, service.ErrRouteInUse) {
+			response.WriteErrorCode(c, http.StatusConflict, "route_in_use", err.Error())
+			return
+		}
 		response.WriteErrorCode(c, http.StatusInternalServerError, "delete_image_failed", "failed to delete image")
 		return
 	}
@@ -851,6 +1003,7 @@ type UpdateImageRequest struct {
 	Tags        []string `json:"tags"`
 	FileName    string   `json:"file_name"`
 	Routes      []string `json:"routes"`
+	Visibility  *string  `json:"visibility"`
 }
 
 // PATCH /api/v1/images/:hash
@@ -866,23 +1019,34 @@ func (h *ImageHandler) Update(c *gin.Context) {
 		response.WriteErrorCode(c, http.StatusBadRequest, "invalid_update_request", "invalid request body")
 		return
 	}
+	if req.Visibility != nil && !service.ValidVisibility(*req.Visibility) {
+		response.WriteErrorCode(c, http.StatusBadRequest, "invalid_visibility", "visibility must be public, unlisted or private")
+		return
+	}
 
 	img, err := h.svc.UpdateImage(hash, req.Description, req.Tags, req.FileName)
 	if err != nil {
 		response.WriteErrorCode(c, http.StatusInternalServerError, "update_image_failed", "failed to update image")
 		return
 	}
+	if req.Visibility != nil && img.Visibility != *req.Visibility {
+		if img, err = h.svc.SetVisibility(hash, *req.Visibility); err != nil {
+			response.WriteErrorCode(c, http.StatusInternalServerError, "update_image_failed", "failed to update image")
+			return
+		}
+	}
 
 	if req.Routes != nil {
 		if err := h.svc.UpdateRoutes(img.ID, req.Routes); err != nil {
-			status := http.StatusInternalServerError
-			if containsDuplicateKey(err.Error()) {
-				status = http.StatusBadRequest
-			}
-			if status == http.StatusBadRequest {
-				response.WriteErrorCode(c, status, "route_exists", "route already exists")
-			} else {
-				response.WriteErrorCode(c, status, "update_routes_failed", "failed to update routes")
+			switch {
+			case errors.Is(err, service.ErrInvalidRoute):
+				response.WriteErrorCode(c, http.StatusBadRequest, "invalid_route", err.Error())
+			case errors.Is(err, service.ErrRouteInUse):
+				response.WriteErrorCode(c, http.StatusConflict, "route_in_use", err.Error())
+			case containsDuplicateKey(err.Error()):
+				response.WriteErrorCode(c, http.StatusBadRequest, "route_exists", "route already exists")
+			default:
+				response.WriteErrorCode(c, http.StatusInternalServerError, "update_routes_failed", "failed to update routes")
 			}
 			return
 		}
@@ -891,10 +1055,11 @@ func (h *ImageHandler) Update(c *gin.Context) {
 	c.JSON(http.StatusOK, img)
 }
 
-// GET /api/v1/routes
+// GET /api/v1/routes?prefix=&q=
 func (h *ImageHandler) ListRoutes(c *gin.Context) {
 	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
 	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+	filter := service.RouteFilter{Prefix: c.Query("prefix"), Query: c.Query("q")}
 
 	if page < 1 {
 		page = 1
@@ -903,7 +1068,21 @@ func (h *ImageHandler) ListRoutes(c *gin.Context) {
 		pageSize = 20
 	}
 
-	routes, total, err := h.svc.ListRoutes(page, pageSize)
+	cursor, useCursor, ok := cursorParam(c)
+	if !ok {
+		return
+	}
+	if useCursor {
+		result, err := h.svc.ListRoutesByCursor(filter, cursor, pageSize)
+		if err != nil {
+			response.WriteErrorCode(c, http.StatusInternalServerError, "list_routes_failed", "failed to list routes")
+			return
+		}
+		c.JSON(http.StatusOK, result)
+		return
+	}
+
+	routes, total, err := h.svc.ListRoutes(filter, page, pageSize)
 	if err != nil {
 		response.WriteErrorCode(c, http.StatusInternalServerError, "list_routes_failed", "failed to list routes")
 		return
@@ -926,6 +1105,10 @@ func (h *ImageHandler) DeleteRoute(c *gin.Context) {
 	}
 
 	if err := h.svc.DeleteRoute(route); err != nil {
+		if errors.Is(err, service.ErrRouteInUse) {
+			response.WriteErrorCode(c, http.StatusConflict, "route_in_use", err.Error())
+			return
+		}
 		response.WriteErrorCode(c, http.StatusInternalServerError, "delete_route_failed", "failed to delete route")
 		return
 	}
@@ -960,6 +1143,11 @@ func (h *ImageHandler) GetInfo(c *gin.Context) {
 		}
 	}
 
+	albumIDs, err := h.svc.AlbumIDsForImage(img.ID)
+	if err != nil {
+		albumIDs = []uint64{}
+	}
+
 	c.JSON(http.StatusOK, gin.H{
 		"hash":                   img.Hash,
 		"file_name":              img.FileName,
@@ -974,12 +1162,14 @@ func (h *ImageHandler) GetInfo(c *gin.Context) {
 		"audio_bitrate":          img.AudioBitrate,
 		"description":            img.Description,
 		"tags":                   img.Tags,
+		"visibility":             img.Visibility,
 		"uploaded_by_token_id":   img.UploadedByTokenID,
 		"uploaded_by_token_name": img.UploadedByTokenName,
 		"uploaded_by_token_type": img.UploadedByTokenType,
 		"created_at":             img.CreatedAt,
 		"updated_at":             img.UpdatedAt,
 		"routes":                 routes,
+		"album_ids":              albumIDs,
 	})
 }
 
@@ -1,12 +1,20 @@
 package handler
 
 import (
+	"context"
+	"io"
+	"net/http"
 	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/gin-gonic/gin"
+
+	"github.com/TangTangChu/AnzuImg/backend/internal/config"
+	"github.com/TangTangChu/AnzuImg/backend/internal/service"
 )
 
 func TestMediaDimensionsAllowed(t *testing.T) {
@@ -43,3 +51,89 @@ func TestServeLocalMediaUsesDetectedMIMEForExtensionlessFile(t *testing.T) {
 		t.Fatalf("unexpected response body: %v", got)
 	}
 }
+
+func TestServeLocalMediaConditionalAndRange(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	path := filepath.Join(t.TempDir(), "hash")
+	if err := os.WriteFile(path, []byte("0123456789"), 0o600); err != nil {
+		t.Fatalf("write test media: %v", err)
+	}
+	lastModified := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	serve := func(header, value string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(recorder)
+		c.Request = httptest.NewRequest("GET", "/i/hash", nil)
+		c.Request.Header.Set(header, value)
+		setCacheHeaders(c, "hash", lastModified, immutableCacheControl)
+		if !checkNotModified(c, lastModified) {
+			serveLocalMedia(c, path, "video/mp4")
+		}
+		c.Writer.WriteHeaderNow()
+		return recorder
+	}
+
+	if rec := serve("If-None-Match", `W/"other", "hash"`); rec.Code != http.StatusNotModified {
+		t.Fatalf("expected 304 for matching etag, got %d", rec.Code)
+	}
+	if rec := serve("If-Modified-Since", lastModified.Format(http.TimeFormat)); rec.Code != http.StatusNotModified {
+		t.Fatalf("expected 304 for if-modified-since, got %d", rec.Code)
+	}
+	rec := serve("Range", "bytes=2-4")
+	if rec.Code != http.StatusPartialContent || rec.Body.String() != "234" {
+		t.Fatalf("expected partial content 234, got %d %q", rec.Code, rec.Body.String())
+	}
+	if got := rec.Header().Get("ETag"); got != `"hash"` {
+		t.Fatalf("unexpected etag %q", got)
+	}
+}
+
+type fakeRemoteStorage struct {
+	service.Storage
+	data      string
+	lastRange string
+}
+
+func (s *fakeRemoteStorage) DeliveryMode() string { return service.DeliveryProxy }
+
+func (s *fakeRemoteStorage) PresignGet(ctx context.Context, relPath string) (string, time.Duration, error) {
+	return "", 0, nil
+}
+
+func (s *fakeRemoteStorage) OpenRange(ctx context.Context, relPath, rangeHeader string) (*service.ObjectStream, error) {
+	s.lastRange = rangeHeader
+	if rangeHeader == "bytes=2-4" {
+		return &service.ObjectStream{Body: io.NopCloser(strings.NewReader(s.data[2:5])), ContentLength: 3, ContentRange: "bytes 2-4/10"}, nil
+	}
+	return &service.ObjectStream{Body: io.NopCloser(strings.NewReader(s.data)), ContentLength: int64(len(s.data))}, nil
+}
+
+func TestProxyRemotePassesRangeThrough(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	storage := &fakeRemoteStorage{data: "0123456789"}
+	h := &ImageHandler{svc: service.NewImageServiceWithStorage(&config.Config{}, nil, storage)}
+
+	serve := func(headers map[string]string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(recorder)
+		c.Request = httptest.NewRequest("GET", "/i/hash", nil)
+		for k, v := range headers {
+			c.Request.Header.Set(k, v)
+		}
+		setCacheHeaders(c, "hash", time.Time{}, immutableCacheControl)
+		h.serveLocation(c, &service.MediaLocation{RelPath: "ha/hash", Proxy: true}, "video/mp4")
+		return recorder
+	}
+
+	rec := serve(map[string]string{"Range": "bytes=2-4"})
+	if rec.Code != http.StatusPartialContent || rec.Body.String() != "234" || rec.Header().Get("Content-Range") != "bytes 2-4/10" {
+		t.Fatalf("unexpected ranged response: %d %q %q", rec.Code, rec.Body.String(), rec.Header().Get("Content-Range"))
+	}
+
+	rec = serve(map[string]string{"Range": "bytes=2-4", "If-Range": `"stale"`})
+	if storage.lastRange != "" || rec.Code != http.StatusOK || rec.Body.String() != "0123456789" {
+		t.Fatalf("expected full response for stale If-Range, got %d %q", rec.Code, rec.Body.String())
+	}
+}
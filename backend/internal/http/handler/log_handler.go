@@ -45,6 +45,21 @@ func parsePageSize(c *gin.Context) (int, int) {
 	return page, size
 }
 
+// cursorParam 请求带 cursor 参数时使用游标分页，第一页传空值 cursor=。
+// 游标无效时已写入 400 响应，调用方直接返回。
+func cursorParam(c *gin.Context) (cursor *service.Cursor, useCursor, ok bool) {
+	raw, present := c.GetQuery("cursor")
+	if !present {
+		return nil, false, true
+	}
+	cursor, err := service.DecodeCursor(strings.TrimSpace(raw))
+	if err != nil {
+		response.WriteErrorCode(c, http.StatusBadRequest, "invalid_cursor", "invalid cursor")
+		return nil, true, false
+	}
+	return cursor, true, true
+}
+
 func parseLogFilter(c *gin.Context) service.LogFilter {
 	return service.LogFilter{
 		Search:    strings.TrimSpace(c.Query("search")),
@@ -60,6 +75,19 @@ func parseLogFilter(c *gin.Context) service.LogFilter {
 // ListApp GET /api/v1/logs/app
 func (h *LogHandler) ListApp(c *gin.Context) {
 	page, size := parsePageSize(c)
+	cursor, useCursor, ok := cursorParam(c)
+	if !ok {
+		return
+	}
+	if useCursor {
+		result, err := h.q.ListAppLogsByCursor(parseLogFilter(c), cursor, size)
+		if err != nil {
+			response.WriteErrorCode(c, http.StatusInternalServerError, "list_app_logs_failed", "failed to list app logs")
+			return
+		}
+		c.JSON(http.StatusOK, result)
+		return
+	}
 	rows, total, err := h.q.ListAppLogs(parseLogFilter(c), page, size)
 	if err != nil {
 		response.WriteErrorCode(c, http.StatusInternalServerError, "list_app_logs_failed", "failed to list app logs")
@@ -72,6 +100,19 @@ func (h *LogHandler) ListApp(c *gin.Context) {
 func (h *LogHandler) ListSecurity(c *gin.Context) {
 	page, size := parsePageSize(c)
 	failedOnly, _ := strconv.ParseBool(c.DefaultQuery("failed_only", "false"))
+	cursor, useCursor, ok := cursorParam(c)
+	if !ok {
+		return
+	}
+	if useCursor {
+		result, err := h.q.ListSecurityLogsByCursor(parseLogFilter(c), cursor, size, failedOnly)
+		if err != nil {
+			response.WriteErrorCode(c, http.StatusInternalServerError, "list_security_logs_failed", "failed to list security logs")
+			return
+		}
+		c.JSON(http.StatusOK, result)
+		return
+	}
 	rows, total, err := h.q.ListSecurityLogs(parseLogFilter(c), page, size, failedOnly)
 	if err != nil {
 		response.WriteErrorCode(c, http.StatusInternalServerError, "list_security_logs_failed", "failed to list security logs")
@@ -84,6 +125,19 @@ func (h *LogHandler) ListSecurity(c *gin.Context) {
 func (h *LogHandler) ListToken(c *gin.Context) {
 	page, size := parsePageSize(c)
 	f := parseLogFilter(c)
+	cursor, useCursor, ok := cursorParam(c)
+	if !ok {
+		return
+	}
+	if useCursor {
+		result, err := h.tokens.ListLogsByCursor(cursor, size, f.Search, f.StartDate, f.EndDate, f.Action)
+		if err != nil {
+			response.WriteErrorCode(c, http.StatusInternalServerError, "list_token_logs_failed", "failed to list token logs")
+			return
+		}
+		c.JSON(http.StatusOK, result)
+		return
+	}
 	rows, total, err := h.tokens.ListLogs(page, size, f.Search, f.StartDate, f.EndDate, f.Action)
 	if err != nil {
 		response.WriteErrorCode(c, http.StatusInternalServerError, "list_token_logs_failed", "failed to list token logs")
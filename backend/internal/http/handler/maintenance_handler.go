@@ -0,0 +1,219 @@
+package handler
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"github.com/TangTangChu/AnzuImg/backend/internal/http/middleware"
+	"github.com/TangTangChu/AnzuImg/backend/internal/http/response"
+	"github.com/TangTangChu/AnzuImg/backend/internal/logger"
+	"github.com/TangTangChu/AnzuImg/backend/internal/model"
+	"github.com/TangTangChu/AnzuImg/backend/internal/service"
+)
+
+type MaintenanceHandler struct {
+	db    *gorm.DB
+	maint *service.MaintenanceService
+	log   *logger.Logger
+}
+
+func NewMaintenanceHandler(db *gorm.DB, maint *service.MaintenanceService) *MaintenanceHandler {
+	return &MaintenanceHandler{
+		db:    db,
+		maint: maint,
+		log:   logger.Register("maintenance-handler"),
+	}
+}
+
+// ListJobs GET /api/v1/maintenance/jobs?limit=20
+func (h *MaintenanceHandler) ListJobs(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	jobs, err := h.maint.ListJobs(limit)
+	if err != nil {
+		response.WriteErrorCode(c, http.StatusInternalServerError, "job_list_failed", "failed to list jobs")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": jobs})
+}
+
+// GetJob GET /api/v1/maintenance/jobs/:id
+func (h *MaintenanceHandler) GetJob(c *gin.Context) {
+	job, err := h.maint.GetJob(c.Param("id"))
+	if err != nil {
+		h.writeJobError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, job)
+}
+
+// CreateStorageMigration POST /api/v1/maintenance/jobs/storage-migration
+func (h *MaintenanceHandler) CreateStorageMigration(c *gin.Context) {
+	var req service.StorageMigrationParams
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.WriteErrorCode(c, http.StatusBadRequest, "invalid_request", "invalid request")
+		return
+	}
+	job, err := h.maint.CreateStorageMigration(req)
+	if err != nil {
+		h.writeJobError(c, err)
+		return
+	}
+	if job, err = h.maint.Start(job.ID); err != nil {
+		h.writeJobError(c, err)
+		return
+	}
+	h.recordSecurityEvent(c, "info", "storage_migration_started", req.From+" -> "+req.To+": job "+job.ID)
+	c.JSON(http.StatusAccepted, job)
+}
+
+// CreateStorageScrub POST /api/v1/maintenance/jobs/storage-scrub
+func (h *MaintenanceHandler) CreateStorageScrub(c *gin.Context) {
+	var req service.StorageScrubParams
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.WriteErrorCode(c, http.StatusBadRequest, "invalid_request", "invalid request")
+		return
+	}
+	job, err := h.maint.CreateStorageScrub(req)
+	if err != nil {
+		h.writeJobError(c, err)
+		return
+	}
+	if job, err = h.maint.Start(job.ID); err != nil {
+		h.writeJobError(c, err)
+		return
+	}
+	h.recordSecurityEvent(c, "info", "storage_scrub_started", string(job.Params)+": job "+job.ID)
+	c.JSON(http.StatusAccepted, job)
+}
+
+// CreateThumbnailBackfill POST /api/v1/maintenance/jobs/thumbnail-backfill
+// 请求体可省略
+func (h *MaintenanceHandler) CreateThumbnailBackfill(c *gin.Context) {
+	var req service.ThumbnailBackfillParams
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		response.WriteErrorCode(c, http.StatusBadRequest, "invalid_request", "invalid request")
+		return
+	}
+	job, err := h.maint.CreateThumbnailBackfill(req)
+	if err != nil {
+		h.writeJobError(c, err)
+		return
+	}
+	if job, err = h.maint.Start(job.ID); err != nil {
+		h.writeJobError(c, err)
+		return
+	}
+	h.recordSecurityEvent(c, "info", "thumbnail_backfill_started", "job "+job.ID)
+	c.JSON(http.StatusAccepted, job)
+}
+
+// CreateThumbnailRegenerate POST /api/v1/maintenance/jobs/thumbnail-regenerate
+func (h *MaintenanceHandler) CreateThumbnailRegenerate(c *gin.Context) {
+	var req service.ThumbnailRegenerateParams
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.WriteErrorCode(c, http.StatusBadRequest, "invalid_request", "invalid request")
+		return
+	}
+	job, err := h.maint.CreateThumbnailRegenerate(req)
+	if err != nil {
+		h.writeJobError(c, err)
+		return
+	}
+	if job, err = h.maint.Start(job.ID); err != nil {
+		h.writeJobError(c, err)
+		return
+	}
+	h.recordSecurityEvent(c, "info", "thumbnail_regenerate_started", string(job.Params)+": job "+job.ID)
+	c.JSON(http.StatusAccepted, job)
+}
+
+// ListScrubFindings GET /api/v1/maintenance/jobs/:id/findings?kind=orphan&page=1&page_size=50
+func (h *MaintenanceHandler) ListScrubFindings(c *gin.Context) {
+	job, err := h.maint.GetJob(c.Param("id"))
+	if err != nil {
+		h.writeJobError(c, err)
+		return
+	}
+	if job.Kind != model.MaintenanceKindStorageScrub {
+		response.WriteErrorCode(c, http.StatusBadRequest, "invalid_job_kind", "job is not a storage scrub")
+		return
+	}
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "50"))
+
+	summary, err := h.maint.ScrubSummary(job.ID)
+	if err != nil {
+		h.writeJobError(c, err)
+		return
+	}
+	findings, total, err := h.maint.ListScrubFindings(job.ID, c.Query("kind"), page, pageSize)
+	if err != nil {
+		h.writeJobError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"job":     job,
+		"summary": summary,
+		"data":    findings,
+		"total":   total,
+		"page":    page,
+		"size":    pageSize,
+	})
+}
+
+// ResumeJob POST /api/v1/maintenance/jobs/:id/resume
+func (h *MaintenanceHandler) ResumeJob(c *gin.Context) {
+	job, err := h.maint.Start(c.Param("id"))
+	if err != nil {
+		h.writeJobError(c, err)
+		return
+	}
+	h.recordSecurityEvent(c, "info", "maintenance_job_resumed", "job "+job.ID)
+	c.JSON(http.StatusAccepted, job)
+}
+
+// CancelJob POST /api/v1/maintenance/jobs/:id/cancel
+func (h *MaintenanceHandler) CancelJob(c *gin.Context) {
+	id := c.Param("id")
+	if err := h.maint.Cancel(id); err != nil {
+		h.writeJobError(c, err)
+		return
+	}
+	h.recordSecurityEvent(c, "info", "maintenance_job_cancelled", "job "+id)
+	c.JSON(http.StatusOK, gin.H{"message": "job cancelled"})
+}
+
+func (h *MaintenanceHandler) writeJobError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, service.ErrJobNotFound):
+		response.WriteErrorCode(c, http.StatusNotFound, "job_not_found", "job not found")
+	case errors.Is(err, service.ErrJobNotResumable):
+		response.WriteErrorCode(c, http.StatusConflict, "job_not_resumable", err.Error())
+	case errors.Is(err, service.ErrInvalidJobParams), errors.Is(err, service.ErrUnknownJobKind):
+		response.WriteErrorCode(c, http.StatusBadRequest, "invalid_job_params", err.Error())
+	default:
+		h.log.Ctx(c.Request.Context()).Errorf("Maintenance job request failed: %v", err)
+		response.WriteErrorCode(c, http.StatusInternalServerError, "job_failed", "maintenance job request failed")
+	}
+}
+
+func (h *MaintenanceHandler) recordSecurityEvent(c *gin.Context, level, action, message string) {
+	event := &model.SecurityEventLog{
+		Category:  "maintenance",
+		Level:     level,
+		Action:    action,
+		Message:   message,
+		Method:    c.Request.Method,
+		Path:      c.Request.URL.Path,
+		IPAddress: middleware.ClientIP(c),
+		Username:  "admin",
+	}
+	if err := h.db.Create(event).Error; err != nil {
+		h.log.Ctx(c.Request.Context()).Warnf("record security event failed: %v", err)
+	}
+}
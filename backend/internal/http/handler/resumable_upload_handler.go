@@ -0,0 +1,302 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/TangTangChu/AnzuImg/backend/internal/http/middleware"
+	"github.com/TangTangChu/AnzuImg/backend/internal/http/response"
+	"github.com/TangTangChu/AnzuImg/backend/internal/model"
+	"github.com/TangTangChu/AnzuImg/backend/internal/service"
+)
+
+// 断点续传使用的请求/响应头，与 tus 协议同名
+const (
+	headerUploadOffset = "Upload-Offset"
+	headerUploadLength = "Upload-Length"
+)
+
+type createResumableUploadRequest struct {
+	FileName     string   `json:"file_name"`
+	Size         int64    `json:"size"`
+	Routes       []string `json:"routes"`
+	Description  string   `json:"description"`
+	Tags         []string `json:"tags"`
+	Visibility   string   `json:"visibility"`
+	CustomName   string   `json:"custom_name"`
+	Convert      bool     `json:"convert"`
+	TargetFormat string   `json:"target_format"`
+	Quality      int      `json:"quality"`
+	Effort       int      `json:"effort"`
+}
+
+func uploaderTokenFromContext(c *gin.Context) *model.APIToken {
+	if v, ok := c.Get("api_token"); ok {
+		if t, ok2 := v.(*model.APIToken); ok2 {
+			return t
+		}
+	}
+	return nil
+}
+
+func uploaderTokenID(token *model.APIToken) *uint {
+	if token == nil {
+		return nil
+	}
+	return &token.ID
+}
+
+// sanitizeUploadFileName 去掉文件名中的路径部分，无法得到有效文件名时返回空字符串
+func sanitizeUploadFileName(name string) string {
+	cleanPath := filepath.Clean(name)
+	if strings.Contains(cleanPath, "..") || filepath.IsAbs(cleanPath) || strings.ContainsAny(cleanPath, "/\\") {
+		cleanPath = filepath.Base(cleanPath)
+	}
+	if cleanPath == "" || cleanPath == "." || cleanPath == ".." {
+		return ""
+	}
+	return cleanPath
+}
+
+func trimNonEmpty(values []string) []string {
+	var out []string
+	for _, v := range values {
+		if v = strings.TrimSpace(v); v != "" {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+func writeUploadProgress(c *gin.Context, upload *model.ResumableUpload) {
+	c.Header(headerUploadOffset, strconv.FormatInt(upload.Offset, 10))
+	c.Header(headerUploadLength, strconv.FormatInt(upload.Size, 10))
+	c.Header("Cache-Control", "no-store")
+}
+
+func (h *ImageHandler) writeResumableUploadError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, service.ErrUploadNotFound):
+		response.WriteErrorCode(c, http.StatusNotFound, "upload_not_found", "upload not found or expired")
+	case errors.Is(err, service.ErrUploadOffsetMismatch):
+		response.WriteErrorCode(c, http.StatusConflict, "upload_offset_mismatch", "upload offset does not match received bytes")
+	case errors.Is(err, service.ErrUploadIncomplete):
+		response.WriteErrorCode(c, http.StatusConflict, "upload_incomplete", "upload is incomplete")
+	case errors.Is(err, service.ErrUploadTooLarge):
+		response.WriteErrorCode(c, http.StatusRequestEntityTooLarge, "file_too_large", "file too large")
+	default:
+		response.WriteErrorCode(c, http.StatusInternalServerError, "resumable_upload_failed", "resumable upload failed")
+	}
+}
+
+// POST /api/v1/images/uploads
+// json: file_name, size 必填；routes, description, tags, visibility, custom_name, convert, target_format, quality, effort 可选
+func (h *ImageHandler) CreateResumableUpload(c *gin.Context) {
+	var req createResumableUploadRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.WriteErrorCode(c, http.StatusBadRequest, "invalid_request", "invalid request body")
+		return
+	}
+	if req.Size <= 0 {
+		response.WriteErrorCode(c, http.StatusBadRequest, "invalid_upload_size", "size must be positive")
+		return
+	}
+
+	visibility := strings.TrimSpace(req.Visibility)
+	if visibility != "" && !service.ValidVisibility(visibility) {
+		response.WriteErrorCode(c, http.StatusBadRequest, "invalid_visibility", "visibility must be public, unlisted or private")
+		return
+	}
+
+	fileName := sanitizeUploadFileName(req.FileName)
+	if fileName == "" {
+		response.WriteErrorCode(c, http.StatusBadRequest, "invalid_filename", "invalid filename")
+		return
+	}
+	if req.CustomName != "" {
+		if cn := sanitizeUploadFileName(req.CustomName); cn != "" {
+			fileName = cn
+		}
+	}
+
+	token := uploaderTokenFromContext(c)
+	upload, err := h.resumable.Create(fileName, req.Size, service.ResumableUploadOptions{
+		Routes:       trimNonEmpty(req.Routes),
+		Description:  req.Description,
+		Tags:         trimNonEmpty(req.Tags),
+		Visibility:   visibility,
+		Convert:      req.Convert,
+		TargetFormat: req.TargetFormat,
+		Quality:      req.Quality,
+		Effort:       req.Effort,
+	}, uploaderTokenID(token))
+	if err != nil {
+		h.writeResumableUploadError(c, err)
+		return
+	}
+
+	writeUploadProgress(c, upload)
+	c.Header("Location", c.Request.URL.Path+"/"+upload.ID)
+	c.JSON(http.StatusCreated, upload)
+}
+
+// HEAD/GET /api/v1/images/uploads/:id
+// 返回已接收的字节数，客户端断线后据此从断点继续
+func (h *ImageHandler) GetResumableUpload(c *gin.Context) {
+	upload, err := h.resumable.Get(c.Param("id"), uploaderTokenID(uploaderTokenFromContext(c)))
+	if err != nil {
+		if c.Request.Method == http.MethodHead {
+			if errors.Is(err, service.ErrUploadNotFound) {
+				c.Status(http.StatusNotFound)
+			} else {
+				c.Status(http.StatusInternalServerError)
+			}
+			return
+		}
+		h.writeResumableUploadError(c, err)
+		return
+	}
+
+	writeUploadProgress(c, upload)
+	if c.Request.Method == http.MethodHead {
+		c.Status(http.StatusOK)
+		return
+	}
+	c.JSON(http.StatusOK, upload)
+}
+
+// PATCH /api/v1/images/uploads/:id
+// header: Upload-Offset=<已接收字节数>，body 为原始分片内容
+func (h *ImageHandler) PatchResumableUpload(c *gin.Context) {
+	offset, err := strconv.ParseInt(c.GetHeader(headerUploadOffset), 10, 64)
+	if err != nil || offset < 0 {
+		response.WriteErrorCode(c, http.StatusBadRequest, "invalid_upload_offset", "Upload-Offset header is required")
+		return
+	}
+
+	maxChunk := int64(100 * 1024 * 1024)
+	if cfg := h.svc.Config(); cfg != nil {
+		if v := cfg.Effective().MaxUploadBytes; v > 0 {
+			maxChunk = v
+		}
+	}
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxChunk)
+
+	upload, err := h.resumable.WriteChunk(c.Request.Context(), c.Param("id"), uploaderTokenID(uploaderTokenFromContext(c)), offset, c.Request.Body)
+	if upload != nil {
+		writeUploadProgress(c, upload)
+	}
+	if err != nil {
+		h.writeResumableUploadError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// POST /api/v1/images/uploads/:id/complete?async=<optional>&callback_url=<optional>
+// 收齐内容后进入与普通上传相同的处理流程；async=true 时创建上传任务并返回 202。
+// 处理失败时保留已上传的内容，可以再次调用完成；内容未通过校验时上传被丢弃
+func (h *ImageHandler) CompleteResumableUpload(c *gin.Context) {
+	async, _ := strconv.ParseBool(c.Query("async"))
+	callbackURL := ""
+	if async {
+		callbackURL = strings.TrimSpace(c.Query("callback_url"))
+		if callbackURL != "" && !h.validateCallbackURL(c, callbackURL) {
+			return
+		}
+	}
+
+	token := uploaderTokenFromContext(c)
+	upload, err := h.resumable.Complete(c.Param("id"), uploaderTokenID(token), func(upload *model.ResumableUpload, staged *service.StagedUpload) error {
+		return h.processResumableUpload(c, token, upload, staged, async, callbackURL)
+	})
+	if err != nil && !c.Writer.Written() {
+		if upload != nil {
+			writeUploadProgress(c, upload)
+		}
+		h.writeResumableUploadError(c, err)
+	}
+}
+
+// processResumableUpload 处理收齐的内容并写出响应。staged 仍归续传服务所有，异步任务使用其副本
+func (h *ImageHandler) processResumableUpload(c *gin.Context, token *model.APIToken, upload *model.ResumableUpload, staged *service.StagedUpload, async bool, callbackURL string) error {
+	mimeType, width, height := detectUploadMIMEAndDimensions(staged)
+	if _, allowed := allowedUploadMIMETypes[mimeType]; !allowed {
+		response.WriteErrorCode(c, http.StatusBadRequest, "unsupported_file_type", "unsupported file type: "+mimeType)
+		return service.ErrUploadRejected
+	}
+	if !mediaDimensionsAllowed(width, height) {
+		response.WriteErrorCode(c, http.StatusBadRequest, "media_dimensions_too_large", "media dimensions exceed limit")
+		return service.ErrUploadRejected
+	}
+
+	opts := h.resumable.Options(upload)
+	var uploadedByTokenName, uploadedByTokenType string
+	if token != nil {
+		uploadedByTokenName = token.Name
+		uploadedByTokenType = token.NormalizedType()
+	}
+	convert := opts.Convert && service.IsImageFile(mimeType)
+
+	if async {
+		// 任务接管并删除输入文件，交给它一份副本
+		taskInput, err := staged.Copy()
+		if err != nil {
+			response.WriteErrorCode(c, http.StatusInternalServerError, "enqueue_upload_failed", "failed to enqueue upload")
+			return err
+		}
+		task, err := h.svc.EnqueueUploadTask(service.UploadTaskInput{
+			Staged:              taskInput,
+			FileName:            upload.FileName,
+			Routes:              opts.Routes,
+			Description:         opts.Description,
+			Tags:                opts.Tags,
+			Visibility:          opts.Visibility,
+			MimeType:            mimeType,
+			Width:               width,
+			Height:              height,
+			Convert:             convert,
+			TargetFormat:        opts.TargetFormat,
+			Quality:             opts.Quality,
+			Effort:              opts.Effort,
+			UploadedByTokenID:   uploaderTokenID(token),
+			UploadedByTokenName: uploadedByTokenName,
+			UploadedByTokenType: uploadedByTokenType,
+			RequestMethod:       c.Request.Method,
+			RequestPath:         c.Request.URL.Path,
+			IPAddress:           middleware.ClientIP(c),
+			UserAgent:           c.Request.UserAgent(),
+			CallbackURL:         callbackURL,
+		})
+		if err != nil {
+			response.WriteErrorCode(c, http.StatusInternalServerError, "enqueue_upload_failed", "failed to enqueue upload")
+			return err
+		}
+		c.JSON(http.StatusAccepted, task)
+		return nil
+	}
+
+	res, err := h.svc.Upload(c.Request.Context(), staged, upload.FileName, opts.Routes, opts.Description, opts.Tags, opts.Visibility, mimeType, width, height, convert, opts.TargetFormat, opts.Quality, opts.Effort, uploaderTokenID(token), uploadedByTokenName, uploadedByTokenType)
+	if err != nil {
+		response.WriteErrorCode(c, http.StatusInternalServerError, "upload_failed", "upload failed")
+		return err
+	}
+
+	h.recordUploadLog(c, token, res.Image.Hash)
+	c.JSON(http.StatusOK, res.Response())
+	return nil
+}
+
+// DELETE /api/v1/images/uploads/:id
+func (h *ImageHandler) AbortResumableUpload(c *gin.Context) {
+	if err := h.resumable.Abort(c.Param("id"), uploaderTokenID(uploaderTokenFromContext(c))); err != nil {
+		h.writeResumableUploadError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,136 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/TangTangChu/AnzuImg/backend/internal/http/response"
+	"github.com/TangTangChu/AnzuImg/backend/internal/service"
+)
+
+type routeRequest struct {
+	Route              string  `json:"route"`
+	ImageHash          *string `json:"image_hash"`
+	RedirectTo         *string `json:"redirect_to"`
+	ExpiresAt          *string `json:"expires_at"`
+	ContentDisposition *string `json:"content_disposition"`
+	DownloadFilename   *string `json:"download_filename"`
+}
+
+// input 转换为服务层参数，expires_at 为 RFC3339 时间，空字符串表示永不过期
+func (r routeRequest) input() (service.RouteInput, error) {
+	in := service.RouteInput{
+		ImageHash:          r.ImageHash,
+		RedirectTo:         r.RedirectTo,
+		ContentDisposition: r.ContentDisposition,
+		DownloadFilename:   r.DownloadFilename,
+	}
+	if r.ExpiresAt != nil {
+		var expiresAt time.Time
+		if raw := strings.TrimSpace(*r.ExpiresAt); raw != "" {
+			t, err := time.Parse(time.RFC3339, raw)
+			if err != nil {
+				return in, errors.New("expires_at must be an RFC3339 time")
+			}
+			expiresAt = t
+		}
+		in.ExpiresAt = &expiresAt
+	}
+	return in, nil
+}
+
+func writeRouteError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, service.ErrRouteNotFound):
+		response.WriteErrorCode(c, http.StatusNotFound, "route_not_found", "route not found")
+	case errors.Is(err, service.ErrInvalidRoute):
+		response.WriteErrorCode(c, http.StatusBadRequest, "invalid_route", err.Error())
+	case errors.Is(err, service.ErrRouteInUse):
+		response.WriteErrorCode(c, http.StatusConflict, "route_in_use", err.Error())
+	case containsDuplicateKey(err.Error()):
+		response.WriteErrorCode(c, http.StatusBadRequest, "route_exists", "route already exists")
+	default:
+		response.WriteErrorCode(c, http.StatusInternalServerError, "route_request_failed", "route request failed")
+	}
+}
+
+// POST /api/v1/routes
+// json: route、image_hash 或 redirect_to（二选一）、expires_at、content_disposition、download_filename
+func (h *ImageHandler) CreateRoute(c *gin.Context) {
+	var req routeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.WriteErrorCode(c, http.StatusBadRequest, "invalid_request", "invalid request body")
+		return
+	}
+	in, err := req.input()
+	if err != nil {
+		response.WriteErrorCode(c, http.StatusBadRequest, "invalid_route", err.Error())
+		return
+	}
+	route, err := h.svc.CreateRoute(req.Route, in)
+	if err != nil {
+		writeRouteError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, route)
+}
+
+// GET /api/v1/routes/:route
+func (h *ImageHandler) GetRoute(c *gin.Context) {
+	route, err := h.svc.GetRoute(c.Param("route"))
+	if err != nil {
+		writeRouteError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, route)
+}
+
+// PATCH /api/v1/routes/:route
+// 设置 image_hash 或 redirect_to 会原子地改指路由，原目标写入历史
+func (h *ImageHandler) UpdateRoute(c *gin.Context) {
+	var req routeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.WriteErrorCode(c, http.StatusBadRequest, "invalid_request", "invalid request body")
+		return
+	}
+	if req.Route != "" && req.Route != c.Param("route") {
+		response.WriteErrorCode(c, http.StatusBadRequest, "invalid_route", "route cannot be renamed")
+		return
+	}
+	in, err := req.input()
+	if err != nil {
+		response.WriteErrorCode(c, http.StatusBadRequest, "invalid_route", err.Error())
+		return
+	}
+	route, err := h.svc.UpdateRoute(c.Param("route"), in)
+	if err != nil {
+		writeRouteError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, route)
+}
+
+// GET /api/v1/routes/:route/history
+func (h *ImageHandler) ListRouteHistory(c *gin.Context) {
+	history, err := h.svc.ListRouteHistory(c.Param("route"))
+	if err != nil {
+		writeRouteError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": history})
+}
+
+// DELETE /api/v1/routes?prefix=
+// 删除命名空间前缀下的全部路由，prefix 不能为空
+func (h *ImageHandler) DeleteRoutesByPrefix(c *gin.Context) {
+	deleted, err := h.svc.DeleteRoutesByPrefix(c.Query("prefix"))
+	if err != nil {
+		writeRouteError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"deleted": deleted})
+}
@@ -0,0 +1,480 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/TangTangChu/AnzuImg/backend/internal/http/middleware"
+	"github.com/TangTangChu/AnzuImg/backend/internal/http/response"
+	"github.com/TangTangChu/AnzuImg/backend/internal/model"
+	"github.com/TangTangChu/AnzuImg/backend/internal/service"
+)
+
+// 访问者只能通过请求头提供分享密码，避免密码出现在代理与访问日志的 URL 中
+const sharePasswordHeader = "X-Share-Password"
+
+type shareRequest struct {
+	ImageHash *string `json:"image_hash"`
+	AlbumID   *uint64 `json:"album_id"`
+	Note      *string `json:"note"`
+	Password  *string `json:"password"`
+	ExpiresAt *string `json:"expires_at"`
+	MaxViews  *int64  `json:"max_views"`
+}
+
+// input 转换为服务层参数，expires_at 为 RFC3339 时间，空字符串表示永不过期
+func (r shareRequest) input() (service.ShareLinkInput, error) {
+	in := service.ShareLinkInput{
+		ImageHash: r.ImageHash,
+		AlbumID:   r.AlbumID,
+		Note:      r.Note,
+		Password:  r.Password,
+		MaxViews:  r.MaxViews,
+	}
+	if r.ExpiresAt != nil {
+		var expiresAt time.Time
+		if raw := strings.TrimSpace(*r.ExpiresAt); raw != "" {
+			t, err := time.Parse(time.RFC3339, raw)
+			if err != nil {
+				return in, errors.New("expires_at must be an RFC3339 time")
+			}
+			expiresAt = t
+		}
+		in.ExpiresAt = &expiresAt
+	}
+	return in, nil
+}
+
+// sharedImage 是公开相册列表中的图片，不包含存储路径与上传者等内部字段
+type sharedImage struct {
+	Hash            string    `json:"hash"`
+	FileName        string    `json:"file_name"`
+	MimeType        string    `json:"mime_type"`
+	Size            int64     `json:"size"`
+	Width           int       `json:"width"`
+	Height          int       `json:"height"`
+	DurationSeconds int       `json:"duration_seconds"`
+	Description     string    `json:"description"`
+	CreatedAt       time.Time `json:"created_at"`
+}
+
+func (h *ImageHandler) writeShareError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, service.ErrShareNotFound):
+		response.WriteErrorCode(c, http.StatusNotFound, "share_not_found", "share link not found")
+	case errors.Is(err, service.ErrAlbumNotFound):
+		response.WriteErrorCode(c, http.StatusBadRequest, "album_not_found", "album not found")
+	case errors.Is(err, service.ErrShareImageNotFound):
+		response.WriteErrorCode(c, http.StatusBadRequest, "image_not_found", err.Error())
+	case errors.Is(err, service.ErrInvalidShare):
+		response.WriteErrorCode(c, http.StatusBadRequest, "invalid_share", err.Error())
+	default:
+		response.WriteErrorCode(c, http.StatusInternalServerError, "share_request_failed", "share request failed")
+	}
+}
+
+// writeShareAccessError 输出公开访问被拒绝的原因
+func writeShareAccessError(c *gin.Context, err error) {
+	clearCacheHeaders(c)
+	c.Header("Cache-Control", shareCacheControl)
+	switch {
+	case errors.Is(err, service.ErrShareNotFound):
+		response.WriteErrorCode(c, http.StatusNotFound, "share_not_found", "share link not found")
+	case errors.Is(err, service.ErrShareRevoked):
+		response.WriteErrorCode(c, http.StatusGone, "share_revoked", "share link has been revoked")
+	case errors.Is(err, service.ErrShareExpired):
+		response.WriteErrorCode(c, http.StatusGone, "share_expired", "share link has expired")
+	case errors.Is(err, service.ErrShareExhausted):
+		response.WriteErrorCode(c, http.StatusGone, "share_exhausted", "share link view limit reached")
+	case errors.Is(err, service.ErrSharePasswordRequired):
+		response.WriteErrorCode(c, http.StatusUnauthorized, "share_password_required", "share link password required")
+	case errors.Is(err, service.ErrSharePasswordInvalid):
+		response.WriteErrorCode(c, http.StatusForbidden, "share_password_invalid", "share link password invalid")
+	case errors.Is(err, service.ErrShareLocked):
+		response.WriteErrorCode(c, http.StatusTooManyRequests, "too_many_share_attempts", "too many share password attempts")
+	default:
+		response.WriteErrorCode(c, http.StatusInternalServerError, "share_request_failed", "share request failed")
+	}
+}
+
+func shareIDParam(c *gin.Context) (uint64, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil || id == 0 {
+		response.WriteErrorCode(c, http.StatusNotFound, "share_not_found", "share link not found")
+		return 0, false
+	}
+	return id, true
+}
+
+// rangeCountsAsView 判断请求是否计入分享访问次数：没有 Range、从第 0 字节开始、
+// 后缀范围不短于整个对象或无法解析的请求都计入，只有从中间开始的分段请求不计
+func rangeCountsAsView(header string, size int64) bool {
+	spec, ok := strings.CutPrefix(strings.TrimSpace(header), "bytes=")
+	if !ok {
+		return true
+	}
+	for _, part := range strings.Split(spec, ",") {
+		start, end, found := strings.Cut(strings.TrimSpace(part), "-")
+		if !found {
+			return true
+		}
+		start, end = strings.TrimSpace(start), strings.TrimSpace(end)
+		if start == "" {
+			n, err := strconv.ParseInt(end, 10, 64)
+			if err != nil || size <= 0 || n >= size {
+				return true
+			}
+			continue
+		}
+		n, err := strconv.ParseInt(start, 10, 64)
+		if err != nil || n <= 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// openShare 校验分享链接，countView 返回 true 时占用一次访问次数，为 nil 表示不计次数。
+// 计次访问与所有被拒绝的访问都会写入访问日志；返回 false 时已写入错误响应。
+func (h *ImageHandler) openShare(c *gin.Context, countView func(*model.ShareLink) bool) (*model.ShareLink, bool) {
+	link, err := h.svc.OpenShareLink(c.Param("token"), c.GetHeader(sharePasswordHeader), middleware.ClientIP(c))
+	counted := false
+	if err == nil && countView != nil && countView(link) {
+		counted = true
+		err = h.svc.CountShareView(link)
+	}
+	if link != nil && (err != nil || counted) {
+		// 路径不含查询参数，避免把密码写进日志
+		h.svc.RecordShareAccess(&model.ShareLinkAccess{
+			ShareLinkID: link.ID,
+			Path:        c.Request.URL.Path,
+			IPAddress:   middleware.ClientIP(c),
+			UserAgent:   c.Request.UserAgent(),
+			Result:      service.ShareAccessResult(err),
+		})
+	}
+	if err != nil {
+		writeShareAccessError(c, err)
+		return nil, false
+	}
+	return link, true
+}
+
+// GET /s/:token
+// 图片分享直接输出图片，支持与 /i/:hash 相同的变换参数；相册分享返回相册信息与图片列表（page、page_size）。
+// 相册只有第一页计入访问次数。
+func (h *ImageHandler) GetShare(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "50"))
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 || pageSize > 100 {
+		pageSize = 50
+	}
+	transform, err := service.ParseTransformOptions(c.Request.URL.Query())
+	if err != nil {
+		response.WriteErrorCode(c, http.StatusBadRequest, "invalid_transform", err.Error())
+		return
+	}
+
+	// 视频播放会分段请求，只有从中间开始的原始视频分段不计入次数
+	link, ok := h.openShare(c, func(l *model.ShareLink) bool {
+		if l.AlbumID != nil {
+			return page == 1
+		}
+		if transform != nil || !service.IsVideoFile(l.ImageMimeType) {
+			return true
+		}
+		return rangeCountsAsView(c.GetHeader("Range"), l.ImageSize)
+	})
+	if !ok {
+		return
+	}
+	if link.ImageID != nil {
+		h.serveSharedImage(c, link.ImageHash, transform)
+		return
+	}
+
+	album, err := h.svc.GetAlbum(*link.AlbumID)
+	if err != nil {
+		writeShareAccessError(c, service.ErrShareNotFound)
+		return
+	}
+	images, total, err := h.svc.ListAlbumImages(album.ID, page, pageSize, "", "")
+	if err != nil {
+		writeShareAccessError(c, err)
+		return
+	}
+	data := make([]sharedImage, 0, len(images))
+	for _, img := range images {
+		data = append(data, sharedImage{
+			Hash:            img.Hash,
+			FileName:        img.FileName,
+			MimeType:        img.MimeType,
+			Size:            img.Size,
+			Width:           img.Width,
+			Height:          img.Height,
+			DurationSeconds: img.DurationSeconds,
+			Description:     img.Description,
+			CreatedAt:       img.CreatedAt,
+		})
+	}
+	c.Header("Cache-Control", shareCacheControl)
+	c.JSON(http.StatusOK, gin.H{
+		"album": gin.H{
+			"title":       album.Title,
+			"description": album.Description,
+			"cover_hash":  album.CoverHash,
+			"image_count": album.ImageCount,
+		},
+		"expires_at": link.ExpiresAt,
+		"data":       data,
+		"total":      total,
+		"page":       page,
+		"size":       pageSize,
+	})
+}
+
+// GET /s/:token/thumbnail
+// 图片分享输出该图片的缩略图，相册分享输出封面缩略图，不计入访问次数
+func (h *ImageHandler) GetShareThumbnail(c *gin.Context) {
+	link, ok := h.openShare(c, nil)
+	if !ok {
+		return
+	}
+	hash := link.ImageHash
+	if link.AlbumID != nil {
+		album, err := h.svc.GetAlbum(*link.AlbumID)
+		if err != nil || album.CoverHash == "" {
+			response.WriteErrorCode(c, http.StatusNotFound, "thumbnail_not_found", "thumbnail not found")
+			return
+		}
+		hash = album.CoverHash
+	}
+	h.serveThumbnail(c, hash, shareCacheControl)
+}
+
+// GET /s/:token/images/:hash
+// 相册分享中的单张图片，不计入访问次数
+func (h *ImageHandler) GetSharedImage(c *gin.Context) {
+	transform, err := service.ParseTransformOptions(c.Request.URL.Query())
+	if err != nil {
+		response.WriteErrorCode(c, http.StatusBadRequest, "invalid_transform", err.Error())
+		return
+	}
+	link, ok := h.openShare(c, nil)
+	if !ok {
+		return
+	}
+	hash, err := h.svc.SharedImageHash(link, c.Param("hash"))
+	if err != nil {
+		response.WriteErrorCode(c, http.StatusNotFound, "image_not_found", "image not found")
+		return
+	}
+	h.serveSharedImage(c, hash, transform)
+}
+
+// GET /s/:token/images/:hash/thumbnail
+func (h *ImageHandler) GetSharedImageThumbnail(c *gin.Context) {
+	link, ok := h.openShare(c, nil)
+	if !ok {
+		return
+	}
+	hash, err := h.svc.SharedImageHash(link, c.Param("hash"))
+	if err != nil {
+		response.WriteErrorCode(c, http.StatusNotFound, "thumbnail_not_found", "thumbnail not found")
+		return
+	}
+	h.serveThumbnail(c, hash, shareCacheControl)
+}
+
+func (h *ImageHandler) serveSharedImage(c *gin.Context, hash string, transform *service.TransformOptions) {
+	img, loc, err := h.svc.ResolveByHash(c.Request.Context(), hash)
+	if err != nil {
+		response.WriteErrorCode(c, http.StatusNotFound, "image_not_found", "image not found")
+		return
+	}
+	h.serveImage(c, img, loc, transform, shareCacheControl)
+}
+
+// GET /api/v1/shares?image_hash=&album_id=&page=&page_size=，带 cursor 时使用游标分页
+func (h *ImageHandler) ListShares(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 || pageSize > 100 {
+		pageSize = 20
+	}
+	filter := service.ShareLinkFilter{ImageHash: strings.TrimSpace(c.Query("image_hash"))}
+	if raw := strings.TrimSpace(c.Query("album_id")); raw != "" {
+		albumID, err := strconv.ParseUint(raw, 10, 64)
+		if err != nil {
+			response.WriteErrorCode(c, http.StatusBadRequest, "invalid_request", "invalid album_id")
+			return
+		}
+		filter.AlbumID = albumID
+	}
+
+	cursor, useCursor, ok := cursorParam(c)
+	if !ok {
+		return
+	}
+	if useCursor {
+		result, err := h.svc.ListShareLinksByCursor(filter, cursor, pageSize)
+		if err != nil {
+			h.writeShareError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, result)
+		return
+	}
+
+	links, total, err := h.svc.ListShareLinks(filter, page, pageSize)
+	if err != nil {
+		h.writeShareError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"data":  links,
+		"total": total,
+		"page":  page,
+		"size":  pageSize,
+	})
+}
+
+// POST /api/v1/shares
+// json: image_hash 与 album_id 二选一，note、password、expires_at、max_views 可选
+func (h *ImageHandler) CreateShare(c *gin.Context) {
+	var req shareRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.WriteErrorCode(c, http.StatusBadRequest, "invalid_request", "invalid request body")
+		return
+	}
+	in, err := req.input()
+	if err != nil {
+		response.WriteErrorCode(c, http.StatusBadRequest, "invalid_share", err.Error())
+		return
+	}
+	link, err := h.svc.CreateShareLink(in)
+	if err != nil {
+		h.writeShareError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, link)
+}
+
+// GET /api/v1/shares/:id
+func (h *ImageHandler) GetShareLink(c *gin.Context) {
+	id, ok := shareIDParam(c)
+	if !ok {
+		return
+	}
+	link, err := h.svc.GetShareLink(id)
+	if err != nil {
+		h.writeShareError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, link)
+}
+
+// PATCH /api/v1/shares/:id
+// json: 只修改出现的字段，password 或 expires_at 传空字符串表示取消，max_views 传 0 表示不限
+func (h *ImageHandler) UpdateShare(c *gin.Context) {
+	id, ok := shareIDParam(c)
+	if !ok {
+		return
+	}
+	var req shareRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.WriteErrorCode(c, http.StatusBadRequest, "invalid_request", "invalid request body")
+		return
+	}
+	in, err := req.input()
+	if err != nil {
+		response.WriteErrorCode(c, http.StatusBadRequest, "invalid_share", err.Error())
+		return
+	}
+	link, err := h.svc.UpdateShareLink(id, in)
+	if err != nil {
+		h.writeShareError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, link)
+}
+
+// POST /api/v1/shares/:id/revoke
+func (h *ImageHandler) RevokeShare(c *gin.Context) {
+	id, ok := shareIDParam(c)
+	if !ok {
+		return
+	}
+	link, err := h.svc.RevokeShareLink(id)
+	if err != nil {
+		h.writeShareError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, link)
+}
+
+// DELETE /api/v1/shares/:id
+func (h *ImageHandler) DeleteShare(c *gin.Context) {
+	id, ok := shareIDParam(c)
+	if !ok {
+		return
+	}
+	if err := h.svc.DeleteShareLink(id); err != nil {
+		h.writeShareError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// GET /api/v1/shares/:id/accesses?page=&page_size=，带 cursor 时使用游标分页
+func (h *ImageHandler) ListShareAccesses(c *gin.Context) {
+	id, ok := shareIDParam(c)
+	if !ok {
+		return
+	}
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 || pageSize > 100 {
+		pageSize = 20
+	}
+
+	cursor, useCursor, ok := cursorParam(c)
+	if !ok {
+		return
+	}
+	if useCursor {
+		result, err := h.svc.ListShareAccessesByCursor(id, cursor, pageSize)
+		if err != nil {
+			h.writeShareError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, result)
+		return
+	}
+
+	accesses, total, err := h.svc.ListShareAccesses(id, page, pageSize)
+	if err != nil {
+		h.writeShareError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"data":  accesses,
+		"total": total,
+		"page":  page,
+		"size":  pageSize,
+	})
+}
@@ -0,0 +1,31 @@
+package handler
+
+import "testing"
+
+func TestRangeCountsAsView(t *testing.T) {
+	const size = 1000
+	cases := []struct {
+		header string
+		want   bool
+	}{
+		{"", true},
+		{"bytes=0-", true},
+		{"bytes=0-99", true},
+		{"bytes=-1000", true},
+		{"bytes=-999999999", true},
+		{"bytes=500-, 0-10", true},
+		{"bytes=abc", true},
+		{"items=500-", true},
+		{"bytes=500-", false},
+		{"bytes=500-599", false},
+		{"bytes=-100", false},
+	}
+	for _, tc := range cases {
+		if got := rangeCountsAsView(tc.header, size); got != tc.want {
+			t.Fatalf("%q: expected %v, got %v", tc.header, tc.want, got)
+		}
+	}
+	if !rangeCountsAsView("bytes=-100", 0) {
+		t.Fatal("suffix range on unknown size should count")
+	}
+}
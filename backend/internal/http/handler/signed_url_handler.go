@@ -0,0 +1,44 @@
+package handler
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"github.com/TangTangChu/AnzuImg/backend/internal/http/response"
+	"github.com/TangTangChu/AnzuImg/backend/internal/service"
+)
+
+type signedURLRequest struct {
+	TTLSeconds int64 `json:"ttl_seconds"`
+}
+
+// POST /api/v1/images/:hash/signed-url
+// json: ttl_seconds 可选，默认 3600，不能超过 ANZUIMG_SIGNED_URL_MAX_TTL_SEC
+func (h *ImageHandler) CreateSignedURL(c *gin.Context) {
+	var req signedURLRequest
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		response.WriteErrorCode(c, http.StatusBadRequest, "invalid_request", "invalid request body")
+		return
+	}
+
+	signed, err := h.svc.SignImageURL(c.Param("hash"), time.Duration(req.TTLSeconds)*time.Second)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrSignedURLNotConfigured):
+			response.WriteErrorCode(c, http.StatusServiceUnavailable, "signed_url_not_configured", "signed url secret is not configured")
+		case errors.Is(err, service.ErrInvalidSignedURLTTL):
+			response.WriteErrorCode(c, http.StatusBadRequest, "invalid_ttl", err.Error())
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			response.WriteErrorCode(c, http.StatusNotFound, "image_not_found", "image not found")
+		default:
+			response.WriteErrorCode(c, http.StatusInternalServerError, "sign_url_failed", "failed to sign url")
+		}
+		return
+	}
+	c.JSON(http.StatusOK, signed)
+}
@@ -0,0 +1,107 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/TangTangChu/AnzuImg/backend/internal/http/response"
+	"github.com/TangTangChu/AnzuImg/backend/internal/service"
+)
+
+// 单次预检最多包含的哈希数量
+const maxHashCheckItems = 100
+
+type hashCheckItem struct {
+	Hash        string   `json:"hash"`
+	Size        int64    `json:"size"`
+	Routes      []string `json:"routes"`
+	Tags        []string `json:"tags"`
+	Description string   `json:"description"`
+	ClientIndex *int     `json:"client_index"`
+}
+
+type hashCheckRequest struct {
+	Items []hashCheckItem `json:"items"`
+}
+
+// existingUploadResult 是预检命中已有内容时的结果，字段与上传结果一致
+type existingUploadResult struct {
+	clientUploadResult
+	Exists bool `json:"exists"`
+}
+
+// POST /api/v1/images/check
+// json: items=[{hash, size<optional>, routes<optional>, tags<optional>, description<optional>, client_index<optional>}]
+// 已存在的内容视为一次复用上传：附加路由、标签与描述，并与上传接口一样记录 Token 日志
+func (h *ImageHandler) CheckHashes(c *gin.Context) {
+	var req hashCheckRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.WriteErrorCode(c, http.StatusBadRequest, "invalid_request", "invalid request body")
+		return
+	}
+	if len(req.Items) == 0 {
+		response.WriteErrorCode(c, http.StatusBadRequest, "hash_required", "at least one hash is required")
+		return
+	}
+	if len(req.Items) > maxHashCheckItems {
+		response.WriteErrorCode(c, http.StatusBadRequest, "too_many_items", "too many hashes")
+		return
+	}
+
+	token := uploaderTokenFromContext(c)
+	results := make([]any, 0, len(req.Items))
+	for i, item := range req.Items {
+		clientIndex := i
+		if item.ClientIndex != nil && *item.ClientIndex >= 0 {
+			clientIndex = *item.ClientIndex
+		}
+
+		hash, ok := service.NormalizeContentHash(item.Hash)
+		if !ok {
+			results = append(results, gin.H{
+				"client_index": clientIndex,
+				"hash":         item.Hash,
+				"exists":       false,
+				"success":      false,
+				"code":         "invalid_hash",
+				"message":      "hash must be a hex encoded sha-256",
+			})
+			continue
+		}
+
+		res, err := h.svc.UploadExisting(c.Request.Context(), service.ExistingUploadInput{
+			Hash:        hash,
+			Size:        item.Size,
+			Routes:      trimNonEmpty(item.Routes),
+			Tags:        trimNonEmpty(item.Tags),
+			Description: item.Description,
+		})
+		if err != nil {
+			results = append(results, gin.H{
+				"client_index": clientIndex,
+				"hash":         hash,
+				"success":      false,
+				"code":         "attach_failed",
+				"message":      "failed to attach metadata",
+			})
+			continue
+		}
+		if res == nil {
+			results = append(results, gin.H{
+				"client_index": clientIndex,
+				"hash":         hash,
+				"exists":       false,
+			})
+			continue
+		}
+
+		h.recordUploadLog(c, token, res.Image.Hash)
+		results = append(results, existingUploadResult{
+			clientUploadResult: clientUploadResult{ClientIndex: clientIndex, UploadResponse: res.Response()},
+			Exists:             true,
+		})
+	}
+
+	c.JSON(http.StatusOK, results)
+}
@@ -0,0 +1,256 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/TangTangChu/AnzuImg/backend/internal/http/response"
+	"github.com/TangTangChu/AnzuImg/backend/internal/model"
+	"github.com/TangTangChu/AnzuImg/backend/internal/service"
+)
+
+const maxUploadTaskBatchSize = 100
+
+type batchUploadTasksRequest struct {
+	IDs []string `json:"ids"`
+}
+
+func (h *ImageHandler) writeUploadTaskError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, service.ErrUploadTaskNotFound):
+		response.WriteErrorCode(c, http.StatusNotFound, "task_not_found", "task not found")
+	case errors.Is(err, service.ErrUploadTaskNotCancellable):
+		response.WriteErrorCode(c, http.StatusConflict, "task_not_cancellable", err.Error())
+	case errors.Is(err, service.ErrUploadTaskNotRetryable):
+		response.WriteErrorCode(c, http.StatusConflict, "task_not_retryable", err.Error())
+	case errors.Is(err, service.ErrUploadTaskInputMissing):
+		response.WriteErrorCode(c, http.StatusConflict, "task_input_missing", err.Error())
+	default:
+		response.WriteErrorCode(c, http.StatusInternalServerError, "upload_task_failed", "upload task request failed")
+	}
+}
+
+// GET /api/v1/images/tasks?status=&start_date=&end_date=&page=&page_size=
+// 令牌只能看到自己创建的任务
+func (h *ImageHandler) ListUploadTasks(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 || pageSize > 100 {
+		pageSize = 20
+	}
+
+	filter := service.UploadTaskFilter{
+		Status:    c.Query("status"),
+		StartDate: c.Query("start_date"),
+		EndDate:   c.Query("end_date"),
+	}
+	tasks, total, err := h.svc.ListUploadTasks(filter, uploaderTokenID(uploaderTokenFromContext(c)), page, pageSize)
+	if err != nil {
+		response.WriteErrorCode(c, http.StatusInternalServerError, "list_upload_tasks_failed", "failed to list upload tasks")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":  tasks,
+		"total": total,
+		"page":  page,
+		"size":  pageSize,
+	})
+}
+
+// POST /api/v1/images/tasks/batch
+// json: ids 最多 100 个；不存在或无权访问的 ID 列在 missing 中
+func (h *ImageHandler) BatchGetUploadTasks(c *gin.Context) {
+	var req batchUploadTasksRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.WriteErrorCode(c, http.StatusBadRequest, "invalid_request", "invalid request body")
+		return
+	}
+	ids := trimNonEmpty(req.IDs)
+	if len(ids) == 0 {
+		response.WriteErrorCode(c, http.StatusBadRequest, "task_id_required", "ids is required")
+		return
+	}
+	if len(ids) > maxUploadTaskBatchSize {
+		response.WriteErrorCode(c, http.StatusBadRequest, "too_many_tasks", "at most 100 ids per request")
+		return
+	}
+
+	tasks, err := h.svc.GetUploadTasks(ids, uploaderTokenID(uploaderTokenFromContext(c)))
+	if err != nil {
+		response.WriteErrorCode(c, http.StatusInternalServerError, "get_upload_task_failed", "failed to get upload tasks")
+		return
+	}
+
+	// 按请求顺序返回，重复的 ID 只返回一次
+	byID := make(map[string]model.UploadTask, len(tasks))
+	for _, task := range tasks {
+		byID[task.ID] = task
+	}
+	data := make([]model.UploadTask, 0, len(tasks))
+	missing := make([]string, 0)
+	seen := make(map[string]struct{}, len(ids))
+	for _, id := range ids {
+		if _, dup := seen[id]; dup {
+			continue
+		}
+		seen[id] = struct{}{}
+		if task, ok := byID[id]; ok {
+			data = append(data, task)
+		} else {
+			missing = append(missing, id)
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{"data": data, "missing": missing})
+}
+
+// POST /api/v1/images/tasks/:id/cancel
+// 只能取消尚未开始执行的 pending 任务
+func (h *ImageHandler) CancelUploadTask(c *gin.Context) {
+	task, err := h.svc.CancelUploadTask(strings.TrimSpace(c.Param("id")), uploaderTokenID(uploaderTokenFromContext(c)))
+	if err != nil {
+		h.writeUploadTaskError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, task)
+}
+
+// POST /api/v1/images/tasks/:id/retry
+// 失败的任务重新排队，执行次数重新计算
+func (h *ImageHandler) RetryUploadTask(c *gin.Context) {
+	task, err := h.svc.RetryUploadTask(strings.TrimSpace(c.Param("id")), uploaderTokenID(uploaderTokenFromContext(c)))
+	if err != nil {
+		h.writeUploadTaskError(c, err)
+		return
+	}
+	c.JSON(http.StatusAccepted, task)
+}
+
+// GET /api/v1/images/tasks/stream?ids=<optional, comma separated>
+// SSE 推送任务状态与阶段变化。指定 ids 时先推送这些任务的当前状态，并定期从数据库补齐
+// 由其他实例执行的任务，全部任务结束后关闭连接；未指定时推送本实例上所有可见任务的变化。
+func (h *ImageHandler) StreamUploadTasks(c *gin.Context) {
+	tokenID := uploaderTokenID(uploaderTokenFromContext(c))
+	ids := trimNonEmpty(strings.Split(c.Query("ids"), ","))
+	if len(ids) > maxUploadTaskBatchSize {
+		response.WriteErrorCode(c, http.StatusBadRequest, "too_many_tasks", "at most 100 ids per request")
+		return
+	}
+
+	flusher, ok := c.Writer.(http.Flusher)
+	if !ok {
+		response.WriteErrorCode(c, http.StatusInternalServerError, "stream_unavailable", "streaming not supported")
+		return
+	}
+
+	filter := service.UploadTaskStreamFilter{TokenID: tokenID}
+	if len(ids) > 0 {
+		filter.IDs = make(map[string]struct{}, len(ids))
+		for _, id := range ids {
+			filter.IDs[id] = struct{}{}
+		}
+	}
+	// 先订阅再读取当前状态，避免错过两者之间的变化
+	sub := h.svc.TaskHub().Subscribe(filter, 128)
+	defer sub.Close()
+
+	c.Writer.Header().Set("Content-Type", "text/event-stream")
+	c.Writer.Header().Set("Cache-Control", "no-cache")
+	c.Writer.Header().Set("Connection", "keep-alive")
+	c.Writer.Header().Set("X-Accel-Buffering", "no")
+	c.Writer.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	// 同一状态只推送一次；watching 为仍需等待结束的任务
+	sent := make(map[string]string)
+	watching := make(map[string]struct{}, len(filter.IDs))
+	send := func(task model.UploadTask) {
+		version := fmt.Sprintf("%s/%s/%d", task.Status, task.Stage, task.Attempts)
+		if sent[task.ID] == version {
+			return
+		}
+		sent[task.ID] = version
+		if service.IsUploadTaskFinished(task.Status) {
+			delete(watching, task.ID)
+		}
+		payload, err := json.Marshal(task)
+		if err != nil {
+			return
+		}
+		_, _ = fmt.Fprintf(c.Writer, "event: upload_task\ndata: %s\n\n", payload)
+		flusher.Flush()
+	}
+	poll := func() {
+		if len(watching) == 0 {
+			return
+		}
+		pending := make([]string, 0, len(watching))
+		for id := range watching {
+			pending = append(pending, id)
+		}
+		tasks, err := h.svc.GetUploadTasks(pending, tokenID)
+		if err != nil {
+			return
+		}
+		for _, task := range tasks {
+			send(task)
+		}
+	}
+
+	if len(ids) > 0 {
+		tasks, err := h.svc.GetUploadTasks(ids, tokenID)
+		if err != nil {
+			return
+		}
+		// 不存在或无权访问的任务不再等待
+		for _, task := range tasks {
+			watching[task.ID] = struct{}{}
+		}
+		for _, task := range tasks {
+			send(task)
+		}
+		if len(watching) == 0 {
+			return
+		}
+	}
+
+	heartbeat := time.NewTicker(20 * time.Second)
+	defer heartbeat.Stop()
+	var pollC <-chan time.Time
+	if len(ids) > 0 {
+		pollTicker := time.NewTicker(5 * time.Second)
+		defer pollTicker.Stop()
+		pollC = pollTicker.C
+	}
+
+	ctx := c.Request.Context()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case task, ok := <-sub.Ch:
+			if !ok {
+				return
+			}
+			send(task)
+		case <-pollC:
+			poll()
+		case <-heartbeat.C:
+			_, _ = fmt.Fprint(c.Writer, ":heartbeat\n\n")
+			flusher.Flush()
+		}
+		if len(ids) > 0 && len(watching) == 0 {
+			return
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"github.com/TangTangChu/AnzuImg/backend/internal/http/response"
+	"github.com/TangTangChu/AnzuImg/backend/internal/model"
+	"github.com/TangTangChu/AnzuImg/backend/internal/service"
+)
+
+// PrivateImageKey 标记当前请求访问的是已通过签名校验的私有媒体
+const PrivateImageKey = "private_image"
+
+// SignedImageAccess 按 :hash 或 *route 查找媒体可见性，私有媒体必须携带有效的 expires 与 signature 参数，
+// 缩略图与按需变换同样适用。媒体不存在时放行，由处理函数返回 404。
+func SignedImageAccess(svc *service.ImageService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		route := strings.TrimPrefix(c.Param("route"), "/")
+		hash, visibility, err := svc.LookupVisibility(c.Request.Context(), c.Param("hash"), route)
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				c.Next()
+				return
+			}
+			response.AbortErrorCode(c, http.StatusServiceUnavailable, "image_lookup_failed", "image lookup failed")
+			return
+		}
+
+		switch visibility {
+		case model.VisibilityPrivate:
+			err := svc.VerifyImageSignature(hash, c.Query("expires"), c.Query("signature"), time.Now())
+			switch {
+			case errors.Is(err, service.ErrSignatureRequired):
+				response.AbortErrorCode(c, http.StatusForbidden, "signature_required", "signed url required")
+				return
+			case errors.Is(err, service.ErrSignatureExpired):
+				response.AbortErrorCode(c, http.StatusForbidden, "signature_expired", "signed url expired")
+				return
+			case err != nil:
+				response.AbortErrorCode(c, http.StatusForbidden, "signature_invalid", "invalid signature")
+				return
+			}
+			c.Set(PrivateImageKey, true)
+			c.Header("X-Robots-Tag", "noindex, nofollow")
+		case model.VisibilityUnlisted:
+			c.Header("X-Robots-Tag", "noindex, nofollow")
+		}
+		c.Next()
+	}
+}
+
+// IsPrivateImage 判断当前请求是否访问私有媒体，私有媒体的响应不应被共享缓存保存
+func IsPrivateImage(c *gin.Context) bool {
+	return c.GetBool(PrivateImageKey)
+}
@@ -15,12 +15,14 @@ import (
 	"github.com/TangTangChu/AnzuImg/backend/internal/service"
 )
 
-func NewRouter(cfg *config.Config, db *gorm.DB, settings *service.SettingsService, hub *service.LogStreamHub) (*gin.Engine, error) {
+func NewRouter(cfg *config.Config, db *gorm.DB, settings *service.SettingsService, hub *service.LogStreamHub, maint *service.MaintenanceService) (*gin.Engine, error) {
 	resolver, err := clientip.NewResolver(cfg.TrustedProxies, cfg.ClientIPHeaders, cfg.ClientIPXFFStrategy)
 	if err != nil {
 		return nil, fmt.Errorf("init client ip resolver failed: %w", err)
 	}
 	r := gin.New()
+	// 按原始路径匹配，管理接口中以 %2F 转义的多级路由仍作为单个参数
+	r.UseRawPath = true
 
 	originsFn := func() []string { return cfg.Effective().AllowedOrigins }
 	cspExtraFn := func() string { return cfg.Effective().CSPExtra }
@@ -44,12 +46,21 @@ func NewRouter(cfg *config.Config, db *gorm.DB, settings *service.SettingsServic
 	apiTokenH := handler.NewAPITokenHandler(cfg, db)
 	settingsH := handler.NewSettingsHandler(cfg, db, settings)
 	logH := handler.NewLogHandler(cfg, db, hub)
+	maintH := handler.NewMaintenanceHandler(db, maint)
+
+	// worker 数随设置热更新
+	settings.OnReload(imageH.ApplyWorkerSettings)
+	// 缩略图维护任务与上传共用同一个缩略图 worker 池
+	maint.UseThumbnailPool(imageH.ThumbnailPool())
 
 	registerHealthRoutes(r, healthH)
 	registerPublicImageRoutes(r, imageH)
-	registerAuthRoutes(r, cfg, authH, apiTokenH, settingsH, logH, originsFn, adminAllowlistFn, stepUpAgeFn)
+	registerPublicShareRoutes(r, imageH)
+	registerAuthRoutes(r, cfg, authH, apiTokenH, settingsH, logH, maintH, originsFn, adminAllowlistFn, stepUpAgeFn)
 	registerAPIRoutes(r, cfg, healthH, imageH, authH, originsFn)
 
+	maint.ResumeStale()
+
 	return r, nil
 }
 
@@ -61,10 +72,28 @@ func registerPublicImageRoutes(r *gin.Engine, h *handler.ImageHandler) {
 	imageRoutes := r.Group("/i")
 	imageRoutes.Use(middleware.ImageCORS())
 	imageRoutes.Use(middleware.ImageSecurityHeaders())
+	imageRoutes.Use(middleware.SignedImageAccess(h.Service()))
 	{
 		imageRoutes.GET("/:hash", h.GetByHash)
 		imageRoutes.GET("/:hash/thumbnail", h.GetThumbnailByHash)
-		imageRoutes.GET("/r/:route", h.GetByRoute)
+		imageRoutes.GET("/r/*route", h.GetByRoute)
+	}
+}
+
+// registerPublicShareRoutes 注册分享链接的公开访问路由，有效性与密码由处理函数校验
+func registerPublicShareRoutes(r *gin.Engine, h *handler.ImageHandler) {
+	shareRoutes := r.Group("/s")
+	shareRoutes.Use(middleware.ShareCORS())
+	shareRoutes.Use(middleware.ImageSecurityHeaders())
+	{
+		shareRoutes.GET("/:token", h.GetShare)
+		shareRoutes.GET("/:token/thumbnail", h.GetShareThumbnail)
+		shareRoutes.GET("/:token/images/:hash", h.GetSharedImage)
+		shareRoutes.GET("/:token/images/:hash/thumbnail", h.GetSharedImageThumbnail)
+		shareRoutes.OPTIONS("/:token", func(c *gin.Context) { c.Status(204) })
+		shareRoutes.OPTIONS("/:token/thumbnail", func(c *gin.Context) { c.Status(204) })
+		shareRoutes.OPTIONS("/:token/images/:hash", func(c *gin.Context) { c.Status(204) })
+		shareRoutes.OPTIONS("/:token/images/:hash/thumbnail", func(c *gin.Context) { c.Status(204) })
 	}
 }
 
@@ -75,6 +104,7 @@ func registerAuthRoutes(
 	tokenH *handler.APITokenHandler,
 	settingsH *handler.SettingsHandler,
 	logH *handler.LogHandler,
+	maintH *handler.MaintenanceHandler,
 	originsFn func() []string,
 	adminAllowlistFn func() []string,
 	stepUpAgeFn func() time.Duration,
@@ -157,6 +187,25 @@ func registerAuthRoutes(
 		logsGrp.DELETE("/:source", stepUp, logH.Cleanup)
 		logsGrp.POST("/:source/cleanup", stepUp, logH.Cleanup)
 	}
+
+	maintGrp := r.Group(apiPrefix+"/maintenance",
+		middleware.CORS(originsFn),
+		middleware.Session(cfg, h.DB()),
+		middleware.RequireSession(),
+		middleware.AdminIPAllowlist(adminAllowlistFn),
+	)
+	{
+		maintGrp.OPTIONS("/*path", func(c *gin.Context) { c.Status(204) })
+		maintGrp.GET("/jobs", maintH.ListJobs)
+		maintGrp.GET("/jobs/:id", maintH.GetJob)
+		maintGrp.GET("/jobs/:id/findings", maintH.ListScrubFindings)
+		maintGrp.POST("/jobs/storage-migration", stepUp, maintH.CreateStorageMigration)
+		maintGrp.POST("/jobs/storage-scrub", stepUp, maintH.CreateStorageScrub)
+		maintGrp.POST("/jobs/thumbnail-backfill", stepUp, maintH.CreateThumbnailBackfill)
+		maintGrp.POST("/jobs/thumbnail-regenerate", stepUp, maintH.CreateThumbnailRegenerate)
+		maintGrp.POST("/jobs/:id/resume", stepUp, maintH.ResumeJob)
+		maintGrp.POST("/jobs/:id/cancel", stepUp, maintH.CancelJob)
+	}
 }
 
 func registerAPIRoutes(r *gin.Engine, cfg *config.Config, hh *handler.HealthHandler, ih *handler.ImageHandler, ah *handler.AuthHandler, originsFn func() []string) {
@@ -166,26 +215,90 @@ func registerAPIRoutes(r *gin.Engine, cfg *config.Config, hh *handler.HealthHand
 		api.GET("/ping", middleware.RequireTokenType(model.TokenTypeFull), hh.Ping)
 		api.POST("/images", middleware.RequireTokenScopes(model.ScopeImagesUpload), ih.Upload)
 		api.POST("/images/tasks", middleware.RequireTokenScopes(model.ScopeImagesUpload), ih.UploadTask)
+		api.GET("/images/tasks", middleware.RequireTokenScopes(model.ScopeImagesUpload), ih.ListUploadTasks)
+		api.POST("/images/tasks/batch", middleware.RequireTokenScopes(model.ScopeImagesUpload), ih.BatchGetUploadTasks)
+		api.GET("/images/tasks/stream", middleware.RequireTokenScopes(model.ScopeImagesUpload), ih.StreamUploadTasks)
 		api.GET("/images/tasks/:id", middleware.RequireTokenScopes(model.ScopeImagesUpload), ih.GetUploadTask)
+		api.POST("/images/tasks/:id/cancel", middleware.RequireTokenScopes(model.ScopeImagesUpload), ih.CancelUploadTask)
+		api.POST("/images/tasks/:id/retry", middleware.RequireTokenScopes(model.ScopeImagesUpload), ih.RetryUploadTask)
+		api.GET("/images/tasks/:id/deliveries", middleware.RequireTokenScopes(model.ScopeImagesUpload), ih.ListUploadTaskDeliveries)
+		api.POST("/images/check", middleware.RequireTokenScopes(model.ScopeImagesUpload), ih.CheckHashes)
+		api.POST("/images/uploads", middleware.RequireTokenScopes(model.ScopeImagesUpload), ih.CreateResumableUpload)
+		api.HEAD("/images/uploads/:id", middleware.RequireTokenScopes(model.ScopeImagesUpload), ih.GetResumableUpload)
+		api.GET("/images/uploads/:id", middleware.RequireTokenScopes(model.ScopeImagesUpload), ih.GetResumableUpload)
+		api.PATCH("/images/uploads/:id", middleware.RequireTokenScopes(model.ScopeImagesUpload), ih.PatchResumableUpload)
+		api.POST("/images/uploads/:id/complete", middleware.RequireTokenScopes(model.ScopeImagesUpload), ih.CompleteResumableUpload)
+		api.DELETE("/images/uploads/:id", middleware.RequireTokenScopes(model.ScopeImagesUpload), ih.AbortResumableUpload)
 		api.GET("/images", middleware.RequireTokenScopes(model.ScopeImagesList), ih.List)
+		api.GET("/images/search", middleware.RequireTokenScopes(model.ScopeImagesList), ih.Search)
 		api.GET("/tags", middleware.RequireTokenType(model.TokenTypeFull), ih.ListTags)
 		api.GET("/images/:hash/info", middleware.RequireTokenType(model.TokenTypeFull), ih.GetInfo)
 		api.DELETE("/images/:hash", middleware.RequireTokenType(model.TokenTypeFull), ih.Delete)
 		api.POST("/images/:hash/delete", middleware.RequireTokenType(model.TokenTypeFull), ih.Delete)
 		api.PATCH("/images/:hash", middleware.RequireTokenType(model.TokenTypeFull), ih.Update)
+		api.POST("/images/:hash/signed-url", middleware.RequireTokenScopes(model.ScopeImagesList), ih.CreateSignedURL)
 		api.GET("/routes", middleware.RequireTokenType(model.TokenTypeFull), ih.ListRoutes)
+		api.POST("/routes", middleware.RequireTokenType(model.TokenTypeFull), ih.CreateRoute)
+		api.DELETE("/routes", middleware.RequireTokenType(model.TokenTypeFull), ih.DeleteRoutesByPrefix)
+		api.POST("/routes/delete", middleware.RequireTokenType(model.TokenTypeFull), ih.DeleteRoutesByPrefix)
+		api.GET("/routes/:route", middleware.RequireTokenType(model.TokenTypeFull), ih.GetRoute)
+		api.PATCH("/routes/:route", middleware.RequireTokenType(model.TokenTypeFull), ih.UpdateRoute)
+		api.GET("/routes/:route/history", middleware.RequireTokenType(model.TokenTypeFull), ih.ListRouteHistory)
 		api.DELETE("/routes/:route", middleware.RequireTokenType(model.TokenTypeFull), ih.DeleteRoute)
 		api.POST("/routes/:route/delete", middleware.RequireTokenType(model.TokenTypeFull), ih.DeleteRoute)
 		api.GET("/stats", middleware.RequireTokenType(model.TokenTypeFull), ih.GetStats)
+		api.GET("/albums", middleware.RequireTokenScopes(model.ScopeImagesList), ih.ListAlbums)
+		api.POST("/albums", middleware.RequireTokenType(model.TokenTypeFull), ih.CreateAlbum)
+		api.GET("/albums/:id", middleware.RequireTokenScopes(model.ScopeImagesList), ih.GetAlbum)
+		api.PATCH("/albums/:id", middleware.RequireTokenType(model.TokenTypeFull), ih.UpdateAlbum)
+		api.DELETE("/albums/:id", middleware.RequireTokenType(model.TokenTypeFull), ih.DeleteAlbum)
+		api.POST("/albums/:id/delete", middleware.RequireTokenType(model.TokenTypeFull), ih.DeleteAlbum)
+		api.GET("/albums/:id/images", middleware.RequireTokenScopes(model.ScopeImagesList), ih.ListAlbumImages)
+		api.POST("/albums/:id/images", middleware.RequireTokenType(model.TokenTypeFull), ih.AddAlbumImages)
+		api.POST("/albums/:id/images/remove", middleware.RequireTokenType(model.TokenTypeFull), ih.RemoveAlbumImages)
+		api.PUT("/albums/:id/images/order", middleware.RequireTokenType(model.TokenTypeFull), ih.ReorderAlbumImages)
+		// 分享链接令牌本身即可访问内容，管理接口只对完整权限开放
+		api.GET("/shares", middleware.RequireTokenType(model.TokenTypeFull), ih.ListShares)
+		api.POST("/shares", middleware.RequireTokenType(model.TokenTypeFull), ih.CreateShare)
+		api.GET("/shares/:id", middleware.RequireTokenType(model.TokenTypeFull), ih.GetShareLink)
+		api.PATCH("/shares/:id", middleware.RequireTokenType(model.TokenTypeFull), ih.UpdateShare)
+		api.DELETE("/shares/:id", middleware.RequireTokenType(model.TokenTypeFull), ih.DeleteShare)
+		api.POST("/shares/:id/delete", middleware.RequireTokenType(model.TokenTypeFull), ih.DeleteShare)
+		api.POST("/shares/:id/revoke", middleware.RequireTokenType(model.TokenTypeFull), ih.RevokeShare)
+		api.GET("/shares/:id/accesses", middleware.RequireTokenType(model.TokenTypeFull), ih.ListShareAccesses)
 
 		api.OPTIONS("/ping", func(c *gin.Context) { c.Status(204) })
 		api.OPTIONS("/images", func(c *gin.Context) { c.Status(204) })
 		api.OPTIONS("/images/tasks", func(c *gin.Context) { c.Status(204) })
+		api.OPTIONS("/images/tasks/batch", func(c *gin.Context) { c.Status(204) })
+		api.OPTIONS("/images/tasks/stream", func(c *gin.Context) { c.Status(204) })
 		api.OPTIONS("/images/tasks/:id", func(c *gin.Context) { c.Status(204) })
+		api.OPTIONS("/images/tasks/:id/cancel", func(c *gin.Context) { c.Status(204) })
+		api.OPTIONS("/images/tasks/:id/retry", func(c *gin.Context) { c.Status(204) })
+		api.OPTIONS("/images/tasks/:id/deliveries", func(c *gin.Context) { c.Status(204) })
+		api.OPTIONS("/images/check", func(c *gin.Context) { c.Status(204) })
+		api.OPTIONS("/images/search", func(c *gin.Context) { c.Status(204) })
+		api.OPTIONS("/images/uploads", func(c *gin.Context) { c.Status(204) })
+		api.OPTIONS("/images/uploads/:id", func(c *gin.Context) { c.Status(204) })
+		api.OPTIONS("/images/uploads/:id/complete", func(c *gin.Context) { c.Status(204) })
 		api.OPTIONS("/tags", func(c *gin.Context) { c.Status(204) })
 		api.OPTIONS("/images/:hash/info", func(c *gin.Context) { c.Status(204) })
 		api.OPTIONS("/images/:hash", func(c *gin.Context) { c.Status(204) })
+		api.OPTIONS("/images/:hash/signed-url", func(c *gin.Context) { c.Status(204) })
 		api.OPTIONS("/routes", func(c *gin.Context) { c.Status(204) })
+		api.OPTIONS("/routes/delete", func(c *gin.Context) { c.Status(204) })
 		api.OPTIONS("/routes/:route", func(c *gin.Context) { c.Status(204) })
+		api.OPTIONS("/routes/:route/history", func(c *gin.Context) { c.Status(204) })
+		api.OPTIONS("/albums", func(c *gin.Context) { c.Status(204) })
+		api.OPTIONS("/albums/:id", func(c *gin.Context) { c.Status(204) })
+		api.OPTIONS("/albums/:id/delete", func(c *gin.Context) { c.Status(204) })
+		api.OPTIONS("/albums/:id/images", func(c *gin.Context) { c.Status(204) })
+		api.OPTIONS("/albums/:id/images/remove", func(c *gin.Context) { c.Status(204) })
+		api.OPTIONS("/albums/:id/images/order", func(c *gin.Context) { c.Status(204) })
+		api.OPTIONS("/shares", func(c *gin.Context) { c.Status(204) })
+		api.OPTIONS("/shares/:id", func(c *gin.Context) { c.Status(204) })
+		api.OPTIONS("/shares/:id/delete", func(c *gin.Context) { c.Status(204) })
+		api.OPTIONS("/shares/:id/revoke", func(c *gin.Context) { c.Status(204) })
+		api.OPTIONS("/shares/:id/accesses", func(c *gin.Context) { c.Status(204) })
 	}
 }
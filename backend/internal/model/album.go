@@ -0,0 +1,24 @@
+package model
+
+import "time"
+
+// Album 是有序的图片集合，一张图片可以属于多个相册。
+// 封面未指定时使用排在最前的图片，ImageCount 与 CoverHash 只在查询时计算。
+type Album struct {
+	ID           uint64    `gorm:"primaryKey" json:"id"`
+	Title        string    `gorm:"size:255;not null" json:"title"`
+	Description  string    `json:"description"`
+	CoverImageID *uint64   `gorm:"column:cover_image_id" json:"cover_image_id"`
+	CoverHash    string    `gorm:"->;-:migration" json:"cover_hash"`
+	ImageCount   int64     `gorm:"->;-:migration" json:"image_count"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// AlbumImage 是相册成员关系，Position 越小越靠前
+type AlbumImage struct {
+	AlbumID   uint64    `gorm:"primaryKey" json:"album_id"`
+	ImageID   uint64    `gorm:"primaryKey" json:"image_id"`
+	Position  int       `gorm:"not null" json:"position"`
+	CreatedAt time.Time `json:"created_at"`
+}
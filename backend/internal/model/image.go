@@ -6,6 +6,22 @@ import (
 	"gorm.io/datatypes"
 )
 
+// 缩略图生成状态
+const (
+	ThumbnailStatusPending = "pending"
+	ThumbnailStatusReady   = "ready"
+	ThumbnailStatusFailed  = "failed"
+	ThumbnailStatusSkipped = "skipped" // 队列已满未生成，由定期补齐或补齐任务处理
+)
+
+// 媒体可见性：public 可按哈希公开访问；unlisted 同样可访问，但响应要求搜索引擎不收录；
+// private 只能通过带签名且未过期的链接访问
+const (
+	VisibilityPublic   = "public"
+	VisibilityUnlisted = "unlisted"
+	VisibilityPrivate  = "private"
+)
+
 type Image struct {
 	ID                  uint64         `gorm:"primaryKey" json:"id"`
 	Hash                string         `gorm:"size:64;uniqueIndex" json:"hash"`
@@ -13,6 +29,7 @@ type Image struct {
 	MimeType            string         `gorm:"size:64" json:"mime_type"`
 	Size                int64          `json:"size"`
 	Path                string         `gorm:"column:storage_path;size:512" json:"path"`
+	StorageBackend      string         `gorm:"column:storage_backend;size:32" json:"storage_backend"` // 为空表示默认存储
 	Width               int            `json:"width"`
 	Height              int            `json:"height"`
 	DurationSeconds     int            `gorm:"column:duration_seconds" json:"duration_seconds"`
@@ -25,16 +42,33 @@ type Image struct {
 	UploadedByTokenID   *uint          `gorm:"column:uploaded_by_token_id" json:"uploaded_by_token_id"`
 	UploadedByTokenName string         `gorm:"size:255" json:"uploaded_by_token_name"`
 	UploadedByTokenType string         `gorm:"size:32" json:"uploaded_by_token_type"`
+	ThumbnailStatus     string         `gorm:"size:16;index" json:"thumbnail_status"` // 为空表示启用状态记录前上传的图片
+	Visibility          string         `gorm:"size:16;not null;default:public" json:"visibility"`
 	CreatedAt           time.Time      `json:"created_at"`
 	UpdatedAt           time.Time      `json:"updated_at"`
 }
 
-// 路由映射表
+// 路由映射表。路由指向一张图片，或以 RedirectTo 重定向到另一个路由，二者只设其一。
+// ExpiresAt 之后路由失效；ContentDisposition 与 DownloadFilename 覆盖输出时的下载方式与文件名。
 type ImageRoute struct {
-	ID        uint64    `gorm:"primaryKey" json:"id"`
-	ImageID   uint64    `gorm:"index;not null" json:"image_id"`
-	Route     string    `gorm:"size:255;uniqueIndex;not null" json:"route"`
-	CreatedAt time.Time `json:"created_at"`
+	ID                 uint64     `gorm:"primaryKey" json:"id"`
+	ImageID            *uint64    `gorm:"index" json:"image_id"`
+	Route              string     `gorm:"size:255;uniqueIndex;not null" json:"route"`
+	RedirectTo         string     `gorm:"size:255" json:"redirect_to"`
+	ExpiresAt          *time.Time `json:"expires_at"`
+	ContentDisposition string     `gorm:"size:16" json:"content_disposition"` // inline、attachment 或空
+	DownloadFilename   string     `gorm:"size:255" json:"download_filename"`
+	CreatedAt          time.Time  `json:"created_at"`
+	UpdatedAt          time.Time  `json:"updated_at"`
+
+	Image *Image `gorm:"foreignKey:ImageID;constraint:OnDelete:CASCADE" json:"image"`
+}
 
-	Image Image `gorm:"foreignKey:ImageID;constraint:OnDelete:CASCADE" json:"image"`
+// ImageRouteHistory 记录路由每次改指前的目标，ImageHash 为当时指向的图片
+type ImageRouteHistory struct {
+	ID         uint64    `gorm:"primaryKey" json:"id"`
+	RouteID    uint64    `gorm:"not null" json:"route_id"`
+	ImageHash  string    `gorm:"size:64" json:"image_hash"`
+	RedirectTo string    `gorm:"size:255" json:"redirect_to"`
+	CreatedAt  time.Time `json:"created_at"`
 }
@@ -0,0 +1,19 @@
+package model
+
+import "time"
+
+const (
+	ReplicaStatusOK      = "ok"
+	ReplicaStatusMissing = "missing"
+)
+
+// ImageReplica 记录原图在某个副本存储上的状态
+type ImageReplica struct {
+	ID        uint64    `gorm:"primaryKey" json:"id"`
+	ImageID   uint64    `gorm:"not null;uniqueIndex:idx_image_replicas_image_backend" json:"image_id"`
+	Backend   string    `gorm:"size:32;not null;uniqueIndex:idx_image_replicas_image_backend" json:"backend"`
+	Status    string    `gorm:"size:16;not null;index" json:"status"`
+	LastError string    `gorm:"type:text" json:"last_error,omitempty"`
+	CheckedAt time.Time `json:"checked_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
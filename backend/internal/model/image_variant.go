@@ -0,0 +1,15 @@
+package model
+
+import "time"
+
+// ImageVariant 按需变换生成的派生文件（缩放/转码结果）
+type ImageVariant struct {
+	ID             uint64    `gorm:"primaryKey" json:"id"`
+	ImageID        uint64    `gorm:"index;not null" json:"image_id"`
+	VariantKey     string    `gorm:"size:255;uniqueIndex;not null" json:"variant_key"`
+	Path           string    `gorm:"column:storage_path;size:512;not null" json:"path"`
+	MimeType       string    `gorm:"size:64" json:"mime_type"`
+	Size           int64     `json:"size"`
+	LastAccessedAt time.Time `gorm:"index" json:"last_accessed_at"`
+	CreatedAt      time.Time `json:"created_at"`
+}
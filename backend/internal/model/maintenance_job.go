@@ -0,0 +1,42 @@
+package model
+
+import (
+	"time"
+
+	"gorm.io/datatypes"
+)
+
+const (
+	MaintenanceKindStorageMigration    = "storage_migration"
+	MaintenanceKindStorageScrub        = "storage_scrub"
+	MaintenanceKindThumbnailBackfill   = "thumbnail_backfill"
+	MaintenanceKindThumbnailRegenerate = "thumbnail_regenerate"
+)
+
+const (
+	MaintenanceStatusPending   = "pending"
+	MaintenanceStatusRunning   = "running"
+	MaintenanceStatusSucceeded = "succeeded"
+	MaintenanceStatusFailed    = "failed"
+	MaintenanceStatusCancelled = "cancelled"
+)
+
+// MaintenanceJob 是可断点续跑的后台维护任务，进度按图片 ID 游标推进。
+// 分阶段的任务用 Stage 记录当前阶段，按对象路径推进时游标记在 LastKey。
+type MaintenanceJob struct {
+	ID          string         `gorm:"size:36;primaryKey" json:"id"`
+	Kind        string         `gorm:"size:32;index;not null" json:"kind"`
+	Status      string         `gorm:"size:32;index;not null" json:"status"`
+	Params      datatypes.JSON `gorm:"type:jsonb" json:"params"`
+	Stage       string         `gorm:"size:32" json:"stage,omitempty"`
+	LastID      uint64         `gorm:"column:last_id" json:"last_id"`
+	LastKey     string         `gorm:"column:last_key" json:"last_key,omitempty"`
+	Total       int64          `json:"total"`
+	Processed   int64          `json:"processed"`
+	Failed      int64          `json:"failed"`
+	LastError   string         `json:"last_error,omitempty"`
+	CreatedAt   time.Time      `json:"created_at"`
+	UpdatedAt   time.Time      `json:"updated_at"`
+	StartedAt   *time.Time     `json:"started_at,omitempty"`
+	CompletedAt *time.Time     `json:"completed_at,omitempty"`
+}
@@ -0,0 +1,21 @@
+package model
+
+import (
+	"time"
+
+	"gorm.io/datatypes"
+)
+
+// ResumableUpload 是一次未完成的断点续传上传，已接收的内容暂存在本地分片文件中
+type ResumableUpload struct {
+	ID       string `gorm:"size:36;primaryKey" json:"id"`
+	FileName string `gorm:"size:255" json:"file_name"`
+	Size     int64  `gorm:"not null" json:"size"`
+	// offset 是 SQL 保留字，列名使用 upload_offset
+	Offset            int64          `gorm:"column:upload_offset;not null" json:"offset"`
+	Options           datatypes.JSON `gorm:"type:jsonb" json:"options,omitempty"`
+	UploadedByTokenID *uint          `gorm:"index" json:"-"`
+	CreatedAt         time.Time      `json:"created_at"`
+	UpdatedAt         time.Time      `json:"updated_at"`
+	ExpiresAt         time.Time      `gorm:"index" json:"expires_at"`
+}
@@ -0,0 +1,28 @@
+package model
+
+import "time"
+
+const (
+	ScrubFindingMissing = "missing" // 数据库记录引用的文件不存在
+	ScrubFindingCorrupt = "corrupt" // 文件大小或哈希与记录不符
+	ScrubFindingOrphan  = "orphan"  // 存储中没有任何记录引用的对象
+)
+
+const (
+	ScrubActionQuarantined = "quarantined"
+	ScrubActionDeleted     = "deleted"
+)
+
+// ScrubFinding 是完整性巡检发现的一条问题
+type ScrubFinding struct {
+	ID        uint64    `gorm:"primaryKey" json:"id"`
+	JobID     string    `gorm:"size:36;index;not null" json:"job_id"`
+	Kind      string    `gorm:"size:16;not null" json:"kind"`
+	Backend   string    `gorm:"size:32;not null" json:"backend"`
+	Path      string    `gorm:"size:512;not null" json:"path"`
+	ImageID   *uint64   `json:"image_id,omitempty"`
+	Size      int64     `json:"size"`
+	Detail    string    `json:"detail,omitempty"`
+	Action    string    `gorm:"size:16" json:"action,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
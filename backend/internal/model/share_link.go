@@ -0,0 +1,50 @@
+package model
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"time"
+)
+
+// ShareLink 是指向单张图片或相册的可撤销分享链接，二者恰好设置其一。
+// MaxViews 为 0 表示不限次数；ImageHash 只在查询时计算。
+type ShareLink struct {
+	ID           uint64     `gorm:"primaryKey" json:"id"`
+	Token        string     `gorm:"size:64;not null;uniqueIndex" json:"token"`
+	ImageID      *uint64    `gorm:"column:image_id" json:"image_id"`
+	AlbumID      *uint64    `gorm:"column:album_id" json:"album_id"`
+	ImageHash    string     `gorm:"->;-:migration" json:"image_hash,omitempty"`
+	Note         string     `gorm:"size:255" json:"note"`
+	PasswordHash string     `json:"-"`
+	HasPassword  bool       `gorm:"-" json:"has_password"`
+	ExpiresAt    *time.Time `json:"expires_at"`
+	MaxViews     int64      `gorm:"not null;default:0" json:"max_views"`
+	ViewCount    int64      `gorm:"not null;default:0" json:"view_count"`
+	RevokedAt    *time.Time `json:"revoked_at"`
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+
+	// 图片分享的大小与类型，只在查询时计算，用于判断分段请求是否计入访问次数
+	ImageSize     int64  `gorm:"->;-:migration" json:"-"`
+	ImageMimeType string `gorm:"->;-:migration" json:"-"`
+}
+
+// ShareLinkAccess 记录一次对分享链接的公开访问，Result 为 ok 或拒绝原因
+type ShareLinkAccess struct {
+	ID          uint64    `gorm:"primaryKey" json:"id"`
+	ShareLinkID uint64    `gorm:"not null" json:"share_link_id"`
+	Path        string    `gorm:"size:512" json:"path"`
+	IPAddress   string    `gorm:"size:45" json:"ip_address"`
+	UserAgent   string    `gorm:"size:512" json:"user_agent"`
+	Result      string    `gorm:"size:32" json:"result"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// GenerateShareToken 生成分享链接令牌，令牌本身即是访问凭据
+func GenerateShareToken() (string, error) {
+	tokenBytes := make([]byte, 16)
+	if _, err := rand.Read(tokenBytes); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(tokenBytes), nil
+}
@@ -11,16 +11,33 @@ const (
 	UploadTaskStatusRunning   = "running"
 	UploadTaskStatusSucceeded = "succeeded"
 	UploadTaskStatusFailed    = "failed"
+	UploadTaskStatusCancelled = "cancelled"
+)
+
+// 执行中（running）任务的细分阶段；其他状态下 Stage 与 Status 相同
+const (
+	UploadTaskStageConverting   = "converting"
+	UploadTaskStageStoring      = "storing"
+	UploadTaskStageThumbnailing = "thumbnailing"
 )
 
 type UploadTask struct {
 	ID           string         `gorm:"size:36;primaryKey" json:"id"`
 	Status       string         `gorm:"size:32;index;not null" json:"status"`
+	Stage        string         `gorm:"size:32" json:"stage"`
 	FileName     string         `gorm:"size:255" json:"file_name"`
 	Result       datatypes.JSON `gorm:"type:jsonb" json:"result,omitempty"`
 	ErrorCode    string         `gorm:"size:64" json:"error_code,omitempty"`
 	ErrorMessage string         `json:"error_message,omitempty"`
-	CreatedAt    time.Time      `json:"created_at"`
-	UpdatedAt    time.Time      `json:"updated_at"`
-	CompletedAt  *time.Time     `json:"completed_at,omitempty"`
+	// 创建任务的 API Token，令牌只能查看和操作自己创建的任务
+	UploadedByTokenID *uint `gorm:"column:uploaded_by_token_id;index" json:"uploaded_by_token_id,omitempty"`
+	// 任务参数，暂存文件位于持久化的任务目录中
+	Payload datatypes.JSON `gorm:"type:jsonb" json:"-"`
+	// 已认领执行的次数，失败后按退避时间重新进入 pending，达到上限后置为 failed
+	Attempts      int        `gorm:"not null;default:0" json:"attempts"`
+	NextAttemptAt time.Time  `gorm:"not null" json:"next_attempt_at"`
+	ClaimedAt     *time.Time `json:"-"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+	CompletedAt   *time.Time `json:"completed_at,omitempty"`
 }
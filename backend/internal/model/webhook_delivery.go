@@ -0,0 +1,36 @@
+package model
+
+import (
+	"time"
+
+	"gorm.io/datatypes"
+)
+
+const (
+	WebhookDeliveryPending   = "pending"
+	WebhookDeliverySucceeded = "succeeded"
+	WebhookDeliveryFailed    = "failed"
+)
+
+const (
+	WebhookEventUploadTaskSucceeded = "upload_task.succeeded"
+	WebhookEventUploadTaskFailed    = "upload_task.failed"
+)
+
+// WebhookDelivery 是一次 Webhook 投递及其重试记录
+type WebhookDelivery struct {
+	ID             uint64         `gorm:"primaryKey" json:"id"`
+	TaskID         string         `gorm:"size:36;index;not null" json:"task_id"`
+	Event          string         `gorm:"size:64;not null" json:"event"`
+	URL            string         `gorm:"size:2048;not null" json:"url"`
+	Payload        datatypes.JSON `gorm:"type:jsonb;not null" json:"-"`
+	Status         string         `gorm:"size:16;not null" json:"status"`
+	Attempts       int            `gorm:"not null;default:0" json:"attempts"`
+	NextAttemptAt  time.Time      `gorm:"not null" json:"next_attempt_at"`
+	ClaimedAt      *time.Time     `json:"-"`
+	LastStatusCode int            `json:"last_status_code,omitempty"`
+	LastError      string         `json:"last_error,omitempty"`
+	CreatedAt      time.Time      `json:"created_at"`
+	UpdatedAt      time.Time      `json:"updated_at"`
+	DeliveredAt    *time.Time     `json:"delivered_at,omitempty"`
+}
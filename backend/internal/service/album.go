@@ -0,0 +1,350 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/TangTangChu/AnzuImg/backend/internal/model"
+)
+
+var (
+	ErrAlbumNotFound      = errors.New("album not found")
+	ErrInvalidAlbum       = errors.New("invalid album")
+	ErrAlbumImageNotFound = errors.New("image not found")
+)
+
+const maxAlbumTitleLength = 255
+
+// albumColumns 在查询相册时一并计算图片数与封面，未指定封面时取排在最前的图片
+const albumColumns = `albums.*,
+(SELECT COUNT(*) FROM album_images ai WHERE ai.album_id = albums.id) AS image_count,
+COALESCE(
+	(SELECT i.hash FROM images i WHERE i.id = albums.cover_image_id),
+	(SELECT i.hash FROM album_images ai JOIN images i ON i.id = ai.image_id
+	 WHERE ai.album_id = albums.id ORDER BY ai.position, ai.image_id LIMIT 1),
+	''
+) AS cover_hash`
+
+// AlbumInput 是创建或修改相册的字段，nil 表示不修改；CoverHash 为空字符串表示改回默认封面
+type AlbumInput struct {
+	Title       *string
+	Description *string
+	CoverHash   *string
+}
+
+func (s *ImageService) albumQuery() *gorm.DB {
+	return s.db.Model(&model.Album{}).Select(albumColumns)
+}
+
+// applyAlbumInput 校验并写入相册字段，封面可以是任意已存在的图片
+func (s *ImageService) applyAlbumInput(tx *gorm.DB, album *model.Album, in AlbumInput) error {
+	if in.Title != nil {
+		title := strings.TrimSpace(*in.Title)
+		if title == "" || utf8.RuneCountInString(title) > maxAlbumTitleLength {
+			return fmt.Errorf("%w: title must be 1-%d characters", ErrInvalidAlbum, maxAlbumTitleLength)
+		}
+		album.Title = title
+	}
+	if in.Description != nil {
+		album.Description = strings.TrimSpace(*in.Description)
+	}
+	if in.CoverHash != nil {
+		hash := strings.TrimSpace(*in.CoverHash)
+		if hash == "" {
+			album.CoverImageID = nil
+		} else {
+			var img model.Image
+			if err := tx.Select("id").Where("hash = ?", hash).First(&img).Error; err != nil {
+				if errors.Is(err, gorm.ErrRecordNotFound) {
+					return fmt.Errorf("%w: cover %s", ErrAlbumImageNotFound, hash)
+				}
+				return err
+			}
+			album.CoverImageID = &img.ID
+		}
+	}
+	return nil
+}
+
+// ListAlbums 按创建时间倒序分页获取相册
+func (s *ImageService) ListAlbums(page, pageSize int) ([]model.Album, int64, error) {
+	var total int64
+	if err := s.db.Model(&model.Album{}).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	var albums []model.Album
+	if err := s.albumQuery().Order("created_at DESC").Order("id DESC").
+		Limit(pageSize).Offset((page - 1) * pageSize).Find(&albums).Error; err != nil {
+		return nil, 0, err
+	}
+	return albums, total, nil
+}
+
+// ListAlbumsByCursor 按游标获取相册，不统计总数
+func (s *ImageService) ListAlbumsByCursor(cursor *Cursor, limit int) (*CursorPage[model.Album], error) {
+	return findCursorPage(s.albumQuery(), cursor, limit, func(a *model.Album) Cursor {
+		return Cursor{CreatedAt: a.CreatedAt, ID: a.ID}
+	})
+}
+
+// GetAlbum 返回单个相册，不存在时返回 ErrAlbumNotFound
+func (s *ImageService) GetAlbum(id uint64) (*model.Album, error) {
+	var album model.Album
+	if err := s.albumQuery().Where("id = ?", id).First(&album).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrAlbumNotFound
+		}
+		return nil, err
+	}
+	return &album, nil
+}
+
+// CreateAlbum 创建相册，标题必填
+func (s *ImageService) CreateAlbum(in AlbumInput) (*model.Album, error) {
+	if in.Title == nil {
+		return nil, fmt.Errorf("%w: title is required", ErrInvalidAlbum)
+	}
+	var album model.Album
+	if err := s.applyAlbumInput(s.db, &album, in); err != nil {
+		return nil, err
+	}
+	if err := s.db.Create(&album).Error; err != nil {
+		return nil, fmt.Errorf("create album failed: %w", err)
+	}
+	return s.GetAlbum(album.ID)
+}
+
+// UpdateAlbum 修改相册的标题、描述或封面
+func (s *ImageService) UpdateAlbum(id uint64, in AlbumInput) (*model.Album, error) {
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		album, err := lockAlbum(tx, id)
+		if err != nil {
+			return err
+		}
+		if err := s.applyAlbumInput(tx, album, in); err != nil {
+			return err
+		}
+		album.UpdatedAt = time.Now()
+		return tx.Model(album).Select("Title", "Description", "CoverImageID", "UpdatedAt").Updates(album).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.GetAlbum(id)
+}
+
+// DeleteAlbum 删除相册及其成员关系，图片本身不受影响
+func (s *ImageService) DeleteAlbum(id uint64) error {
+	res := s.db.Where("id = ?", id).Delete(&model.Album{})
+	if res.Error != nil {
+		return fmt.Errorf("delete album failed: %w", res.Error)
+	}
+	if res.RowsAffected == 0 {
+		return ErrAlbumNotFound
+	}
+	return nil
+}
+
+// ListAlbumImages 按相册内顺序分页获取图片，筛选条件与 ListImages 一致
+func (s *ImageService) ListAlbumImages(albumID uint64, page, pageSize int, tag, fileName string) ([]model.Image, int64, error) {
+	if err := s.db.Select("id").Where("id = ?", albumID).First(&model.Album{}).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, 0, ErrAlbumNotFound
+		}
+		return nil, 0, err
+	}
+
+	query := s.imageListQuery(tag, fileName).
+		Joins("JOIN album_images ON album_images.image_id = images.id AND album_images.album_id = ?", albumID)
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	var images []model.Image
+	if err := query.Select("images.*").Order("album_images.position ASC").Order("images.id ASC").
+		Limit(pageSize).Offset((page - 1) * pageSize).Find(&images).Error; err != nil {
+		return nil, 0, err
+	}
+	return images, total, nil
+}
+
+// AlbumIDsForImage 返回包含该图片的相册 ID
+func (s *ImageService) AlbumIDsForImage(imageID uint64) ([]uint64, error) {
+	ids := []uint64{}
+	err := s.db.Model(&model.AlbumImage{}).Where("image_id = ?", imageID).
+		Order("album_id").Pluck("album_id", &ids).Error
+	return ids, err
+}
+
+// AddAlbumImages 把图片加入相册，已在相册中的图片保持原位置。
+// position 为空时追加到末尾，否则从该位置插入，原有图片依次后移。返回新加入的数量。
+func (s *ImageService) AddAlbumImages(albumID uint64, hashes []string, position *int) (int, error) {
+	added := 0
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if _, err := lockAlbum(tx, albumID); err != nil {
+			return err
+		}
+		ids, err := resolveImageIDs(tx, hashes)
+		if err != nil {
+			return err
+		}
+
+		var existing []uint64
+		if err := tx.Model(&model.AlbumImage{}).Where("album_id = ? AND image_id IN ?", albumID, ids).
+			Pluck("image_id", &existing).Error; err != nil {
+			return err
+		}
+		member := make(map[uint64]bool, len(existing))
+		for _, id := range existing {
+			member[id] = true
+		}
+		var fresh []uint64
+		for _, id := range ids {
+			if !member[id] {
+				member[id] = true
+				fresh = append(fresh, id)
+			}
+		}
+		if len(fresh) == 0 {
+			return nil
+		}
+
+		var start int
+		if position == nil {
+			if err := tx.Model(&model.AlbumImage{}).Where("album_id = ?", albumID).
+				Select("COALESCE(MAX(position) + 1, 0)").Scan(&start).Error; err != nil {
+				return err
+			}
+		} else {
+			start = max(*position, 0)
+			if err := tx.Model(&model.AlbumImage{}).Where("album_id = ? AND position >= ?", albumID, start).
+				Update("position", gorm.Expr("position + ?", len(fresh))).Error; err != nil {
+				return err
+			}
+		}
+
+		rows := make([]model.AlbumImage, len(fresh))
+		for i, id := range fresh {
+			rows[i] = model.AlbumImage{AlbumID: albumID, ImageID: id, Position: start + i}
+		}
+		if err := tx.Create(&rows).Error; err != nil {
+			return fmt.Errorf("add album images failed: %w", err)
+		}
+		added = len(rows)
+		return touchAlbum(tx, albumID)
+	})
+	return added, err
+}
+
+// RemoveAlbumImages 从相册移除图片，不在相册中的图片忽略。返回移除的数量。
+func (s *ImageService) RemoveAlbumImages(albumID uint64, hashes []string) (int64, error) {
+	var removed int64
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if _, err := lockAlbum(tx, albumID); err != nil {
+			return err
+		}
+		res := tx.Where("album_id = ? AND image_id IN (?)", albumID,
+			tx.Model(&model.Image{}).Select("id").Where("hash IN ?", hashes)).
+			Delete(&model.AlbumImage{})
+		if res.Error != nil {
+			return fmt.Errorf("remove album images failed: %w", res.Error)
+		}
+		removed = res.RowsAffected
+		if removed == 0 {
+			return nil
+		}
+		return touchAlbum(tx, albumID)
+	})
+	return removed, err
+}
+
+// ReorderAlbumImages 调整相册内顺序：hashes 中的图片按给定顺序排在最前，其余图片保持相对顺序排在其后
+func (s *ImageService) ReorderAlbumImages(albumID uint64, hashes []string) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if _, err := lockAlbum(tx, albumID); err != nil {
+			return err
+		}
+		ids, err := resolveImageIDs(tx, hashes)
+		if err != nil {
+			return err
+		}
+		var current []uint64
+		if err := tx.Model(&model.AlbumImage{}).Where("album_id = ?", albumID).
+			Order("position").Order("image_id").Pluck("image_id", &current).Error; err != nil {
+			return err
+		}
+		member := make(map[uint64]bool, len(current))
+		for _, id := range current {
+			member[id] = true
+		}
+
+		order := make([]uint64, 0, len(current))
+		placed := make(map[uint64]bool, len(current))
+		for i, id := range ids {
+			if !member[id] {
+				return fmt.Errorf("%w: %s is not in the album", ErrInvalidAlbum, hashes[i])
+			}
+			if !placed[id] {
+				placed[id] = true
+				order = append(order, id)
+			}
+		}
+		for _, id := range current {
+			if !placed[id] {
+				order = append(order, id)
+			}
+		}
+
+		for pos, id := range order {
+			if err := tx.Model(&model.AlbumImage{}).Where("album_id = ? AND image_id = ?", albumID, id).
+				Update("position", pos).Error; err != nil {
+				return fmt.Errorf("reorder album images failed: %w", err)
+			}
+		}
+		return touchAlbum(tx, albumID)
+	})
+}
+
+// lockAlbum 锁定相册行，串行化同一相册的成员与顺序修改
+func lockAlbum(tx *gorm.DB, id uint64) (*model.Album, error) {
+	var album model.Album
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", id).First(&album).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrAlbumNotFound
+		}
+		return nil, err
+	}
+	return &album, nil
+}
+
+func touchAlbum(tx *gorm.DB, id uint64) error {
+	return tx.Model(&model.Album{}).Where("id = ?", id).Update("updated_at", time.Now()).Error
+}
+
+// resolveImageIDs 按输入顺序把哈希换成图片 ID，任一哈希不存在时返回 ErrAlbumImageNotFound
+func resolveImageIDs(tx *gorm.DB, hashes []string) ([]uint64, error) {
+	var images []model.Image
+	if err := tx.Select("id", "hash").Where("hash IN ?", hashes).Find(&images).Error; err != nil {
+		return nil, err
+	}
+	byHash := make(map[string]uint64, len(images))
+	for _, img := range images {
+		byHash[img.Hash] = img.ID
+	}
+	ids := make([]uint64, len(hashes))
+	for i, h := range hashes {
+		id, ok := byHash[h]
+		if !ok {
+			return nil, fmt.Errorf("%w: %s", ErrAlbumImageNotFound, h)
+		}
+		ids[i] = id
+	}
+	return ids, nil
+}
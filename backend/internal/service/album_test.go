@@ -0,0 +1,39 @@
+package service
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/TangTangChu/AnzuImg/backend/internal/model"
+)
+
+func TestApplyAlbumInput(t *testing.T) {
+	s := &ImageService{}
+	title, desc := "  旅行  ", " 2026 夏天 "
+	var album model.Album
+	if err := s.applyAlbumInput(nil, &album, AlbumInput{Title: &title, Description: &desc}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if album.Title != "旅行" || album.Description != "2026 夏天" {
+		t.Fatalf("unexpected album: %+v", album)
+	}
+
+	// 未出现的字段保持不变
+	if err := s.applyAlbumInput(nil, &album, AlbumInput{}); err != nil || album.Title != "旅行" {
+		t.Fatalf("empty input changed album: %+v, %v", album, err)
+	}
+
+	for _, bad := range []string{"", "   ", strings.Repeat("相", maxAlbumTitleLength+1)} {
+		if err := s.applyAlbumInput(nil, &album, AlbumInput{Title: &bad}); !errors.Is(err, ErrInvalidAlbum) {
+			t.Fatalf("expected ErrInvalidAlbum for %q, got %v", bad, err)
+		}
+	}
+
+	id := uint64(7)
+	album.CoverImageID = &id
+	empty := ""
+	if err := s.applyAlbumInput(nil, &album, AlbumInput{CoverHash: &empty}); err != nil || album.CoverImageID != nil {
+		t.Fatalf("empty cover_hash should reset cover: %+v, %v", album, err)
+	}
+}
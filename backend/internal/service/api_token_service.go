@@ -144,9 +144,8 @@ func (s *APITokenService) RecordLog(log *model.APITokenLog) error {
 	return s.db.Create(log).Error
 }
 
-func (s *APITokenService) ListLogs(page, pageSize int, search, startDate, endDate, actionType string) ([]model.APITokenLog, int64, error) {
-	var logs []model.APITokenLog
-	var total int64
+// logQuery 构造 Token 日志的筛选条件
+func (s *APITokenService) logQuery(search, startDate, endDate, actionType string) *gorm.DB {
 	query := s.db.Model(&model.APITokenLog{})
 
 	if search != "" {
@@ -175,6 +174,20 @@ func (s *APITokenService) ListLogs(page, pageSize int, search, startDate, endDat
 	if actionType != "" {
 		query = query.Where("action = ?", actionType)
 	}
+	return query
+}
+
+func clampTokenLogPageSize(pageSize int) int {
+	if pageSize < 1 || pageSize > 200 {
+		return 20
+	}
+	return pageSize
+}
+
+func (s *APITokenService) ListLogs(page, pageSize int, search, startDate, endDate, actionType string) ([]model.APITokenLog, int64, error) {
+	var logs []model.APITokenLog
+	var total int64
+	query := s.logQuery(search, startDate, endDate, actionType)
 
 	if err := query.Count(&total).Error; err != nil {
 		return nil, 0, err
@@ -182,16 +195,22 @@ func (s *APITokenService) ListLogs(page, pageSize int, search, startDate, endDat
 	if page < 1 {
 		page = 1
 	}
-	if pageSize < 1 || pageSize > 200 {
-		pageSize = 20
-	}
+	pageSize = clampTokenLogPageSize(pageSize)
 	offset := (page - 1) * pageSize
-	if err := query.Order("created_at DESC").Limit(pageSize).Offset(offset).Find(&logs).Error; err != nil {
+	if err := query.Order("created_at DESC").Order("id DESC").Limit(pageSize).Offset(offset).Find(&logs).Error; err != nil {
 		return nil, 0, err
 	}
 	return logs, total, nil
 }
 
+// ListLogsByCursor 按游标查询 Token 日志，不统计总数
+func (s *APITokenService) ListLogsByCursor(cursor *Cursor, pageSize int, search, startDate, endDate, actionType string) (*CursorPage[model.APITokenLog], error) {
+	query := s.logQuery(search, startDate, endDate, actionType)
+	return findCursorPage(query, cursor, clampTokenLogPageSize(pageSize), func(l *model.APITokenLog) Cursor {
+		return Cursor{CreatedAt: l.CreatedAt, ID: uint64(l.ID)}
+	})
+}
+
 func (s *APITokenService) CleanupLogsBefore(cutoff time.Time) (int64, error) {
 	result := s.db.Where("created_at < ?", cutoff).Delete(&model.APITokenLog{})
 	return result.RowsAffected, result.Error
@@ -0,0 +1,168 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/TangTangChu/AnzuImg/backend/internal/model"
+)
+
+// autoFormats 按优先级排列的自动协商目标格式
+var autoFormats = []string{"avif", "webp"}
+
+// NegotiateFormat 根据 Accept 头选出客户端支持且优于原图的格式，无可用格式时返回空字符串。
+// 只认显式声明的 image/avif、image/webp，忽略 */* 与 image/* 通配。
+func NegotiateFormat(accept string, sourceMimeType string) string {
+	if !autoFormatEligible(sourceMimeType) {
+		return ""
+	}
+	for _, format := range autoFormats {
+		mime := transformFormatMime[format]
+		if mime == sourceMimeType {
+			// 原图已是更优格式，无需再协商
+			return ""
+		}
+		if acceptsMIME(accept, mime) {
+			return format
+		}
+	}
+	return ""
+}
+
+func autoFormatEligible(mimeType string) bool {
+	return IsImageFile(mimeType) && mimeType != "image/svg+xml"
+}
+
+func acceptsMIME(accept string, mime string) bool {
+	for _, part := range strings.Split(accept, ",") {
+		fields := strings.Split(part, ";")
+		if !strings.EqualFold(strings.TrimSpace(fields[0]), mime) {
+			continue
+		}
+		for _, param := range fields[1:] {
+			key, value, ok := strings.Cut(strings.TrimSpace(param), "=")
+			if !ok || strings.TrimSpace(key) != "q" {
+				continue
+			}
+			if q, err := strconv.ParseFloat(strings.TrimSpace(value), 64); err == nil && q <= 0 {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// autoFormatParams 返回目标格式当前配置的质量与压缩力度
+func (s *ImageService) autoFormatParams(format string) (quality, effort int) {
+	eff := s.cfg.Effective()
+	if format == "avif" {
+		return eff.AutoFormatAVIFQuality, eff.AutoFormatAVIFEffort
+	}
+	return eff.AutoFormatWebPQuality, eff.AutoFormatWebPEffort
+}
+
+func (s *ImageService) autoVariantName(hash, format string) string {
+	quality, effort := s.autoFormatParams(format)
+	return fmt.Sprintf("%s_a_%s_q%d_e%d.%s", hash, format, quality, effort, format)
+}
+
+// AutoFormatActive 判断是否按 Accept 头输出 AVIF/WebP。协商结果作为派生文件缓存，
+// VARIANT_CACHE_MAX_MB 为 0 时不缓存也不淘汰，此时不生成协商格式
+func (s *ImageService) AutoFormatActive() bool {
+	eff := s.cfg.Effective()
+	return eff.AutoFormatEnabled && eff.VariantCacheMaxBytes > 0
+}
+
+// AutoFormatVariant 返回协商格式的派生文件；尚未生成时在后台异步生成并返回 nil，
+// 调用方应回退到原图。生成结果不小于原图时同样返回 nil。
+func (s *ImageService) AutoFormatVariant(ctx context.Context, img *model.Image, format string) *VariantContent {
+	if !s.AutoFormatActive() || format == "" {
+		return nil
+	}
+
+	name := s.autoVariantName(img.Hash, format)
+	var v model.ImageVariant
+	if err := s.db.WithContext(ctx).Where("variant_key = ?", name).First(&v).Error; err != nil {
+		s.enqueueAutoFormat(img, format)
+		return nil
+	}
+	if v.Size >= img.Size {
+		return nil
+	}
+
+	data, ok := s.loadVariant(ctx, name)
+	if !ok {
+		s.enqueueAutoFormat(img, format)
+		return nil
+	}
+	return &VariantContent{Key: name, MimeType: v.MimeType, Data: data}
+}
+
+// enqueueAutoFormat 后台生成协商格式的派生文件，同名任务只会有一个在执行
+func (s *ImageService) enqueueAutoFormat(img *model.Image, format string) {
+	name := s.autoVariantName(img.Hash, format)
+	if _, loaded := s.autoFormatPending.LoadOrStore(name, struct{}{}); loaded {
+		return
+	}
+	source := *img
+	go func() {
+		defer s.autoFormatPending.Delete(name)
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+		defer cancel()
+
+		release, err := s.acquireTransformSlot(ctx)
+		if err != nil {
+			s.log.Ctx(ctx).Debugf("Skipped auto format generation for %s: %v", name, err)
+			return
+		}
+		defer release()
+
+		data, err := readStorageFile(ctx, s.storageFor(&source), source.Path)
+		if err != nil {
+			s.log.Ctx(ctx).Warnf("Failed to read original for auto format: %v", err)
+			return
+		}
+		s.generateAutoFormat(ctx, &source, data, format)
+	}()
+}
+
+func (s *ImageService) generateAutoFormat(ctx context.Context, img *model.Image, data []byte, format string) {
+	if !s.AutoFormatActive() {
+		return
+	}
+	quality, effort := s.autoFormatParams(format)
+	buf, mimeType, err := ConvertImage(ctx, data, img.MimeType, format, quality, effort)
+	if err != nil {
+		s.log.Ctx(ctx).Warnf("Auto format conversion failed: hash=%s, format=%s, err=%v", img.Hash, format, err)
+		return
+	}
+	// 即使结果更大也登记，避免每次请求都重新尝试
+	s.storeVariant(ctx, img, s.autoVariantName(img.Hash, format), buf, mimeType)
+}
+
+// pregenerateAutoFormats 在上传后预先生成各协商格式，srcPath 为原图的本地暂存文件
+func (s *ImageService) pregenerateAutoFormats(ctx context.Context, hash string, srcPath string, mimeType string) {
+	if !s.AutoFormatActive() || !autoFormatEligible(mimeType) {
+		return
+	}
+	var img model.Image
+	if err := s.db.WithContext(ctx).Where("hash = ?", hash).First(&img).Error; err != nil {
+		return
+	}
+	data, err := os.ReadFile(srcPath)
+	if err != nil {
+		s.log.Ctx(ctx).Warnf("Failed to read original for auto format: %v", err)
+		return
+	}
+	for _, format := range autoFormats {
+		if transformFormatMime[format] == mimeType {
+			break
+		}
+		s.generateAutoFormat(ctx, &img, data, format)
+	}
+}
@@ -1,9 +1,10 @@
 package service
 
 import (
-	"bytes"
 	"context"
 	"fmt"
+	"io"
+	"os"
 	"strings"
 	"time"
 
@@ -19,11 +20,13 @@ import (
 
 // CloudStorage 云端存储
 type CloudStorage struct {
-	cfg    *appconfig.Config
-	log    *logger.Logger
-	bucket string
-	region string
-	client *s3.Client
+	cfg     *appconfig.Config
+	log     *logger.Logger
+	bucket  string
+	region  string
+	client  *s3.Client
+	presign *s3.PresignClient
+	mode    string
 }
 
 // NewCloudStorage 创建云端存储实例
@@ -102,30 +105,55 @@ func NewCloudStorage(cfg *appconfig.Config, log *logger.Logger) (*CloudStorage,
 		log.Warnf("Failed to connect to bucket (might not exist): %v", err)
 	}
 
+	mode := cfg.CloudDeliveryMode
+	switch mode {
+	case DeliveryRedirect, DeliveryPresign, DeliveryProxy:
+	default:
+		log.Warnf("Unknown cloud delivery mode %q, falling back to %s", mode, DeliveryRedirect)
+		mode = DeliveryRedirect
+	}
+	log.Infof("Cloud delivery mode: %s", mode)
+
 	return &CloudStorage{
-		cfg:    cfg,
-		log:    log,
-		bucket: bucket,
-		region: region,
-		client: client,
+		cfg:     cfg,
+		log:     log,
+		bucket:  bucket,
+		region:  region,
+		client:  client,
+		presign: s3.NewPresignClient(client),
+		mode:    mode,
 	}, nil
 }
 
-// Save 保存图片到云端存储
-func (s *CloudStorage) Save(ctx context.Context, hash string, data []byte, mimeType string) (string, int64, error) {
+// Save 保存内容到云端存储。
+// 签名需要可重读的请求体与确定的长度，不满足时先落盘到临时文件再上传。
+func (s *CloudStorage) Save(ctx context.Context, hash string, r io.Reader, size int64, mimeType string) (string, int64, error) {
 	// 生成云端存储路径（按hash前两位分目录）
 	key := fmt.Sprintf("%s/%s", hash[:2], hash)
 
+	body, ok := r.(io.ReadSeeker)
+	if !ok || size < 0 {
+		spool, n, err := spoolToTemp(r, "anzuimg-cloud-*")
+		if err != nil {
+			return "", 0, err
+		}
+		defer func() {
+			_ = spool.Close()
+			_ = os.Remove(spool.Name())
+		}()
+		body, size = spool, n
+	}
+
 	s.log.Ctx(ctx).Infof("Uploading to cloud storage: bucket=%s, key=%s, size=%d",
-		s.bucket, key, len(data))
+		s.bucket, key, size)
 
 	// 上传到S3
 	input := &s3.PutObjectInput{
 		Bucket:        aws.String(s.bucket),
 		Key:           aws.String(key),
-		Body:          bytes.NewReader(data),
+		Body:          body,
 		ContentType:   aws.String(mimeType),
-		ContentLength: aws.Int64(int64(len(data))),
+		ContentLength: aws.Int64(size),
 		// 设置缓存控制（1年）
 		CacheControl: aws.String("public, max-age=31536000"),
 	}
@@ -139,7 +167,7 @@ func (s *CloudStorage) Save(ctx context.Context, hash string, data []byte, mimeT
 	}
 
 	s.log.Ctx(ctx).Infof("Successfully uploaded to cloud storage: bucket=%s, key=%s", s.bucket, key)
-	return key, int64(len(data)), nil
+	return key, size, nil
 }
 
 // GetAbsPath 根据相对路径获取访问URL
@@ -163,6 +191,76 @@ func normalizeEndpointHost(endpoint string) string {
 	return strings.TrimSuffix(endpoint, "/")
 }
 
+// Open 打开云端对象，按当前读取位置发起范围请求，Seek 后重新请求
+func (s *CloudStorage) Open(ctx context.Context, relPath string) (io.ReadSeekCloser, error) {
+	head, err := s.client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(relPath),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat object in cloud storage: %w", err)
+	}
+	return &rangedReader{
+		ctx:  ctx,
+		size: aws.ToInt64(head.ContentLength),
+		fetch: func(ctx context.Context, offset int64) (io.ReadCloser, error) {
+			out, err := s.client.GetObject(ctx, &s3.GetObjectInput{
+				Bucket: aws.String(s.bucket),
+				Key:    aws.String(relPath),
+				Range:  aws.String(fmt.Sprintf("bytes=%d-", offset)),
+			})
+			if err != nil {
+				return nil, fmt.Errorf("failed to get object from cloud storage: %w", err)
+			}
+			return out.Body, nil
+		},
+	}, nil
+}
+
+// DeliveryMode 返回分发方式
+func (s *CloudStorage) DeliveryMode() string {
+	return s.mode
+}
+
+// PresignGet 生成预签名下载地址
+func (s *CloudStorage) PresignGet(ctx context.Context, relPath string) (string, time.Duration, error) {
+	ttl := time.Duration(s.cfg.CloudPresignTTLSec) * time.Second
+	if ttl <= 0 {
+		ttl = time.Hour
+	}
+	req, err := s.presign.PresignGetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(relPath),
+	}, s3.WithPresignExpires(ttl))
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to presign object: %w", err)
+	}
+	return req.URL, ttl, nil
+}
+
+// OpenRange 按范围读取云端对象，Range 头原样透传
+func (s *CloudStorage) OpenRange(ctx context.Context, relPath string, rangeHeader string) (*ObjectStream, error) {
+	input := &s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(relPath),
+	}
+	if rangeHeader != "" {
+		input.Range = aws.String(rangeHeader)
+	}
+	out, err := s.client.GetObject(ctx, input)
+	if err != nil {
+		if strings.Contains(err.Error(), "InvalidRange") {
+			return nil, ErrInvalidRange
+		}
+		return nil, fmt.Errorf("failed to get object from cloud storage: %w", err)
+	}
+	return &ObjectStream{
+		Body:          out.Body,
+		ContentLength: aws.ToInt64(out.ContentLength),
+		ContentRange:  aws.ToString(out.ContentRange),
+	}, nil
+}
+
 // Delete 删除云端文件
 func (s *CloudStorage) Delete(ctx context.Context, relPath string) error {
 	s.log.Ctx(ctx).Infof("Deleting from cloud storage: bucket=%s, key=%s",
@@ -201,6 +299,31 @@ func (s *CloudStorage) Exists(ctx context.Context, relPath string) (bool, error)
 	return true, nil
 }
 
+// List 分页遍历存储桶中的对象，S3 按键的字典序返回
+func (s *CloudStorage) List(ctx context.Context, startAfter string, fn func(StorageObject) error) error {
+	input := &s3.ListObjectsV2Input{Bucket: aws.String(s.bucket)}
+	if startAfter != "" {
+		input.StartAfter = aws.String(startAfter)
+	}
+	paginator := s3.NewListObjectsV2Paginator(s.client, input)
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to list cloud storage: %w", err)
+		}
+		for _, obj := range page.Contents {
+			if err := fn(StorageObject{
+				Path:    aws.ToString(obj.Key),
+				Size:    aws.ToInt64(obj.Size),
+				ModTime: aws.ToTime(obj.LastModified),
+			}); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
 // Type 返回存储类型
 func (s *CloudStorage) Type() string {
 	return "cloud"
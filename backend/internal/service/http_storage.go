@@ -0,0 +1,290 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/TangTangChu/AnzuImg/backend/internal/config"
+	"github.com/TangTangChu/AnzuImg/backend/internal/logger"
+)
+
+// errPresignUnsupported 表示存储后端不能生成带有效期的下载地址
+var errPresignUnsupported = errors.New("presigned urls are not supported by this storage")
+
+// httpObjectStore 以 HTTP PUT/GET/HEAD/DELETE 读写对象，是 HTTP 与 WebDAV 存储的公共部分
+type httpObjectStore struct {
+	log       *logger.Logger
+	kind      string
+	base      *url.URL
+	publicURL string
+	client    *http.Client
+	// authorize 为每个请求附加认证信息
+	authorize func(req *http.Request)
+	putHeader http.Header
+	// beforePut 在上传前调用，WebDAV 用它创建父目录
+	beforePut func(ctx context.Context, relPath string) error
+}
+
+func newHTTPObjectStore(kind, rawURL, publicURL string, log *logger.Logger) (*httpObjectStore, error) {
+	if rawURL == "" {
+		return nil, fmt.Errorf("%s storage url is required", kind)
+	}
+	base, err := url.Parse(rawURL)
+	if err != nil || (base.Scheme != "http" && base.Scheme != "https") || base.Host == "" {
+		return nil, fmt.Errorf("invalid %s storage url: %s", kind, rawURL)
+	}
+	base.Path = strings.TrimSuffix(base.Path, "/")
+	base.RawPath = ""
+	return &httpObjectStore{
+		log:       log,
+		kind:      kind,
+		base:      base,
+		publicURL: strings.TrimSuffix(publicURL, "/"),
+		client:    &http.Client{},
+		authorize: func(*http.Request) {},
+		putHeader: http.Header{},
+	}, nil
+}
+
+// objectURL 返回对象地址，保留基础地址上的查询参数
+func (s *httpObjectStore) objectURL(relPath string) string {
+	u := *s.base
+	if relPath != "" {
+		u.Path = s.base.Path + "/" + strings.TrimPrefix(relPath, "/")
+	}
+	return u.String()
+}
+
+// request 发送请求，调用方负责关闭响应体
+func (s *httpObjectStore) request(ctx context.Context, method, target string, body io.Reader, header http.Header) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, target, body)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	s.authorize(req)
+	return s.client.Do(req)
+}
+
+// statusError 把非预期的响应转换为错误并关闭响应体
+func (s *httpObjectStore) statusError(method, relPath string, resp *http.Response) error {
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 4<<10))
+	_ = resp.Body.Close()
+	return fmt.Errorf("%s %s %s: unexpected status %s", s.kind, method, relPath, resp.Status)
+}
+
+// ping 检查服务是否可达且凭据有效，失败时只记录警告，与云存储的 HeadBucket 检查一致
+func (s *httpObjectStore) ping(method string, header http.Header) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	resp, err := s.request(ctx, method, s.objectURL(""), nil, header)
+	if err != nil {
+		s.log.Warnf("Failed to connect to %s storage: %v", s.kind, err)
+		return
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden {
+		s.log.Warnf("Failed to connect to %s storage (check credentials): %s", s.kind, resp.Status)
+	}
+}
+
+// Save 以 PUT 上传对象，长度未知时先落盘以便携带 Content-Length
+func (s *httpObjectStore) Save(ctx context.Context, hash string, r io.Reader, size int64, mimeType string) (string, int64, error) {
+	key := fmt.Sprintf("%s/%s", hash[:2], hash)
+	if size < 0 {
+		spool, n, err := spoolToTemp(r, "anzuimg-"+s.kind+"-*")
+		if err != nil {
+			return "", 0, err
+		}
+		defer func() {
+			_ = spool.Close()
+			_ = os.Remove(spool.Name())
+		}()
+		r, size = spool, n
+	}
+	if s.beforePut != nil {
+		if err := s.beforePut(ctx, key); err != nil {
+			return "", 0, err
+		}
+	}
+
+	header := s.putHeader.Clone()
+	header.Set("Content-Type", mimeType)
+	header.Set("Cache-Control", "public, max-age=31536000")
+	if mimeType == "image/svg+xml" {
+		header.Set("Content-Disposition", "attachment")
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, s.objectURL(key), io.NopCloser(r))
+	if err != nil {
+		return "", 0, err
+	}
+	req.ContentLength = size
+	req.Header = header
+	s.authorize(req)
+
+	s.log.Ctx(ctx).Infof("Uploading to %s storage: key=%s, size=%d", s.kind, key, size)
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to upload to %s storage: %w", s.kind, err)
+	}
+	if resp.StatusCode/100 != 2 {
+		return "", 0, s.statusError(http.MethodPut, key, resp)
+	}
+	_ = resp.Body.Close()
+	return key, size, nil
+}
+
+// GetAbsPath 返回公开访问地址，未配置时返回不带查询参数的存储地址
+func (s *httpObjectStore) GetAbsPath(ctx context.Context, relPath string) (string, error) {
+	if s.publicURL != "" {
+		return s.publicURL + "/" + relPath, nil
+	}
+	u, err := url.Parse(s.objectURL(relPath))
+	if err != nil {
+		return "", err
+	}
+	u.RawQuery = ""
+	u.User = nil
+	return u.String(), nil
+}
+
+// Open 打开远端对象，按当前读取位置发起范围请求
+func (s *httpObjectStore) Open(ctx context.Context, relPath string) (io.ReadSeekCloser, error) {
+	resp, err := s.request(ctx, http.MethodHead, s.objectURL(relPath), nil, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat object in %s storage: %w", s.kind, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, s.statusError(http.MethodHead, relPath, resp)
+	}
+	_ = resp.Body.Close()
+	if resp.ContentLength < 0 {
+		return nil, fmt.Errorf("%s storage did not report the size of %s", s.kind, relPath)
+	}
+	return &rangedReader{
+		ctx:  ctx,
+		size: resp.ContentLength,
+		fetch: func(ctx context.Context, offset int64) (io.ReadCloser, error) {
+			stream, err := s.OpenRange(ctx, relPath, fmt.Sprintf("bytes=%d-", offset))
+			if err != nil {
+				return nil, err
+			}
+			return stream.Body, nil
+		},
+	}, nil
+}
+
+// DeliveryMode 配置了公开地址时重定向，否则由服务端代理
+func (s *httpObjectStore) DeliveryMode() string {
+	if s.publicURL != "" {
+		return DeliveryRedirect
+	}
+	return DeliveryProxy
+}
+
+// PresignGet HTTP 存储不支持预签名
+func (s *httpObjectStore) PresignGet(ctx context.Context, relPath string) (string, time.Duration, error) {
+	return "", 0, errPresignUnsupported
+}
+
+// OpenRange 按范围读取对象，Range 头原样透传
+func (s *httpObjectStore) OpenRange(ctx context.Context, relPath string, rangeHeader string) (*ObjectStream, error) {
+	header := http.Header{}
+	if rangeHeader != "" {
+		header.Set("Range", rangeHeader)
+	}
+	resp, err := s.request(ctx, http.MethodGet, s.objectURL(relPath), nil, header)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get object from %s storage: %w", s.kind, err)
+	}
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusPartialContent:
+	case http.StatusRequestedRangeNotSatisfiable:
+		_ = resp.Body.Close()
+		return nil, ErrInvalidRange
+	default:
+		return nil, s.statusError(http.MethodGet, relPath, resp)
+	}
+	return &ObjectStream{
+		Body:          resp.Body,
+		ContentLength: resp.ContentLength,
+		ContentRange:  resp.Header.Get("Content-Range"),
+	}, nil
+}
+
+// Delete 删除对象，对象不存在视为删除成功
+func (s *httpObjectStore) Delete(ctx context.Context, relPath string) error {
+	s.log.Ctx(ctx).Infof("Deleting from %s storage: key=%s", s.kind, relPath)
+	resp, err := s.request(ctx, http.MethodDelete, s.objectURL(relPath), nil, nil)
+	if err != nil {
+		return fmt.Errorf("failed to delete from %s storage: %w", s.kind, err)
+	}
+	if resp.StatusCode/100 != 2 && resp.StatusCode != http.StatusNotFound {
+		return s.statusError(http.MethodDelete, relPath, resp)
+	}
+	_ = resp.Body.Close()
+	return nil
+}
+
+// Exists 以 HEAD 请求检查对象是否存在
+func (s *httpObjectStore) Exists(ctx context.Context, relPath string) (bool, error) {
+	resp, err := s.request(ctx, http.MethodHead, s.objectURL(relPath), nil, nil)
+	if err != nil {
+		return false, fmt.Errorf("failed to check object existence: %w", err)
+	}
+	switch resp.StatusCode {
+	case http.StatusOK:
+		_ = resp.Body.Close()
+		return true, nil
+	case http.StatusNotFound:
+		_ = resp.Body.Close()
+		return false, nil
+	default:
+		return false, s.statusError(http.MethodHead, relPath, resp)
+	}
+}
+
+// Type 返回存储类型
+func (s *httpObjectStore) Type() string {
+	return s.kind
+}
+
+// HTTPStorage 通用 HTTP 存储：PUT 上传、GET 读取、DELETE 删除。
+// 基础地址可以携带查询参数，例如以 SAS 令牌访问的 Azure Blob 容器
+// （需配置 PutHeaders 为 "x-ms-blob-type: BlockBlob"）。
+type HTTPStorage struct {
+	*httpObjectStore
+}
+
+// NewHTTPStorage 创建通用 HTTP 存储实例
+func NewHTTPStorage(cfg *config.Config, log *logger.Logger) (*HTTPStorage, error) {
+	store, err := newHTTPObjectStore(string(StorageTypeHTTP), cfg.HTTPStorageURL, cfg.HTTPStoragePublicURL, log)
+	if err != nil {
+		return nil, err
+	}
+	if token := cfg.HTTPStorageToken; token != "" {
+		store.authorize = func(req *http.Request) {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+	}
+	for _, h := range cfg.HTTPStoragePutHeaders {
+		k, v, ok := strings.Cut(h, ":")
+		if !ok || strings.TrimSpace(k) == "" {
+			return nil, fmt.Errorf("invalid http storage put header: %q", h)
+		}
+		store.putHeader.Add(strings.TrimSpace(k), strings.TrimSpace(v))
+	}
+
+	log.Infof("Initializing http storage: url=%s, delivery=%s", store.base.Host+store.base.Path, store.DeliveryMode())
+	store.ping(http.MethodHead, nil)
+	return &HTTPStorage{httpObjectStore: store}, nil
+}
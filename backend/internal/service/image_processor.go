@@ -124,26 +124,49 @@ func DetectImageDimensions(data []byte) (width, height int, err error) {
 	return width, height, err
 }
 
-// GenerateThumbnail 生成 WebP 缩略图
-func GenerateThumbnail(reader io.Reader, width, height int) ([]byte, error) {
+// GenerateThumbnail 生成缩略图，format 为 webp、avif 或 jpeg，返回编码后的内容与 MIME 类型
+func GenerateThumbnail(reader io.Reader, width, height int, format string) ([]byte, string, error) {
 	source := vips.NewSource(io.NopCloser(reader))
 	img, err := vips.NewThumbnailSource(source, width, &vips.ThumbnailSourceOptions{
 		Height: height,
 		Size:   vips.SizeDown,
 	})
 	if err != nil {
-		return nil, fmt.Errorf("thumbnail failed: %v", err)
+		return nil, "", fmt.Errorf("thumbnail failed: %v", err)
 	}
 	defer img.Close()
-	buf, err := img.WebpsaveBuffer(&vips.WebpsaveBufferOptions{
-		Q:      75,
-		Effort: 4,
-	})
+
+	var buf []byte
+	var mimeType string
+	switch format {
+	case "", "webp":
+		buf, err = img.WebpsaveBuffer(&vips.WebpsaveBufferOptions{
+			Q:      75,
+			Effort: 4,
+		})
+		format, mimeType = "webp", "image/webp"
+	case "avif":
+		buf, err = img.HeifsaveBuffer(&vips.HeifsaveBufferOptions{
+			Q:           50,
+			Effort:      4,
+			Compression: vips.HeifCompressionAv1,
+		})
+		mimeType = "image/avif"
+	case "jpeg":
+		buf, err = img.JpegsaveBuffer(&vips.JpegsaveBufferOptions{
+			Q:          80,
+			Interlace:  true,
+			Background: []float64{255, 255, 255},
+		})
+		mimeType = "image/jpeg"
+	default:
+		return nil, "", fmt.Errorf("unsupported thumbnail format: %s", format)
+	}
 	if err != nil {
-		return nil, fmt.Errorf("webp encode failed: %v", err)
+		return nil, "", fmt.Errorf("%s encode failed: %v", format, err)
 	}
 
-	return buf, nil
+	return buf, mimeType, nil
 }
 
 // ConvertImage 将图片转换为指定格式
@@ -0,0 +1,463 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"mime"
+	"net/url"
+	"regexp"
+	"regexp/syntax"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/TangTangChu/AnzuImg/backend/internal/model"
+)
+
+var (
+	ErrRouteNotFound = errors.New("route not found")
+	ErrInvalidRoute  = errors.New("invalid route")
+	ErrRouteExpired  = errors.New("route expired")
+	ErrRouteExists   = errors.New("route already exists")
+	// ErrRouteInUse 表示路由仍是其他路由的重定向目标，不能删除
+	ErrRouteInUse = errors.New("route is a redirect target")
+)
+
+// 路由的下载方式
+const (
+	RouteDispositionInline     = "inline"
+	RouteDispositionAttachment = "attachment"
+)
+
+const (
+	maxRouteLength = 255
+	// 路由校验规则的默认值，可通过系统配置 ROUTE_ALLOWED_CHARS 与 ROUTE_MAX_DEPTH 调整。
+	// 默认除 / 与控制字符外均允许，与引入校验前已创建的路由（可含空格、+、@ 等）保持兼容
+	defaultRouteAllowedChars = `^/\p{C}`
+	defaultRouteMaxDepth     = 8
+	// 路由因被重定向而无法删除时，错误信息中最多列出的来源路由数
+	maxReportedReferrers = 5
+)
+
+// RouteInput 是创建或修改路由的字段，nil 表示不修改。
+// ImageHash 与 RedirectTo 只能设置其一，设置一个会清除另一个；ExpiresAt 为零值表示永不过期，
+// ContentDisposition 与 DownloadFilename 为空字符串表示恢复默认。
+type RouteInput struct {
+	ImageHash          *string
+	RedirectTo         *string
+	ExpiresAt          *time.Time
+	ContentDisposition *string
+	DownloadFilename   *string
+}
+
+// RouteFilter 按命名空间前缀或关键字筛选路由，零值表示不限。
+// Prefix 按段匹配，brand/logo 匹配 brand/logo 本身及 brand/logo/dark，不匹配 brand/logos。
+type RouteFilter struct {
+	Prefix string
+	Query  string
+}
+
+// routeSegmentPattern 把允许的字符类编译为单段路由的匹配规则
+func routeSegmentPattern(allowed string) (*regexp.Regexp, error) {
+	allowed = strings.TrimSpace(allowed)
+	if allowed == "" {
+		return nil, errors.New("allowed characters must not be empty")
+	}
+	// 只接受单个字符类，避免 a-z]|.* 之类的内容改变整体规则
+	class, err := syntax.Parse(`[`+allowed+`]`, syntax.Perl)
+	if err != nil {
+		return nil, fmt.Errorf("invalid character class: %w", err)
+	}
+	if class.Op != syntax.OpCharClass && class.Op != syntax.OpLiteral {
+		return nil, fmt.Errorf("invalid character class: %q", allowed)
+	}
+	return regexp.MustCompile(`^[` + allowed + `]+$`), nil
+}
+
+// validateRoute 校验路由：按 / 分段，不允许空段与 . ..，段数不超过 maxDepth，每段只含允许的字符
+func validateRoute(route, allowed string, maxDepth int) (string, error) {
+	route = strings.TrimSpace(route)
+	if route == "" {
+		return "", fmt.Errorf("%w: route is required", ErrInvalidRoute)
+	}
+	if len(route) > maxRouteLength {
+		return "", fmt.Errorf("%w: route must be at most %d bytes", ErrInvalidRoute, maxRouteLength)
+	}
+	if maxDepth <= 0 {
+		maxDepth = defaultRouteMaxDepth
+	}
+	segments := strings.Split(route, "/")
+	if len(segments) > maxDepth {
+		return "", fmt.Errorf("%w: route must have at most %d segments", ErrInvalidRoute, maxDepth)
+	}
+	if allowed == "" {
+		allowed = defaultRouteAllowedChars
+	}
+	re, err := routeSegmentPattern(allowed)
+	if err != nil {
+		return "", fmt.Errorf("route charset misconfigured: %w", err)
+	}
+	for _, seg := range segments {
+		if seg == "" || seg == "." || seg == ".." {
+			return "", fmt.Errorf("%w: route %q contains an empty or relative segment", ErrInvalidRoute, route)
+		}
+		if !re.MatchString(seg) {
+			return "", fmt.Errorf("%w: route segment %q contains disallowed characters", ErrInvalidRoute, seg)
+		}
+	}
+	return route, nil
+}
+
+// normalizeRoute 按当前系统配置校验路由
+func (s *ImageService) normalizeRoute(route string) (string, error) {
+	eff := s.cfg.Effective()
+	return validateRoute(route, eff.RouteAllowedChars, eff.RouteMaxDepth)
+}
+
+// ValidateRoutes 校验一组路由，用于在接收上传前提前拒绝不合法的路由
+func (s *ImageService) ValidateRoutes(routes []string) error {
+	for _, r := range routes {
+		if _, err := s.normalizeRoute(r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RoutePath 返回路由的访问路径，各段分别转义
+func RoutePath(route string) string {
+	segments := strings.Split(route, "/")
+	for i, seg := range segments {
+		segments[i] = url.PathEscape(seg)
+	}
+	return "/i/r/" + strings.Join(segments, "/")
+}
+
+// normalizeRoutePrefix 去除前缀首尾的空白与 /
+func normalizeRoutePrefix(prefix string) string {
+	return strings.Trim(strings.TrimSpace(prefix), "/")
+}
+
+// routePrefixCond 返回 column 按段匹配前缀的查询条件
+func routePrefixCond(column, prefix string) (string, string, string) {
+	return "(" + column + " = ? OR " + column + " LIKE ?)", prefix, escapeLike(prefix) + "/%"
+}
+
+// routeFilterQuery 按筛选条件构造路由查询
+func (s *ImageService) routeFilterQuery(filter RouteFilter) *gorm.DB {
+	query := s.db.Model(&model.ImageRoute{})
+	if prefix := normalizeRoutePrefix(filter.Prefix); prefix != "" {
+		cond, exact, like := routePrefixCond("route", prefix)
+		query = query.Where(cond, exact, like)
+	}
+	if q := strings.TrimSpace(filter.Query); q != "" {
+		query = query.Where("route ILIKE ?", "%"+escapeLike(q)+"%")
+	}
+	return query
+}
+
+// DeleteRoutesByPrefix 删除命名空间前缀下的全部路由，返回删除数量；前缀不能为空。
+// 前缀外仍有路由重定向到前缀内时返回 ErrRouteInUse，不删除任何路由
+func (s *ImageService) DeleteRoutesByPrefix(prefix string) (int64, error) {
+	prefix = normalizeRoutePrefix(prefix)
+	if prefix == "" {
+		return 0, fmt.Errorf("%w: prefix is required", ErrInvalidRoute)
+	}
+	var deleted int64
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		routeCond, exact, like := routePrefixCond("route", prefix)
+		var ids []uint64
+		if err := tx.Model(&model.ImageRoute{}).Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where(routeCond, exact, like).Pluck("id", &ids).Error; err != nil {
+			return err
+		}
+		if len(ids) == 0 {
+			return nil
+		}
+
+		// 前缀内互相重定向的路由一并删除，只拦截来自前缀外的重定向
+		redirectCond, _, _ := routePrefixCond("redirect_to", prefix)
+		var referrers []string
+		if err := tx.Model(&model.ImageRoute{}).Where(redirectCond, exact, like).Not(routeCond, exact, like).
+			Order("route").Limit(maxReportedReferrers).Pluck("route", &referrers).Error; err != nil {
+			return err
+		}
+		if len(referrers) > 0 {
+			return routeInUseError(referrers)
+		}
+
+		result := tx.Where("id IN ?", ids).Delete(&model.ImageRoute{})
+		if result.Error != nil {
+			return result.Error
+		}
+		deleted = result.RowsAffected
+		return nil
+	})
+	if err != nil {
+		if errors.Is(err, ErrRouteInUse) {
+			return 0, err
+		}
+		return 0, fmt.Errorf("delete routes by prefix failed: %w", err)
+	}
+	return deleted, nil
+}
+
+// applyRouteInput 把除目标外的字段写入路由
+func applyRouteInput(r *model.ImageRoute, in RouteInput, now time.Time) error {
+	if in.ImageHash != nil && in.RedirectTo != nil {
+		return fmt.Errorf("%w: image_hash and redirect_to are mutually exclusive", ErrInvalidRoute)
+	}
+	if in.ExpiresAt != nil {
+		if in.ExpiresAt.IsZero() {
+			r.ExpiresAt = nil
+		} else {
+			if !in.ExpiresAt.After(now) {
+				return fmt.Errorf("%w: expires_at must be in the future", ErrInvalidRoute)
+			}
+			expiresAt := in.ExpiresAt.UTC()
+			r.ExpiresAt = &expiresAt
+		}
+	}
+	if in.ContentDisposition != nil {
+		switch d := strings.ToLower(strings.TrimSpace(*in.ContentDisposition)); d {
+		case "", RouteDispositionInline, RouteDispositionAttachment:
+			r.ContentDisposition = d
+		default:
+			return fmt.Errorf("%w: content_disposition must be inline or attachment", ErrInvalidRoute)
+		}
+	}
+	if in.DownloadFilename != nil {
+		name := strings.TrimSpace(*in.DownloadFilename)
+		if utf8.RuneCountInString(name) > maxRouteLength {
+			return fmt.Errorf("%w: download_filename must be at most %d characters", ErrInvalidRoute, maxRouteLength)
+		}
+		if strings.ContainsAny(name, "/\\\r\n\x00") {
+			return fmt.Errorf("%w: download_filename contains invalid characters", ErrInvalidRoute)
+		}
+		r.DownloadFilename = name
+	}
+	return nil
+}
+
+// RouteContentDisposition 计算路由输出时的 Content-Disposition，路由未覆盖下载方式与文件名时返回空。
+// 只设置文件名时按 inline 输出；SVG 始终以附件下载。
+func RouteContentDisposition(r *model.ImageRoute, img *model.Image) string {
+	if r.ContentDisposition == "" && r.DownloadFilename == "" {
+		return ""
+	}
+	disposition := r.ContentDisposition
+	if disposition == "" {
+		disposition = RouteDispositionInline
+	}
+	if img.MimeType == "image/svg+xml" {
+		disposition = RouteDispositionAttachment
+	}
+	name := r.DownloadFilename
+	if name == "" {
+		name = img.FileName
+	}
+	if name == "" {
+		return disposition
+	}
+	if value := mime.FormatMediaType(disposition, map[string]string{"filename": name}); value != "" {
+		return value
+	}
+	return disposition
+}
+
+// setRouteTarget 在事务中设置路由目标。重定向目标必须存在、不能是自身，且不能形成重定向链
+func setRouteTarget(tx *gorm.DB, r *model.ImageRoute, in RouteInput) error {
+	switch {
+	case in.ImageHash != nil:
+		var img model.Image
+		if err := tx.Select("id").Where("hash = ?", *in.ImageHash).First(&img).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return fmt.Errorf("%w: image %s not found", ErrInvalidRoute, *in.ImageHash)
+			}
+			return err
+		}
+		r.ImageID = &img.ID
+		r.RedirectTo = ""
+	case in.RedirectTo != nil:
+		target := strings.TrimSpace(*in.RedirectTo)
+		if target == "" || target == r.Route {
+			return fmt.Errorf("%w: redirect_to must be another route", ErrInvalidRoute)
+		}
+		// 共享锁与删除路由时的行锁互斥，避免指向正在删除的路由
+		var dst model.ImageRoute
+		if err := tx.Clauses(clause.Locking{Strength: "SHARE"}).Select("id", "redirect_to").Where("route = ?", target).First(&dst).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return fmt.Errorf("%w: redirect target %s not found", ErrInvalidRoute, target)
+			}
+			return err
+		}
+		if dst.RedirectTo != "" {
+			return fmt.Errorf("%w: redirect target %s is itself a redirect", ErrInvalidRoute, target)
+		}
+		if r.ID != 0 {
+			var count int64
+			if err := tx.Model(&model.ImageRoute{}).Where("redirect_to = ?", r.Route).Count(&count).Error; err != nil {
+				return err
+			}
+			if count > 0 {
+				return fmt.Errorf("%w: route %s is a redirect target and cannot redirect", ErrInvalidRoute, r.Route)
+			}
+		}
+		r.ImageID = nil
+		r.RedirectTo = target
+	}
+	return nil
+}
+
+// routeInUseError 列出仍重定向到待删除路由的路由
+func routeInUseError(referrers []string) error {
+	return fmt.Errorf("%w: redirected from %s", ErrRouteInUse, strings.Join(referrers, ", "))
+}
+
+// ensureNoRedirectReferrers 在删除路由前检查是否仍有路由重定向到 targets，避免留下失效的重定向。
+// 调用方应先锁定待删除的路由行
+func ensureNoRedirectReferrers(tx *gorm.DB, targets []string) error {
+	if len(targets) == 0 {
+		return nil
+	}
+	var referrers []string
+	if err := tx.Model(&model.ImageRoute{}).Where("redirect_to IN ?", targets).
+		Order("route").Limit(maxReportedReferrers).Pluck("route", &referrers).Error; err != nil {
+		return err
+	}
+	if len(referrers) > 0 {
+		return routeInUseError(referrers)
+	}
+	return nil
+}
+
+// attachImageRoute 为图片新增路由，路由已指向该图片时视为成功，
+// 使超时重新认领的上传任务在图片已入库后重试不会因唯一索引失败
+func attachImageRoute(tx *gorm.DB, imageID uint64, route string) error {
+	var current []model.ImageRoute
+	if err := tx.Where("route = ?", route).Limit(1).Find(&current).Error; err != nil {
+		return fmt.Errorf("route lookup failed: %w", err)
+	}
+	if len(current) > 0 && current[0].ImageID != nil && *current[0].ImageID == imageID {
+		return nil
+	}
+	r := model.ImageRoute{ImageID: &imageID, Route: route}
+	if err := tx.Create(&r).Error; err != nil {
+		if isDuplicateKeyError(err) {
+			return fmt.Errorf("%w: %s", ErrRouteExists, route)
+		}
+		return fmt.Errorf("route insert failed: %w", err)
+	}
+	return nil
+}
+
+// isDuplicateKeyError 判断错误是否来自唯一约束冲突
+func isDuplicateKeyError(err error) bool {
+	msg := strings.ToLower(err.Error())
+	return strings.Contains(msg, "duplicate key") ||
+		strings.Contains(msg, "unique constraint") ||
+		strings.Contains(msg, "violates unique")
+}
+
+// GetRoute 获取路由详情
+func (s *ImageService) GetRoute(route string) (*model.ImageRoute, error) {
+	var r model.ImageRoute
+	if err := s.db.Preload("Image").Where("route = ?", route).First(&r).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrRouteNotFound
+		}
+		return nil, err
+	}
+	return &r, nil
+}
+
+// CreateRoute 创建指向图片或重定向到其他路由的路由
+func (s *ImageService) CreateRoute(route string, in RouteInput) (*model.ImageRoute, error) {
+	route, err := s.normalizeRoute(route)
+	if err != nil {
+		return nil, err
+	}
+	if in.ImageHash == nil && in.RedirectTo == nil {
+		return nil, fmt.Errorf("%w: image_hash or redirect_to is required", ErrInvalidRoute)
+	}
+	r := model.ImageRoute{Route: route}
+	if err := applyRouteInput(&r, in, time.Now()); err != nil {
+		return nil, err
+	}
+	if err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := setRouteTarget(tx, &r, in); err != nil {
+			return err
+		}
+		if err := tx.Create(&r).Error; err != nil {
+			return fmt.Errorf("route insert failed: %w", err)
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	return s.GetRoute(route)
+}
+
+// UpdateRoute 修改路由。改指图片或重定向目标在同一事务中完成，并把原目标写入历史，
+// 使稳定地址背后的图片可以原子替换。
+func (s *ImageService) UpdateRoute(route string, in RouteInput) (*model.ImageRoute, error) {
+	if err := s.db.Transaction(func(tx *gorm.DB) error {
+		var r model.ImageRoute
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("route = ?", route).First(&r).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrRouteNotFound
+			}
+			return err
+		}
+		if err := applyRouteInput(&r, in, time.Now()); err != nil {
+			return err
+		}
+
+		if in.ImageHash != nil || in.RedirectTo != nil {
+			history := model.ImageRouteHistory{RouteID: r.ID, RedirectTo: r.RedirectTo}
+			if r.ImageID != nil {
+				if err := tx.Model(&model.Image{}).Where("id = ?", *r.ImageID).Pluck("hash", &history.ImageHash).Error; err != nil {
+					return err
+				}
+			}
+			prevImageID, prevRedirect := r.ImageID, r.RedirectTo
+			if err := setRouteTarget(tx, &r, in); err != nil {
+				return err
+			}
+			changed := r.RedirectTo != prevRedirect || (r.ImageID == nil) != (prevImageID == nil) ||
+				(r.ImageID != nil && *r.ImageID != *prevImageID)
+			if changed {
+				if err := tx.Create(&history).Error; err != nil {
+					return fmt.Errorf("route history insert failed: %w", err)
+				}
+			}
+		}
+
+		if err := tx.Model(&r).Select("ImageID", "RedirectTo", "ExpiresAt", "ContentDisposition", "DownloadFilename", "UpdatedAt").Updates(&r).Error; err != nil {
+			return fmt.Errorf("update route failed: %w", err)
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	return s.GetRoute(route)
+}
+
+// ListRouteHistory 按时间倒序获取路由的改指历史
+func (s *ImageService) ListRouteHistory(route string) ([]model.ImageRouteHistory, error) {
+	var r model.ImageRoute
+	if err := s.db.Select("id").Where("route = ?", route).First(&r).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrRouteNotFound
+		}
+		return nil, err
+	}
+	history := []model.ImageRouteHistory{}
+	if err := s.db.Where("route_id = ?", r.ID).Order("created_at DESC").Order("id DESC").Find(&history).Error; err != nil {
+		return nil, err
+	}
+	return history, nil
+}
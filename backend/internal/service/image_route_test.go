@@ -0,0 +1,110 @@
+package service
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/TangTangChu/AnzuImg/backend/internal/model"
+)
+
+func TestApplyRouteInput(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	str := func(s string) *string { return &s }
+
+	var r model.ImageRoute
+	future := now.Add(time.Hour)
+	err := applyRouteInput(&r, RouteInput{
+		ExpiresAt:          &future,
+		ContentDisposition: str(" Attachment "),
+		DownloadFilename:   str(" logo.png "),
+	}, now)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if r.ExpiresAt == nil || !r.ExpiresAt.Equal(future) || r.ContentDisposition != "attachment" || r.DownloadFilename != "logo.png" {
+		t.Fatalf("unexpected route: %+v", r)
+	}
+
+	if err := applyRouteInput(&r, RouteInput{ExpiresAt: &time.Time{}, ContentDisposition: str("")}, now); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if r.ExpiresAt != nil || r.ContentDisposition != "" || r.DownloadFilename != "logo.png" {
+		t.Fatalf("expected expiry and disposition cleared: %+v", r)
+	}
+
+	past := now.Add(-time.Second)
+	cases := map[string]RouteInput{
+		"both targets":   {ImageHash: str("abc"), RedirectTo: str("other")},
+		"past expiry":    {ExpiresAt: &past},
+		"bad type":       {ContentDisposition: str("download")},
+		"path separator": {DownloadFilename: str("../logo.png")},
+		"header break":   {DownloadFilename: str("a\r\nX-Evil: 1")},
+	}
+	for name, in := range cases {
+		if err := applyRouteInput(&model.ImageRoute{}, in, now); !errors.Is(err, ErrInvalidRoute) {
+			t.Fatalf("%s: expected ErrInvalidRoute, got %v", name, err)
+		}
+	}
+}
+
+func TestRouteContentDisposition(t *testing.T) {
+	png := &model.Image{FileName: "original.png", MimeType: "image/png"}
+	svg := &model.Image{FileName: "icon.svg", MimeType: "image/svg+xml"}
+
+	cases := []struct {
+		name  string
+		route model.ImageRoute
+		img   *model.Image
+		want  string
+	}{
+		{"default", model.ImageRoute{}, png, ""},
+		{"attachment", model.ImageRoute{ContentDisposition: "attachment"}, png, `attachment; filename=original.png`},
+		{"filename only", model.ImageRoute{DownloadFilename: "logo.png"}, png, `inline; filename=logo.png`},
+		{"quoted", model.ImageRoute{ContentDisposition: "inline", DownloadFilename: "my logo.png"}, png, `inline; filename="my logo.png"`},
+		{"non ascii", model.ImageRoute{DownloadFilename: "标志.png"}, png, `inline; filename*=utf-8''%E6%A0%87%E5%BF%97.png`},
+		{"svg forced", model.ImageRoute{ContentDisposition: "inline"}, svg, `attachment; filename=icon.svg`},
+	}
+	for _, tc := range cases {
+		if got := RouteContentDisposition(&tc.route, tc.img); got != tc.want {
+			t.Fatalf("%s: expected %q, got %q", tc.name, tc.want, got)
+		}
+	}
+}
+
+func TestValidateRoute(t *testing.T) {
+	valid := []string{"logo", "brand/logo/dark", " brand/logo ", "v1.2_final-~", "品牌/标志", "a b", "c++", "me@host", "a%2Fb"}
+	for _, r := range valid {
+		if _, err := validateRoute(r, "", 0); err != nil {
+			t.Fatalf("%q: unexpected error: %v", r, err)
+		}
+	}
+
+	invalid := []string{"", "/logo", "logo/", "brand//logo", "brand/../logo", "./logo", "a\tb", "a\x00b", "a/b/c/d/e/f/g/h/i"}
+	for _, r := range invalid {
+		if _, err := validateRoute(r, "", 0); !errors.Is(err, ErrInvalidRoute) {
+			t.Fatalf("%q: expected ErrInvalidRoute, got %v", r, err)
+		}
+	}
+
+	if _, err := validateRoute("brand/logo/dark", "", 2); !errors.Is(err, ErrInvalidRoute) {
+		t.Fatalf("expected depth limit, got %v", err)
+	}
+	if _, err := validateRoute("Logo", "a-z", 0); !errors.Is(err, ErrInvalidRoute) {
+		t.Fatalf("expected charset limit, got %v", err)
+	}
+	if _, err := validateRoute("a b", `\p{L}\p{N}._~-`, 0); !errors.Is(err, ErrInvalidRoute) {
+		t.Fatalf("expected strict charset to reject spaces, got %v", err)
+	}
+	for _, allowed := range []string{`\p{Nope}`, "a-z]|.*", "a-z][0-9", ""} {
+		if _, err := routeSegmentPattern(allowed); err == nil {
+			t.Fatalf("%q: expected invalid character class to be rejected", allowed)
+		}
+	}
+}
+
+func TestRoutePath(t *testing.T) {
+	if got := RoutePath("brand/logo dark/标"); got != "/i/r/brand/logo%20dark/%E6%A0%87" {
+		t.Fatalf("unexpected path: %s", got)
+	}
+}
@@ -0,0 +1,361 @@
+package service
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/TangTangChu/AnzuImg/backend/internal/model"
+)
+
+var ErrInvalidSearch = errors.New("invalid search")
+
+const (
+	defaultSearchLimit = 20
+	maxSearchLimit     = 100
+	maxSearchTags      = 20
+)
+
+// 媒体类型
+const (
+	MediaKindImage = "image"
+	MediaKindVideo = "video"
+	MediaKindOther = "other"
+)
+
+// imageSortColumns 是可排序字段与对应的列表达式，可能为 NULL 的列按 0 处理，保证游标比较有效
+var imageSortColumns = map[string]string{
+	"created_at": "created_at",
+	"size":       "size",
+	"file_name":  "file_name",
+	"width":      "COALESCE(width, 0)",
+	"height":     "COALESCE(height, 0)",
+	"duration":   "duration_seconds",
+}
+
+// descriptionTSVector 与 ensureTables 中的 idx_images_description_fts 表达式一致，否则用不上索引
+const descriptionTSVector = "to_tsvector('simple', COALESCE(description, ''))"
+
+// ImageSearch 图片检索条件，零值字段不参与过滤
+type ImageSearch struct {
+	Tags        []string // 必须全部包含
+	AnyTags     []string // 至少包含其一
+	ExcludeTags []string // 不得包含任何一个
+	Query       string   // 描述全文检索，支持引号短语、or 与 -排除
+	FileName    string
+	MimeTypes   []string // 可用 image/* 形式匹配大类
+	Kind        string   // image、video 或 other
+	Visibility  string   // public、unlisted 或 private
+
+	MinSize, MaxSize         int64
+	MinWidth, MaxWidth       int
+	MinHeight, MaxHeight     int
+	MinDuration, MaxDuration int // 秒
+
+	TokenID   *uint
+	StartDate string
+	EndDate   string
+
+	Sort   string // 见 imageSortColumns，默认 created_at
+	Desc   bool
+	Cursor string
+	Limit  int
+}
+
+// ImageSearchPage 一页检索结果，NextCursor 为空表示没有更多
+type ImageSearchPage struct {
+	Data       []model.Image `json:"data"`
+	NextCursor string        `json:"next_cursor"`
+	HasMore    bool          `json:"has_more"`
+}
+
+// searchCursor 记录上一页最后一条的排序值与 ID，连同排序方式一起编码，换了排序的游标直接拒绝
+type searchCursor struct {
+	Sort  string `json:"s"`
+	Desc  bool   `json:"d"`
+	Value string `json:"v"`
+	ID    uint64 `json:"i"`
+}
+
+// ParseImageSearch 从查询参数解析检索条件，多值参数用逗号分隔
+func ParseImageSearch(query url.Values) (*ImageSearch, error) {
+	s := &ImageSearch{
+		Tags:        splitCommaList(query.Get("tags")),
+		AnyTags:     splitCommaList(query.Get("any_tags")),
+		ExcludeTags: splitCommaList(query.Get("exclude_tags")),
+		Query:       strings.TrimSpace(query.Get("q")),
+		FileName:    strings.TrimSpace(query.Get("file_name")),
+		MimeTypes:   splitCommaList(strings.ToLower(query.Get("mime"))),
+		Kind:        strings.ToLower(strings.TrimSpace(query.Get("kind"))),
+		Visibility:  strings.ToLower(strings.TrimSpace(query.Get("visibility"))),
+		StartDate:   strings.TrimSpace(query.Get("start_date")),
+		EndDate:     strings.TrimSpace(query.Get("end_date")),
+		Sort:        strings.ToLower(strings.TrimSpace(query.Get("sort"))),
+		Desc:        true,
+		Cursor:      strings.TrimSpace(query.Get("cursor")),
+		Limit:       defaultSearchLimit,
+	}
+	// 兼容 /images 的单标签参数
+	if tag := strings.TrimSpace(query.Get("tag")); tag != "" {
+		s.Tags = append(s.Tags, tag)
+	}
+	if len(s.Tags)+len(s.AnyTags)+len(s.ExcludeTags) > maxSearchTags {
+		return nil, fmt.Errorf("%w: at most %d tags", ErrInvalidSearch, maxSearchTags)
+	}
+	switch s.Kind {
+	case "", MediaKindImage, MediaKindVideo, MediaKindOther:
+	default:
+		return nil, fmt.Errorf("%w: unknown kind %q", ErrInvalidSearch, s.Kind)
+	}
+	if s.Visibility != "" && !ValidVisibility(s.Visibility) {
+		return nil, fmt.Errorf("%w: unknown visibility %q", ErrInvalidSearch, s.Visibility)
+	}
+	if s.Sort == "" {
+		s.Sort = "created_at"
+	}
+	if _, ok := imageSortColumns[s.Sort]; !ok {
+		return nil, fmt.Errorf("%w: unknown sort %q", ErrInvalidSearch, s.Sort)
+	}
+	switch order := strings.ToLower(strings.TrimSpace(query.Get("order"))); order {
+	case "", "desc":
+	case "asc":
+		s.Desc = false
+	default:
+		return nil, fmt.Errorf("%w: unknown order %q", ErrInvalidSearch, order)
+	}
+	for _, raw := range []string{s.StartDate, s.EndDate} {
+		if _, ok := parseTimeBound(raw, false); raw != "" && !ok {
+			return nil, fmt.Errorf("%w: invalid date %q", ErrInvalidSearch, raw)
+		}
+	}
+
+	ints := []struct {
+		key string
+		dst *int
+	}{
+		{"min_width", &s.MinWidth}, {"max_width", &s.MaxWidth},
+		{"min_height", &s.MinHeight}, {"max_height", &s.MaxHeight},
+		{"min_duration", &s.MinDuration}, {"max_duration", &s.MaxDuration},
+		{"limit", &s.Limit},
+	}
+	for _, f := range ints {
+		raw := strings.TrimSpace(query.Get(f.key))
+		if raw == "" {
+			continue
+		}
+		v, err := strconv.Atoi(raw)
+		if err != nil || v < 0 {
+			return nil, fmt.Errorf("%w: invalid %s", ErrInvalidSearch, f.key)
+		}
+		*f.dst = v
+	}
+	for _, f := range []struct {
+		key string
+		dst *int64
+	}{{"min_size", &s.MinSize}, {"max_size", &s.MaxSize}} {
+		raw := strings.TrimSpace(query.Get(f.key))
+		if raw == "" {
+			continue
+		}
+		v, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil || v < 0 {
+			return nil, fmt.Errorf("%w: invalid %s", ErrInvalidSearch, f.key)
+		}
+		*f.dst = v
+	}
+	if s.Limit < 1 || s.Limit > maxSearchLimit {
+		return nil, fmt.Errorf("%w: limit must be between 1 and %d", ErrInvalidSearch, maxSearchLimit)
+	}
+	if raw := strings.TrimSpace(query.Get("token_id")); raw != "" {
+		v, err := strconv.ParseUint(raw, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("%w: invalid token_id", ErrInvalidSearch)
+		}
+		id := uint(v)
+		s.TokenID = &id
+	}
+	return s, nil
+}
+
+// tagsJSON 生成 jsonb 包含查询的参数
+func tagsJSON(tags ...string) string {
+	b, _ := json.Marshal(tags)
+	return string(b)
+}
+
+// apply 把过滤条件加到查询上，不含游标与排序
+func (s *ImageSearch) apply(q *gorm.DB) *gorm.DB {
+	if len(s.Tags) > 0 {
+		q = q.Where("tags @> ?", tagsJSON(s.Tags...))
+	}
+	if len(s.AnyTags) > 0 {
+		conds := make([]string, len(s.AnyTags))
+		args := make([]interface{}, len(s.AnyTags))
+		for i, tag := range s.AnyTags {
+			conds[i] = "tags @> ?"
+			args[i] = tagsJSON(tag)
+		}
+		q = q.Where(strings.Join(conds, " OR "), args...)
+	}
+	for _, tag := range s.ExcludeTags {
+		q = q.Where("NOT COALESCE(tags @> ?, FALSE)", tagsJSON(tag))
+	}
+	if s.Query != "" {
+		q = q.Where(descriptionTSVector+" @@ websearch_to_tsquery('simple', ?)", s.Query)
+	}
+	if s.FileName != "" {
+		q = q.Where("file_name ILIKE ?", "%"+escapeLike(s.FileName)+"%")
+	}
+	if len(s.MimeTypes) > 0 {
+		var conds []string
+		var args []interface{}
+		for _, m := range s.MimeTypes {
+			if major, ok := strings.CutSuffix(m, "/*"); ok {
+				conds = append(conds, "mime_type LIKE ?")
+				args = append(args, escapeLike(major)+"/%")
+			} else {
+				conds = append(conds, "mime_type = ?")
+				args = append(args, m)
+			}
+		}
+		q = q.Where(strings.Join(conds, " OR "), args...)
+	}
+	switch s.Kind {
+	case MediaKindImage:
+		q = q.Where("mime_type LIKE ?", "image/%")
+	case MediaKindVideo:
+		q = q.Where("mime_type LIKE ?", "video/%")
+	case MediaKindOther:
+		q = q.Where("mime_type NOT LIKE ? AND mime_type NOT LIKE ?", "image/%", "video/%")
+	}
+	if s.Visibility != "" {
+		q = q.Where("visibility = ?", s.Visibility)
+	}
+
+	ranges := []struct {
+		column   string
+		min, max int64
+	}{
+		{"size", s.MinSize, s.MaxSize},
+		{"COALESCE(width, 0)", int64(s.MinWidth), int64(s.MaxWidth)},
+		{"COALESCE(height, 0)", int64(s.MinHeight), int64(s.MaxHeight)},
+		{"duration_seconds", int64(s.MinDuration), int64(s.MaxDuration)},
+	}
+	for _, r := range ranges {
+		if r.min > 0 {
+			q = q.Where(r.column+" >= ?", r.min)
+		}
+		if r.max > 0 {
+			q = q.Where(r.column+" <= ?", r.max)
+		}
+	}
+
+	if s.TokenID != nil {
+		q = q.Where("uploaded_by_token_id = ?", *s.TokenID)
+	}
+	return applyTimeBounds(q, LogFilter{StartDate: s.StartDate, EndDate: s.EndDate})
+}
+
+// sortValue 返回图片在当前排序字段上的值，写入游标
+func (s *ImageSearch) sortValue(img *model.Image) string {
+	switch s.Sort {
+	case "size":
+		return strconv.FormatInt(img.Size, 10)
+	case "file_name":
+		return img.FileName
+	case "width":
+		return strconv.Itoa(img.Width)
+	case "height":
+		return strconv.Itoa(img.Height)
+	case "duration":
+		return strconv.Itoa(img.DurationSeconds)
+	default:
+		return img.CreatedAt.UTC().Format(time.RFC3339Nano)
+	}
+}
+
+// cursorValue 把游标中的排序值还原为查询参数
+func (s *ImageSearch) cursorValue(raw string) (interface{}, error) {
+	switch s.Sort {
+	case "created_at":
+		return time.Parse(time.RFC3339Nano, raw)
+	case "file_name":
+		return raw, nil
+	default:
+		return strconv.ParseInt(raw, 10, 64)
+	}
+}
+
+func encodeSearchCursor(c searchCursor) string {
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodeSearchCursor(raw string) (searchCursor, error) {
+	var c searchCursor
+	b, err := base64.RawURLEncoding.DecodeString(raw)
+	if err != nil {
+		return c, err
+	}
+	err = json.Unmarshal(b, &c)
+	return c, err
+}
+
+// SearchImages 按条件检索图片，使用 (排序字段, id) 游标翻页，新上传的图片不会造成重复或遗漏
+func (s *ImageService) SearchImages(ctx context.Context, search *ImageSearch) (*ImageSearchPage, error) {
+	column := imageSortColumns[search.Sort]
+	if column == "" {
+		return nil, fmt.Errorf("%w: unknown sort %q", ErrInvalidSearch, search.Sort)
+	}
+	limit := search.Limit
+	if limit < 1 || limit > maxSearchLimit {
+		limit = defaultSearchLimit
+	}
+
+	q := search.apply(s.db.WithContext(ctx).Model(&model.Image{}))
+	cmp, dir := ">", "ASC"
+	if search.Desc {
+		cmp, dir = "<", "DESC"
+	}
+	if search.Cursor != "" {
+		cur, err := decodeSearchCursor(search.Cursor)
+		if err != nil || cur.Sort != search.Sort || cur.Desc != search.Desc {
+			return nil, fmt.Errorf("%w: invalid cursor", ErrInvalidSearch)
+		}
+		v, err := search.cursorValue(cur.Value)
+		if err != nil {
+			return nil, fmt.Errorf("%w: invalid cursor", ErrInvalidSearch)
+		}
+		q = q.Where(fmt.Sprintf("(%s, id) %s (?, ?)", column, cmp), v, cur.ID)
+	}
+
+	var images []model.Image
+	if err := q.Order(column + " " + dir).Order("id " + dir).Limit(limit + 1).Find(&images).Error; err != nil {
+		return nil, fmt.Errorf("search images failed: %w", err)
+	}
+
+	page := &ImageSearchPage{Data: images}
+	if len(images) > limit {
+		page.Data = images[:limit]
+		page.HasMore = true
+		last := &page.Data[limit-1]
+		page.NextCursor = encodeSearchCursor(searchCursor{
+			Sort:  search.Sort,
+			Desc:  search.Desc,
+			Value: search.sortValue(last),
+			ID:    last.ID,
+		})
+	}
+	if page.Data == nil {
+		page.Data = []model.Image{}
+	}
+	return page, nil
+}
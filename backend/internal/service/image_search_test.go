@@ -0,0 +1,106 @@
+package service
+
+import (
+	"errors"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/TangTangChu/AnzuImg/backend/internal/model"
+)
+
+func TestParseImageSearch(t *testing.T) {
+	s, err := ParseImageSearch(url.Values{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if s.Sort != "created_at" || !s.Desc || s.Limit != defaultSearchLimit {
+		t.Fatalf("unexpected defaults: %+v", s)
+	}
+
+	s, err = ParseImageSearch(url.Values{
+		"tags":       {"cat, cute"},
+		"tag":        {"pet"},
+		"any_tags":   {"a,b"},
+		"mime":       {"IMAGE/*,video/mp4"},
+		"kind":       {"image"},
+		"min_size":   {"1024"},
+		"max_width":  {"4000"},
+		"token_id":   {"7"},
+		"start_date": {"2026-01-01"},
+		"sort":       {"size"},
+		"order":      {"asc"},
+		"limit":      {"50"},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(s.Tags) != 3 || s.Tags[2] != "pet" || len(s.AnyTags) != 2 || s.MimeTypes[0] != "image/*" {
+		t.Fatalf("unexpected tags or mime: %+v", s)
+	}
+	if s.MinSize != 1024 || s.MaxWidth != 4000 || s.TokenID == nil || *s.TokenID != 7 {
+		t.Fatalf("unexpected ranges: %+v", s)
+	}
+	if s.Sort != "size" || s.Desc || s.Limit != 50 {
+		t.Fatalf("unexpected paging: %+v", s)
+	}
+
+	invalid := []url.Values{
+		{"kind": {"audio"}},
+		{"visibility": {"hidden"}},
+		{"sort": {"hash"}},
+		{"order": {"up"}},
+		{"limit": {"101"}},
+		{"limit": {"0"}},
+		{"min_size": {"-1"}},
+		{"max_duration": {"long"}},
+		{"token_id": {"x"}},
+		{"end_date": {"yesterday"}},
+	}
+	for _, q := range invalid {
+		if _, err := ParseImageSearch(q); !errors.Is(err, ErrInvalidSearch) {
+			t.Fatalf("expected ErrInvalidSearch for %v, got %v", q, err)
+		}
+	}
+}
+
+func TestSearchCursorRoundTrip(t *testing.T) {
+	created := time.Date(2026, 7, 4, 8, 30, 0, 123456000, time.FixedZone("CST", 8*3600))
+	img := &model.Image{ID: 42, Size: 2048, FileName: "a,b.png", Width: 640, CreatedAt: created}
+
+	cases := []struct {
+		sort string
+		want interface{}
+	}{
+		{"created_at", created},
+		{"size", int64(2048)},
+		{"file_name", "a,b.png"},
+		{"width", int64(640)},
+		{"duration", int64(0)},
+	}
+	for _, tc := range cases {
+		s := &ImageSearch{Sort: tc.sort, Desc: true}
+		raw := encodeSearchCursor(searchCursor{Sort: s.Sort, Desc: s.Desc, Value: s.sortValue(img), ID: img.ID})
+		cur, err := decodeSearchCursor(raw)
+		if err != nil || cur.ID != 42 || cur.Sort != tc.sort {
+			t.Fatalf("%s: decode = %+v, %v", tc.sort, cur, err)
+		}
+		v, err := s.cursorValue(cur.Value)
+		if err != nil {
+			t.Fatalf("%s: cursor value: %v", tc.sort, err)
+		}
+		if want, ok := tc.want.(time.Time); ok {
+			if got := v.(time.Time); !got.Equal(want) {
+				t.Fatalf("%s: got %v, want %v", tc.sort, got, want)
+			}
+			continue
+		}
+		if v != tc.want {
+			t.Fatalf("%s: got %v, want %v", tc.sort, v, tc.want)
+		}
+	}
+
+	if _, err := decodeSearchCursor("not a cursor"); err == nil {
+		t.Fatal("expected malformed cursor to fail")
+	}
+}
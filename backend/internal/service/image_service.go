@@ -8,15 +8,16 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"os"
+	"runtime"
 	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
-	"github.com/google/uuid"
 	"gorm.io/datatypes"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 
 	"github.com/TangTangChu/AnzuImg/backend/internal/config"
 	"github.com/TangTangChu/AnzuImg/backend/internal/logger"
@@ -29,43 +30,46 @@ type ImageService struct {
 	log *logger.Logger
 
 	storage        Storage
-	uploadQueue    chan uploadTaskJob
-	thumbnailQueue chan thumbnailJob
+	backends       sync.Map // 非默认存储后端，按类型懒加载
+	uploadWake     chan struct{}
+	webhooks       *WebhookService
+	taskHub        *UploadTaskHub
+	uploadPool     *workerPool
+	thumbnails     *ThumbnailPool
+	transformSlots chan struct{}
 	uploadLocks    [256]sync.Mutex
-}
 
-type uploadTaskJob struct {
-	TaskID string
-	Input  UploadTaskInput
+	variantLocks      [256]sync.Mutex
+	variantEvicting   atomic.Bool
+	autoFormatPending sync.Map
+
+	sharePasswords sync.Map // 验证通过的分享密码，见 OpenShareLink
 }
 
+// UploadTaskInput 是上传任务的参数，除暂存文件外都会随任务持久化
 type UploadTaskInput struct {
-	Buf                 []byte
-	TempPath            string
-	FileName            string
-	Routes              []string
-	Description         string
-	Tags                []string
-	MimeType            string
-	Width               int
-	Height              int
-	Convert             bool
-	TargetFormat        string
-	Quality             int
-	Effort              int
-	UploadedByTokenID   *uint
-	UploadedByTokenName string
-	UploadedByTokenType string
-	RequestMethod       string
-	RequestPath         string
-	IPAddress           string
-	UserAgent           string
-}
-
-type thumbnailJob struct {
-	Hash     string
-	TempPath string
-	MIMEType string
+	Staged              *StagedUpload `json:"-"`
+	FileName            string        `json:"file_name"`
+	Routes              []string      `json:"routes,omitempty"`
+	Description         string        `json:"description,omitempty"`
+	Tags                []string      `json:"tags,omitempty"`
+	Visibility          string        `json:"visibility,omitempty"`
+	MimeType            string        `json:"mime_type"`
+	Width               int           `json:"width,omitempty"`
+	Height              int           `json:"height,omitempty"`
+	Convert             bool          `json:"convert,omitempty"`
+	TargetFormat        string        `json:"target_format,omitempty"`
+	Quality             int           `json:"quality,omitempty"`
+	Effort              int           `json:"effort,omitempty"`
+	UploadedByTokenID   *uint         `json:"uploaded_by_token_id,omitempty"`
+	UploadedByTokenName string        `json:"uploaded_by_token_name,omitempty"`
+	UploadedByTokenType string        `json:"uploaded_by_token_type,omitempty"`
+	RequestMethod       string        `json:"request_method,omitempty"`
+	RequestPath         string        `json:"request_path,omitempty"`
+	IPAddress           string        `json:"ip_address,omitempty"`
+	UserAgent           string        `json:"user_agent,omitempty"`
+	// 任务结束时额外投递通知的地址
+	CallbackURL string `json:"callback_url,omitempty"`
 }
 
 const (
@@ -73,6 +77,8 @@ const (
 	maxProcessedMediaPixels    = int64(100_000_000)
 )
 
+var ErrMediaDimensionsTooLarge = errors.New("media dimensions exceed limit")
+
 func processedMediaDimensionsAllowed(width, height int) bool {
 	if width <= 0 || height <= 0 {
 		return true
@@ -93,26 +99,36 @@ func NewImageService(cfg *config.Config, db *gorm.DB) *ImageService {
 	storage := factory.CreateDefaultStorage()
 
 	svc := &ImageService{
-		cfg:     cfg,
-		db:      db,
-		log:     logger.Register("image"),
-		storage: storage,
-	}
-	svc.startUploadWorkers(2, 8)
-	svc.startThumbnailWorkers(2, 4)
+		cfg:            cfg,
+		db:             db,
+		log:            logger.Register("image"),
+		storage:        storage,
+		transformSlots: make(chan struct{}, runtime.NumCPU()),
+		webhooks:       NewWebhookService(cfg, db),
+		taskHub:        NewUploadTaskHub(),
+		thumbnails:     NewThumbnailPool(cfg, db),
+	}
+	svc.startUploadWorkers()
+	svc.startThumbnailSweep()
+	svc.startReplicaRepair()
 	return svc
 }
 
 // NewImageServiceWithStorage 使用指定的存储创建服务
 func NewImageServiceWithStorage(cfg *config.Config, db *gorm.DB, storage Storage) *ImageService {
 	svc := &ImageService{
-		cfg:     cfg,
-		db:      db,
-		log:     logger.Register("image"),
-		storage: storage,
-	}
-	svc.startUploadWorkers(2, 8)
-	svc.startThumbnailWorkers(2, 4)
+		cfg:            cfg,
+		db:             db,
+		log:            logger.Register("image"),
+		storage:        storage,
+		transformSlots: make(chan struct{}, runtime.NumCPU()),
+		webhooks:       NewWebhookService(cfg, db),
+		taskHub:        NewUploadTaskHub(),
+		thumbnails:     NewThumbnailPool(cfg, db),
+	}
+	svc.startUploadWorkers()
+	svc.startThumbnailSweep()
+	svc.startReplicaRepair()
 	return svc
 }
 
@@ -124,18 +140,88 @@ type UploadResult struct {
 	RouteURL string // 为空表示未映射
 }
 
+// UploadResponse 是单个媒体上传成功后返回给客户端的内容，同步上传、断点续传与上传任务的结果共用
+type UploadResponse struct {
+	Success         bool           `json:"success"`
+	Hash            string         `json:"hash"`
+	FileName        string         `json:"file_name"`
+	Size            int64          `json:"size"`
+	Mime            string         `json:"mime"`
+	Path            string         `json:"path"`
+	Width           int            `json:"width"`
+	Height          int            `json:"height"`
+	DurationSeconds int            `json:"duration_seconds"`
+	VideoCodec      string         `json:"video_codec"`
+	VideoBitrate    int64          `json:"video_bitrate"`
+	AudioCodec      string         `json:"audio_codec"`
+	AudioBitrate    int64          `json:"audio_bitrate"`
+	Description     string         `json:"description"`
+	Tags            datatypes.JSON `json:"tags"`
+	Visibility      string         `json:"visibility"`
+	CreatedAt       time.Time      `json:"created_at"`
+	UpdatedAt       time.Time      `json:"updated_at"`
+	Reused          bool           `json:"reused"`
+	URL             string         `json:"url"`
+	Route           string         `json:"route"`
+	RouteURL        string         `json:"route_url"`
+}
+
+// Response 转换为返回给客户端的内容
+func (r *UploadResult) Response() UploadResponse {
+	return UploadResponse{
+		Success:         true,
+		Hash:            r.Image.Hash,
+		FileName:        r.Image.FileName,
+		Size:            r.Image.Size,
+		Mime:            r.Image.MimeType,
+		Path:            r.Image.Path,
+		Width:           r.Image.Width,
+		Height:          r.Image.Height,
+		DurationSeconds: r.Image.DurationSeconds,
+		VideoCodec:      r.Image.VideoCodec,
+		VideoBitrate:    r.Image.VideoBitrate,
+		AudioCodec:      r.Image.AudioCodec,
+		AudioBitrate:    r.Image.AudioBitrate,
+		Description:     r.Image.Description,
+		Tags:            r.Image.Tags,
+		Visibility:      r.Image.Visibility,
+		CreatedAt:       r.Image.CreatedAt,
+		UpdatedAt:       r.Image.UpdatedAt,
+		Reused:          r.Reused,
+		URL:             r.HashURL,
+		Route:           r.Route,
+		RouteURL:        r.RouteURL,
+	}
+}
+
 // Upload 上传图片
+// src 参数：已暂存到磁盘的上传内容，由调用者负责删除
 // fileName 参数：显示用的文件名
 // mimeType 参数：调用者提供的MIME类型
+// visibility 参数：新媒体的可见性，为空时默认公开；命中去重的已有媒体保持原可见性，只能通过更新接口修改
 // width, height 参数：调用者提供的图片尺寸，如果是图片的话
-func (s *ImageService) Upload(ctx context.Context, buf []byte, fileName string, routes []string, description string, tags []string, mimeType string, width, height int, convert bool, targetFormat string, quality int, effort int, uploadedByTokenID *uint, uploadedByTokenName string, uploadedByTokenType string) (*UploadResult, error) {
+func (s *ImageService) Upload(ctx context.Context, src *StagedUpload, fileName string, routes []string, description string, tags []string, visibility string, mimeType string, width, height int, convert bool, targetFormat string, quality int, effort int, uploadedByTokenID *uint, uploadedByTokenName string, uploadedByTokenType string) (*UploadResult, error) {
+	if visibility != "" && !ValidVisibility(visibility) {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidVisibility, visibility)
+	}
+
 	// 如果需要转换
 	if convert && IsImageFile(mimeType) {
+		reportUploadStage(ctx, model.UploadTaskStageConverting)
+		buf, err := src.ReadAll()
+		if err != nil {
+			return nil, fmt.Errorf("read staged upload failed: %w", err)
+		}
 		newBuf, newMime, err := ConvertImage(ctx, buf, mimeType, targetFormat, quality, effort)
 		if err != nil {
 			return nil, fmt.Errorf("convert image failed: %w", err)
 		}
-		buf = newBuf
+		converted, err := StageUpload(bytes.NewReader(newBuf), 0)
+		if err != nil {
+			return nil, fmt.Errorf("stage converted image failed: %w", err)
+		}
+		defer converted.Remove()
+		src = converted
 		mimeType = newMime
 
 		// 更新文件名后缀
@@ -146,7 +232,7 @@ func (s *ImageService) Upload(ctx context.Context, buf []byte, fileName string,
 		fileName = fileName + ext
 
 		// 重新检测尺寸
-		if w, h, err := DetectImageDimensions(buf); err == nil {
+		if w, h, err := DetectImageDimensions(newBuf); err == nil {
 			width = w
 			height = h
 		}
@@ -158,7 +244,7 @@ func (s *ImageService) Upload(ctx context.Context, buf []byte, fileName string,
 	audioCodec := ""
 	audioBitrate := int64(0)
 	if IsVideoFile(mimeType) {
-		if info, err := ProbeVideoInfo(ctx, buf); err == nil {
+		if info, err := ProbeVideoFile(ctx, src.Path); err == nil {
 			if width <= 0 {
 				width = info.Width
 			}
@@ -175,7 +261,7 @@ func (s *ImageService) Upload(ctx context.Context, buf []byte, fileName string,
 		}
 	}
 	if !processedMediaDimensionsAllowed(width, height) {
-		return nil, errors.New("media dimensions exceed limit")
+		return nil, ErrMediaDimensionsTooLarge
 	}
 
 	tagsBytes, err := json.Marshal(tags)
@@ -183,13 +269,20 @@ func (s *ImageService) Upload(ctx context.Context, buf []byte, fileName string,
 		return nil, fmt.Errorf("marshal tags failed: %w", err)
 	}
 	tagsJSON := datatypes.JSON(tagsBytes)
-	sum := sha256.Sum256(buf)
-	hashStr := hex.EncodeToString(sum[:])
+	hashStr := src.Hash
+	sum, err := hex.DecodeString(hashStr)
+	if err != nil || len(sum) != sha256.Size {
+		return nil, fmt.Errorf("invalid staged upload hash: %q", hashStr)
+	}
 	contentLock := &s.uploadLocks[int(sum[0])]
 	contentLock.Lock()
-	defer contentLock.Unlock()
+	unlockContent := sync.OnceFunc(contentLock.Unlock)
+	defer unlockContent()
 
 	// 按 hash 去重
+	// 结果中返回第一个规范化后的路由，与实际存储的路由一致
+	firstRoute := ""
+
 	var existing model.Image
 	if err := s.db.Where("hash = ?", hashStr).First(&existing).Error; err == nil {
 		if len(routes) > 0 {
@@ -198,9 +291,15 @@ func (s *ImageService) Upload(ctx context.Context, buf []byte, fileName string,
 					if rStr == "" {
 						continue
 					}
-					r := model.ImageRoute{ImageID: existing.ID, Route: rStr}
-					if err := tx.Create(&r).Error; err != nil {
-						return fmt.Errorf("route insert failed: %w", err)
+					route, err := s.normalizeRoute(rStr)
+					if err != nil {
+						return err
+					}
+					if err := attachImageRoute(tx, existing.ID, route); err != nil {
+						return err
+					}
+					if firstRoute == "" {
+						firstRoute = route
 					}
 				}
 				return nil
@@ -209,11 +308,6 @@ func (s *ImageService) Upload(ctx context.Context, buf []byte, fileName string,
 			}
 		}
 
-		firstRoute := ""
-		if len(routes) > 0 {
-			firstRoute = routes[0]
-		}
-
 		return &UploadResult{
 			Image:    existing,
 			Reused:   true,
@@ -225,7 +319,20 @@ func (s *ImageService) Upload(ctx context.Context, buf []byte, fileName string,
 		return nil, fmt.Errorf("db query failed: %w", err)
 	}
 
-	relPath, size, err := s.storage.Save(ctx, hashStr, buf, mimeType)
+	reportUploadStage(ctx, model.UploadTaskStageStoring)
+	f, err := src.Open()
+	if err != nil {
+		return nil, fmt.Errorf("open staged upload failed: %w", err)
+	}
+	var replicas []ReplicaResult
+	var relPath string
+	var size int64
+	if rs, ok := s.storage.(*ReplicatedStorage); ok {
+		relPath, size, replicas, err = rs.SaveAll(ctx, hashStr, f, src.Size, mimeType)
+	} else {
+		relPath, size, err = s.storage.Save(ctx, hashStr, f, src.Size, mimeType)
+	}
+	f.Close()
 	if err != nil {
 		return nil, err
 	}
@@ -236,6 +343,7 @@ func (s *ImageService) Upload(ctx context.Context, buf []byte, fileName string,
 		MimeType:            mimeType,
 		Size:                size,
 		Path:                relPath,
+		StorageBackend:      s.storage.Type(),
 		Width:               width,
 		Height:              height,
 		DurationSeconds:     durationSeconds,
@@ -248,6 +356,11 @@ func (s *ImageService) Upload(ctx context.Context, buf []byte, fileName string,
 		UploadedByTokenID:   uploadedByTokenID,
 		UploadedByTokenName: uploadedByTokenName,
 		UploadedByTokenType: uploadedByTokenType,
+		ThumbnailStatus:     initialThumbnailStatus(mimeType),
+		Visibility:          model.VisibilityPublic,
+	}
+	if visibility != "" {
+		img.Visibility = visibility
 	}
 
 	if err := s.db.Transaction(func(tx *gorm.DB) error {
@@ -259,9 +372,21 @@ func (s *ImageService) Upload(ctx context.Context, buf []byte, fileName string,
 			if rStr == "" {
 				continue
 			}
-			r := model.ImageRoute{ImageID: img.ID, Route: rStr}
-			if err := tx.Create(&r).Error; err != nil {
-				return fmt.Errorf("route insert failed: %w", err)
+			route, err := s.normalizeRoute(rStr)
+			if err != nil {
+				return err
+			}
+			if err := attachImageRoute(tx, img.ID, route); err != nil {
+				return err
+			}
+			if firstRoute == "" {
+				firstRoute = route
+			}
+		}
+
+		for _, res := range replicas {
+			if err := recordReplicaState(tx, img.ID, res.Backend, res.Err); err != nil {
+				return fmt.Errorf("replica state insert failed: %w", err)
 			}
 		}
 
@@ -270,18 +395,17 @@ func (s *ImageService) Upload(ctx context.Context, buf []byte, fileName string,
 		if delErr := s.storage.Delete(ctx, relPath); delErr != nil {
 			s.log.Ctx(ctx).Warnf("Failed to cleanup file after db rollback: %v", delErr)
 		}
-		suffixes := []string{"_thumb.webp", "_thumb.jpg", "_thumb"}
-		for _, suffix := range suffixes {
-			_ = s.storage.Delete(ctx, relPath+suffix)
-		}
+		s.deleteThumbnails(ctx, s.storage, relPath)
 		return nil, err
 	}
 
-	s.enqueueThumbnail(hashStr, buf, mimeType)
-
-	firstRoute := ""
-	if len(routes) > 0 {
-		firstRoute = routes[0]
+	// 异步任务直接在 worker 中生成缩略图，任务结束时缩略图已可用；记录已入库，先释放内容锁
+	if report := uploadStageReporter(ctx); report != nil {
+		unlockContent()
+		report(model.UploadTaskStageThumbnailing)
+		img.ThumbnailStatus = s.generateThumbnail(&img, src.Path)
+	} else {
+		img.ThumbnailStatus = s.enqueueThumbnail(&img, src.Path)
 	}
 
 	return &UploadResult{
@@ -293,340 +417,231 @@ func (s *ImageService) Upload(ctx context.Context, buf []byte, fileName string,
 	}, nil
 }
 
-func writeTempData(pattern string, data []byte) (string, error) {
-	tmp, err := os.CreateTemp("", pattern)
-	if err != nil {
-		return "", err
-	}
-	path := tmp.Name()
-	if _, err := tmp.Write(data); err != nil {
-		_ = tmp.Close()
-		_ = os.Remove(path)
-		return "", err
-	}
-	if err := tmp.Close(); err != nil {
-		_ = os.Remove(path)
-		return "", err
+func routeURL(route string) string {
+	if route == "" {
+		return ""
 	}
-	return path, nil
+	return RoutePath(route)
+}
+
+// MediaLocation 描述存储对象应如何分发给客户端，三个字段中恰有一个生效
+type MediaLocation struct {
+	RelPath     string
+	LocalPath   string        // 本地文件绝对路径，由服务端直接输出
+	RedirectURL string        // 重定向地址（公开或预签名）
+	RedirectTTL time.Duration // 预签名地址的有效期，公开地址为 0
+	Proxy       bool          // 由服务端代理读取远端对象
+
+	storage Storage // 对象所在的存储后端，为空时使用默认存储
 }
 
-func (s *ImageService) enqueueThumbnail(hashStr string, buf []byte, mimeType string) {
-	if !IsImageFile(mimeType) && !IsVideoFile(mimeType) {
-		return
+// storageFor 返回图片所在的存储后端，storage_backend 为空的历史数据视为默认存储
+func (s *ImageService) storageFor(img *model.Image) Storage {
+	name := img.StorageBackend
+	if name == "" || name == s.storage.Type() {
+		return s.storage
 	}
-	tempPath, err := writeTempData("anzuimg-thumbnail-*", buf)
+	st, err := s.backend(name)
 	if err != nil {
-		s.log.Warnf("Failed to stage thumbnail input: %v", err)
-		return
-	}
-	job := thumbnailJob{Hash: hashStr, TempPath: tempPath, MIMEType: mimeType}
-	select {
-	case s.thumbnailQueue <- job:
-	default:
-		_ = os.Remove(tempPath)
-		s.log.Warnf("Thumbnail queue full; skipped thumbnail for %s", hashStr)
+		s.log.Errorf("Failed to open storage backend %s for image %s: %v", name, img.Hash, err)
+		return s.storage
 	}
+	return st
 }
 
-func (s *ImageService) startThumbnailWorkers(workerCount, queueSize int) {
-	if workerCount <= 0 {
-		workerCount = 1
+// backend 按类型获取存储后端，首次使用时创建并缓存
+func (s *ImageService) backend(name string) (Storage, error) {
+	if v, ok := s.backends.Load(name); ok {
+		return v.(Storage), nil
 	}
-	if queueSize <= 0 {
-		queueSize = 4
+	st, err := NewStorageFactory(s.cfg, s.log).CreateStorage(StorageType(name))
+	if err != nil {
+		return nil, err
 	}
-	s.thumbnailQueue = make(chan thumbnailJob, queueSize)
-	for i := 0; i < workerCount; i++ {
-		go func() {
-			for job := range s.thumbnailQueue {
-				s.runThumbnailJob(job)
-			}
-		}()
+	actual, loaded := s.backends.LoadOrStore(name, st)
+	if loaded {
+		// 并发创建时只保留先存入的实例
+		closeStorage(st)
 	}
+	return actual.(Storage), nil
 }
 
-func (s *ImageService) runThumbnailJob(job thumbnailJob) {
-	defer func() { _ = os.Remove(job.TempPath) }()
-	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
-	defer cancel()
-	data, err := os.ReadFile(job.TempPath)
-	if err != nil {
-		s.log.Ctx(ctx).Warnf("Failed to read thumbnail input: %v", err)
-		return
+// locate 根据存储类型与分发方式生成对象的访问方式
+func (s *ImageService) locate(ctx context.Context, storage Storage, relPath string) (*MediaLocation, error) {
+	if rs, ok := storage.(*ReplicatedStorage); ok {
+		storage = rs.ReadBackend(ctx, relPath)
 	}
-	if IsImageFile(job.MIMEType) {
-		if thumbData, err := GenerateThumbnail(bytes.NewReader(data), 800, 800); err == nil {
-			if _, _, err := s.storage.Save(ctx, job.Hash+"_thumb.webp", thumbData, "image/webp"); err != nil {
-				s.log.Ctx(ctx).Warnf("Failed to save thumbnail: %v", err)
-			}
-		} else {
-			s.log.Ctx(ctx).Warnf("Failed to generate thumbnail: %v", err)
+
+	loc := &MediaLocation{RelPath: relPath, storage: storage}
+	remote, ok := storage.(RemoteStorage)
+	if !ok {
+		absPath, err := storage.GetAbsPath(ctx, relPath)
+		if err != nil {
+			return nil, err
 		}
-		return
+		loc.LocalPath = absPath
+		return loc, nil
 	}
-	if thumbData, err := GenerateVideoThumbnail(ctx, data, 800, 800); err == nil {
-		if _, _, err := s.storage.Save(ctx, job.Hash+"_thumb.jpg", thumbData, "image/jpeg"); err != nil {
-			s.log.Ctx(ctx).Warnf("Failed to save video thumbnail: %v", err)
+
+	switch remote.DeliveryMode() {
+	case DeliveryProxy:
+		loc.Proxy = true
+	case DeliveryPresign:
+		url, ttl, err := remote.PresignGet(ctx, relPath)
+		if err != nil {
+			return nil, err
 		}
-	} else {
-		s.log.Ctx(ctx).Warnf("Failed to generate video thumbnail: %v", err)
+		loc.RedirectURL = url
+		loc.RedirectTTL = ttl
+	default:
+		url, err := remote.GetAbsPath(ctx, relPath)
+		if err != nil {
+			return nil, err
+		}
+		loc.RedirectURL = url
 	}
+	return loc, nil
 }
 
-func (s *ImageService) startUploadWorkers(workerCount int, queueSize int) {
-	if workerCount <= 0 {
-		workerCount = 1
+// OpenRemote 以代理方式读取远端对象，rangeHeader 原样透传给存储后端。
+// 对象属于组合存储时，选定后端失败会依次回退到其余后端，本地副本以 LocalPath 返回。
+func (s *ImageService) OpenRemote(ctx context.Context, loc *MediaLocation, rangeHeader string) (*ObjectStream, error) {
+	storage := loc.storage
+	if storage == nil {
+		storage = s.storage
 	}
-	if queueSize <= 0 {
-		queueSize = 16
+	candidates := []Storage{storage}
+	if rs, ok := s.storage.(*ReplicatedStorage); ok && rs.contains(storage) {
+		candidates = append([]Storage{storage, rs.Primary()}, rs.Replicas()...)
 	}
 
-	s.uploadQueue = make(chan uploadTaskJob, queueSize)
-	for i := 0; i < workerCount; i++ {
-		go func() {
-			for job := range s.uploadQueue {
-				s.runUploadTask(job)
+	var err error
+	for _, backend := range candidates {
+		remote, ok := backend.(RemoteStorage)
+		if !ok {
+			if exists, existsErr := backend.Exists(ctx, loc.RelPath); existsErr != nil || !exists {
+				continue
 			}
-		}()
-	}
-}
-
-func (s *ImageService) EnqueueUploadTask(input UploadTaskInput) (*model.UploadTask, error) {
-	if s.uploadQueue == nil {
-		s.startUploadWorkers(2, 8)
-	}
-
-	tempPath, err := writeTempData("anzuimg-upload-task-*", input.Buf)
-	if err != nil {
-		return nil, fmt.Errorf("stage upload task failed: %w", err)
-	}
-	input.Buf = nil
-	input.TempPath = tempPath
-	task := model.UploadTask{
-		ID:       uuid.NewString(),
-		Status:   model.UploadTaskStatusPending,
-		FileName: input.FileName,
-	}
-	if err := s.db.Create(&task).Error; err != nil {
-		_ = os.Remove(tempPath)
-		return nil, fmt.Errorf("create upload task failed: %w", err)
-	}
-
-	select {
-	case s.uploadQueue <- uploadTaskJob{TaskID: task.ID, Input: input}:
-		return &task, nil
-	default:
-		_ = os.Remove(tempPath)
-		now := time.Now()
-		updates := map[string]interface{}{
-			"status":        model.UploadTaskStatusFailed,
-			"error_code":    "queue_full",
-			"error_message": "upload queue is full",
-			"completed_at":  &now,
-		}
-		_ = s.db.Model(&model.UploadTask{}).Where("id = ?", task.ID).Updates(updates).Error
-		task.Status = model.UploadTaskStatusFailed
-		task.ErrorCode = "queue_full"
-		task.ErrorMessage = "upload queue is full"
-		task.CompletedAt = &now
-		return &task, nil
-	}
-}
-
-func (s *ImageService) GetUploadTask(id string) (*model.UploadTask, error) {
-	var task model.UploadTask
-	if err := s.db.Where("id = ?", id).First(&task).Error; err != nil {
-		return nil, err
-	}
-	return &task, nil
-}
-
-func (s *ImageService) runUploadTask(job uploadTaskJob) {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
-	defer cancel()
-	_ = s.db.Model(&model.UploadTask{}).Where("id = ?", job.TaskID).Updates(map[string]interface{}{
-		"status": model.UploadTaskStatusRunning,
-	}).Error
-
-	input := job.Input
-	defer func() { _ = os.Remove(input.TempPath) }()
-	buf, readErr := os.ReadFile(input.TempPath)
-	if readErr != nil {
-		now := time.Now()
-		_ = s.db.Model(&model.UploadTask{}).Where("id = ?", job.TaskID).Updates(map[string]interface{}{
-			"status":        model.UploadTaskStatusFailed,
-			"error_code":    "upload_input_unavailable",
-			"error_message": "upload input unavailable",
-			"completed_at":  &now,
-		}).Error
-		s.log.Ctx(ctx).Warnf("Failed to read upload task input %s: %v", job.TaskID, readErr)
-		return
-	}
-	res, err := s.Upload(
-		ctx,
-		buf,
-		input.FileName,
-		input.Routes,
-		input.Description,
-		input.Tags,
-		input.MimeType,
-		input.Width,
-		input.Height,
-		input.Convert,
-		input.TargetFormat,
-		input.Quality,
-		input.Effort,
-		input.UploadedByTokenID,
-		input.UploadedByTokenName,
-		input.UploadedByTokenType,
-	)
-
-	now := time.Now()
-	if err != nil {
-		if updateErr := s.db.Model(&model.UploadTask{}).Where("id = ?", job.TaskID).Updates(map[string]interface{}{
-			"status":        model.UploadTaskStatusFailed,
-			"error_code":    "upload_failed",
-			"error_message": "upload processing failed",
-			"completed_at":  &now,
-		}).Error; updateErr != nil {
-			s.log.Ctx(ctx).Warnf("Failed to update failed upload task %s: %v", job.TaskID, updateErr)
-		}
-		s.log.Ctx(ctx).Warnf("Upload task %s failed: %v", job.TaskID, err)
-		return
-	}
-
-	if input.UploadedByTokenID != nil {
-		tokenSvc := NewAPITokenService(s.cfg, s.db)
-		_ = tokenSvc.RecordLog(&model.APITokenLog{
-			TokenID:   *input.UploadedByTokenID,
-			TokenName: input.UploadedByTokenName,
-			TokenType: input.UploadedByTokenType,
-			Action:    "image_upload",
-			Method:    input.RequestMethod,
-			Path:      input.RequestPath,
-			IPAddress: input.IPAddress,
-			UserAgent: input.UserAgent,
-			ImageHash: res.Image.Hash,
-		})
-	}
-
-	result := map[string]interface{}{
-		"success":          true,
-		"hash":             res.Image.Hash,
-		"file_name":        res.Image.FileName,
-		"size":             res.Image.Size,
-		"mime":             res.Image.MimeType,
-		"path":             res.Image.Path,
-		"width":            res.Image.Width,
-		"height":           res.Image.Height,
-		"duration_seconds": res.Image.DurationSeconds,
-		"video_codec":      res.Image.VideoCodec,
-		"video_bitrate":    res.Image.VideoBitrate,
-		"audio_codec":      res.Image.AudioCodec,
-		"audio_bitrate":    res.Image.AudioBitrate,
-		"description":      res.Image.Description,
-		"tags":             res.Image.Tags,
-		"created_at":       res.Image.CreatedAt,
-		"updated_at":       res.Image.UpdatedAt,
-		"reused":           res.Reused,
-		"url":              res.HashURL,
-		"route":            res.Route,
-		"route_url":        res.RouteURL,
-	}
-	resultBytes, err := json.Marshal(result)
-	if err != nil {
-		if updateErr := s.db.Model(&model.UploadTask{}).Where("id = ?", job.TaskID).Updates(map[string]interface{}{
-			"status":        model.UploadTaskStatusFailed,
-			"error_code":    "result_encode_failed",
-			"error_message": "failed to encode upload result",
-			"completed_at":  &now,
-		}).Error; updateErr != nil {
-			s.log.Ctx(ctx).Warnf("Failed to update result encode error for upload task %s: %v", job.TaskID, updateErr)
+			absPath, pathErr := backend.GetAbsPath(ctx, loc.RelPath)
+			if pathErr != nil {
+				continue
+			}
+			if err != nil {
+				s.log.Ctx(ctx).Warnf("Remote read failed, served from local replica %s: path=%s, err=%v", backend.Type(), loc.RelPath, err)
+			}
+			return &ObjectStream{LocalPath: absPath}, nil
+		}
+		stream, openErr := remote.OpenRange(ctx, loc.RelPath, rangeHeader)
+		// 范围错误说明对象存在，无需再回退
+		if openErr == nil || errors.Is(openErr, ErrInvalidRange) {
+			return stream, openErr
 		}
-		return
+		err = openErr
 	}
-
-	if updateErr := s.db.Model(&model.UploadTask{}).Where("id = ?", job.TaskID).Updates(map[string]interface{}{
-		"status":       model.UploadTaskStatusSucceeded,
-		"result":       datatypes.JSON(resultBytes),
-		"completed_at": &now,
-	}).Error; updateErr != nil {
-		s.log.Ctx(ctx).Warnf("Failed to update succeeded upload task %s: %v", job.TaskID, updateErr)
+	if err == nil {
+		err = fmt.Errorf("storage %s does not support proxy delivery", storage.Type())
 	}
+	return nil, err
 }
 
-func routeURL(route string) string {
-	if route == "" {
-		return ""
-	}
-	return "/i/r/" + route
-}
-
-// ResolveByHash：返回图片和绝对路径或访问URL。
-func (s *ImageService) ResolveByHash(ctx context.Context, hash string) (*model.Image, string, error) {
+// ResolveByHash：返回图片及其访问方式。
+func (s *ImageService) ResolveByHash(ctx context.Context, hash string) (*model.Image, *MediaLocation, error) {
 	var img model.Image
 	if err := s.db.Where("hash = ?", hash).First(&img).Error; err != nil {
-		return nil, "", err
+		return nil, nil, err
 	}
-	absPath, err := s.storage.GetAbsPath(ctx, img.Path)
+	loc, err := s.locate(ctx, s.storageFor(&img), img.Path)
 	if err != nil {
-		return nil, "", err
+		return nil, nil, err
 	}
-	return &img, absPath, nil
+	restrictPrivate(&img, loc)
+	return &img, loc, nil
 }
 
-// ResolveThumbnailByHash：返回图片缩略图的绝对路径或访问URL，以及对应的 MIME 类型。
-func (s *ImageService) ResolveThumbnailByHash(ctx context.Context, hash string) (string, string, error) {
+// ResolveThumbnailByHash：返回图片指定规格缩略图的访问方式，以及对应的 MIME 类型。size 为空表示 default。
+// 缩略图缺失时依次回退到 default 规格、早期缩略图与原图，并在后台补生成缺失的规格。
+func (s *ImageService) ResolveThumbnailByHash(ctx context.Context, hash string, size string) (*MediaLocation, string, error) {
+	preset, ok := s.cfg.ThumbnailPreset(size)
+	if !ok {
+		return nil, "", ErrUnknownThumbnailSize
+	}
 	var img model.Image
 	if err := s.db.Where("hash = ?", hash).First(&img).Error; err != nil {
-		return "", "", err
+		return nil, "", err
 	}
-	candidates := []struct {
-		suffix   string
-		mimeType string
-	}{
-		{suffix: "_thumb.webp", mimeType: "image/webp"},
-		{suffix: "_thumb.jpg", mimeType: "image/jpeg"},
+
+	candidates := []thumbnailFile{thumbnailFileFor(preset, img.MimeType)}
+	if preset.Name != config.DefaultThumbnailPreset {
+		if def, ok := s.cfg.ThumbnailPreset(config.DefaultThumbnailPreset); ok {
+			candidates = append(candidates, thumbnailFileFor(def, img.MimeType))
+		}
 	}
+	candidates = append(candidates, legacyThumbnailFiles...)
 
-	for _, candidate := range candidates {
+	// 等待生成或已失败的缩略图交给队列与补齐任务处理，不在访问时重建
+	rebuild := img.ThumbnailStatus == "" || img.ThumbnailStatus == model.ThumbnailStatusReady
+	storage := s.storageFor(&img)
+	seen := make(map[string]bool, len(candidates))
+	for i, candidate := range candidates {
+		if seen[candidate.suffix] {
+			continue
+		}
+		seen[candidate.suffix] = true
 		thumbPath := img.Path + candidate.suffix
-		exists, err := s.storage.Exists(ctx, thumbPath)
+		exists, err := storage.Exists(ctx, thumbPath)
 		if err == nil && exists {
-			absPath, err := s.storage.GetAbsPath(ctx, thumbPath)
-			return absPath, candidate.mimeType, err
+			if i > 0 && rebuild {
+				s.thumbnails.requestRebuild(storage, &img)
+			}
+			loc, err := s.locate(ctx, storage, thumbPath)
+			if err != nil {
+				return nil, "", err
+			}
+			restrictPrivate(&img, loc)
+			return loc, candidate.mimeType, nil
 		}
 	}
 
 	// 如果缩略图都不存在，返回原图
-	absPath, err := s.storage.GetAbsPath(ctx, img.Path)
-	return absPath, img.MimeType, err
+	if rebuild {
+		s.thumbnails.requestRebuild(storage, &img)
+	}
+	loc, err := s.locate(ctx, storage, img.Path)
+	if err != nil {
+		return nil, "", err
+	}
+	restrictPrivate(&img, loc)
+	return loc, img.MimeType, nil
 }
 
-func (s *ImageService) ResolveByRoute(ctx context.Context, route string) (*model.Image, string, error) {
+// ResolveByRoute 按路由解析图片。过期路由返回 ErrRouteExpired；重定向路由只返回路由本身，由调用方跳转
+func (s *ImageService) ResolveByRoute(ctx context.Context, route string) (*model.ImageRoute, *model.Image, *MediaLocation, error) {
 	var r model.ImageRoute
 	if err := s.db.Where("route = ?", route).First(&r).Error; err != nil {
-		return nil, "", err
+		return nil, nil, nil, err
+	}
+	if r.ExpiresAt != nil && !time.Now().Before(*r.ExpiresAt) {
+		return nil, nil, nil, ErrRouteExpired
+	}
+	if r.RedirectTo != "" || r.ImageID == nil {
+		return &r, nil, nil, nil
 	}
 
 	var img model.Image
-	if err := s.db.First(&img, r.ImageID).Error; err != nil {
-		return nil, "", err
+	if err := s.db.First(&img, *r.ImageID).Error; err != nil {
+		return nil, nil, nil, err
 	}
 
-	absPath, err := s.storage.GetAbsPath(ctx, img.Path)
+	loc, err := s.locate(ctx, s.storageFor(&img), img.Path)
 	if err != nil {
-		return nil, "", err
+		return nil, nil, nil, err
 	}
-	return &img, absPath, nil
+	restrictPrivate(&img, loc)
+	return &r, &img, loc, nil
 }
 
-// ListImages 分页获取图片列表
-func (s *ImageService) ListImages(page, pageSize int, tag string, fileName string) ([]model.Image, int64, error) {
-	var images []model.Image
-	var total int64
-
+// imageListQuery 构造图片列表的筛选条件
+func (s *ImageService) imageListQuery(tag string, fileName string) *gorm.DB {
 	query := s.db.Model(&model.Image{})
 
 	if tag != "" {
@@ -643,19 +658,35 @@ func (s *ImageService) ListImages(page, pageSize int, tag string, fileName strin
 		escapedFileName = strings.ReplaceAll(escapedFileName, `_`, `\_`)
 		query = query.Where("file_name ILIKE ?", "%"+escapedFileName+"%")
 	}
+	return query
+}
+
+// ListImages 分页获取图片列表
+func (s *ImageService) ListImages(page, pageSize int, tag string, fileName string) ([]model.Image, int64, error) {
+	var images []model.Image
+	var total int64
+
+	query := s.imageListQuery(tag, fileName)
 
 	if err := query.Count(&total).Error; err != nil {
 		return nil, 0, err
 	}
 
 	offset := (page - 1) * pageSize
-	if err := query.Order("created_at DESC").Limit(pageSize).Offset(offset).Find(&images).Error; err != nil {
+	if err := query.Order("created_at DESC").Order("id DESC").Limit(pageSize).Offset(offset).Find(&images).Error; err != nil {
 		return nil, 0, err
 	}
 
 	return images, total, nil
 }
 
+// ListImagesByCursor 按游标获取图片列表，不统计总数
+func (s *ImageService) ListImagesByCursor(cursor *Cursor, limit int, tag string, fileName string) (*CursorPage[model.Image], error) {
+	return findCursorPage(s.imageListQuery(tag, fileName), cursor, limit, func(img *model.Image) Cursor {
+		return Cursor{CreatedAt: img.CreatedAt, ID: img.ID}
+	})
+}
+
 // ListTags 获取标签列表（按数量排序）
 func (s *ImageService) ListTags(limit int) ([]TagCount, error) {
 	if limit <= 0 {
@@ -717,46 +748,96 @@ func (s *ImageService) ListTags(limit int) ([]TagCount, error) {
 	return result, nil
 }
 
-// ListRoutes 分页获取路由信息
-func (s *ImageService) ListRoutes(page, pageSize int) ([]model.ImageRoute, int64, error) {
+// ListRoutes 分页获取路由信息，支持按前缀与关键字筛选
+func (s *ImageService) ListRoutes(filter RouteFilter, page, pageSize int) ([]model.ImageRoute, int64, error) {
 	var routes []model.ImageRoute
 	var total int64
 
-	query := s.db.Model(&model.ImageRoute{})
+	query := s.routeFilterQuery(filter)
 
 	if err := query.Count(&total).Error; err != nil {
 		return nil, 0, err
 	}
 
 	offset := (page - 1) * pageSize
-	if err := query.Preload("Image").Order("created_at DESC").Limit(pageSize).Offset(offset).Find(&routes).Error; err != nil {
+	if err := query.Preload("Image").Order("created_at DESC").Order("id DESC").Limit(pageSize).Offset(offset).Find(&routes).Error; err != nil {
 		return nil, 0, err
 	}
 
 	return routes, total, nil
 }
 
-// DeleteRoute 删除指定路由
+// ListRoutesByCursor 按游标获取路由列表，不统计总数
+func (s *ImageService) ListRoutesByCursor(filter RouteFilter, cursor *Cursor, limit int) (*CursorPage[model.ImageRoute], error) {
+	return findCursorPage(s.routeFilterQuery(filter).Preload("Image"), cursor, limit, func(r *model.ImageRoute) Cursor {
+		return Cursor{CreatedAt: r.CreatedAt, ID: r.ID}
+	})
+}
+
+// DeleteRoute 删除指定路由，仍有其他路由重定向到它时返回 ErrRouteInUse
 func (s *ImageService) DeleteRoute(route string) error {
-	return s.db.Where("route = ?", route).Delete(&model.ImageRoute{}).Error
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		var r model.ImageRoute
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").Where("route = ?", route).First(&r).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil
+			}
+			return err
+		}
+		if err := ensureNoRedirectReferrers(tx, []string{route}); err != nil {
+			return err
+		}
+		return tx.Delete(&model.ImageRoute{}, r.ID).Error
+	})
 }
 
-// UpdateRoutes 更新图片的路由
+// UpdateRoutes 更新图片的路由，保留仍在列表中的路由及其设置
 func (s *ImageService) UpdateRoutes(imageID uint64, routes []string) error {
 	return s.db.Transaction(func(tx *gorm.DB) error {
-		// 删除旧路由
-		if err := tx.Where("image_id = ?", imageID).Delete(&model.ImageRoute{}).Error; err != nil {
+		keep := make(map[string]bool, len(routes))
+		for _, r := range routes {
+			if r != "" {
+				keep[r] = true
+			}
+		}
+
+		var existing []model.ImageRoute
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("image_id = ?", imageID).Find(&existing).Error; err != nil {
 			return err
 		}
+		// 删除不再使用的旧路由，仍被重定向的路由不能删除
+		var removed []string
+		var removedIDs []uint64
+		for _, r := range existing {
+			if keep[r.Route] {
+				delete(keep, r.Route)
+				continue
+			}
+			removed = append(removed, r.Route)
+			removedIDs = append(removedIDs, r.ID)
+		}
+		if len(removedIDs) > 0 {
+			if err := ensureNoRedirectReferrers(tx, removed); err != nil {
+				return err
+			}
+			if err := tx.Delete(&model.ImageRoute{}, removedIDs).Error; err != nil {
+				return err
+			}
+		}
 
 		// 添加新路由
 		for _, r := range routes {
-			if r == "" {
+			if !keep[r] {
 				continue
 			}
+			delete(keep, r)
+			normalized, err := s.normalizeRoute(r)
+			if err != nil {
+				return err
+			}
 			route := model.ImageRoute{
-				ImageID: imageID,
-				Route:   r,
+				ImageID: &imageID,
+				Route:   normalized,
 			}
 			if err := tx.Create(&route).Error; err != nil {
 				return err
@@ -768,27 +849,36 @@ func (s *ImageService) UpdateRoutes(imageID uint64, routes []string) error {
 
 // DeleteImage 删除图片
 func (s *ImageService) DeleteImage(ctx context.Context, hash string) error {
-	var img model.Image
-	if err := s.db.Where("hash = ?", hash).First(&img).Error; err != nil {
-		return err
-	}
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		var img model.Image
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("hash = ?", hash).First(&img).Error; err != nil {
+			return err
+		}
 
-	if err := s.storage.Delete(ctx, img.Path); err != nil {
-		s.log.Ctx(ctx).Warnf("Failed to delete file from storage: %v", err)
-	}
+		// 图片的路由随图片级联删除，仍被其他路由重定向时拒绝删除，避免留下失效的重定向
+		var routes []string
+		if err := tx.Model(&model.ImageRoute{}).Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("image_id = ?", img.ID).Pluck("route", &routes).Error; err != nil {
+			return err
+		}
+		if err := ensureNoRedirectReferrers(tx, routes); err != nil {
+			return err
+		}
 
-	suffixes := []string{"_thumb.webp", "_thumb.jpg", "_thumb"}
-	for _, suffix := range suffixes {
-		if err := s.storage.Delete(ctx, img.Path+suffix); err != nil {
-			s.log.Ctx(ctx).Debugf("Failed to delete thumbnail %s: %v", suffix, err)
+		storage := s.storageFor(&img)
+		if err := storage.Delete(ctx, img.Path); err != nil {
+			s.log.Ctx(ctx).Warnf("Failed to delete file from storage: %v", err)
 		}
-	}
 
-	if err := s.db.Delete(&img).Error; err != nil {
-		return fmt.Errorf("failed to delete image from db: %w", err)
-	}
+		s.deleteThumbnails(ctx, storage, img.Path)
+		s.deleteVariants(ctx, img.ID)
 
-	return nil
+		// 路由、派生记录与相册成员由外键级联删除，以它为封面的相册改回默认封面
+		if err := tx.Delete(&img).Error; err != nil {
+			return fmt.Errorf("failed to delete image from db: %w", err)
+		}
+		return nil
+	})
 }
 
 // UpdateImage 更新图片信息
@@ -828,6 +918,14 @@ func (s *ImageService) Config() *config.Config {
 	return s.cfg
 }
 
+func (s *ImageService) Webhooks() *WebhookService {
+	return s.webhooks
+}
+
+func (s *ImageService) TaskHub() *UploadTaskHub {
+	return s.taskHub
+}
+
 // GetStats 获取系统统计信息
 func (s *ImageService) GetStats() (*model.SystemStats, error) {
 	var stats model.SystemStats
@@ -1,6 +1,14 @@
 package service
 
-import "testing"
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/TangTangChu/AnzuImg/backend/internal/config"
+)
 
 func TestProcessedMediaDimensionsAllowed(t *testing.T) {
 	if !processedMediaDimensionsAllowed(8000, 8000) {
@@ -13,3 +21,47 @@ func TestProcessedMediaDimensionsAllowed(t *testing.T) {
 		t.Fatal("expected excessive pixel count to be rejected")
 	}
 }
+
+func TestStageUploadHashesAndEnforcesLimit(t *testing.T) {
+	u, err := StageUpload(strings.NewReader("hello"), 5)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer u.Remove()
+	if u.Size != 5 || u.Hash != "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824" {
+		t.Fatalf("unexpected staged upload: %+v", u)
+	}
+
+	if _, err := StageUpload(strings.NewReader("hello!"), 5); !errors.Is(err, ErrUploadTooLarge) {
+		t.Fatalf("expected ErrUploadTooLarge, got %v", err)
+	}
+}
+
+func TestLocalStorageSaveStreamsAndOpens(t *testing.T) {
+	st := NewLocalStorage(&config.Config{StorageBase: t.TempDir()}, nil)
+	ctx := context.Background()
+
+	path, n, err := st.Save(ctx, "abcdef", strings.NewReader("0123456789"), -1, "text/plain")
+	if err != nil || n != 10 {
+		t.Fatalf("save failed: n=%d err=%v", n, err)
+	}
+	if _, _, err := st.Save(ctx, "abcdeg", strings.NewReader("short"), 10, "text/plain"); err == nil {
+		t.Fatal("expected size mismatch to fail")
+	}
+	if ok, _ := st.Exists(ctx, "ab/abcdeg"); ok {
+		t.Fatal("expected failed save to leave no file")
+	}
+
+	f, err := st.Open(ctx, path)
+	if err != nil {
+		t.Fatalf("open failed: %v", err)
+	}
+	defer f.Close()
+	if _, err := f.Seek(4, io.SeekStart); err != nil {
+		t.Fatalf("seek failed: %v", err)
+	}
+	rest, _ := io.ReadAll(f)
+	if string(rest) != "456789" {
+		t.Fatalf("unexpected content after seek: %q", rest)
+	}
+}
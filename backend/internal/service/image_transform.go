@@ -0,0 +1,348 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cshum/vipsgen/vips"
+
+	"github.com/TangTangChu/AnzuImg/backend/internal/model"
+)
+
+var (
+	ErrInvalidTransform     = errors.New("invalid transform")
+	ErrTransformUnsupported = errors.New("transform not supported for this media")
+	ErrTransformBusy        = errors.New("transform capacity exhausted")
+)
+
+const (
+	TransformFitInside = "inside" // 等比缩放到边界框内（默认）
+	TransformFitCover  = "cover"  // 等比缩放填满边界框后裁剪
+	TransformFitFill   = "fill"   // 拉伸到精确尺寸
+
+	transformSlotWait = 10 * time.Second
+)
+
+// 允许的输出边长，限制可生成的变体数量，避免被用来任意消耗 CPU
+var allowedTransformSizes = map[int]bool{
+	32: true, 64: true, 128: true, 160: true, 240: true, 256: true,
+	320: true, 480: true, 512: true, 640: true, 720: true, 800: true,
+	960: true, 1024: true, 1280: true, 1440: true, 1600: true, 1920: true,
+	2048: true, 2560: true, 3840: true,
+}
+
+var transformCropModes = map[string]vips.Interesting{
+	"centre":    vips.InterestingCentre,
+	"entropy":   vips.InterestingEntropy,
+	"attention": vips.InterestingAttention,
+}
+
+var transformFormatAliases = map[string]string{
+	"webp": "webp",
+	"avif": "avif",
+	"jpeg": "jpeg",
+	"jpg":  "jpeg",
+	"png":  "png",
+}
+
+var transformFormatMime = map[string]string{
+	"webp": "image/webp",
+	"avif": "image/avif",
+	"jpeg": "image/jpeg",
+	"png":  "image/png",
+}
+
+var transformDefaultQuality = map[string]int{
+	"webp": 80,
+	"avif": 50,
+	"jpeg": 82,
+}
+
+// TransformPresets 预设的变换参数，可通过 preset=<name> 使用
+var TransformPresets = map[string]TransformOptions{
+	"thumb":  {Width: 256, Height: 256, Fit: TransformFitCover, Crop: "attention"},
+	"small":  {Width: 480},
+	"medium": {Width: 1024},
+	"large":  {Width: 1920},
+}
+
+// TransformOptions 描述一次按需图片变换
+type TransformOptions struct {
+	Width   int
+	Height  int
+	Fit     string
+	Crop    string
+	Format  string // 为空表示沿用原图格式
+	Quality int    // 为 0 表示使用格式默认质量
+}
+
+var transformQueryKeys = []string{"w", "h", "fit", "crop", "fm", "q", "preset"}
+
+// ParseTransformOptions 从查询参数解析变换选项；未携带任何变换参数时返回 nil
+func ParseTransformOptions(query url.Values) (*TransformOptions, error) {
+	present := false
+	for _, key := range transformQueryKeys {
+		if _, ok := query[key]; ok {
+			present = true
+			break
+		}
+	}
+	if !present {
+		return nil, nil
+	}
+
+	var opts TransformOptions
+	if name := strings.ToLower(strings.TrimSpace(query.Get("preset"))); name != "" {
+		preset, ok := TransformPresets[name]
+		if !ok {
+			return nil, fmt.Errorf("%w: unknown preset %q", ErrInvalidTransform, name)
+		}
+		opts = preset
+	}
+
+	if raw := strings.TrimSpace(query.Get("w")); raw != "" {
+		v, err := parseTransformSize(raw)
+		if err != nil {
+			return nil, fmt.Errorf("%w: w %v", ErrInvalidTransform, err)
+		}
+		opts.Width = v
+	}
+	if raw := strings.TrimSpace(query.Get("h")); raw != "" {
+		v, err := parseTransformSize(raw)
+		if err != nil {
+			return nil, fmt.Errorf("%w: h %v", ErrInvalidTransform, err)
+		}
+		opts.Height = v
+	}
+	if raw := strings.ToLower(strings.TrimSpace(query.Get("fit"))); raw != "" {
+		switch raw {
+		case TransformFitInside, TransformFitCover, TransformFitFill:
+			opts.Fit = raw
+		default:
+			return nil, fmt.Errorf("%w: unknown fit %q", ErrInvalidTransform, raw)
+		}
+	}
+	if raw := strings.ToLower(strings.TrimSpace(query.Get("crop"))); raw != "" {
+		if raw == "center" {
+			raw = "centre"
+		}
+		if _, ok := transformCropModes[raw]; !ok {
+			return nil, fmt.Errorf("%w: unknown crop %q", ErrInvalidTransform, raw)
+		}
+		opts.Crop = raw
+	}
+	if raw := strings.ToLower(strings.TrimSpace(query.Get("fm"))); raw != "" {
+		format, ok := transformFormatAliases[raw]
+		if !ok {
+			return nil, fmt.Errorf("%w: unsupported format %q", ErrInvalidTransform, raw)
+		}
+		opts.Format = format
+	}
+	if raw := strings.TrimSpace(query.Get("q")); raw != "" {
+		v, err := strconv.Atoi(raw)
+		// 质量仅允许 30-95 之间 5 的倍数
+		if err != nil || v < 30 || v > 95 || v%5 != 0 {
+			return nil, fmt.Errorf("%w: q must be a multiple of 5 between 30 and 95", ErrInvalidTransform)
+		}
+		opts.Quality = v
+	}
+
+	if opts.Fit == "" {
+		opts.Fit = TransformFitInside
+		if opts.Crop != "" {
+			opts.Fit = TransformFitCover
+		}
+	}
+	if opts.Crop != "" && opts.Fit != TransformFitCover {
+		return nil, fmt.Errorf("%w: crop requires fit=cover", ErrInvalidTransform)
+	}
+	if opts.Fit == TransformFitCover && opts.Crop == "" {
+		opts.Crop = "centre"
+	}
+	if (opts.Fit == TransformFitCover || opts.Fit == TransformFitFill) && (opts.Width == 0 || opts.Height == 0) {
+		return nil, fmt.Errorf("%w: fit=%s requires both w and h", ErrInvalidTransform, opts.Fit)
+	}
+
+	return &opts, nil
+}
+
+func parseTransformSize(raw string) (int, error) {
+	v, err := strconv.Atoi(raw)
+	if err != nil {
+		return 0, fmt.Errorf("must be an integer")
+	}
+	if !allowedTransformSizes[v] {
+		return 0, fmt.Errorf("%d is not an allowed size", v)
+	}
+	return v, nil
+}
+
+// Resolve 根据源图 MIME 补全输出格式与质量
+func (o TransformOptions) Resolve(sourceMimeType string) TransformOptions {
+	if o.Format == "" {
+		o.Format = "webp"
+		for format, mime := range transformFormatMime {
+			if mime == sourceMimeType {
+				o.Format = format
+				break
+			}
+		}
+	}
+	if o.Format == "png" {
+		o.Quality = 0
+	} else if o.Quality == 0 {
+		o.Quality = transformDefaultQuality[o.Format]
+	}
+	return o
+}
+
+// Key 返回变换参数的规范化表示，需在 Resolve 之后调用
+func (o TransformOptions) Key() string {
+	return fmt.Sprintf("w%d-h%d-%s-%s-%s-q%d", o.Width, o.Height, o.Fit, o.Crop, o.Format, o.Quality)
+}
+
+// MimeType 返回输出格式的 MIME 类型，需在 Resolve 之后调用
+func (o TransformOptions) MimeType() string {
+	return transformFormatMime[o.Format]
+}
+
+// ApplyTransform 按选项对图片进行缩放/裁剪并编码为目标格式。
+// 动图仅输出第一帧。
+func ApplyTransform(data []byte, sourceMimeType string, opts TransformOptions) ([]byte, string, error) {
+	opts = opts.Resolve(sourceMimeType)
+
+	width := opts.Width
+	height := opts.Height
+	if width == 0 {
+		width = maxProcessedMediaDimension
+	}
+	if height == 0 {
+		height = maxProcessedMediaDimension
+	}
+
+	thumbOpts := &vips.ThumbnailBufferOptions{
+		Height: height,
+		Size:   vips.SizeDown,
+	}
+	switch opts.Fit {
+	case TransformFitCover:
+		thumbOpts.Crop = transformCropModes[opts.Crop]
+	case TransformFitFill:
+		thumbOpts.Size = vips.SizeForce
+	}
+
+	img, err := vips.NewThumbnailBuffer(data, width, thumbOpts)
+	if err != nil {
+		return nil, "", fmt.Errorf("transform failed: %v", err)
+	}
+	defer img.Close()
+
+	var buf []byte
+	switch opts.Format {
+	case "webp":
+		buf, err = img.WebpsaveBuffer(&vips.WebpsaveBufferOptions{
+			Q:      opts.Quality,
+			Effort: 4,
+		})
+	case "avif":
+		buf, err = img.HeifsaveBuffer(&vips.HeifsaveBufferOptions{
+			Q:           opts.Quality,
+			Effort:      4,
+			Compression: vips.HeifCompressionAv1,
+		})
+	case "jpeg":
+		buf, err = img.JpegsaveBuffer(&vips.JpegsaveBufferOptions{
+			Q:          opts.Quality,
+			Interlace:  true,
+			Background: []float64{255, 255, 255},
+		})
+	case "png":
+		buf, err = img.PngsaveBuffer(&vips.PngsaveBufferOptions{
+			Compression: 6,
+			Q:           100,
+			Bitdepth:    8,
+			Effort:      7,
+		})
+	default:
+		return nil, "", fmt.Errorf("unsupported transform format: %s", opts.Format)
+	}
+	if err != nil {
+		return nil, "", fmt.Errorf("%s encode failed: %v", opts.Format, err)
+	}
+
+	return buf, opts.MimeType(), nil
+}
+
+// VariantContent 是一次派生输出（变换或协商格式）的内容
+type VariantContent struct {
+	Key      string // 派生文件名，包含原图哈希，可直接作为 ETag
+	MimeType string
+	Data     []byte
+}
+
+// TransformVariantKey 返回变换结果对应的派生文件名，不触发生成
+func (s *ImageService) TransformVariantKey(img *model.Image, opts TransformOptions) string {
+	return variantName(img.Hash, opts.Resolve(img.MimeType))
+}
+
+// TransformImage 返回变换结果：优先读取已缓存的派生文件，否则读取原图生成并缓存，
+// 生成并发数受 transformSlots 限制
+func (s *ImageService) TransformImage(ctx context.Context, img *model.Image, opts TransformOptions) (*VariantContent, error) {
+	if !IsImageFile(img.MimeType) || img.MimeType == "image/svg+xml" {
+		return nil, ErrTransformUnsupported
+	}
+	if !processedMediaDimensionsAllowed(img.Width, img.Height) {
+		return nil, ErrTransformUnsupported
+	}
+
+	opts = opts.Resolve(img.MimeType)
+	cacheEnabled := s.cfg.Effective().VariantCacheMaxBytes > 0
+	name := variantName(img.Hash, opts)
+	if cacheEnabled {
+		// 同名派生文件串行生成，避免并发请求重复计算
+		unlock := s.variantLock(name)
+		defer unlock()
+		if buf, ok := s.loadVariant(ctx, name); ok {
+			return &VariantContent{Key: name, MimeType: opts.MimeType(), Data: buf}, nil
+		}
+	}
+
+	release, err := s.acquireTransformSlot(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	data, err := readStorageFile(ctx, s.storageFor(img), img.Path)
+	if err != nil {
+		return nil, fmt.Errorf("read original failed: %w", err)
+	}
+	buf, mimeType, err := ApplyTransform(data, img.MimeType, opts)
+	if err != nil {
+		s.log.Ctx(ctx).Warnf("Transform failed: hash=%s, err=%v", img.Hash, err)
+		return nil, err
+	}
+	if cacheEnabled {
+		s.storeVariant(ctx, img, name, buf, mimeType)
+	}
+	return &VariantContent{Key: name, MimeType: mimeType, Data: buf}, nil
+}
+
+func (s *ImageService) acquireTransformSlot(ctx context.Context) (func(), error) {
+	timer := time.NewTimer(transformSlotWait)
+	defer timer.Stop()
+
+	select {
+	case s.transformSlots <- struct{}{}:
+		return func() { <-s.transformSlots }, nil
+	case <-timer.C:
+		return nil, ErrTransformBusy
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
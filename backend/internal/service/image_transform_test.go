@@ -0,0 +1,73 @@
+package service
+
+import (
+	"errors"
+	"net/url"
+	"testing"
+)
+
+func TestParseTransformOptions(t *testing.T) {
+	opts, err := ParseTransformOptions(url.Values{"v": {"1"}})
+	if err != nil || opts != nil {
+		t.Fatalf("expected no transform for unrelated params, got %+v, %v", opts, err)
+	}
+
+	opts, err = ParseTransformOptions(url.Values{"w": {"640"}, "fm": {"jpg"}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if opts.Width != 640 || opts.Fit != TransformFitInside || opts.Format != "jpeg" {
+		t.Fatalf("unexpected options: %+v", opts)
+	}
+
+	opts, err = ParseTransformOptions(url.Values{"preset": {"thumb"}, "fm": {"avif"}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := opts.Resolve("image/png").Key(); got != "w256-h256-cover-attention-avif-q50" {
+		t.Fatalf("unexpected key: %s", got)
+	}
+
+	invalid := []url.Values{
+		{"w": {"641"}},
+		{"q": {"99"}},
+		{"fit": {"cover"}, "w": {"640"}},
+		{"crop": {"entropy"}, "fit": {"inside"}, "w": {"640"}, "h": {"640"}},
+		{"preset": {"huge"}},
+		{"fm": {"gif"}},
+	}
+	for _, q := range invalid {
+		if _, err := ParseTransformOptions(q); !errors.Is(err, ErrInvalidTransform) {
+			t.Fatalf("expected ErrInvalidTransform for %v, got %v", q, err)
+		}
+	}
+}
+
+func TestTransformOptionsResolveKeepsSourceFormat(t *testing.T) {
+	if got := (TransformOptions{Width: 320}).Resolve("image/png"); got.Format != "png" || got.Quality != 0 {
+		t.Fatalf("expected png without quality, got %+v", got)
+	}
+	if got := (TransformOptions{Width: 320}).Resolve("image/gif"); got.Format != "webp" || got.Quality != 80 {
+		t.Fatalf("expected webp fallback, got %+v", got)
+	}
+}
+
+func TestNegotiateFormat(t *testing.T) {
+	chrome := "image/avif,image/webp,image/apng,image/svg+xml,image/*,*/*;q=0.8"
+	cases := []struct {
+		accept, source, want string
+	}{
+		{chrome, "image/jpeg", "avif"},
+		{"image/webp,*/*", "image/png", "webp"},
+		{"image/avif;q=0,image/webp", "image/jpeg", "webp"},
+		{"image/*,*/*", "image/jpeg", ""},
+		{chrome, "image/avif", ""},
+		{chrome, "image/svg+xml", ""},
+		{chrome, "video/mp4", ""},
+	}
+	for _, tc := range cases {
+		if got := NegotiateFormat(tc.accept, tc.source); got != tc.want {
+			t.Fatalf("NegotiateFormat(%q, %q) = %q, want %q", tc.accept, tc.source, got, tc.want)
+		}
+	}
+}
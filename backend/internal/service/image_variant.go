@@ -0,0 +1,158 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+
+	"gorm.io/gorm/clause"
+
+	"github.com/TangTangChu/AnzuImg/backend/internal/model"
+)
+
+const (
+	variantTouchInterval = time.Minute
+	variantEvictBatch    = 100
+)
+
+// variantName 由原图哈希与规范化变换参数得到确定的派生文件名，
+// 与 _thumb.webp 一样经 Storage.Save 存放在原图同目录下
+func variantName(hash string, opts TransformOptions) string {
+	sum := sha256.Sum256([]byte(opts.Key()))
+	return hash + "_v_" + hex.EncodeToString(sum[:8]) + "." + opts.Format
+}
+
+func (s *ImageService) variantLock(name string) func() {
+	sum := sha256.Sum256([]byte(name))
+	lock := &s.variantLocks[sum[0]]
+	lock.Lock()
+	return lock.Unlock
+}
+
+// loadVariant 读取已缓存的派生文件，命中时刷新访问时间
+func (s *ImageService) loadVariant(ctx context.Context, name string) ([]byte, bool) {
+	var v model.ImageVariant
+	if err := s.db.WithContext(ctx).Where("variant_key = ?", name).First(&v).Error; err != nil {
+		return nil, false
+	}
+
+	data, err := readStorageFile(ctx, s.storage, v.Path)
+	if err != nil {
+		// 文件已丢失，删除记录后重新生成
+		s.log.Ctx(ctx).Warnf("Variant file missing, regenerating: key=%s, err=%v", name, err)
+		s.db.WithContext(ctx).Delete(&v)
+		return nil, false
+	}
+
+	if time.Since(v.LastAccessedAt) > variantTouchInterval {
+		s.db.WithContext(ctx).Model(&v).UpdateColumn("last_accessed_at", time.Now())
+	}
+	return data, true
+}
+
+// storeVariant 保存派生文件并登记到 image_variants
+func (s *ImageService) storeVariant(ctx context.Context, img *model.Image, name string, data []byte, mimeType string) {
+	path, size, err := s.storage.Save(ctx, name, bytes.NewReader(data), int64(len(data)), mimeType)
+	if err != nil {
+		s.log.Ctx(ctx).Warnf("Failed to save variant: key=%s, err=%v", name, err)
+		return
+	}
+
+	now := time.Now()
+	v := model.ImageVariant{
+		ImageID:        img.ID,
+		VariantKey:     name,
+		Path:           path,
+		MimeType:       mimeType,
+		Size:           size,
+		LastAccessedAt: now,
+		CreatedAt:      now,
+	}
+	err = s.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "variant_key"}},
+		DoUpdates: clause.AssignmentColumns([]string{"storage_path", "mime_type", "size", "last_accessed_at"}),
+	}).Create(&v).Error
+	if err != nil {
+		// 原图可能已被删除，清理刚写入的文件
+		s.log.Ctx(ctx).Warnf("Failed to record variant: key=%s, err=%v", name, err)
+		if delErr := s.storage.Delete(ctx, path); delErr != nil {
+			s.log.Ctx(ctx).Warnf("Failed to cleanup variant file: %v", delErr)
+		}
+		return
+	}
+
+	budget := s.cfg.Effective().VariantCacheMaxBytes
+	if budget > 0 && s.variantEvicting.CompareAndSwap(false, true) {
+		go func() {
+			defer s.variantEvicting.Store(false)
+			if _, _, err := s.EvictVariants(context.Background(), budget); err != nil {
+				s.log.Warnf("Variant eviction failed: %v", err)
+			}
+		}()
+	}
+}
+
+// EvictVariants 按最近访问时间淘汰派生文件，直到总大小不超过 budget 字节
+func (s *ImageService) EvictVariants(ctx context.Context, budget int64) (int, int64, error) {
+	var total int64
+	if err := s.db.WithContext(ctx).Model(&model.ImageVariant{}).
+		Select("COALESCE(SUM(size), 0)").Scan(&total).Error; err != nil {
+		return 0, 0, err
+	}
+
+	evicted := 0
+	var freed int64
+	// 按 (last_accessed_at, id) 向后翻页，删除失败的记录留待下次淘汰，不会被重复读取
+	var last *model.ImageVariant
+	for total > budget {
+		var batch []model.ImageVariant
+		query := s.db.WithContext(ctx).Order("last_accessed_at ASC").Order("id ASC")
+		if last != nil {
+			query = query.Where("(last_accessed_at, id) > (?, ?)", last.LastAccessedAt, last.ID)
+		}
+		if err := query.Limit(variantEvictBatch).Find(&batch).Error; err != nil {
+			return evicted, freed, err
+		}
+		if len(batch) == 0 {
+			break
+		}
+		last = &batch[len(batch)-1]
+		for i := range batch {
+			if total <= budget {
+				break
+			}
+			v := batch[i]
+			if err := s.storage.Delete(ctx, v.Path); err != nil {
+				s.log.Ctx(ctx).Warnf("Failed to delete variant file %s: %v", v.Path, err)
+				continue
+			}
+			if err := s.db.WithContext(ctx).Delete(&v).Error; err != nil {
+				return evicted, freed, err
+			}
+			total -= v.Size
+			freed += v.Size
+			evicted++
+		}
+	}
+
+	if evicted > 0 {
+		s.log.Ctx(ctx).Infof("Evicted %d variants, freed %d bytes", evicted, freed)
+	}
+	return evicted, freed, nil
+}
+
+// deleteVariants 删除某张图片的全部派生文件，记录随 images 级联删除
+func (s *ImageService) deleteVariants(ctx context.Context, imageID uint64) {
+	var variants []model.ImageVariant
+	if err := s.db.WithContext(ctx).Where("image_id = ?", imageID).Find(&variants).Error; err != nil {
+		s.log.Ctx(ctx).Warnf("Failed to list variants: %v", err)
+		return
+	}
+	for _, v := range variants {
+		if err := s.storage.Delete(ctx, v.Path); err != nil {
+			s.log.Ctx(ctx).Warnf("Failed to delete variant file %s: %v", v.Path, err)
+		}
+	}
+}
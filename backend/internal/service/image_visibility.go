@@ -0,0 +1,151 @@
+package service
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/TangTangChu/AnzuImg/backend/internal/model"
+)
+
+var (
+	ErrInvalidVisibility      = errors.New("invalid visibility")
+	ErrSignedURLNotConfigured = errors.New("signed url secret not configured")
+	ErrInvalidSignedURLTTL    = errors.New("invalid signed url ttl")
+	ErrSignatureRequired      = errors.New("signature required")
+	ErrSignatureInvalid       = errors.New("signature invalid")
+	ErrSignatureExpired       = errors.New("signature expired")
+)
+
+const defaultSignedURLTTL = time.Hour
+
+// SignedImageURL 是私有媒体的签名链接，原图、缩略图与按需变换共用同一签名
+type SignedImageURL struct {
+	URL          string    `json:"url"`
+	ThumbnailURL string    `json:"thumbnail_url"`
+	ExpiresAt    time.Time `json:"expires_at"`
+}
+
+// ValidVisibility 判断可见性取值是否合法
+func ValidVisibility(v string) bool {
+	switch v {
+	case model.VisibilityPublic, model.VisibilityUnlisted, model.VisibilityPrivate:
+		return true
+	}
+	return false
+}
+
+// signImage 计算 HMAC-SHA256(secret, "<hash>.<expires>")
+func signImage(secret, hash string, expires int64) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(hash))
+	mac.Write([]byte("."))
+	mac.Write([]byte(strconv.FormatInt(expires, 10)))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// signedURLMaxTTL 返回签名链接的最长有效期，未配置时为 7 天
+func (s *ImageService) signedURLMaxTTL() time.Duration {
+	if s.cfg.SignedURLMaxTTLSec > 0 {
+		return time.Duration(s.cfg.SignedURLMaxTTLSec) * time.Second
+	}
+	return 7 * 24 * time.Hour
+}
+
+// SignImageURL 为媒体生成带有效期的签名链接，ttl 为 0 时使用 1 小时。
+// 公开媒体也可以签名，签名参数会被忽略。
+func (s *ImageService) SignImageURL(hash string, ttl time.Duration) (*SignedImageURL, error) {
+	if s.cfg.SignedURLSecret == "" {
+		return nil, ErrSignedURLNotConfigured
+	}
+	if ttl == 0 {
+		ttl = defaultSignedURLTTL
+	}
+	if maxTTL := s.signedURLMaxTTL(); ttl < time.Second || ttl > maxTTL {
+		return nil, fmt.Errorf("%w: ttl must be between 1 and %d seconds", ErrInvalidSignedURLTTL, int64(maxTTL.Seconds()))
+	}
+	if err := s.db.Select("id").Where("hash = ?", hash).First(&model.Image{}).Error; err != nil {
+		return nil, err
+	}
+
+	expiresAt := time.Now().Add(ttl).Truncate(time.Second)
+	query := url.Values{}
+	query.Set("expires", strconv.FormatInt(expiresAt.Unix(), 10))
+	query.Set("signature", signImage(s.cfg.SignedURLSecret, hash, expiresAt.Unix()))
+	return &SignedImageURL{
+		URL:          "/i/" + hash + "?" + query.Encode(),
+		ThumbnailURL: "/i/" + hash + "/thumbnail?" + query.Encode(),
+		ExpiresAt:    expiresAt,
+	}, nil
+}
+
+// VerifyImageSignature 校验签名链接的 expires 与 signature 参数，先校验签名再判断是否过期
+func (s *ImageService) VerifyImageSignature(hash, expires, signature string, now time.Time) error {
+	if expires == "" || signature == "" {
+		return ErrSignatureRequired
+	}
+	if s.cfg.SignedURLSecret == "" {
+		return ErrSignatureInvalid
+	}
+	exp, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil {
+		return ErrSignatureInvalid
+	}
+	expected := signImage(s.cfg.SignedURLSecret, hash, exp)
+	if !hmac.Equal([]byte(expected), []byte(signature)) {
+		return ErrSignatureInvalid
+	}
+	if now.Unix() >= exp {
+		return ErrSignatureExpired
+	}
+	return nil
+}
+
+// LookupVisibility 按哈希或路由查找媒体的哈希与可见性，route 非空时按路由查找
+func (s *ImageService) LookupVisibility(ctx context.Context, hash, route string) (string, string, error) {
+	var row struct {
+		Hash       string
+		Visibility string
+	}
+	query := s.db.WithContext(ctx).Model(&model.Image{}).Select("images.hash, images.visibility")
+	if route != "" {
+		query = query.Joins("JOIN image_routes ON image_routes.image_id = images.id").
+			Where("image_routes.route = ?", route)
+	} else {
+		query = query.Where("images.hash = ?", hash)
+	}
+	if err := query.Take(&row).Error; err != nil {
+		return "", "", err
+	}
+	return row.Hash, row.Visibility, nil
+}
+
+// SetVisibility 修改媒体可见性
+func (s *ImageService) SetVisibility(hash, visibility string) (*model.Image, error) {
+	if !ValidVisibility(visibility) {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidVisibility, visibility)
+	}
+	var img model.Image
+	if err := s.db.Where("hash = ?", hash).First(&img).Error; err != nil {
+		return nil, err
+	}
+	img.Visibility = visibility
+	if err := s.db.Model(&img).Select("Visibility", "UpdatedAt").Updates(&img).Error; err != nil {
+		return nil, fmt.Errorf("update visibility failed: %w", err)
+	}
+	return &img, nil
+}
+
+// restrictPrivate 私有媒体不能重定向到公开地址，改为由服务端代理；预签名地址本身有有效期，保持不变
+func restrictPrivate(img *model.Image, loc *MediaLocation) {
+	if img.Visibility == model.VisibilityPrivate && loc.RedirectURL != "" && loc.RedirectTTL == 0 {
+		loc.RedirectURL = ""
+		loc.Proxy = true
+	}
+}
@@ -0,0 +1,66 @@
+package service
+
+import (
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/TangTangChu/AnzuImg/backend/internal/config"
+	"github.com/TangTangChu/AnzuImg/backend/internal/model"
+)
+
+func TestVerifyImageSignature(t *testing.T) {
+	s := &ImageService{cfg: &config.Config{SignedURLSecret: "secret"}}
+	now := time.Unix(1700000000, 0)
+	exp := now.Add(time.Hour).Unix()
+	expires := strconv.FormatInt(exp, 10)
+	sig := signImage("secret", "abc", exp)
+
+	if err := s.VerifyImageSignature("abc", expires, sig, now); err != nil {
+		t.Fatalf("valid signature rejected: %v", err)
+	}
+
+	cases := []struct {
+		name, hash, expires, sig string
+		now                      time.Time
+		want                     error
+	}{
+		{"missing", "abc", "", "", now, ErrSignatureRequired},
+		{"other hash", "abd", expires, sig, now, ErrSignatureInvalid},
+		{"extended expiry", "abc", strconv.FormatInt(exp+1, 10), sig, now, ErrSignatureInvalid},
+		{"bad expires", "abc", "soon", sig, now, ErrSignatureInvalid},
+		{"expired", "abc", expires, sig, time.Unix(exp, 0), ErrSignatureExpired},
+	}
+	for _, tc := range cases {
+		if err := s.VerifyImageSignature(tc.hash, tc.expires, tc.sig, tc.now); !errors.Is(err, tc.want) {
+			t.Fatalf("%s: expected %v, got %v", tc.name, tc.want, err)
+		}
+	}
+
+	// 未配置密钥时任何签名都无效
+	unconfigured := &ImageService{cfg: &config.Config{}}
+	if err := unconfigured.VerifyImageSignature("abc", expires, signImage("", "abc", exp), now); !errors.Is(err, ErrSignatureInvalid) {
+		t.Fatalf("expected ErrSignatureInvalid without secret, got %v", err)
+	}
+}
+
+func TestRestrictPrivate(t *testing.T) {
+	public := &MediaLocation{RedirectURL: "https://cdn.example.com/a"}
+	restrictPrivate(&model.Image{Visibility: model.VisibilityPublic}, public)
+	if public.Proxy || public.RedirectURL == "" {
+		t.Fatalf("public media should keep redirect: %+v", public)
+	}
+
+	private := &MediaLocation{RedirectURL: "https://cdn.example.com/a"}
+	restrictPrivate(&model.Image{Visibility: model.VisibilityPrivate}, private)
+	if !private.Proxy || private.RedirectURL != "" {
+		t.Fatalf("private media should be proxied: %+v", private)
+	}
+
+	presigned := &MediaLocation{RedirectURL: "https://s3.example.com/a?X-Amz-Signature=x", RedirectTTL: time.Hour}
+	restrictPrivate(&model.Image{Visibility: model.VisibilityPrivate}, presigned)
+	if presigned.Proxy || presigned.RedirectURL == "" {
+		t.Fatalf("presigned redirect should be kept: %+v", presigned)
+	}
+}
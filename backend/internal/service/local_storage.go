@@ -3,8 +3,11 @@ package service
 import (
 	"context"
 	"fmt"
+	"io"
+	"io/fs"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/TangTangChu/AnzuImg/backend/internal/config"
 	"github.com/TangTangChu/AnzuImg/backend/internal/logger"
@@ -21,8 +24,8 @@ func NewLocalStorage(cfg *config.Config, log *logger.Logger) *LocalStorage {
 	return &LocalStorage{cfg: cfg, log: log}
 }
 
-// Save 保存图片到本地文件系统
-func (s *LocalStorage) Save(ctx context.Context, hash string, data []byte, mimeType string) (string, int64, error) {
+// Save 将内容写入本地文件系统，先写临时文件再原子重命名，避免读到写了一半的文件
+func (s *LocalStorage) Save(ctx context.Context, hash string, r io.Reader, size int64, mimeType string) (string, int64, error) {
 	if err := os.MkdirAll(s.cfg.StorageBase, 0o755); err != nil {
 		return "", 0, fmt.Errorf("mkdir storage base failed: %w", err)
 	}
@@ -35,11 +38,30 @@ func (s *LocalStorage) Save(ctx context.Context, hash string, data []byte, mimeT
 	absPath := filepath.Join(subdir, hash)
 	relPath := filepath.Join(hash[:2], hash)
 
-	if err := os.WriteFile(absPath, data, 0o644); err != nil {
+	tmp, err := os.CreateTemp(subdir, ".tmp-"+hash+"-*")
+	if err != nil {
+		return "", 0, fmt.Errorf("create temp file failed: %w", err)
+	}
+	tmpPath := tmp.Name()
+	written, err := io.Copy(tmp, r)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil && size >= 0 && written != size {
+		err = fmt.Errorf("short write: expected %d bytes, got %d", size, written)
+	}
+	if err == nil {
+		err = os.Chmod(tmpPath, 0o644)
+	}
+	if err == nil {
+		err = os.Rename(tmpPath, absPath)
+	}
+	if err != nil {
+		_ = os.Remove(tmpPath)
 		return "", 0, fmt.Errorf("write file failed: %w", err)
 	}
 
-	return relPath, int64(len(data)), nil
+	return relPath, written, nil
 }
 
 // GetAbsPath 根据相对路径获取绝对路径
@@ -47,6 +69,20 @@ func (s *LocalStorage) GetAbsPath(ctx context.Context, relPath string) (string,
 	return filepath.Join(s.cfg.StorageBase, relPath), nil
 }
 
+// Open 打开本地文件
+func (s *LocalStorage) Open(ctx context.Context, relPath string) (io.ReadSeekCloser, error) {
+	absPath, err := s.GetAbsPath(ctx, relPath)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(absPath)
+	if err != nil {
+		return nil, fmt.Errorf("open file failed: %w", err)
+	}
+	return f, nil
+}
+
 // Delete 删除文件
 func (s *LocalStorage) Delete(ctx context.Context, relPath string) error {
 	absPath, err := s.GetAbsPath(ctx, relPath)
@@ -82,6 +118,45 @@ func (s *LocalStorage) Exists(ctx context.Context, relPath string) (bool, error)
 	return true, nil
 }
 
+// List 遍历存储目录下的全部文件，WalkDir 按字典序访问目录项
+func (s *LocalStorage) List(ctx context.Context, startAfter string, fn func(StorageObject) error) error {
+	err := filepath.WalkDir(s.cfg.StorageBase, func(absPath string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		relPath, err := filepath.Rel(s.cfg.StorageBase, absPath)
+		if err != nil || relPath == "." {
+			return err
+		}
+		if d.IsDir() {
+			// 整个目录都在 startAfter 之前时跳过
+			prefix := relPath + string(filepath.Separator)
+			if prefix < startAfter && !strings.HasPrefix(startAfter, prefix) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if relPath <= startAfter || !d.Type().IsRegular() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		return fn(StorageObject{Path: relPath, Size: info.Size(), ModTime: info.ModTime()})
+	})
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
 // Type 返回存储类型
 func (s *LocalStorage) Type() string {
 	return "local"
@@ -0,0 +1,41 @@
+package service
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/TangTangChu/AnzuImg/backend/internal/config"
+)
+
+func TestLocalStorageListResumesAfterKey(t *testing.T) {
+	ctx := context.Background()
+	st := NewLocalStorage(&config.Config{StorageBase: t.TempDir()}, nil)
+	for _, name := range []string{"bb01", "aa01", "aa02", "cc01"} {
+		if _, _, err := st.Save(ctx, name, strings.NewReader(name), -1, "text/plain"); err != nil {
+			t.Fatalf("save failed: %v", err)
+		}
+	}
+
+	var all []string
+	if err := st.List(ctx, "", func(obj StorageObject) error {
+		all = append(all, obj.Path)
+		return nil
+	}); err != nil {
+		t.Fatalf("list failed: %v", err)
+	}
+	if strings.Join(all, ",") != "aa/aa01,aa/aa02,bb/bb01,cc/cc01" {
+		t.Fatalf("unexpected listing: %v", all)
+	}
+
+	var rest []string
+	if err := st.List(ctx, "aa/aa02", func(obj StorageObject) error {
+		rest = append(rest, obj.Path)
+		return nil
+	}); err != nil {
+		t.Fatalf("list failed: %v", err)
+	}
+	if strings.Join(rest, ",") != "bb/bb01,cc/cc01" {
+		t.Fatalf("unexpected listing after key: %v", rest)
+	}
+}
@@ -103,9 +103,8 @@ func applyTimeBounds(q *gorm.DB, f LogFilter) *gorm.DB {
 	return q
 }
 
-// ListAppLogs 分页查询应用日志。
-func (s *LogQueryService) ListAppLogs(filter LogFilter, page, size int) ([]model.AppLog, int64, error) {
-	page, size = clampPage(page, size)
+// appLogQuery 构造应用日志的筛选条件。
+func (s *LogQueryService) appLogQuery(filter LogFilter) *gorm.DB {
 	q := s.db.Model(&model.AppLog{})
 	if filter.Level != "" {
 		q = q.Where("level IN ?", levelsAtOrAbove(filter.Level))
@@ -120,21 +119,34 @@ func (s *LogQueryService) ListAppLogs(filter LogFilter, page, size int) ([]model
 		like := "%" + escapeLike(filter.Search) + "%"
 		q = q.Where("message LIKE ? OR module LIKE ?", like, like)
 	}
-	q = applyTimeBounds(q, filter)
+	return applyTimeBounds(q, filter)
+}
+
+// ListAppLogs 分页查询应用日志。
+func (s *LogQueryService) ListAppLogs(filter LogFilter, page, size int) ([]model.AppLog, int64, error) {
+	page, size = clampPage(page, size)
+	q := s.appLogQuery(filter)
 	var total int64
 	if err := q.Count(&total).Error; err != nil {
 		return nil, 0, err
 	}
 	var rows []model.AppLog
-	if err := q.Order("created_at DESC").Limit(size).Offset((page - 1) * size).Find(&rows).Error; err != nil {
+	if err := q.Order("created_at DESC").Order("id DESC").Limit(size).Offset((page - 1) * size).Find(&rows).Error; err != nil {
 		return nil, 0, err
 	}
 	return rows, total, nil
 }
 
-// ListSecurityLogs 分页查询安全事件日志。failedOnly=true 时仅返回 warning/error。
-func (s *LogQueryService) ListSecurityLogs(filter LogFilter, page, size int, failedOnly bool) ([]model.SecurityEventLog, int64, error) {
-	page, size = clampPage(page, size)
+// ListAppLogsByCursor 按游标查询应用日志，不统计总数。
+func (s *LogQueryService) ListAppLogsByCursor(filter LogFilter, cursor *Cursor, size int) (*CursorPage[model.AppLog], error) {
+	_, size = clampPage(1, size)
+	return findCursorPage(s.appLogQuery(filter), cursor, size, func(row *model.AppLog) Cursor {
+		return Cursor{CreatedAt: row.CreatedAt, ID: row.ID}
+	})
+}
+
+// securityLogQuery 构造安全事件日志的筛选条件。failedOnly=true 时仅返回 warning/error。
+func (s *LogQueryService) securityLogQuery(filter LogFilter, failedOnly bool) *gorm.DB {
 	q := s.db.Model(&model.SecurityEventLog{})
 	if failedOnly {
 		q = q.Where("level IN ?", levelsAtOrAbove("warn"))
@@ -152,18 +164,32 @@ func (s *LogQueryService) ListSecurityLogs(filter LogFilter, page, size int, fai
 		like := "%" + escapeLike(filter.Search) + "%"
 		q = q.Where("action LIKE ? OR message LIKE ? OR path LIKE ? OR ip_address LIKE ? OR username LIKE ?", like, like, like, like, like)
 	}
-	q = applyTimeBounds(q, filter)
+	return applyTimeBounds(q, filter)
+}
+
+// ListSecurityLogs 分页查询安全事件日志。failedOnly=true 时仅返回 warning/error。
+func (s *LogQueryService) ListSecurityLogs(filter LogFilter, page, size int, failedOnly bool) ([]model.SecurityEventLog, int64, error) {
+	page, size = clampPage(page, size)
+	q := s.securityLogQuery(filter, failedOnly)
 	var total int64
 	if err := q.Count(&total).Error; err != nil {
 		return nil, 0, err
 	}
 	var rows []model.SecurityEventLog
-	if err := q.Order("created_at DESC").Limit(size).Offset((page - 1) * size).Find(&rows).Error; err != nil {
+	if err := q.Order("created_at DESC").Order("id DESC").Limit(size).Offset((page - 1) * size).Find(&rows).Error; err != nil {
 		return nil, 0, err
 	}
 	return rows, total, nil
 }
 
+// ListSecurityLogsByCursor 按游标查询安全事件日志，不统计总数。
+func (s *LogQueryService) ListSecurityLogsByCursor(filter LogFilter, cursor *Cursor, size int, failedOnly bool) (*CursorPage[model.SecurityEventLog], error) {
+	_, size = clampPage(1, size)
+	return findCursorPage(s.securityLogQuery(filter, failedOnly), cursor, size, func(row *model.SecurityEventLog) Cursor {
+		return Cursor{CreatedAt: row.CreatedAt, ID: row.ID}
+	})
+}
+
 // CleanupAppLogs 删除指定天数前的应用日志,返回受影响行数。
 func (s *LogQueryService) CleanupAppLogs(days int) (int64, error) {
 	if days <= 0 {
@@ -189,22 +215,7 @@ func (s *LogQueryService) IterateAppLogs(filter LogFilter, hardLimit int, fn fun
 	if hardLimit <= 0 || hardLimit > 100000 {
 		hardLimit = 50000
 	}
-	q := s.db.Model(&model.AppLog{})
-	if filter.Level != "" {
-		q = q.Where("level IN ?", levelsAtOrAbove(filter.Level))
-	}
-	if filter.Module != "" {
-		q = q.Where("module = ?", filter.Module)
-	}
-	if filter.IPAddress != "" {
-		q = q.Where("ip_address = ?", filter.IPAddress)
-	}
-	if filter.Search != "" {
-		like := "%" + escapeLike(filter.Search) + "%"
-		q = q.Where("message LIKE ? OR module LIKE ?", like, like)
-	}
-	q = applyTimeBounds(q, filter)
-	rows, err := q.Order("created_at DESC").Limit(hardLimit).Rows()
+	rows, err := s.appLogQuery(filter).Order("created_at DESC").Limit(hardLimit).Rows()
 	if err != nil {
 		return err
 	}
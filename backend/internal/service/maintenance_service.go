@@ -0,0 +1,294 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+
+	"github.com/TangTangChu/AnzuImg/backend/internal/config"
+	"github.com/TangTangChu/AnzuImg/backend/internal/logger"
+	"github.com/TangTangChu/AnzuImg/backend/internal/model"
+)
+
+// 运行中的任务每批都会刷新 updated_at，超过该时长未刷新视为进程已退出，可被重新认领
+const maintenanceStaleAfter = 2 * time.Minute
+
+var (
+	ErrJobNotFound      = errors.New("maintenance job not found")
+	ErrJobNotResumable  = errors.New("maintenance job is already running or finished")
+	ErrJobCancelled     = errors.New("maintenance job cancelled")
+	ErrUnknownJobKind   = errors.New("unknown maintenance job kind")
+	ErrInvalidJobParams = errors.New("invalid maintenance job params")
+)
+
+// maintenanceRunner 执行一种维护任务。实现按图片 ID 或对象路径递增分批处理，
+// 每处理完一项或一批更新 job 的游标与计数并调用 checkpoint 持久化。
+type maintenanceRunner func(ctx context.Context, job *model.MaintenanceJob, checkpoint func() error) error
+
+// MaintenanceService 管理存储迁移等可断点续跑的维护任务。
+// 任务既可由 Web 端在服务进程内后台执行，也可通过命令行在前台执行。
+type MaintenanceService struct {
+	cfg *config.Config
+	db  *gorm.DB
+	log *logger.Logger
+
+	mu         sync.Mutex
+	cancels    map[string]context.CancelFunc
+	runners    map[string]maintenanceRunner
+	thumbnails *ThumbnailPool
+}
+
+func NewMaintenanceService(cfg *config.Config, db *gorm.DB) *MaintenanceService {
+	s := &MaintenanceService{
+		cfg:     cfg,
+		db:      db,
+		log:     logger.Register("maintenance"),
+		cancels: make(map[string]context.CancelFunc),
+	}
+	s.runners = map[string]maintenanceRunner{
+		model.MaintenanceKindStorageMigration:    s.runStorageMigration,
+		model.MaintenanceKindStorageScrub:        s.runStorageScrub,
+		model.MaintenanceKindThumbnailBackfill:   s.runThumbnailBackfill,
+		model.MaintenanceKindThumbnailRegenerate: s.runThumbnailRegenerate,
+	}
+	return s
+}
+
+// createJob 登记新任务，参数以 JSON 保存以便续跑时还原
+func (s *MaintenanceService) createJob(kind string, params interface{}) (*model.MaintenanceJob, error) {
+	raw, err := json.Marshal(params)
+	if err != nil {
+		return nil, err
+	}
+	job := model.MaintenanceJob{
+		ID:     uuid.NewString(),
+		Kind:   kind,
+		Status: model.MaintenanceStatusPending,
+		Params: datatypes.JSON(raw),
+	}
+	if err := s.db.Create(&job).Error; err != nil {
+		return nil, fmt.Errorf("create maintenance job failed: %w", err)
+	}
+	return &job, nil
+}
+
+// ListJobs 按创建时间倒序列出任务
+func (s *MaintenanceService) ListJobs(limit int) ([]model.MaintenanceJob, error) {
+	if limit <= 0 || limit > 100 {
+		limit = 20
+	}
+	var jobs []model.MaintenanceJob
+	err := s.db.Order("created_at DESC").Limit(limit).Find(&jobs).Error
+	return jobs, err
+}
+
+// GetJob 获取任务详情
+func (s *MaintenanceService) GetJob(id string) (*model.MaintenanceJob, error) {
+	var job model.MaintenanceJob
+	if err := s.db.Where("id = ?", id).First(&job).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrJobNotFound
+		}
+		return nil, err
+	}
+	return &job, nil
+}
+
+// Start 在后台执行任务，任务已被其他进程认领时返回 ErrJobNotResumable
+func (s *MaintenanceService) Start(id string) (*model.MaintenanceJob, error) {
+	job, err := s.claim(id)
+	if err != nil {
+		return nil, err
+	}
+	go func() {
+		if err := s.execute(context.Background(), job); err != nil && !errors.Is(err, ErrJobCancelled) {
+			s.log.Warnf("Maintenance job %s failed: %v", job.ID, err)
+		}
+	}()
+	return job, nil
+}
+
+// Run 在当前 goroutine 中执行任务直到结束，供命令行使用
+func (s *MaintenanceService) Run(ctx context.Context, id string) (*model.MaintenanceJob, error) {
+	job, err := s.claim(id)
+	if err != nil {
+		return nil, err
+	}
+	err = s.execute(ctx, job)
+	return job, err
+}
+
+// Cancel 取消任务。本进程内运行的任务立即中断，其他进程中的任务在下一次检查点停止。
+func (s *MaintenanceService) Cancel(id string) error {
+	res := s.db.Model(&model.MaintenanceJob{}).
+		Where("id = ? AND status IN ?", id, []string{model.MaintenanceStatusPending, model.MaintenanceStatusRunning}).
+		Updates(map[string]interface{}{"status": model.MaintenanceStatusCancelled, "updated_at": time.Now()})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		if _, err := s.GetJob(id); err != nil {
+			return err
+		}
+		return ErrJobNotResumable
+	}
+
+	s.mu.Lock()
+	cancel := s.cancels[id]
+	s.mu.Unlock()
+	if cancel != nil {
+		cancel()
+	}
+	return nil
+}
+
+// ResumeStale 在服务启动时接管上次进程退出时仍在运行的任务
+func (s *MaintenanceService) ResumeStale() {
+	var ids []string
+	if err := s.db.Model(&model.MaintenanceJob{}).
+		Where("status = ? AND updated_at < ?", model.MaintenanceStatusRunning, time.Now().Add(-maintenanceStaleAfter)).
+		Pluck("id", &ids).Error; err != nil {
+		s.log.Warnf("Failed to list interrupted maintenance jobs: %v", err)
+		return
+	}
+	for _, id := range ids {
+		if _, err := s.Start(id); err != nil {
+			s.log.Warnf("Failed to resume maintenance job %s: %v", id, err)
+			continue
+		}
+		s.log.Infof("Resumed maintenance job %s", id)
+	}
+}
+
+// claim 以条件更新认领任务，保证同一任务同时只有一个执行者。
+// 失败的任务从头重试，取消与中断的任务从游标处继续。
+func (s *MaintenanceService) claim(id string) (*model.MaintenanceJob, error) {
+	job, err := s.GetJob(id)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := s.runners[job.Kind]; !ok {
+		return nil, ErrUnknownJobKind
+	}
+
+	now := time.Now()
+	updates := map[string]interface{}{
+		"status":       model.MaintenanceStatusRunning,
+		"last_error":   "",
+		"updated_at":   now,
+		"completed_at": nil,
+	}
+	if job.StartedAt == nil {
+		updates["started_at"] = now
+	}
+	if job.Status == model.MaintenanceStatusFailed {
+		updates["stage"] = ""
+		updates["last_id"] = 0
+		updates["last_key"] = ""
+		updates["processed"] = 0
+		updates["failed"] = 0
+	}
+	res := s.db.Model(&model.MaintenanceJob{}).
+		Where("id = ?", id).
+		Where("status IN ? OR (status = ? AND updated_at < ?)",
+			[]string{model.MaintenanceStatusPending, model.MaintenanceStatusFailed, model.MaintenanceStatusCancelled},
+			model.MaintenanceStatusRunning, now.Add(-maintenanceStaleAfter)).
+		Updates(updates)
+	if res.Error != nil {
+		return nil, res.Error
+	}
+	if res.RowsAffected == 0 {
+		return nil, ErrJobNotResumable
+	}
+	return s.GetJob(id)
+}
+
+// execute 执行已认领的任务并记录最终状态
+func (s *MaintenanceService) execute(parent context.Context, job *model.MaintenanceJob) error {
+	ctx, cancel := context.WithCancel(parent)
+	s.mu.Lock()
+	s.cancels[job.ID] = cancel
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.cancels, job.ID)
+		s.mu.Unlock()
+		cancel()
+	}()
+
+	s.log.Infof("Maintenance job %s (%s) started from id %d", job.ID, job.Kind, job.LastID)
+	checkpoint := func() error {
+		return s.checkpoint(ctx, job)
+	}
+	err := s.runners[job.Kind](ctx, job, checkpoint)
+
+	now := time.Now()
+	updates := map[string]interface{}{
+		"stage":        job.Stage,
+		"last_id":      job.LastID,
+		"last_key":     job.LastKey,
+		"total":        job.Total,
+		"processed":    job.Processed,
+		"failed":       job.Failed,
+		"updated_at":   now,
+		"completed_at": &now,
+	}
+	switch {
+	case errors.Is(err, ErrJobCancelled) || errors.Is(err, context.Canceled):
+		err = ErrJobCancelled
+		updates["status"] = model.MaintenanceStatusCancelled
+		updates["completed_at"] = nil
+	case err != nil:
+		updates["status"] = model.MaintenanceStatusFailed
+		updates["last_error"] = err.Error()
+	case job.Failed > 0:
+		err = fmt.Errorf("%d items failed", job.Failed)
+		updates["status"] = model.MaintenanceStatusFailed
+		if job.LastError == "" {
+			updates["last_error"] = err.Error()
+		} else {
+			updates["last_error"] = job.LastError
+		}
+	default:
+		updates["status"] = model.MaintenanceStatusSucceeded
+	}
+	if dbErr := s.db.Model(&model.MaintenanceJob{}).Where("id = ?", job.ID).Updates(updates).Error; dbErr != nil {
+		s.log.Warnf("Failed to record maintenance job %s result: %v", job.ID, dbErr)
+	}
+	s.log.Infof("Maintenance job %s finished: status=%v, processed=%d/%d, failed=%d",
+		job.ID, updates["status"], job.Processed, job.Total, job.Failed)
+	return err
+}
+
+// checkpoint 持久化进度，同时检查任务是否已在其他进程中被取消
+func (s *MaintenanceService) checkpoint(ctx context.Context, job *model.MaintenanceJob) error {
+	if err := ctx.Err(); err != nil {
+		return ErrJobCancelled
+	}
+	res := s.db.Model(&model.MaintenanceJob{}).
+		Where("id = ? AND status = ?", job.ID, model.MaintenanceStatusRunning).
+		Updates(map[string]interface{}{
+			"stage":      job.Stage,
+			"last_id":    job.LastID,
+			"last_key":   job.LastKey,
+			"total":      job.Total,
+			"processed":  job.Processed,
+			"failed":     job.Failed,
+			"last_error": job.LastError,
+			"updated_at": time.Now(),
+		})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrJobCancelled
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+package service
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// Cursor 是按 (created_at, id) 倒序翻页时上一页最后一条的位置
+type Cursor struct {
+	CreatedAt time.Time `json:"t"`
+	ID        uint64    `json:"i"`
+}
+
+// CursorPage 是游标分页的一页结果，NextCursor 为空表示没有更多
+type CursorPage[T any] struct {
+	Data       []T    `json:"data"`
+	NextCursor string `json:"next_cursor"`
+	HasMore    bool   `json:"has_more"`
+}
+
+// Encode 把位置编码为不透明字符串
+func (c Cursor) Encode() string {
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// DecodeCursor 解析客户端传回的游标，空字符串表示第一页
+func DecodeCursor(raw string) (*Cursor, error) {
+	if raw == "" {
+		return nil, nil
+	}
+	b, err := base64.RawURLEncoding.DecodeString(raw)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	var c Cursor
+	if err := json.Unmarshal(b, &c); err != nil || c.ID == 0 {
+		return nil, ErrInvalidCursor
+	}
+	return &c, nil
+}
+
+// findCursorPage 按 (created_at, id) 倒序读取 cursor 之后的一页，多取一条判断是否还有下一页。
+// 不做 COUNT，翻页期间新插入的行只会出现在第一页之前，不会造成重复或遗漏。
+func findCursorPage[T any](q *gorm.DB, cursor *Cursor, limit int, key func(*T) Cursor) (*CursorPage[T], error) {
+	if cursor != nil {
+		q = q.Where("(created_at, id) < (?, ?)", cursor.CreatedAt, cursor.ID)
+	}
+	var rows []T
+	if err := q.Order("created_at DESC").Order("id DESC").Limit(limit + 1).Find(&rows).Error; err != nil {
+		return nil, fmt.Errorf("cursor query failed: %w", err)
+	}
+	page := &CursorPage[T]{Data: rows}
+	if len(rows) > limit {
+		page.Data = rows[:limit]
+		page.HasMore = true
+		page.NextCursor = key(&page.Data[limit-1]).Encode()
+	}
+	if page.Data == nil {
+		page.Data = []T{}
+	}
+	return page, nil
+}
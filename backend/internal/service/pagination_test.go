@@ -0,0 +1,28 @@
+package service
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCursorRoundTrip(t *testing.T) {
+	if c, err := DecodeCursor(""); err != nil || c != nil {
+		t.Fatalf("empty cursor should mean first page, got %+v, %v", c, err)
+	}
+
+	want := Cursor{CreatedAt: time.Date(2026, 7, 4, 8, 30, 0, 123456000, time.UTC), ID: 42}
+	got, err := DecodeCursor(want.Encode())
+	if err != nil {
+		t.Fatalf("decode failed: %v", err)
+	}
+	if !got.CreatedAt.Equal(want.CreatedAt) || got.ID != want.ID {
+		t.Fatalf("got %+v, want %+v", got, want)
+	}
+
+	for _, raw := range []string{"not a cursor", "e30", Cursor{CreatedAt: want.CreatedAt}.Encode()} {
+		if _, err := DecodeCursor(raw); !errors.Is(err, ErrInvalidCursor) {
+			t.Fatalf("expected ErrInvalidCursor for %q, got %v", raw, err)
+		}
+	}
+}
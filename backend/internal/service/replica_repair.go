@@ -0,0 +1,118 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/TangTangChu/AnzuImg/backend/internal/model"
+)
+
+const replicaRepairBatch = 200
+
+// ErrReplicationDisabled 表示未配置副本存储
+var ErrReplicationDisabled = errors.New("storage replication is not enabled")
+
+// ReplicaRepairStats 是一次副本修复的统计
+type ReplicaRepairStats struct {
+	Checked  int `json:"checked"`
+	Repaired int `json:"repaired"`
+	Failed   int `json:"failed"`
+}
+
+// recordReplicaState 写入或更新原图在某个副本上的状态
+func recordReplicaState(db *gorm.DB, imageID uint64, backend string, replicaErr error) error {
+	now := time.Now()
+	row := model.ImageReplica{
+		ImageID:   imageID,
+		Backend:   backend,
+		Status:    model.ReplicaStatusOK,
+		CheckedAt: now,
+		UpdatedAt: now,
+	}
+	if replicaErr != nil {
+		row.Status = model.ReplicaStatusMissing
+		row.LastError = replicaErr.Error()
+	}
+	return db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "image_id"}, {Name: "backend"}},
+		DoUpdates: clause.AssignmentColumns([]string{"status", "last_error", "checked_at", "updated_at"}),
+	}).Create(&row).Error
+}
+
+// RepairReplicas 逐张检查原图在各副本上是否存在，缺失时从可读的后端重新复制，
+// 并刷新 image_replicas 中的状态
+func (s *ImageService) RepairReplicas(ctx context.Context) (ReplicaRepairStats, error) {
+	var stats ReplicaRepairStats
+	rs, ok := s.storage.(*ReplicatedStorage)
+	if !ok {
+		return stats, ErrReplicationDisabled
+	}
+
+	var lastID uint64
+	for {
+		var batch []model.Image
+		if err := s.db.WithContext(ctx).Where("id > ?", lastID).Order("id ASC").
+			Limit(replicaRepairBatch).Find(&batch).Error; err != nil {
+			return stats, err
+		}
+		if len(batch) == 0 {
+			break
+		}
+		lastID = batch[len(batch)-1].ID
+
+		for i := range batch {
+			img := &batch[i]
+			for _, replica := range rs.Replicas() {
+				if err := ctx.Err(); err != nil {
+					return stats, err
+				}
+				stats.Checked++
+
+				exists, err := replica.Exists(ctx, img.Path)
+				if err == nil && !exists {
+					err = rs.copyToReplica(ctx, replica, img.Hash, img.Path, img.Size, img.MimeType)
+					if err == nil {
+						stats.Repaired++
+						s.log.Ctx(ctx).Infof("Repaired replica: backend=%s, hash=%s", replica.Type(), img.Hash)
+					}
+				}
+				if err != nil {
+					stats.Failed++
+					s.log.Ctx(ctx).Warnf("Replica repair failed: backend=%s, hash=%s, err=%v", replica.Type(), img.Hash, err)
+				}
+				if recErr := recordReplicaState(s.db.WithContext(ctx), img.ID, replica.Type(), err); recErr != nil {
+					s.log.Ctx(ctx).Warnf("Failed to record replica state: %v", recErr)
+				}
+			}
+		}
+	}
+
+	if stats.Repaired > 0 || stats.Failed > 0 {
+		s.log.Ctx(ctx).Infof("Replica repair finished: checked=%d, repaired=%d, failed=%d", stats.Checked, stats.Repaired, stats.Failed)
+	}
+	return stats, nil
+}
+
+// startReplicaRepair 按配置的间隔在后台周期修复副本
+func (s *ImageService) startReplicaRepair() {
+	if _, ok := s.storage.(*ReplicatedStorage); !ok {
+		return
+	}
+	interval := time.Duration(s.cfg.StorageRepairIntervalMin) * time.Minute
+	if interval <= 0 {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			if _, err := s.RepairReplicas(context.Background()); err != nil {
+				s.log.Warnf("Replica repair failed: %v", err)
+			}
+		}
+	}()
+}
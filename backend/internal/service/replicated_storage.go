@@ -0,0 +1,194 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/TangTangChu/AnzuImg/backend/internal/logger"
+)
+
+// ReplicaResult 是一次写入在某个副本上的结果
+type ReplicaResult struct {
+	Backend string
+	Err     error
+}
+
+// ReplicatedStorage 组合一个主存储与若干副本：写入主存储成功即视为成功，
+// 副本写入失败只记录结果；读取时主存储失败则依次回退到副本
+type ReplicatedStorage struct {
+	primary  Storage
+	replicas []Storage
+	log      *logger.Logger
+}
+
+// NewReplicatedStorage 创建组合存储，各后端的 Type 必须互不相同
+func NewReplicatedStorage(primary Storage, replicas []Storage, log *logger.Logger) (*ReplicatedStorage, error) {
+	seen := map[string]bool{primary.Type(): true}
+	for _, r := range replicas {
+		if seen[r.Type()] {
+			return nil, fmt.Errorf("duplicate storage backend: %s", r.Type())
+		}
+		seen[r.Type()] = true
+	}
+	return &ReplicatedStorage{primary: primary, replicas: replicas, log: log}, nil
+}
+
+// Primary 返回主存储
+func (s *ReplicatedStorage) Primary() Storage {
+	return s.primary
+}
+
+// Replicas 返回全部副本存储
+func (s *ReplicatedStorage) Replicas() []Storage {
+	return s.replicas
+}
+
+// contains 判断 st 是否为组合存储本身或其中的某个后端
+func (s *ReplicatedStorage) contains(st Storage) bool {
+	if st == Storage(s) || st == s.primary {
+		return true
+	}
+	for _, r := range s.replicas {
+		if st == r {
+			return true
+		}
+	}
+	return false
+}
+
+// Save 写入主存储与全部副本
+func (s *ReplicatedStorage) Save(ctx context.Context, hash string, r io.Reader, size int64, mimeType string) (string, int64, error) {
+	path, written, _, err := s.SaveAll(ctx, hash, r, size, mimeType)
+	return path, written, err
+}
+
+// SaveAll 写入主存储与全部副本，返回各副本的写入结果；仅主存储失败时返回错误。
+// 内容需要读取多次，r 不可 Seek 时先落盘到临时文件。
+func (s *ReplicatedStorage) SaveAll(ctx context.Context, hash string, r io.Reader, size int64, mimeType string) (string, int64, []ReplicaResult, error) {
+	body, ok := r.(io.ReadSeeker)
+	if !ok {
+		spool, err := StageUpload(r, 0)
+		if err != nil {
+			return "", 0, nil, err
+		}
+		defer spool.Remove()
+		f, err := spool.Open()
+		if err != nil {
+			return "", 0, nil, err
+		}
+		defer f.Close()
+		body, size = f, spool.Size
+	}
+	start, err := body.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return "", 0, nil, err
+	}
+
+	path, written, err := s.primary.Save(ctx, hash, body, size, mimeType)
+	if err != nil {
+		return "", 0, nil, err
+	}
+
+	results := make([]ReplicaResult, 0, len(s.replicas))
+	for _, replica := range s.replicas {
+		res := ReplicaResult{Backend: replica.Type()}
+		if _, err := body.Seek(start, io.SeekStart); err != nil {
+			res.Err = err
+		} else if _, _, err := replica.Save(ctx, hash, body, written, mimeType); err != nil {
+			res.Err = err
+		}
+		if res.Err != nil {
+			s.log.Ctx(ctx).Warnf("Failed to write replica: backend=%s, name=%s, err=%v", res.Backend, hash, res.Err)
+		}
+		results = append(results, res)
+	}
+	return path, written, results, nil
+}
+
+// GetAbsPath 返回主存储上的路径
+func (s *ReplicatedStorage) GetAbsPath(ctx context.Context, relPath string) (string, error) {
+	return s.primary.GetAbsPath(ctx, relPath)
+}
+
+// Open 优先从主存储读取，失败时依次尝试副本
+func (s *ReplicatedStorage) Open(ctx context.Context, relPath string) (io.ReadSeekCloser, error) {
+	f, err := s.primary.Open(ctx, relPath)
+	if err == nil {
+		return f, nil
+	}
+	for _, replica := range s.replicas {
+		rf, rerr := replica.Open(ctx, relPath)
+		if rerr == nil {
+			s.log.Ctx(ctx).Warnf("Primary read failed, served from replica %s: path=%s, err=%v", replica.Type(), relPath, err)
+			return rf, nil
+		}
+	}
+	return nil, err
+}
+
+// ReadBackend 选择用于分发 relPath 的后端。代理分发的远端主存储不做探测，读取失败时由 OpenRemote 回退；
+// 其余情况主存储缺失文件或探测出错时回退到首个存在该文件的副本。
+func (s *ReplicatedStorage) ReadBackend(ctx context.Context, relPath string) Storage {
+	if remote, ok := s.primary.(RemoteStorage); ok && remote.DeliveryMode() == DeliveryProxy {
+		return s.primary
+	}
+	ok, err := s.primary.Exists(ctx, relPath)
+	if err == nil && ok {
+		return s.primary
+	}
+	for _, replica := range s.replicas {
+		if rok, rerr := replica.Exists(ctx, relPath); rerr == nil && rok {
+			s.log.Ctx(ctx).Warnf("File unavailable on primary, serving from replica %s: path=%s, err=%v", replica.Type(), relPath, err)
+			return replica
+		}
+	}
+	return s.primary
+}
+
+// Delete 从所有后端删除，返回主存储的错误
+func (s *ReplicatedStorage) Delete(ctx context.Context, relPath string) error {
+	for _, replica := range s.replicas {
+		if err := replica.Delete(ctx, relPath); err != nil {
+			s.log.Ctx(ctx).Warnf("Failed to delete from replica %s: path=%s, err=%v", replica.Type(), relPath, err)
+		}
+	}
+	return s.primary.Delete(ctx, relPath)
+}
+
+// Exists 任一后端存在即视为存在
+func (s *ReplicatedStorage) Exists(ctx context.Context, relPath string) (bool, error) {
+	ok, err := s.primary.Exists(ctx, relPath)
+	if err == nil && ok {
+		return true, nil
+	}
+	for _, replica := range s.replicas {
+		if rok, rerr := replica.Exists(ctx, relPath); rerr == nil && rok {
+			return true, nil
+		}
+	}
+	return ok, err
+}
+
+// Type 返回主存储类型
+func (s *ReplicatedStorage) Type() string {
+	return s.primary.Type()
+}
+
+// copyToReplica 将 relPath 从可读的后端复制到指定副本
+func (s *ReplicatedStorage) copyToReplica(ctx context.Context, replica Storage, name, relPath string, size int64, mimeType string) error {
+	src, err := s.Open(ctx, relPath)
+	if err != nil {
+		return fmt.Errorf("open source failed: %w", err)
+	}
+	defer src.Close()
+
+	_, written, err := replica.Save(ctx, name, src, size, mimeType)
+	if err != nil {
+		return err
+	}
+	if size >= 0 && written != size {
+		return fmt.Errorf("size mismatch: expected %d bytes, wrote %d", size, written)
+	}
+	return nil
+}
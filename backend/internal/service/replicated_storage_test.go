@@ -0,0 +1,113 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/TangTangChu/AnzuImg/backend/internal/config"
+	"github.com/TangTangChu/AnzuImg/backend/internal/logger"
+)
+
+type namedStorage struct {
+	Storage
+	name string
+}
+
+func (s namedStorage) Type() string { return s.name }
+
+func TestReplicatedStorageFallsBackToReplica(t *testing.T) {
+	ctx := context.Background()
+	primary := NewLocalStorage(&config.Config{StorageBase: t.TempDir()}, nil)
+	replica := namedStorage{Storage: NewLocalStorage(&config.Config{StorageBase: t.TempDir()}, nil), name: "backup"}
+	rs, err := NewReplicatedStorage(primary, []Storage{replica}, logger.Register("storage-test"))
+	if err != nil {
+		t.Fatalf("create replicated storage: %v", err)
+	}
+
+	// 不可 Seek 的输入也需要写入每个后端
+	path, _, results, err := rs.SaveAll(ctx, "abcdef", io.MultiReader(strings.NewReader("payload")), -1, "text/plain")
+	if err != nil || len(results) != 1 || results[0].Err != nil || results[0].Backend != "backup" {
+		t.Fatalf("unexpected save result: %v %+v", err, results)
+	}
+
+	if err := primary.Delete(ctx, path); err != nil {
+		t.Fatalf("delete primary copy: %v", err)
+	}
+	if got := rs.ReadBackend(ctx, path); got.Type() != "backup" {
+		t.Fatalf("expected replica backend, got %s", got.Type())
+	}
+	f, err := rs.Open(ctx, path)
+	if err != nil {
+		t.Fatalf("open with fallback: %v", err)
+	}
+	defer f.Close()
+	if data, _ := io.ReadAll(f); string(data) != "payload" {
+		t.Fatalf("unexpected content: %q", data)
+	}
+
+	if _, err := NewReplicatedStorage(primary, []Storage{NewLocalStorage(&config.Config{}, nil)}, nil); err == nil {
+		t.Fatal("expected duplicate backend type to be rejected")
+	}
+}
+
+// unreachableRemote 模拟不可用的远端主存储
+type unreachableRemote struct {
+	Storage
+	mode string
+}
+
+var errUnreachable = errors.New("remote unreachable")
+
+func (unreachableRemote) Type() string           { return "s3" }
+func (r unreachableRemote) DeliveryMode() string { return r.mode }
+func (unreachableRemote) Exists(context.Context, string) (bool, error) {
+	return false, errUnreachable
+}
+func (unreachableRemote) PresignGet(context.Context, string) (string, time.Duration, error) {
+	return "", 0, errUnreachable
+}
+func (unreachableRemote) OpenRange(context.Context, string, string) (*ObjectStream, error) {
+	return nil, errUnreachable
+}
+
+func TestReplicatedStorageRemotePrimaryFallsBackToLocal(t *testing.T) {
+	ctx := context.Background()
+	local := NewLocalStorage(&config.Config{StorageBase: t.TempDir()}, nil)
+	path, _, err := local.Save(ctx, "abcdef", strings.NewReader("payload"), 7, "text/plain")
+	if err != nil {
+		t.Fatalf("save local replica: %v", err)
+	}
+
+	// 重定向与预签名分发在生成地址前探测主存储
+	for _, mode := range []string{DeliveryRedirect, DeliveryPresign} {
+		rs, err := NewReplicatedStorage(unreachableRemote{mode: mode}, []Storage{local}, logger.Register("storage-test"))
+		if err != nil {
+			t.Fatalf("create replicated storage: %v", err)
+		}
+		if got := rs.ReadBackend(ctx, path); got != local {
+			t.Fatalf("%s: expected local replica, got %s", mode, got.Type())
+		}
+	}
+
+	// 代理分发在读取失败时回退到本地副本
+	rs, err := NewReplicatedStorage(unreachableRemote{mode: DeliveryProxy}, []Storage{local}, logger.Register("storage-test"))
+	if err != nil {
+		t.Fatalf("create replicated storage: %v", err)
+	}
+	if got := rs.ReadBackend(ctx, path); got != rs.Primary() {
+		t.Fatalf("proxy mode should not probe, got %s", got.Type())
+	}
+	svc := &ImageService{storage: rs, log: logger.Register("storage-test")}
+	stream, err := svc.OpenRemote(ctx, &MediaLocation{RelPath: path, storage: rs.Primary()}, "bytes=1-")
+	if err != nil {
+		t.Fatalf("open with local fallback: %v", err)
+	}
+	want, _ := local.GetAbsPath(ctx, path)
+	if stream.LocalPath != want || stream.Body != nil {
+		t.Fatalf("expected local path %s, got %+v", want, stream)
+	}
+}
@@ -0,0 +1,313 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+
+	"github.com/TangTangChu/AnzuImg/backend/internal/config"
+	"github.com/TangTangChu/AnzuImg/backend/internal/logger"
+	"github.com/TangTangChu/AnzuImg/backend/internal/model"
+)
+
+var (
+	ErrUploadNotFound       = errors.New("resumable upload not found")
+	ErrUploadOffsetMismatch = errors.New("upload offset mismatch")
+	ErrUploadIncomplete     = errors.New("resumable upload is incomplete")
+	// ErrUploadRejected 表示内容未通过校验，重试也不会成功，完成时据此丢弃上传
+	ErrUploadRejected = errors.New("resumable upload rejected")
+)
+
+// ResumableUploadOptions 是创建上传时提交的元数据，完成时原样交给上传流程
+type ResumableUploadOptions struct {
+	Routes       []string `json:"routes,omitempty"`
+	Description  string   `json:"description,omitempty"`
+	Tags         []string `json:"tags,omitempty"`
+	Visibility   string   `json:"visibility,omitempty"`
+	Convert      bool     `json:"convert,omitempty"`
+	TargetFormat string   `json:"target_format,omitempty"`
+	Quality      int      `json:"quality,omitempty"`
+	Effort       int      `json:"effort,omitempty"`
+}
+
+// ResumableUploadService 管理断点续传：创建上传、按偏移追加分片、查询进度、完成后转交上传流程。
+// 分片写入 cfg.ResumableUploadDir 下以上传 ID 命名的文件，进度记录在 resumable_uploads 表中，
+// 服务重启后仍可继续上传。
+type ResumableUploadService struct {
+	cfg *config.Config
+	db  *gorm.DB
+	log *logger.Logger
+
+	locks [64]sync.Mutex
+}
+
+func NewResumableUploadService(cfg *config.Config, db *gorm.DB) *ResumableUploadService {
+	s := &ResumableUploadService{
+		cfg: cfg,
+		db:  db,
+		log: logger.Register("resumable-upload"),
+	}
+	return s
+}
+
+func (s *ResumableUploadService) lock(id string) *sync.Mutex {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(id))
+	return &s.locks[h.Sum32()%uint32(len(s.locks))]
+}
+
+func (s *ResumableUploadService) ttl() time.Duration {
+	if s.cfg.ResumableUploadTTLHours > 0 {
+		return time.Duration(s.cfg.ResumableUploadTTLHours) * time.Hour
+	}
+	return 24 * time.Hour
+}
+
+func (s *ResumableUploadService) partPath(id string) string {
+	return filepath.Join(s.cfg.ResumableUploadDir, id+".part")
+}
+
+// Create 登记一次上传并创建空的分片文件，size 超过单文件上限时返回 ErrUploadTooLarge
+func (s *ResumableUploadService) Create(fileName string, size int64, opts ResumableUploadOptions, tokenID *uint) (*model.ResumableUpload, error) {
+	if size <= 0 {
+		return nil, fmt.Errorf("invalid upload size: %d", size)
+	}
+	if limit := s.cfg.Effective().MaxUploadFileBytes; limit > 0 && size > limit {
+		return nil, ErrUploadTooLarge
+	}
+	optsJSON, err := json.Marshal(opts)
+	if err != nil {
+		return nil, fmt.Errorf("encode upload options failed: %w", err)
+	}
+
+	if err := os.MkdirAll(s.cfg.ResumableUploadDir, 0o755); err != nil {
+		return nil, fmt.Errorf("create resumable upload dir failed: %w", err)
+	}
+	upload := model.ResumableUpload{
+		ID:                uuid.NewString(),
+		FileName:          fileName,
+		Size:              size,
+		Options:           datatypes.JSON(optsJSON),
+		UploadedByTokenID: tokenID,
+		ExpiresAt:         time.Now().Add(s.ttl()),
+	}
+	f, err := os.OpenFile(s.partPath(upload.ID), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("create upload part file failed: %w", err)
+	}
+	_ = f.Close()
+
+	if err := s.db.Create(&upload).Error; err != nil {
+		_ = os.Remove(s.partPath(upload.ID))
+		return nil, fmt.Errorf("create resumable upload failed: %w", err)
+	}
+	return &upload, nil
+}
+
+// Get 返回上传进度。tokenID 必须与创建者一致，否则视为不存在
+func (s *ResumableUploadService) Get(id string, tokenID *uint) (*model.ResumableUpload, error) {
+	var upload model.ResumableUpload
+	if err := s.db.Where("id = ? AND expires_at > ?", id, time.Now()).First(&upload).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrUploadNotFound
+		}
+		return nil, err
+	}
+	if !sameToken(upload.UploadedByTokenID, tokenID) {
+		return nil, ErrUploadNotFound
+	}
+	return &upload, nil
+}
+
+func sameToken(a, b *uint) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return *a == *b
+}
+
+// Options 解析上传创建时提交的元数据
+func (s *ResumableUploadService) Options(upload *model.ResumableUpload) ResumableUploadOptions {
+	var opts ResumableUploadOptions
+	if len(upload.Options) > 0 {
+		_ = json.Unmarshal(upload.Options, &opts)
+	}
+	return opts
+}
+
+// WriteChunk 从 offset 处追加分片。offset 必须等于已接收的字节数，否则返回 ErrUploadOffsetMismatch。
+// 读取中途出错时已写入的部分仍计入进度，客户端查询偏移后从断点继续即可。
+func (s *ResumableUploadService) WriteChunk(ctx context.Context, id string, tokenID *uint, offset int64, r io.Reader) (*model.ResumableUpload, error) {
+	mu := s.lock(id)
+	mu.Lock()
+	defer mu.Unlock()
+
+	upload, err := s.Get(id, tokenID)
+	if err != nil {
+		return nil, err
+	}
+	if offset != upload.Offset {
+		return upload, ErrUploadOffsetMismatch
+	}
+
+	n, writeErr := writeChunkAt(s.partPath(id), upload.Offset, upload.Size, r)
+	if n > 0 {
+		upload.Offset += n
+		upload.ExpiresAt = time.Now().Add(s.ttl())
+		if err := s.db.Model(&model.ResumableUpload{}).Where("id = ?", id).Updates(map[string]interface{}{
+			"upload_offset": upload.Offset,
+			"expires_at":    upload.ExpiresAt,
+		}).Error; err != nil {
+			return nil, fmt.Errorf("update upload offset failed: %w", err)
+		}
+	}
+	if writeErr != nil {
+		s.log.Ctx(ctx).Warnf("Resumable upload %s interrupted at offset %d: %v", id, upload.Offset, writeErr)
+		return upload, writeErr
+	}
+	return upload, nil
+}
+
+// writeChunkAt 把 r 写入分片文件的 offset 处，最多写到 size 为止。
+// 写入前截断到 offset，丢弃上次崩溃时已写入但未记录进度的尾部；超出 size 时回滚本次写入。
+func writeChunkAt(path string, offset, size int64, r io.Reader) (int64, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY, 0)
+	if err != nil {
+		return 0, fmt.Errorf("open upload part file failed: %w", err)
+	}
+	defer f.Close()
+	if err := f.Truncate(offset); err != nil {
+		return 0, fmt.Errorf("truncate upload part file failed: %w", err)
+	}
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		return 0, fmt.Errorf("seek upload part file failed: %w", err)
+	}
+
+	remaining := size - offset
+	n, copyErr := io.Copy(f, io.LimitReader(r, remaining+1))
+	if n > remaining {
+		_ = f.Truncate(offset)
+		return 0, ErrUploadTooLarge
+	}
+	if err := f.Sync(); err != nil && copyErr == nil {
+		copyErr = err
+	}
+	if copyErr != nil {
+		return n, fmt.Errorf("write upload chunk failed: %w", copyErr)
+	}
+	return n, nil
+}
+
+// Complete 收齐内容后把分片文件交给 process 处理，处理期间持有该上传的锁，避免重复完成。
+// staged 指向分片文件本身，process 不得删除或移动它，需要转交时先 Copy。
+// process 成功或返回 ErrUploadRejected 时删除上传记录和分片文件，其他错误保留两者以便客户端重试。
+// 尚未收齐全部内容时返回 ErrUploadIncomplete。
+func (s *ResumableUploadService) Complete(id string, tokenID *uint, process func(*model.ResumableUpload, *StagedUpload) error) (*model.ResumableUpload, error) {
+	mu := s.lock(id)
+	mu.Lock()
+	defer mu.Unlock()
+
+	upload, err := s.Get(id, tokenID)
+	if err != nil {
+		return nil, err
+	}
+	if upload.Offset != upload.Size {
+		return upload, ErrUploadIncomplete
+	}
+
+	// 顺延过期时间，避免处理期间被定时清理删除
+	upload.ExpiresAt = time.Now().Add(s.ttl())
+	if err := s.db.Model(&model.ResumableUpload{}).Where("id = ?", id).Update("expires_at", upload.ExpiresAt).Error; err != nil {
+		return upload, fmt.Errorf("extend resumable upload failed: %w", err)
+	}
+	staged, err := stagePartFile(s.partPath(id), upload.Size)
+	if err != nil {
+		return upload, err
+	}
+	err = process(upload, staged)
+	if err != nil && !errors.Is(err, ErrUploadRejected) {
+		return upload, err
+	}
+	if delErr := s.db.Delete(&model.ResumableUpload{}, "id = ?", id).Error; delErr != nil {
+		// 内容已处理，残留记录会在过期后清理
+		s.log.Warnf("Delete completed resumable upload %s failed: %v", id, delErr)
+	} else {
+		_ = os.Remove(s.partPath(id))
+	}
+	return upload, err
+}
+
+// stagePartFile 校验分片文件长度并计算哈希
+func stagePartFile(path string, size int64) (*StagedUpload, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("open upload part file failed: %w", err)
+	}
+	defer f.Close()
+
+	hasher := sha256.New()
+	n, err := io.Copy(hasher, f)
+	if err != nil {
+		return nil, fmt.Errorf("hash upload part file failed: %w", err)
+	}
+	if n != size {
+		return nil, fmt.Errorf("upload part file size mismatch: expected %d, got %d", size, n)
+	}
+	return &StagedUpload{
+		Path: path,
+		Size: n,
+		Hash: hex.EncodeToString(hasher.Sum(nil)),
+	}, nil
+}
+
+// Abort 放弃上传并删除分片文件
+func (s *ResumableUploadService) Abort(id string, tokenID *uint) error {
+	mu := s.lock(id)
+	mu.Lock()
+	defer mu.Unlock()
+
+	if _, err := s.Get(id, tokenID); err != nil {
+		return err
+	}
+	if err := s.db.Delete(&model.ResumableUpload{}, "id = ?", id).Error; err != nil {
+		return fmt.Errorf("delete resumable upload failed: %w", err)
+	}
+	_ = os.Remove(s.partPath(id))
+	return nil
+}
+
+// CleanupExpired 删除超过保留时长未继续的上传及其分片文件
+func (s *ResumableUploadService) CleanupExpired() (int, error) {
+	var expired []model.ResumableUpload
+	if err := s.db.Select("id").Where("expires_at <= ?", time.Now()).Find(&expired).Error; err != nil {
+		return 0, fmt.Errorf("query expired uploads failed: %w", err)
+	}
+	removed := 0
+	for _, upload := range expired {
+		mu := s.lock(upload.ID)
+		mu.Lock()
+		res := s.db.Where("id = ? AND expires_at <= ?", upload.ID, time.Now()).Delete(&model.ResumableUpload{})
+		if res.Error == nil && res.RowsAffected > 0 {
+			_ = os.Remove(s.partPath(upload.ID))
+			removed++
+		}
+		mu.Unlock()
+		if res.Error != nil {
+			return removed, fmt.Errorf("delete expired upload failed: %w", res.Error)
+		}
+	}
+	return removed, nil
+}
@@ -0,0 +1,78 @@
+package service
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// failingReader 读出 data 后返回错误，模拟上传中途断线
+type failingReader struct {
+	data io.Reader
+}
+
+func (r *failingReader) Read(p []byte) (int, error) {
+	n, err := r.data.Read(p)
+	if err == io.EOF {
+		return n, io.ErrUnexpectedEOF
+	}
+	return n, err
+}
+
+func TestWriteChunkAtResumesAfterInterruption(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "id.part")
+	if err := os.WriteFile(path, nil, 0o600); err != nil {
+		t.Fatalf("create part file: %v", err)
+	}
+
+	// 断线时已收到的字节仍计入进度
+	n, err := writeChunkAt(path, 0, 5, &failingReader{data: strings.NewReader("he")})
+	if err == nil || n != 2 {
+		t.Fatalf("expected partial write with error, got %d %v", n, err)
+	}
+
+	// 上次崩溃残留的未记录尾部会被覆盖
+	if err := os.WriteFile(path, []byte("hexx"), 0o600); err != nil {
+		t.Fatalf("write stale tail: %v", err)
+	}
+	if n, err := writeChunkAt(path, 2, 5, strings.NewReader("llo")); err != nil || n != 3 {
+		t.Fatalf("unexpected resume result: %d %v", n, err)
+	}
+
+	staged, err := stagePartFile(path, 5)
+	if err != nil {
+		t.Fatalf("stage part file: %v", err)
+	}
+	if staged.Hash != "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824" {
+		t.Fatalf("unexpected staged upload: %+v", staged)
+	}
+
+	// 交给异步任务的副本被删除后分片文件仍在，失败时可以重试完成
+	cp, err := staged.Copy()
+	if err != nil || cp.Path == path || cp.Hash != staged.Hash {
+		t.Fatalf("unexpected copy: %+v %v", cp, err)
+	}
+	cp.Remove()
+	if data, err := os.ReadFile(path); err != nil || string(data) != "hello" {
+		t.Fatalf("part file changed after copy removed: %q %v", data, err)
+	}
+}
+
+func TestWriteChunkAtRejectsOverflow(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "id.part")
+	if err := os.WriteFile(path, []byte("ab"), 0o600); err != nil {
+		t.Fatalf("create part file: %v", err)
+	}
+	if _, err := writeChunkAt(path, 2, 4, strings.NewReader("cde")); !errors.Is(err, ErrUploadTooLarge) {
+		t.Fatalf("expected ErrUploadTooLarge, got %v", err)
+	}
+	if data, _ := os.ReadFile(path); string(data) != "ab" {
+		t.Fatalf("overflowing chunk should be rolled back, got %q", data)
+	}
+	if _, err := stagePartFile(path, 4); err == nil {
+		t.Fatal("expected incomplete part file to be rejected")
+	}
+}
@@ -40,6 +40,7 @@ const (
 	GroupLogs           FieldGroup = "logs"
 	GroupStepUp         FieldGroup = "stepup"
 	GroupURLFetch       FieldGroup = "url_fetch"
+	GroupMedia          FieldGroup = "media"
 )
 
 // FieldSchema 描述一个可被 Web 修改的 effective 配置项。
@@ -255,6 +256,7 @@ func buildSchema() []FieldSchema {
 		{Key: "MAX_UPLOAD_MB", Group: GroupUploads, Type: FieldInt, Default: 110, Min: ptrInt(1), Max: ptrInt(102400)},
 		{Key: "MAX_UPLOAD_FILE_MB", Group: GroupUploads, Type: FieldInt, Default: 60, Min: ptrInt(1), Max: ptrInt(102400)},
 		{Key: "MAX_UPLOAD_FILES", Group: GroupUploads, Type: FieldInt, Default: 20, Min: ptrInt(1), Max: ptrInt(1000)},
+		{Key: "UPLOAD_WORKERS", Group: GroupUploads, Type: FieldInt, Default: 2, Min: ptrInt(1), Max: ptrInt(32)},
 
 		// session
 		{Key: "COOKIE_SAMESITE", Group: GroupSession, Type: FieldEnum, Default: "Lax", Options: []string{"Lax", "Strict", "None"}},
@@ -306,6 +308,19 @@ func buildSchema() []FieldSchema {
 			return FieldSchema{Key: "URL_FETCH_MAX_MB", Group: GroupURLFetch, Type: FieldInt, Default: 60, Min: min, Max: max}
 		}(),
 		{Key: "URL_FETCH_ALLOW_PRIVATE", Group: GroupURLFetch, Type: FieldBool, Default: false},
+
+		// 媒体处理
+		{Key: "VARIANT_CACHE_MAX_MB", Group: GroupMedia, Type: FieldInt, Default: 2048, Min: ptrInt(0), Max: ptrInt(1048576)}, // 0 = 不缓存
+		{Key: "AUTO_FORMAT_ENABLED", Group: GroupMedia, Type: FieldBool, Default: false},
+		{Key: "AUTO_FORMAT_AVIF_QUALITY", Group: GroupMedia, Type: FieldInt, Default: 50, Min: ptrInt(1), Max: ptrInt(100)},
+		{Key: "AUTO_FORMAT_AVIF_EFFORT", Group: GroupMedia, Type: FieldInt, Default: 4, Min: ptrInt(0), Max: ptrInt(9)},
+		{Key: "AUTO_FORMAT_WEBP_QUALITY", Group: GroupMedia, Type: FieldInt, Default: 80, Min: ptrInt(1), Max: ptrInt(100)},
+		{Key: "AUTO_FORMAT_WEBP_EFFORT", Group: GroupMedia, Type: FieldInt, Default: 4, Min: ptrInt(0), Max: ptrInt(6)},
+		{Key: "ROUTE_CACHE_MAX_AGE_SEC", Group: GroupMedia, Type: FieldInt, Default: 300, Min: ptrInt(0), Max: ptrInt(31536000)}, // 0 = no-cache
+		{Key: "ROUTE_ALLOWED_CHARS", Group: GroupMedia, Type: FieldString, Default: defaultRouteAllowedChars},
+		{Key: "ROUTE_MAX_DEPTH", Group: GroupMedia, Type: FieldInt, Default: defaultRouteMaxDepth, Min: ptrInt(1), Max: ptrInt(32)},
+		{Key: "THUMBNAIL_WORKERS", Group: GroupMedia, Type: FieldInt, Default: 2, Min: ptrInt(1), Max: ptrInt(32)},
+		{Key: "THUMBNAIL_QUEUE_SIZE", Group: GroupMedia, Type: FieldInt, Default: 64, Min: ptrInt(1), Max: ptrInt(100000)},
 	}
 }
 
@@ -349,7 +364,11 @@ func validateValue(f FieldSchema, raw string) error {
 			}
 		}
 	case FieldString, FieldMultiline:
-		// 任意字符串
+		if f.Key == "ROUTE_ALLOWED_CHARS" {
+			if _, err := routeSegmentPattern(raw); err != nil {
+				return err
+			}
+		}
 	}
 	return nil
 }
@@ -364,6 +383,8 @@ func applyOverride(eff *config.Effective, f FieldSchema, raw string) error {
 		eff.MaxUploadFileBytes = mb * 1024 * 1024
 	case "MAX_UPLOAD_FILES":
 		eff.MaxUploadFiles = model.ParseConfigInt(raw, 20)
+	case "UPLOAD_WORKERS":
+		eff.UploadWorkers = model.ParseConfigInt(raw, 2)
 	case "COOKIE_SAMESITE":
 		eff.CookieSameSite = strings.TrimSpace(raw)
 	case "STRICT_SESSION_IP":
@@ -427,6 +448,29 @@ func applyOverride(eff *config.Effective, f FieldSchema, raw string) error {
 		eff.URLFetchMaxBytes = mb * 1024 * 1024
 	case "URL_FETCH_ALLOW_PRIVATE":
 		eff.URLFetchAllowPrivate = model.ParseConfigBool(raw, false)
+	case "VARIANT_CACHE_MAX_MB":
+		mb := model.ParseConfigInt64(raw, 2048)
+		eff.VariantCacheMaxBytes = mb * 1024 * 1024
+	case "AUTO_FORMAT_ENABLED":
+		eff.AutoFormatEnabled = model.ParseConfigBool(raw, false)
+	case "AUTO_FORMAT_AVIF_QUALITY":
+		eff.AutoFormatAVIFQuality = model.ParseConfigInt(raw, 50)
+	case "AUTO_FORMAT_AVIF_EFFORT":
+		eff.AutoFormatAVIFEffort = model.ParseConfigInt(raw, 4)
+	case "AUTO_FORMAT_WEBP_QUALITY":
+		eff.AutoFormatWebPQuality = model.ParseConfigInt(raw, 80)
+	case "AUTO_FORMAT_WEBP_EFFORT":
+		eff.AutoFormatWebPEffort = model.ParseConfigInt(raw, 4)
+	case "ROUTE_CACHE_MAX_AGE_SEC":
+		eff.RouteCacheMaxAgeSeconds = model.ParseConfigInt(raw, 300)
+	case "ROUTE_ALLOWED_CHARS":
+		eff.RouteAllowedChars = strings.TrimSpace(raw)
+	case "ROUTE_MAX_DEPTH":
+		eff.RouteMaxDepth = model.ParseConfigInt(raw, defaultRouteMaxDepth)
+	case "THUMBNAIL_WORKERS":
+		eff.ThumbnailWorkers = model.ParseConfigInt(raw, 2)
+	case "THUMBNAIL_QUEUE_SIZE":
+		eff.ThumbnailQueueSize = model.ParseConfigInt(raw, 64)
 	default:
 		return fmt.Errorf("unhandled key: %s", f.Key)
 	}
@@ -441,6 +485,8 @@ func extractEffectiveValue(eff *config.Effective, key string) any {
 		return eff.MaxUploadFileBytes / 1024 / 1024
 	case "MAX_UPLOAD_FILES":
 		return eff.MaxUploadFiles
+	case "UPLOAD_WORKERS":
+		return eff.UploadWorkers
 	case "COOKIE_SAMESITE":
 		return eff.CookieSameSite
 	case "STRICT_SESSION_IP":
@@ -503,6 +549,28 @@ func extractEffectiveValue(eff *config.Effective, key string) any {
 		return eff.URLFetchMaxBytes / 1024 / 1024
 	case "URL_FETCH_ALLOW_PRIVATE":
 		return eff.URLFetchAllowPrivate
+	case "VARIANT_CACHE_MAX_MB":
+		return eff.VariantCacheMaxBytes / 1024 / 1024
+	case "AUTO_FORMAT_ENABLED":
+		return eff.AutoFormatEnabled
+	case "AUTO_FORMAT_AVIF_QUALITY":
+		return eff.AutoFormatAVIFQuality
+	case "AUTO_FORMAT_AVIF_EFFORT":
+		return eff.AutoFormatAVIFEffort
+	case "AUTO_FORMAT_WEBP_QUALITY":
+		return eff.AutoFormatWebPQuality
+	case "AUTO_FORMAT_WEBP_EFFORT":
+		return eff.AutoFormatWebPEffort
+	case "ROUTE_CACHE_MAX_AGE_SEC":
+		return eff.RouteCacheMaxAgeSeconds
+	case "ROUTE_ALLOWED_CHARS":
+		return eff.RouteAllowedChars
+	case "ROUTE_MAX_DEPTH":
+		return eff.RouteMaxDepth
+	case "THUMBNAIL_WORKERS":
+		return eff.ThumbnailWorkers
+	case "THUMBNAIL_QUEUE_SIZE":
+		return eff.ThumbnailQueueSize
 	}
 	return nil
 }
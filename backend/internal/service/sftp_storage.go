@@ -0,0 +1,386 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+
+	"github.com/TangTangChu/AnzuImg/backend/internal/config"
+	"github.com/TangTangChu/AnzuImg/backend/internal/logger"
+)
+
+const sftpDialTimeout = 10 * time.Second
+
+// sftpConn 是一条 SFTP 会话及其底层连接
+type sftpConn struct {
+	client *sftp.Client
+	close  func() error
+}
+
+// SFTPStorage SFTP 存储。连接在首次使用时建立，断开后下一次操作自动重连；
+// 对象经由服务端代理分发。
+type SFTPStorage struct {
+	log  *logger.Logger
+	addr string
+	base string
+	dial func(ctx context.Context) (*sftpConn, error)
+
+	mu   sync.Mutex
+	conn *sftpConn
+}
+
+// NewSFTPStorage 创建 SFTP 存储实例
+func NewSFTPStorage(cfg *config.Config, log *logger.Logger) (*SFTPStorage, error) {
+	if cfg.SFTPAddr == "" || cfg.SFTPUsername == "" {
+		return nil, fmt.Errorf("sftp address and username are required")
+	}
+	var auth []ssh.AuthMethod
+	if cfg.SFTPPrivateKeyFile != "" {
+		key, err := os.ReadFile(cfg.SFTPPrivateKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("read sftp private key failed: %w", err)
+		}
+		signer, err := ssh.ParsePrivateKey(key)
+		if err != nil {
+			return nil, fmt.Errorf("parse sftp private key failed: %w", err)
+		}
+		auth = append(auth, ssh.PublicKeys(signer))
+	}
+	if cfg.SFTPPassword != "" {
+		auth = append(auth, ssh.Password(cfg.SFTPPassword))
+	}
+	if len(auth) == 0 {
+		return nil, fmt.Errorf("sftp password or private key is required")
+	}
+
+	var hostKey ssh.HostKeyCallback
+	switch {
+	case cfg.SFTPKnownHostsFile != "":
+		cb, err := knownhosts.New(cfg.SFTPKnownHostsFile)
+		if err != nil {
+			return nil, fmt.Errorf("load sftp known hosts failed: %w", err)
+		}
+		hostKey = cb
+	case cfg.SFTPInsecureIgnoreHostKey:
+		log.Warnf("ANZUIMG_SFTP_INSECURE_IGNORE_HOST_KEY is enabled, sftp host key will not be verified")
+		hostKey = ssh.InsecureIgnoreHostKey()
+	default:
+		return nil, fmt.Errorf("sftp known hosts file is required, or set ANZUIMG_SFTP_INSECURE_IGNORE_HOST_KEY=true to skip host key verification")
+	}
+
+	addr := cfg.SFTPAddr
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		addr = net.JoinHostPort(addr, "22")
+	}
+	sshCfg := &ssh.ClientConfig{
+		User:            cfg.SFTPUsername,
+		Auth:            auth,
+		HostKeyCallback: hostKey,
+		Timeout:         sftpDialTimeout,
+	}
+	dial := func(ctx context.Context) (*sftpConn, error) {
+		var d net.Dialer
+		nc, err := d.DialContext(ctx, "tcp", addr)
+		if err != nil {
+			return nil, err
+		}
+		_ = nc.SetDeadline(time.Now().Add(sftpDialTimeout))
+		c, chans, reqs, err := ssh.NewClientConn(nc, addr, sshCfg)
+		if err != nil {
+			_ = nc.Close()
+			return nil, err
+		}
+		_ = nc.SetDeadline(time.Time{})
+		sshClient := ssh.NewClient(c, chans, reqs)
+		client, err := sftp.NewClient(sshClient)
+		if err != nil {
+			_ = sshClient.Close()
+			return nil, err
+		}
+		return &sftpConn{client: client, close: func() error {
+			_ = client.Close()
+			return sshClient.Close()
+		}}, nil
+	}
+
+	log.Infof("Initializing sftp storage: addr=%s, user=%s, base=%s", addr, cfg.SFTPUsername, cfg.SFTPBasePath)
+	s := newSFTPStorage(addr, cfg.SFTPBasePath, dial, log)
+
+	// 测试连接
+	ctx, cancel := context.WithTimeout(context.Background(), sftpDialTimeout)
+	defer cancel()
+	if err := s.do(ctx, func(c *sftp.Client) error {
+		_, err := c.Getwd()
+		return err
+	}); err != nil {
+		log.Warnf("Failed to connect to sftp server: %v", err)
+	}
+	return s, nil
+}
+
+func newSFTPStorage(addr, base string, dial func(ctx context.Context) (*sftpConn, error), log *logger.Logger) *SFTPStorage {
+	base = strings.TrimSuffix(base, "/")
+	if base == "" {
+		base = "."
+	}
+	return &SFTPStorage{log: log, addr: addr, base: base, dial: dial}
+}
+
+// client 返回当前会话，没有可用会话时重新建立
+func (s *SFTPStorage) client(ctx context.Context) (*sftp.Client, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conn != nil {
+		return s.conn.client, nil
+	}
+	conn, err := s.dial(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("connect to sftp server failed: %w", err)
+	}
+	s.conn = conn
+	return conn.client, nil
+}
+
+// Close 关闭当前会话，之后的操作会重新建立连接
+func (s *SFTPStorage) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conn == nil {
+		return nil
+	}
+	err := s.conn.close()
+	s.conn = nil
+	return err
+}
+
+// drop 在连接断开后丢弃会话，c 已被其他调用替换时不做处理
+func (s *SFTPStorage) drop(c *sftp.Client) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conn != nil && s.conn.client == c {
+		_ = s.conn.close()
+		s.conn = nil
+	}
+}
+
+// do 在会话上执行操作，连接已断开时重连并重试一次。
+// 会消费输入流的操作不能重试，应使用 doOnce。
+func (s *SFTPStorage) do(ctx context.Context, fn func(c *sftp.Client) error) error {
+	err := s.doOnce(ctx, fn)
+	if isSFTPConnLost(err) {
+		err = s.doOnce(ctx, fn)
+	}
+	return err
+}
+
+// doOnce 在会话上执行一次操作，连接已断开时丢弃会话
+func (s *SFTPStorage) doOnce(ctx context.Context, fn func(c *sftp.Client) error) error {
+	c, err := s.client(ctx)
+	if err != nil {
+		return err
+	}
+	err = fn(c)
+	if isSFTPConnLost(err) {
+		s.drop(c)
+	}
+	return err
+}
+
+func isSFTPConnLost(err error) bool {
+	return err != nil && (errors.Is(err, sftp.ErrSSHFxConnectionLost) || errors.Is(err, io.EOF) ||
+		errors.Is(err, net.ErrClosed))
+}
+
+func (s *SFTPStorage) remotePath(relPath string) string {
+	return path.Join(s.base, relPath)
+}
+
+// Save 先写入同目录下的临时文件再重命名，避免读到写了一半的文件
+func (s *SFTPStorage) Save(ctx context.Context, hash string, r io.Reader, size int64, mimeType string) (string, int64, error) {
+	relPath := path.Join(hash[:2], hash)
+	target := s.remotePath(relPath)
+	tmpPath := path.Join(path.Dir(target), fmt.Sprintf(".tmp-%s-%d", hash, time.Now().UnixNano()))
+
+	var written int64
+	err := s.doOnce(ctx, func(c *sftp.Client) error {
+		if err := c.MkdirAll(path.Dir(target)); err != nil {
+			return fmt.Errorf("mkdir failed: %w", err)
+		}
+		f, err := c.Create(tmpPath)
+		if err != nil {
+			return fmt.Errorf("create temp file failed: %w", err)
+		}
+		written, err = io.Copy(f, r)
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		if err == nil && size >= 0 && written != size {
+			err = fmt.Errorf("short write: expected %d bytes, got %d", size, written)
+		}
+		if err == nil {
+			err = c.PosixRename(tmpPath, target)
+			if err != nil {
+				// 服务端不支持 posix-rename 扩展时退回普通重命名，目标已存在需先删除
+				_ = c.Remove(target)
+				err = c.Rename(tmpPath, target)
+			}
+		}
+		if err != nil {
+			_ = c.Remove(tmpPath)
+		}
+		return err
+	})
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to upload to sftp storage: %w", err)
+	}
+	return relPath, written, nil
+}
+
+// GetAbsPath 返回对象的 sftp 地址，仅用于展示
+func (s *SFTPStorage) GetAbsPath(ctx context.Context, relPath string) (string, error) {
+	return fmt.Sprintf("sftp://%s/%s", s.addr, strings.TrimPrefix(s.remotePath(relPath), "/")), nil
+}
+
+// Open 打开远端文件，返回的文件支持随机读取
+func (s *SFTPStorage) Open(ctx context.Context, relPath string) (io.ReadSeekCloser, error) {
+	var f *sftp.File
+	err := s.do(ctx, func(c *sftp.Client) error {
+		var err error
+		f, err = c.Open(s.remotePath(relPath))
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("open file failed: %w", err)
+	}
+	return f, nil
+}
+
+// DeliveryMode SFTP 不能直接对外提供访问，只能由服务端代理
+func (s *SFTPStorage) DeliveryMode() string {
+	return DeliveryProxy
+}
+
+// PresignGet SFTP 存储不支持预签名
+func (s *SFTPStorage) PresignGet(ctx context.Context, relPath string) (string, time.Duration, error) {
+	return "", 0, errPresignUnsupported
+}
+
+// OpenRange 按 Range 头读取远端文件的一段
+func (s *SFTPStorage) OpenRange(ctx context.Context, relPath string, rangeHeader string) (*ObjectStream, error) {
+	f, err := s.Open(ctx, relPath)
+	if err != nil {
+		return nil, err
+	}
+	size, err := f.Seek(0, io.SeekEnd)
+	if err != nil {
+		_ = f.Close()
+		return nil, fmt.Errorf("stat file failed: %w", err)
+	}
+
+	start, length, contentRange := int64(0), size, ""
+	if rangeHeader != "" {
+		if start, length, err = parseByteRange(rangeHeader, size); err != nil {
+			_ = f.Close()
+			return nil, err
+		}
+		contentRange = fmt.Sprintf("bytes %d-%d/%d", start, start+length-1, size)
+	}
+	if _, err := f.Seek(start, io.SeekStart); err != nil {
+		_ = f.Close()
+		return nil, fmt.Errorf("seek file failed: %w", err)
+	}
+	return &ObjectStream{
+		Body: struct {
+			io.Reader
+			io.Closer
+		}{io.LimitReader(f, length), f},
+		ContentLength: length,
+		ContentRange:  contentRange,
+	}, nil
+}
+
+// Delete 删除远端文件，文件不存在视为删除成功
+func (s *SFTPStorage) Delete(ctx context.Context, relPath string) error {
+	err := s.do(ctx, func(c *sftp.Client) error {
+		return c.Remove(s.remotePath(relPath))
+	})
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("delete file failed: %w", err)
+	}
+	return nil
+}
+
+// Exists 检查远端文件是否存在
+func (s *SFTPStorage) Exists(ctx context.Context, relPath string) (bool, error) {
+	err := s.do(ctx, func(c *sftp.Client) error {
+		_, err := c.Stat(s.remotePath(relPath))
+		return err
+	})
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return false, nil
+		}
+		return false, fmt.Errorf("check file exists failed: %w", err)
+	}
+	return true, nil
+}
+
+// List 按路径字典序递归遍历 startAfter 之后的文件
+func (s *SFTPStorage) List(ctx context.Context, startAfter string, fn func(StorageObject) error) error {
+	var walk func(relDir string) error
+	walk = func(relDir string) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		var infos []os.FileInfo
+		err := s.do(ctx, func(c *sftp.Client) error {
+			var err error
+			infos, err = c.ReadDir(s.remotePath(relDir))
+			return err
+		})
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				return nil
+			}
+			return fmt.Errorf("list sftp directory failed: %w", err)
+		}
+		sort.Slice(infos, func(i, j int) bool { return infos[i].Name() < infos[j].Name() })
+		for _, info := range infos {
+			relPath := path.Join(relDir, info.Name())
+			if info.IsDir() {
+				if listSkipsDir(relPath, startAfter) {
+					continue
+				}
+				if err := walk(relPath); err != nil {
+					return err
+				}
+				continue
+			}
+			if relPath <= startAfter || !info.Mode().IsRegular() {
+				continue
+			}
+			if err := fn(StorageObject{Path: relPath, Size: info.Size(), ModTime: info.ModTime()}); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return walk("")
+}
+
+// Type 返回存储类型
+func (s *SFTPStorage) Type() string {
+	return string(StorageTypeSFTP)
+}
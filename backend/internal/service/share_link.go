@@ -0,0 +1,468 @@
+package service
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+
+	"github.com/TangTangChu/AnzuImg/backend/internal/model"
+)
+
+var (
+	ErrShareNotFound         = errors.New("share link not found")
+	ErrShareImageNotFound    = errors.New("shared image not found")
+	ErrInvalidShare          = errors.New("invalid share link")
+	ErrShareRevoked          = errors.New("share link revoked")
+	ErrShareExpired          = errors.New("share link expired")
+	ErrShareExhausted        = errors.New("share link view limit reached")
+	ErrSharePasswordRequired = errors.New("share link password required")
+	ErrSharePasswordInvalid  = errors.New("share link password invalid")
+	ErrShareLocked           = errors.New("too many share password attempts")
+)
+
+// 访问日志中的结果
+const (
+	ShareAccessOK               = "ok"
+	ShareAccessRevoked          = "revoked"
+	ShareAccessExpired          = "expired"
+	ShareAccessExhausted        = "exhausted"
+	ShareAccessPasswordRequired = "password_required"
+	ShareAccessPasswordInvalid  = "password_invalid"
+	ShareAccessLocked           = "locked"
+)
+
+const (
+	maxShareNoteLength = 255
+	// bcrypt 只使用前 72 字节
+	maxSharePasswordLength = 72
+	// 验证通过的密码在内存中缓存的时长，期间同一密码的访问不再重复计算 bcrypt
+	sharePasswordCacheTTL = 10 * time.Minute
+)
+
+const shareLinkColumns = `share_links.*,
+COALESCE((SELECT i.hash FROM images i WHERE i.id = share_links.image_id), '') AS image_hash,
+COALESCE((SELECT i.size FROM images i WHERE i.id = share_links.image_id), 0) AS image_size,
+COALESCE((SELECT i.mime_type FROM images i WHERE i.id = share_links.image_id), '') AS image_mime_type`
+
+// sharePasswordEntry 是验证通过的分享密码摘要
+type sharePasswordEntry struct {
+	digest    [sha256.Size]byte
+	expiresAt time.Time
+}
+
+// ShareLinkInput 是创建或修改分享链接的字段，nil 表示不修改。
+// 分享目标只能在创建时指定；Password 为空字符串表示取消密码，ExpiresAt 为零值表示永不过期。
+type ShareLinkInput struct {
+	ImageHash *string
+	AlbumID   *uint64
+	Note      *string
+	Password  *string
+	ExpiresAt *time.Time
+	MaxViews  *int64
+}
+
+// ShareLinkFilter 按分享目标筛选，零值表示不限
+type ShareLinkFilter struct {
+	ImageHash string
+	AlbumID   uint64
+}
+
+// ShareAccessResult 把访问错误转换为访问日志中的结果
+func ShareAccessResult(err error) string {
+	switch {
+	case err == nil:
+		return ShareAccessOK
+	case errors.Is(err, ErrShareRevoked):
+		return ShareAccessRevoked
+	case errors.Is(err, ErrShareExpired):
+		return ShareAccessExpired
+	case errors.Is(err, ErrShareExhausted):
+		return ShareAccessExhausted
+	case errors.Is(err, ErrSharePasswordRequired):
+		return ShareAccessPasswordRequired
+	case errors.Is(err, ErrSharePasswordInvalid):
+		return ShareAccessPasswordInvalid
+	case errors.Is(err, ErrShareLocked):
+		return ShareAccessLocked
+	default:
+		return ""
+	}
+}
+
+func (s *ImageService) shareLinkQuery() *gorm.DB {
+	return s.db.Model(&model.ShareLink{}).Select(shareLinkColumns)
+}
+
+func (s *ImageService) shareLinkListQuery(filter ShareLinkFilter) *gorm.DB {
+	query := s.shareLinkQuery()
+	if filter.ImageHash != "" {
+		query = query.Where("image_id = (SELECT id FROM images WHERE hash = ?)", filter.ImageHash)
+	}
+	if filter.AlbumID != 0 {
+		query = query.Where("album_id = ?", filter.AlbumID)
+	}
+	return query
+}
+
+func fillShareLinks(links []model.ShareLink) {
+	for i := range links {
+		links[i].HasPassword = links[i].PasswordHash != ""
+	}
+}
+
+// applyShareLinkInput 校验并写入可修改的字段
+func applyShareLinkInput(link *model.ShareLink, in ShareLinkInput, now time.Time) error {
+	if in.Note != nil {
+		note := strings.TrimSpace(*in.Note)
+		if utf8.RuneCountInString(note) > maxShareNoteLength {
+			return fmt.Errorf("%w: note must be at most %d characters", ErrInvalidShare, maxShareNoteLength)
+		}
+		link.Note = note
+	}
+	if in.Password != nil {
+		if *in.Password == "" {
+			link.PasswordHash = ""
+		} else {
+			if len(*in.Password) > maxSharePasswordLength {
+				return fmt.Errorf("%w: password must be at most %d bytes", ErrInvalidShare, maxSharePasswordLength)
+			}
+			hashed, err := bcrypt.GenerateFromPassword([]byte(*in.Password), bcrypt.DefaultCost)
+			if err != nil {
+				return fmt.Errorf("hash share password failed: %w", err)
+			}
+			link.PasswordHash = string(hashed)
+		}
+	}
+	if in.ExpiresAt != nil {
+		if in.ExpiresAt.IsZero() {
+			link.ExpiresAt = nil
+		} else {
+			if !in.ExpiresAt.After(now) {
+				return fmt.Errorf("%w: expires_at must be in the future", ErrInvalidShare)
+			}
+			expiresAt := in.ExpiresAt.UTC()
+			link.ExpiresAt = &expiresAt
+		}
+	}
+	if in.MaxViews != nil {
+		if *in.MaxViews < 0 {
+			return fmt.Errorf("%w: max_views must not be negative", ErrInvalidShare)
+		}
+		link.MaxViews = *in.MaxViews
+	}
+	return nil
+}
+
+// ListShareLinks 按创建时间倒序分页获取分享链接
+func (s *ImageService) ListShareLinks(filter ShareLinkFilter, page, pageSize int) ([]model.ShareLink, int64, error) {
+	query := s.shareLinkListQuery(filter)
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	var links []model.ShareLink
+	if err := query.Order("created_at DESC").Order("id DESC").
+		Limit(pageSize).Offset((page - 1) * pageSize).Find(&links).Error; err != nil {
+		return nil, 0, err
+	}
+	fillShareLinks(links)
+	return links, total, nil
+}
+
+// ListShareLinksByCursor 按游标获取分享链接，不统计总数
+func (s *ImageService) ListShareLinksByCursor(filter ShareLinkFilter, cursor *Cursor, limit int) (*CursorPage[model.ShareLink], error) {
+	result, err := findCursorPage(s.shareLinkListQuery(filter), cursor, limit, func(l *model.ShareLink) Cursor {
+		return Cursor{CreatedAt: l.CreatedAt, ID: l.ID}
+	})
+	if err != nil {
+		return nil, err
+	}
+	fillShareLinks(result.Data)
+	return result, nil
+}
+
+// GetShareLink 返回单个分享链接，不存在时返回 ErrShareNotFound
+func (s *ImageService) GetShareLink(id uint64) (*model.ShareLink, error) {
+	var link model.ShareLink
+	if err := s.shareLinkQuery().Where("id = ?", id).First(&link).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrShareNotFound
+		}
+		return nil, err
+	}
+	link.HasPassword = link.PasswordHash != ""
+	return &link, nil
+}
+
+// CreateShareLink 为一张图片或一个相册创建分享链接
+func (s *ImageService) CreateShareLink(in ShareLinkInput) (*model.ShareLink, error) {
+	hasImage := in.ImageHash != nil && strings.TrimSpace(*in.ImageHash) != ""
+	hasAlbum := in.AlbumID != nil && *in.AlbumID != 0
+	if hasImage == hasAlbum {
+		return nil, fmt.Errorf("%w: exactly one of image_hash or album_id is required", ErrInvalidShare)
+	}
+
+	var link model.ShareLink
+	if hasImage {
+		var img model.Image
+		if err := s.db.Select("id").Where("hash = ?", strings.TrimSpace(*in.ImageHash)).First(&img).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil, fmt.Errorf("%w: %s", ErrShareImageNotFound, strings.TrimSpace(*in.ImageHash))
+			}
+			return nil, err
+		}
+		link.ImageID = &img.ID
+	} else {
+		if err := s.db.Select("id").Where("id = ?", *in.AlbumID).First(&model.Album{}).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil, ErrAlbumNotFound
+			}
+			return nil, err
+		}
+		link.AlbumID = in.AlbumID
+	}
+	if err := applyShareLinkInput(&link, in, time.Now()); err != nil {
+		return nil, err
+	}
+
+	token, err := model.GenerateShareToken()
+	if err != nil {
+		return nil, fmt.Errorf("generate share token failed: %w", err)
+	}
+	link.Token = token
+	if err := s.db.Create(&link).Error; err != nil {
+		return nil, fmt.Errorf("create share link failed: %w", err)
+	}
+	return s.GetShareLink(link.ID)
+}
+
+// UpdateShareLink 修改备注、密码、有效期或次数上限，分享目标不可修改
+func (s *ImageService) UpdateShareLink(id uint64, in ShareLinkInput) (*model.ShareLink, error) {
+	if in.ImageHash != nil || in.AlbumID != nil {
+		return nil, fmt.Errorf("%w: share target cannot be changed", ErrInvalidShare)
+	}
+	var link model.ShareLink
+	if err := s.db.Where("id = ?", id).First(&link).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrShareNotFound
+		}
+		return nil, err
+	}
+	if err := applyShareLinkInput(&link, in, time.Now()); err != nil {
+		return nil, err
+	}
+	if err := s.db.Model(&link).Select("Note", "PasswordHash", "ExpiresAt", "MaxViews", "UpdatedAt").Updates(&link).Error; err != nil {
+		return nil, fmt.Errorf("update share link failed: %w", err)
+	}
+	return s.GetShareLink(id)
+}
+
+// RevokeShareLink 撤销分享链接，已撤销的链接保持原撤销时间
+func (s *ImageService) RevokeShareLink(id uint64) (*model.ShareLink, error) {
+	result := s.db.Model(&model.ShareLink{}).Where("id = ? AND revoked_at IS NULL", id).
+		Updates(map[string]any{"revoked_at": time.Now(), "updated_at": time.Now()})
+	if result.Error != nil {
+		return nil, fmt.Errorf("revoke share link failed: %w", result.Error)
+	}
+	return s.GetShareLink(id)
+}
+
+// DeleteShareLink 删除分享链接及其访问日志
+func (s *ImageService) DeleteShareLink(id uint64) error {
+	result := s.db.Where("id = ?", id).Delete(&model.ShareLink{})
+	if result.Error != nil {
+		return fmt.Errorf("delete share link failed: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrShareNotFound
+	}
+	return nil
+}
+
+// ListShareAccesses 按时间倒序分页获取分享链接的访问日志
+func (s *ImageService) ListShareAccesses(id uint64, page, pageSize int) ([]model.ShareLinkAccess, int64, error) {
+	if _, err := s.GetShareLink(id); err != nil {
+		return nil, 0, err
+	}
+	query := s.db.Model(&model.ShareLinkAccess{}).Where("share_link_id = ?", id)
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	var accesses []model.ShareLinkAccess
+	if err := query.Order("created_at DESC").Order("id DESC").
+		Limit(pageSize).Offset((page - 1) * pageSize).Find(&accesses).Error; err != nil {
+		return nil, 0, err
+	}
+	return accesses, total, nil
+}
+
+// ListShareAccessesByCursor 按游标获取分享链接的访问日志
+func (s *ImageService) ListShareAccessesByCursor(id uint64, cursor *Cursor, limit int) (*CursorPage[model.ShareLinkAccess], error) {
+	if _, err := s.GetShareLink(id); err != nil {
+		return nil, err
+	}
+	query := s.db.Model(&model.ShareLinkAccess{}).Where("share_link_id = ?", id)
+	return findCursorPage(query, cursor, limit, func(a *model.ShareLinkAccess) Cursor {
+		return Cursor{CreatedAt: a.CreatedAt, ID: a.ID}
+	})
+}
+
+// RecordShareAccess 写入一条访问日志，失败不影响访问本身
+func (s *ImageService) RecordShareAccess(access *model.ShareLinkAccess) {
+	if err := s.db.Create(access).Error; err != nil {
+		s.log.Warnf("record share access failed: %v", err)
+	}
+}
+
+// checkShareLink 检查链接是否仍可访问以及密码是否正确。
+// 次数用完后链接下的所有资源都不可访问，包括不计次数的相册图片、缩略图与分段请求
+func checkShareLink(link *model.ShareLink, password string, now time.Time) error {
+	if link.RevokedAt != nil {
+		return ErrShareRevoked
+	}
+	if link.ExpiresAt != nil && !link.ExpiresAt.After(now) {
+		return ErrShareExpired
+	}
+	if link.MaxViews > 0 && link.ViewCount >= link.MaxViews {
+		return ErrShareExhausted
+	}
+	if link.PasswordHash != "" {
+		if password == "" {
+			return ErrSharePasswordRequired
+		}
+		if bcrypt.CompareHashAndPassword([]byte(link.PasswordHash), []byte(password)) != nil {
+			return ErrSharePasswordInvalid
+		}
+	}
+	return nil
+}
+
+// OpenShareLink 按令牌查找分享链接，并校验是否仍可访问以及密码是否正确，不占用访问次数，
+// 次数已用完时返回 ErrShareExhausted。
+// 密码错误按 clientIP 计入与登录相同的失败次数，超过上限时返回 ErrShareLocked；
+// 验证通过的密码短时间内缓存，相册中的大量图片请求不会逐个计算 bcrypt。
+// 链接存在但不可访问时同时返回链接与对应错误，便于调用方记录访问日志。
+func (s *ImageService) OpenShareLink(token, password, clientIP string) (*model.ShareLink, error) {
+	var link model.ShareLink
+	if err := s.shareLinkQuery().Where("token = ?", token).First(&link).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrShareNotFound
+		}
+		return nil, err
+	}
+	link.HasPassword = link.PasswordHash != ""
+	now := time.Now()
+	// 先不带密码检查链接状态，需要密码时再单独校验
+	err := checkShareLink(&link, "", now)
+	if !errors.Is(err, ErrSharePasswordRequired) || password == "" {
+		return &link, err
+	}
+	if s.sharePasswordCached(&link, password, now) {
+		return &link, nil
+	}
+
+	subject := fmt.Sprintf("share:%d", link.ID)
+	eff := s.cfg.Effective()
+	locked, _, err := model.IsLoginSubjectLocked(s.db, clientIP, subject, eff.LoginMaxAttempts, eff.LoginLockoutMinutes)
+	if err != nil {
+		return &link, err
+	}
+	if locked {
+		return &link, ErrShareLocked
+	}
+	if err := checkShareLink(&link, password, now); err != nil {
+		if errors.Is(err, ErrSharePasswordInvalid) {
+			if recErr := model.RecordLoginAttempt(s.db, clientIP, subject, false); recErr != nil {
+				s.log.Warnf("record share password attempt failed: %v", recErr)
+			}
+		}
+		return &link, err
+	}
+	s.rememberSharePassword(&link, password, now)
+	return &link, nil
+}
+
+// sharePasswordKey 以链接与密码哈希为键，修改密码后旧缓存自然失效
+func sharePasswordKey(link *model.ShareLink) string {
+	return fmt.Sprintf("%d:%s", link.ID, link.PasswordHash)
+}
+
+func (s *ImageService) sharePasswordCached(link *model.ShareLink, password string, now time.Time) bool {
+	v, ok := s.sharePasswords.Load(sharePasswordKey(link))
+	if !ok {
+		return false
+	}
+	entry := v.(sharePasswordEntry)
+	if !now.Before(entry.expiresAt) {
+		s.sharePasswords.Delete(sharePasswordKey(link))
+		return false
+	}
+	digest := sha256.Sum256([]byte(password))
+	return subtle.ConstantTimeCompare(digest[:], entry.digest[:]) == 1
+}
+
+func (s *ImageService) rememberSharePassword(link *model.ShareLink, password string, now time.Time) {
+	s.sharePasswords.Store(sharePasswordKey(link), sharePasswordEntry{
+		digest:    sha256.Sum256([]byte(password)),
+		expiresAt: now.Add(sharePasswordCacheTTL),
+	})
+}
+
+// CountShareView 原子地占用一次访问次数，并发访问不会超出 MaxViews
+func (s *ImageService) CountShareView(link *model.ShareLink) error {
+	now := time.Now()
+	result := s.db.Model(&model.ShareLink{}).
+		Where("id = ? AND revoked_at IS NULL AND (expires_at IS NULL OR expires_at > ?)", link.ID, now).
+		Where("max_views = 0 OR view_count < max_views").
+		UpdateColumn("view_count", gorm.Expr("view_count + 1"))
+	if result.Error != nil {
+		return fmt.Errorf("count share view failed: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		// 打开之后链接可能刚被撤销或删除，或者次数刚被并发访问用完
+		var current model.ShareLink
+		if err := s.db.Where("id = ?", link.ID).First(&current).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrShareNotFound
+			}
+			return err
+		}
+		current.PasswordHash = ""
+		if err := checkShareLink(&current, "", now); err != nil {
+			return err
+		}
+		return ErrShareExhausted
+	}
+	link.ViewCount++
+	return nil
+}
+
+// SharedImageHash 返回分享链接下可访问的图片哈希：图片分享只能访问其本身，
+// 相册分享要求图片属于该相册，否则返回 ErrShareNotFound
+func (s *ImageService) SharedImageHash(link *model.ShareLink, hash string) (string, error) {
+	if link.AlbumID == nil {
+		if hash != "" && hash != link.ImageHash {
+			return "", ErrShareNotFound
+		}
+		return link.ImageHash, nil
+	}
+	var count int64
+	if err := s.db.Model(&model.AlbumImage{}).
+		Joins("JOIN images ON images.id = album_images.image_id").
+		Where("album_images.album_id = ? AND images.hash = ?", *link.AlbumID, hash).
+		Count(&count).Error; err != nil {
+		return "", err
+	}
+	if count == 0 {
+		return "", ErrShareNotFound
+	}
+	return hash, nil
+}
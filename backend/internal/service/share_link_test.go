@@ -0,0 +1,115 @@
+package service
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/TangTangChu/AnzuImg/backend/internal/model"
+)
+
+func TestApplyShareLinkInput(t *testing.T) {
+	now := time.Date(2026, 7, 1, 0, 0, 0, 0, time.UTC)
+	note, password := "  给朋友 ", "secret"
+	expiresAt := now.Add(24 * time.Hour)
+	maxViews := int64(10)
+
+	var link model.ShareLink
+	in := ShareLinkInput{Note: &note, Password: &password, ExpiresAt: &expiresAt, MaxViews: &maxViews}
+	if err := applyShareLinkInput(&link, in, now); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if link.Note != "给朋友" || link.PasswordHash == "" || link.PasswordHash == password ||
+		link.ExpiresAt == nil || !link.ExpiresAt.Equal(expiresAt) || link.MaxViews != 10 {
+		t.Fatalf("unexpected link: %+v", link)
+	}
+	if err := checkShareLink(&link, password, now); err != nil {
+		t.Fatalf("password should match: %v", err)
+	}
+
+	// 空字符串取消密码，零值时间取消过期
+	empty, never := "", time.Time{}
+	if err := applyShareLinkInput(&link, ShareLinkInput{Password: &empty, ExpiresAt: &never}, now); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if link.PasswordHash != "" || link.ExpiresAt != nil || link.Note != "给朋友" {
+		t.Fatalf("unexpected link after reset: %+v", link)
+	}
+
+	past := now.Add(-time.Second)
+	negative := int64(-1)
+	long := strings.Repeat("a", maxSharePasswordLength+1)
+	for _, bad := range []ShareLinkInput{{ExpiresAt: &past}, {MaxViews: &negative}, {Password: &long}} {
+		if err := applyShareLinkInput(&link, bad, now); !errors.Is(err, ErrInvalidShare) {
+			t.Fatalf("expected ErrInvalidShare for %+v, got %v", bad, err)
+		}
+	}
+}
+
+func TestCheckShareLink(t *testing.T) {
+	now := time.Date(2026, 7, 1, 0, 0, 0, 0, time.UTC)
+	password := "secret"
+	var link model.ShareLink
+	if err := applyShareLinkInput(&link, ShareLinkInput{Password: &password}, now); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	cases := []struct {
+		password string
+		mutate   func(*model.ShareLink)
+		want     error
+	}{
+		{password: "secret"},
+		{password: "", want: ErrSharePasswordRequired},
+		{password: "wrong", want: ErrSharePasswordInvalid},
+		{password: "secret", mutate: func(l *model.ShareLink) { at := now; l.ExpiresAt = &at }, want: ErrShareExpired},
+		{password: "secret", mutate: func(l *model.ShareLink) { at := now; l.RevokedAt = &at }, want: ErrShareRevoked},
+		{password: "secret", mutate: func(l *model.ShareLink) { l.MaxViews, l.ViewCount = 3, 2 }},
+		{password: "secret", mutate: func(l *model.ShareLink) { l.MaxViews, l.ViewCount = 3, 3 }, want: ErrShareExhausted},
+	}
+	for i, tc := range cases {
+		l := link
+		if tc.mutate != nil {
+			tc.mutate(&l)
+		}
+		err := checkShareLink(&l, tc.password, now)
+		if !errors.Is(err, tc.want) || (tc.want == nil && err != nil) {
+			t.Fatalf("case %d: expected %v, got %v", i, tc.want, err)
+		}
+		if got := ShareAccessResult(err); got == "" {
+			t.Fatalf("case %d: missing access result for %v", i, err)
+		}
+	}
+}
+
+// 不计次数的访问（相册内图片、缩略图、分段请求）同样经过 OpenShareLink 的检查，
+// 次数用完后不能再取到内容
+func TestExhaustedShareRejectsUncountedAccess(t *testing.T) {
+	now := time.Date(2026, 7, 1, 0, 0, 0, 0, time.UTC)
+	albumID := uint64(1)
+	link := model.ShareLink{AlbumID: &albumID, MaxViews: 1, ViewCount: 1}
+	if err := checkShareLink(&link, "", now); !errors.Is(err, ErrShareExhausted) {
+		t.Fatalf("expected exhausted album share to be rejected, got %v", err)
+	}
+}
+
+func TestSharePasswordCache(t *testing.T) {
+	now := time.Date(2026, 7, 1, 0, 0, 0, 0, time.UTC)
+	s := &ImageService{}
+	link := &model.ShareLink{ID: 1, PasswordHash: "hash-a"}
+	if s.sharePasswordCached(link, "secret", now) {
+		t.Fatal("password should not be cached before verification")
+	}
+	s.rememberSharePassword(link, "secret", now)
+	if !s.sharePasswordCached(link, "secret", now) || s.sharePasswordCached(link, "wrong", now) {
+		t.Fatal("cache should match only the verified password")
+	}
+	// 修改密码或过期后需要重新校验
+	if s.sharePasswordCached(&model.ShareLink{ID: 1, PasswordHash: "hash-b"}, "secret", now) {
+		t.Fatal("cache should not survive a password change")
+	}
+	if s.sharePasswordCached(link, "secret", now.Add(sharePasswordCacheTTL)) {
+		t.Fatal("cache entry should expire")
+	}
+}
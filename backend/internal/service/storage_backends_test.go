@@ -0,0 +1,269 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/net/webdav"
+
+	"github.com/TangTangChu/AnzuImg/backend/internal/config"
+	"github.com/TangTangChu/AnzuImg/backend/internal/logger"
+)
+
+// exerciseStorage 对存储做一轮写入、读取、范围读取与删除
+func exerciseStorage(t *testing.T, st RemoteStorage) string {
+	t.Helper()
+	ctx := context.Background()
+
+	// 长度未知且不可 Seek 的输入
+	path, written, err := st.Save(ctx, "abcdef", io.MultiReader(strings.NewReader("hello storage")), -1, "text/plain")
+	if err != nil || written != 13 || path != "ab/abcdef" {
+		t.Fatalf("unexpected save result: %q %d %v", path, written, err)
+	}
+	if ok, err := st.Exists(ctx, path); err != nil || !ok {
+		t.Fatalf("expected object to exist: %v", err)
+	}
+
+	f, err := st.Open(ctx, path)
+	if err != nil {
+		t.Fatalf("open failed: %v", err)
+	}
+	if _, err := f.Seek(6, io.SeekStart); err != nil {
+		t.Fatalf("seek failed: %v", err)
+	}
+	rest, _ := io.ReadAll(f)
+	_ = f.Close()
+	if string(rest) != "storage" {
+		t.Fatalf("unexpected content after seek: %q", rest)
+	}
+
+	stream, err := st.OpenRange(ctx, path, "bytes=0-4")
+	if err != nil {
+		t.Fatalf("open range failed: %v", err)
+	}
+	part, _ := io.ReadAll(stream.Body)
+	_ = stream.Body.Close()
+	if string(part) != "hello" || stream.ContentRange != "bytes 0-4/13" {
+		t.Fatalf("unexpected range result: %q %q", part, stream.ContentRange)
+	}
+	if _, err := st.OpenRange(ctx, path, "bytes=100-"); !errors.Is(err, ErrInvalidRange) {
+		t.Fatalf("expected invalid range, got %v", err)
+	}
+
+	if err := st.Delete(ctx, path); err != nil {
+		t.Fatalf("delete failed: %v", err)
+	}
+	if ok, err := st.Exists(ctx, path); err != nil || ok {
+		t.Fatalf("expected object to be deleted: %v", err)
+	}
+	if err := st.Delete(ctx, path); err != nil {
+		t.Fatalf("deleting a missing object should succeed: %v", err)
+	}
+	return path
+}
+
+// listPaths 返回 startAfter 之后的全部对象路径
+func listPaths(t *testing.T, st ListableStorage, startAfter string) string {
+	t.Helper()
+	var paths []string
+	if err := st.List(context.Background(), startAfter, func(obj StorageObject) error {
+		paths = append(paths, obj.Path)
+		return nil
+	}); err != nil {
+		t.Fatalf("list failed: %v", err)
+	}
+	return strings.Join(paths, ",")
+}
+
+func saveNames(t *testing.T, st Storage, names ...string) {
+	t.Helper()
+	for _, name := range names {
+		if _, _, err := st.Save(context.Background(), name, strings.NewReader(name), int64(len(name)), "text/plain"); err != nil {
+			t.Fatalf("save %s failed: %v", name, err)
+		}
+	}
+}
+
+// memObjectServer 是只支持 PUT/GET/HEAD/DELETE 的内存对象服务，要求 Bearer 认证
+type memObjectServer struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+	headers map[string]http.Header
+}
+
+func (m *memObjectServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Authorization") != "Bearer secret" || r.URL.Query().Get("sig") != "x" {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	switch r.Method {
+	case http.MethodPut:
+		data, _ := io.ReadAll(r.Body)
+		if r.ContentLength != int64(len(data)) {
+			w.WriteHeader(http.StatusLengthRequired)
+			return
+		}
+		m.objects[r.URL.Path] = data
+		m.headers[r.URL.Path] = r.Header.Clone()
+		w.WriteHeader(http.StatusCreated)
+	case http.MethodGet, http.MethodHead:
+		data, ok := m.objects[r.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(data))
+	case http.MethodDelete:
+		if _, ok := m.objects[r.URL.Path]; !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		delete(m.objects, r.URL.Path)
+		w.WriteHeader(http.StatusAccepted)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func TestHTTPStorageAgainstFakeServer(t *testing.T) {
+	fake := &memObjectServer{objects: map[string][]byte{}, headers: map[string]http.Header{}}
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+
+	st, err := NewHTTPStorage(&config.Config{
+		HTTPStorageURL:        srv.URL + "/container/?sig=x",
+		HTTPStorageToken:      "secret",
+		HTTPStoragePutHeaders: []string{"x-ms-blob-type: BlockBlob"},
+	}, logger.Register("storage-test"))
+	if err != nil {
+		t.Fatalf("create http storage: %v", err)
+	}
+	if st.DeliveryMode() != DeliveryProxy {
+		t.Fatalf("expected proxy delivery without public url, got %s", st.DeliveryMode())
+	}
+
+	saveNames(t, st, "ff00")
+	if h := fake.headers["/container/ff/ff00"]; h.Get("X-Ms-Blob-Type") != "BlockBlob" || h.Get("Content-Type") != "text/plain" {
+		t.Fatalf("unexpected upload headers: %v", h)
+	}
+	exerciseStorage(t, st)
+
+	if _, err := NewHTTPStorage(&config.Config{HTTPStorageURL: "ftp://example.com"}, logger.Register("storage-test")); err == nil {
+		t.Fatal("expected unsupported url scheme to be rejected")
+	}
+}
+
+func TestWebDAVStorageAgainstFakeServer(t *testing.T) {
+	handler := &webdav.Handler{FileSystem: webdav.NewMemFS(), LockSystem: webdav.NewMemLS()}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, pass, ok := r.BasicAuth(); !ok || user != "anzu" || pass != "pw" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+
+	st, err := NewWebDAVStorage(&config.Config{
+		WebDAVURL:      srv.URL + "/dav/images",
+		WebDAVUsername: "anzu",
+		WebDAVPassword: "pw",
+	}, logger.Register("storage-test"))
+	if err != nil {
+		t.Fatalf("create webdav storage: %v", err)
+	}
+	exerciseStorage(t, st)
+
+	saveNames(t, st, "bb01", "aa01", "aa02", "cc01")
+	if got := listPaths(t, st, ""); got != "aa/aa01,aa/aa02,bb/bb01,cc/cc01" {
+		t.Fatalf("unexpected listing: %s", got)
+	}
+	if got := listPaths(t, st, "aa/aa02"); got != "bb/bb01,cc/cc01" {
+		t.Fatalf("unexpected listing after key: %s", got)
+	}
+}
+
+// pipeSFTPDialer 通过内存管道连接进程内的 SFTP 服务端
+func pipeSFTPDialer() (func(ctx context.Context) (*sftpConn, error), *int) {
+	dials := 0
+	return func(ctx context.Context) (*sftpConn, error) {
+		dials++
+		c2sR, c2sW := io.Pipe()
+		s2cR, s2cW := io.Pipe()
+		server, err := sftp.NewServer(struct {
+			io.Reader
+			io.WriteCloser
+		}{c2sR, s2cW})
+		if err != nil {
+			return nil, err
+		}
+		go func() { _ = server.Serve() }()
+		client, err := sftp.NewClientPipe(s2cR, c2sW)
+		if err != nil {
+			return nil, err
+		}
+		return &sftpConn{client: client, close: func() error {
+			_ = s2cW.Close()
+			return client.Close()
+		}}, nil
+	}, &dials
+}
+
+func TestSFTPStorageAgainstFakeServer(t *testing.T) {
+	dial, dials := pipeSFTPDialer()
+	st := newSFTPStorage("pipe", t.TempDir(), dial, logger.Register("storage-test"))
+
+	exerciseStorage(t, st)
+
+	saveNames(t, st, "bb01", "aa01", "aa02", "cc01")
+	if got := listPaths(t, st, ""); got != "aa/aa01,aa/aa02,bb/bb01,cc/cc01" {
+		t.Fatalf("unexpected listing: %s", got)
+	}
+	if got := listPaths(t, st, "aa/aa02"); got != "bb/bb01,cc/cc01" {
+		t.Fatalf("unexpected listing after key: %s", got)
+	}
+
+	// 连接断开后下一次操作自动重连
+	st.mu.Lock()
+	_ = st.conn.close()
+	st.mu.Unlock()
+	if ok, err := st.Exists(context.Background(), "bb/bb01"); err != nil || !ok {
+		t.Fatalf("expected reconnect to succeed: %v", err)
+	}
+	if *dials != 2 {
+		t.Fatalf("expected one reconnect, got %d dials", *dials)
+	}
+}
+
+func TestParseByteRange(t *testing.T) {
+	cases := []struct {
+		header        string
+		start, length int64
+		ok            bool
+	}{
+		{"bytes=0-4", 0, 5, true},
+		{"bytes=5-", 5, 5, true},
+		{"bytes=-3", 7, 3, true},
+		{"bytes=8-100", 8, 2, true},
+		{"bytes=10-", 0, 0, false},
+		{"bytes=0-1,3-4", 0, 0, false},
+		{"items=0-1", 0, 0, false},
+	}
+	for _, c := range cases {
+		start, length, err := parseByteRange(c.header, 10)
+		if c.ok != (err == nil) || (c.ok && (start != c.start || length != c.length)) {
+			t.Errorf("%s: got %d,%d,%v", c.header, start, length, err)
+		}
+	}
+}
@@ -2,6 +2,8 @@ package service
 
 import (
 	"fmt"
+	"io"
+	"strings"
 
 	"github.com/TangTangChu/AnzuImg/backend/internal/config"
 	"github.com/TangTangChu/AnzuImg/backend/internal/logger"
@@ -11,8 +13,11 @@ import (
 type StorageType string
 
 const (
-	StorageTypeLocal StorageType = "local"
-	StorageTypeCloud StorageType = "cloud"
+	StorageTypeLocal  StorageType = "local"
+	StorageTypeCloud  StorageType = "cloud"
+	StorageTypeWebDAV StorageType = "webdav"
+	StorageTypeSFTP   StorageType = "sftp"
+	StorageTypeHTTP   StorageType = "http"
 )
 
 // StorageFactory 存储工厂
@@ -33,11 +38,24 @@ func (f *StorageFactory) CreateStorage(storageType StorageType) (Storage, error)
 		return NewLocalStorage(f.cfg, f.log), nil
 	case StorageTypeCloud:
 		return NewCloudStorage(f.cfg, f.log)
+	case StorageTypeWebDAV:
+		return NewWebDAVStorage(f.cfg, f.log)
+	case StorageTypeSFTP:
+		return NewSFTPStorage(f.cfg, f.log)
+	case StorageTypeHTTP:
+		return NewHTTPStorage(f.cfg, f.log)
 	default:
 		return nil, fmt.Errorf("unsupported storage type: %s", storageType)
 	}
 }
 
+// closeStorage 关闭持有连接的存储实例，用于只在单个任务或校验中使用的实例
+func closeStorage(st Storage) {
+	if c, ok := st.(io.Closer); ok {
+		_ = c.Close()
+	}
+}
+
 // CreateDefaultStorage 创建默认存储
 func (f *StorageFactory) CreateDefaultStorage() Storage {
 	storageType := f.GetStorageTypeFromConfig()
@@ -47,7 +65,38 @@ func (f *StorageFactory) CreateDefaultStorage() Storage {
 		return NewLocalStorage(f.cfg, f.log)
 	}
 	f.log.Infof("Created storage type: %s", storage.Type())
-	return storage
+	return f.withReplicas(storage)
+}
+
+// withReplicas 按 StorageReplicas 配置为主存储附加副本，没有可用副本时原样返回
+func (f *StorageFactory) withReplicas(primary Storage) Storage {
+	var replicas []Storage
+	for _, name := range f.cfg.StorageReplicas {
+		storageType := StorageType(strings.ToLower(name))
+		if string(storageType) == primary.Type() {
+			f.log.Warnf("Replica storage %s is the same as primary, ignored", storageType)
+			continue
+		}
+		replica, err := f.CreateStorage(storageType)
+		if err != nil {
+			f.log.Errorf("Failed to create replica storage %s: %v", storageType, err)
+			continue
+		}
+		replicas = append(replicas, replica)
+	}
+	if len(replicas) == 0 {
+		return primary
+	}
+
+	replicated, err := NewReplicatedStorage(primary, replicas, f.log)
+	if err != nil {
+		f.log.Errorf("Failed to enable storage replication: %v", err)
+		return primary
+	}
+	for _, r := range replicas {
+		f.log.Infof("Added replica storage: %s", r.Type())
+	}
+	return replicated
 }
 
 // GetStorageTypeFromConfig 从配置中获取存储类型
@@ -58,6 +107,12 @@ func (f *StorageFactory) GetStorageTypeFromConfig() StorageType {
 		return StorageTypeLocal
 	case "cloud":
 		return StorageTypeCloud
+	case "webdav":
+		return StorageTypeWebDAV
+	case "sftp":
+		return StorageTypeSFTP
+	case "http":
+		return StorageTypeHTTP
 	default:
 		f.log.Warnf("Unknown storage type: %s, using local storage", storageType)
 		return StorageTypeLocal
@@ -2,15 +2,21 @@ package service
 
 import (
 	"context"
+	"errors"
+	"io"
+	"time"
 )
 
 // Storage 定义图床存储接口
 type Storage interface {
-	// Save 保存图片数据，返回存储路径和文件大小
-	Save(ctx context.Context, hash string, data []byte, mimeType string) (path string, size int64, err error)
+	// Save 从 r 读取内容并保存，size 为内容长度，未知时传 -1；返回存储路径和实际写入大小
+	Save(ctx context.Context, hash string, r io.Reader, size int64, mimeType string) (path string, written int64, err error)
 	// GetAbsPath 根据相对路径获取绝对路径或访问URL
 	GetAbsPath(ctx context.Context, relPath string) (string, error)
 
+	// Open 打开指定路径的文件，返回可随机读取的流
+	Open(ctx context.Context, relPath string) (io.ReadSeekCloser, error)
+
 	// Delete 删除指定路径的文件
 	Delete(ctx context.Context, relPath string) error
 
@@ -20,3 +26,50 @@ type Storage interface {
 	// Type 返回存储类型
 	Type() string
 }
+
+// StorageObject 是存储中的一个对象
+type StorageObject struct {
+	Path    string
+	Size    int64
+	ModTime time.Time
+}
+
+// ListableStorage 由可枚举全部对象的存储实现，供完整性巡检使用
+type ListableStorage interface {
+	Storage
+
+	// List 按路径字典序遍历 startAfter 之后的对象，fn 返回错误时停止遍历并返回该错误
+	List(ctx context.Context, startAfter string, fn func(StorageObject) error) error
+}
+
+// 云存储分发方式
+const (
+	DeliveryRedirect = "redirect"
+	DeliveryPresign  = "presign"
+	DeliveryProxy    = "proxy"
+)
+
+// ErrInvalidRange 表示请求的范围无法满足
+var ErrInvalidRange = errors.New("requested range not satisfiable")
+
+// ObjectStream 是按范围读取的对象内容
+type ObjectStream struct {
+	Body          io.ReadCloser
+	ContentLength int64
+	ContentRange  string // 非空表示返回的是部分内容
+	LocalPath     string // 非空表示远端读取失败、已回退到本地副本，调用方应直接输出该文件，Body 为空
+}
+
+// RemoteStorage 由远端对象存储实现，决定 /i 请求如何分发到存储后端
+type RemoteStorage interface {
+	Storage
+
+	// DeliveryMode 返回分发方式：redirect、presign 或 proxy
+	DeliveryMode() string
+
+	// PresignGet 生成带有效期的下载地址
+	PresignGet(ctx context.Context, relPath string) (url string, ttl time.Duration, err error)
+
+	// OpenRange 读取对象，rangeHeader 为空时读取完整内容
+	OpenRange(ctx context.Context, relPath string, rangeHeader string) (*ObjectStream, error)
+}
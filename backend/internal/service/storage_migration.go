@@ -0,0 +1,222 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"gorm.io/gorm"
+
+	"github.com/TangTangChu/AnzuImg/backend/internal/model"
+)
+
+const storageMigrationBatch = 100
+
+// StorageMigrationParams 存储迁移参数
+type StorageMigrationParams struct {
+	From         string `json:"from"`
+	To           string `json:"to"`
+	DeleteSource bool   `json:"delete_source"` // 校验并切换成功后删除源文件
+}
+
+// BackfillImageStorageBackend 启动时为 storage_backend 为空的历史图片补上当前配置的存储类型，
+// 之后切换 ANZUIMG_STORAGE_TYPE 不会让未迁移的图片指向错误的后端
+func (s *MaintenanceService) BackfillImageStorageBackend() error {
+	storageType := NewStorageFactory(s.cfg, s.log).GetStorageTypeFromConfig()
+	res := s.db.Model(&model.Image{}).Where("storage_backend = ''").
+		Update("storage_backend", string(storageType))
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected > 0 {
+		s.log.Infof("Backfilled storage_backend=%s for %d images", storageType, res.RowsAffected)
+	}
+	return nil
+}
+
+// CreateStorageMigration 校验参数并登记一个存储迁移任务
+func (s *MaintenanceService) CreateStorageMigration(params StorageMigrationParams) (*model.MaintenanceJob, error) {
+	params.From = strings.ToLower(strings.TrimSpace(params.From))
+	params.To = strings.ToLower(strings.TrimSpace(params.To))
+	if params.From == "" || params.To == "" || params.From == params.To {
+		return nil, fmt.Errorf("%w: from and to must be different storage types", ErrInvalidJobParams)
+	}
+	factory := NewStorageFactory(s.cfg, s.log)
+	for _, name := range []string{params.From, params.To} {
+		st, err := factory.CreateStorage(StorageType(name))
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidJobParams, err)
+		}
+		closeStorage(st)
+	}
+	return s.createJob(model.MaintenanceKindStorageMigration, params)
+}
+
+func (s *MaintenanceService) runStorageMigration(ctx context.Context, job *model.MaintenanceJob, checkpoint func() error) error {
+	var params StorageMigrationParams
+	if err := json.Unmarshal(job.Params, &params); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidJobParams, err)
+	}
+	factory := NewStorageFactory(s.cfg, s.log)
+	src, err := factory.CreateStorage(StorageType(params.From))
+	if err != nil {
+		return fmt.Errorf("open source storage failed: %w", err)
+	}
+	defer closeStorage(src)
+	dst, err := factory.CreateStorage(StorageType(params.To))
+	if err != nil {
+		return fmt.Errorf("open target storage failed: %w", err)
+	}
+	defer closeStorage(dst)
+
+	pending := s.db.WithContext(ctx).Model(&model.Image{}).Where("storage_backend = ?", params.From)
+	var remaining int64
+	if err := pending.Session(&gorm.Session{}).Where("id > ?", job.LastID).Count(&remaining).Error; err != nil {
+		return err
+	}
+	job.Total = job.Processed + remaining
+	if err := checkpoint(); err != nil {
+		return err
+	}
+
+	for {
+		var batch []model.Image
+		if err := pending.Session(&gorm.Session{}).Where("id > ?", job.LastID).
+			Order("id ASC").Limit(storageMigrationBatch).Find(&batch).Error; err != nil {
+			return err
+		}
+		if len(batch) == 0 {
+			return nil
+		}
+		for i := range batch {
+			img := &batch[i]
+			if err := s.migrateImage(ctx, src, dst, img, params); err != nil {
+				if errors.Is(err, context.Canceled) {
+					return ErrJobCancelled
+				}
+				job.Failed++
+				job.LastError = fmt.Sprintf("%s: %v", img.Hash, err)
+				s.log.Warnf("Storage migration failed for %s: %v", img.Hash, err)
+			}
+			job.LastID = img.ID
+			job.Processed++
+			if err := checkpoint(); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// migrateImage 复制原图与缩略图到目标存储，校验后切换 storage_path 与 storage_backend
+func (s *MaintenanceService) migrateImage(ctx context.Context, src, dst Storage, img *model.Image, params StorageMigrationParams) error {
+	newPath, err := copyVerified(ctx, src, dst, img.Path, img.Hash, img.Size, img.MimeType)
+	if err != nil {
+		return err
+	}
+	written := []string{newPath}
+	cleanup := func() {
+		for _, p := range written {
+			if delErr := dst.Delete(ctx, p); delErr != nil {
+				s.log.Warnf("Failed to cleanup migrated file %s: %v", p, delErr)
+			}
+		}
+	}
+
+	for _, thumb := range allThumbnailFiles(s.cfg) {
+		thumbPath := img.Path + thumb.suffix
+		if ok, err := src.Exists(ctx, thumbPath); err != nil || !ok {
+			continue
+		}
+		p, err := copyObject(ctx, src, dst, thumbPath, img.Hash+thumb.suffix, thumb.mimeType)
+		if err != nil {
+			cleanup()
+			return fmt.Errorf("copy thumbnail failed: %w", err)
+		}
+		written = append(written, p)
+	}
+
+	// 以原值为条件切换，期间被删除或已被其他任务迁移的图片不会被覆盖
+	res := s.db.WithContext(ctx).Model(&model.Image{}).
+		Where("id = ? AND storage_path = ? AND storage_backend = ?", img.ID, img.Path, img.StorageBackend).
+		Updates(map[string]interface{}{"storage_path": newPath, "storage_backend": params.To})
+	if res.Error != nil {
+		cleanup()
+		return fmt.Errorf("update image failed: %w", res.Error)
+	}
+	if res.RowsAffected == 0 {
+		cleanup()
+		return errors.New("image changed during migration")
+	}
+
+	if params.DeleteSource {
+		if err := src.Delete(ctx, img.Path); err != nil {
+			s.log.Warnf("Failed to delete source file %s: %v", img.Path, err)
+		}
+		for _, thumb := range allThumbnailFiles(s.cfg) {
+			_ = src.Delete(ctx, img.Path+thumb.suffix)
+		}
+	}
+	return nil
+}
+
+// copyVerified 复制原图并回读目标文件，校验大小与 SHA-256
+func copyVerified(ctx context.Context, src, dst Storage, relPath, hash string, size int64, mimeType string) (string, error) {
+	newPath, err := copyObject(ctx, src, dst, relPath, hash, mimeType)
+	if err != nil {
+		return "", err
+	}
+
+	gotSize, gotHash, err := hashObject(ctx, dst, newPath)
+	if err == nil && (gotSize != size || gotHash != hash) {
+		err = fmt.Errorf("verification failed: size %d/%d, hash %s", gotSize, size, gotHash)
+	}
+	if err != nil {
+		if delErr := dst.Delete(ctx, newPath); delErr != nil {
+			err = fmt.Errorf("%w (cleanup failed: %v)", err, delErr)
+		}
+		return "", err
+	}
+	return newPath, nil
+}
+
+// copyObject 以流的方式把 src 中的 relPath 保存为 dst 中的 name
+func copyObject(ctx context.Context, src, dst Storage, relPath, name, mimeType string) (string, error) {
+	f, err := src.Open(ctx, relPath)
+	if err != nil {
+		return "", fmt.Errorf("open source failed: %w", err)
+	}
+	defer f.Close()
+
+	size, err := f.Seek(0, io.SeekEnd)
+	if err == nil {
+		_, err = f.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		size = -1
+	}
+	newPath, _, err := dst.Save(ctx, name, f, size, mimeType)
+	if err != nil {
+		return "", fmt.Errorf("write target failed: %w", err)
+	}
+	return newPath, nil
+}
+
+// hashObject 读取存储中的文件并计算大小与 SHA-256
+func hashObject(ctx context.Context, st Storage, relPath string) (int64, string, error) {
+	f, err := st.Open(ctx, relPath)
+	if err != nil {
+		return 0, "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	n, err := io.Copy(h, f)
+	if err != nil {
+		return n, "", err
+	}
+	return n, hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,44 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"github.com/TangTangChu/AnzuImg/backend/internal/config"
+)
+
+func TestCopyVerifiedRejectsHashMismatch(t *testing.T) {
+	ctx := context.Background()
+	src := NewLocalStorage(&config.Config{StorageBase: t.TempDir()}, nil)
+	dst := NewLocalStorage(&config.Config{StorageBase: t.TempDir()}, nil)
+
+	content := "migrate me"
+	sum := sha256.Sum256([]byte(content))
+	hash := hex.EncodeToString(sum[:])
+	path, _, err := src.Save(ctx, hash, strings.NewReader(content), -1, "text/plain")
+	if err != nil {
+		t.Fatalf("save failed: %v", err)
+	}
+
+	newPath, err := copyVerified(ctx, src, dst, path, hash, int64(len(content)), "text/plain")
+	if err != nil {
+		t.Fatalf("copy failed: %v", err)
+	}
+	if ok, _ := dst.Exists(ctx, newPath); !ok {
+		t.Fatal("expected copied file on target")
+	}
+
+	badPath, _, err := src.Save(ctx, "ffff"+hash[4:], strings.NewReader("tampered"), -1, "text/plain")
+	if err != nil {
+		t.Fatalf("save failed: %v", err)
+	}
+	if _, err := copyVerified(ctx, src, dst, badPath, "ffff"+hash[4:], 8, "text/plain"); err == nil {
+		t.Fatal("expected hash mismatch to fail")
+	}
+	if ok, _ := dst.Exists(ctx, badPath); ok {
+		t.Fatal("expected mismatched copy to be removed")
+	}
+}
@@ -0,0 +1,409 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/TangTangChu/AnzuImg/backend/internal/model"
+)
+
+const (
+	storageScrubBatch     = 100
+	storageScrubListBatch = 500
+
+	scrubStageImages  = "images"
+	scrubStageObjects = "objects"
+)
+
+// 孤立对象的处理方式
+const (
+	ScrubOrphanReport     = "report"
+	ScrubOrphanQuarantine = "quarantine"
+	ScrubOrphanDelete     = "delete"
+)
+
+// 默认只处理 24 小时前写入的孤立对象，避免误伤正在上传、尚未写入数据库的文件
+const defaultScrubOrphanMinAgeHours = 24
+
+// StorageScrubParams 完整性巡检参数
+type StorageScrubParams struct {
+	Backend           string `json:"backend"`              // 为空表示当前配置的主存储
+	Orphans           string `json:"orphans"`              // report、quarantine 或 delete，默认 report
+	OrphanMinAgeHours int    `json:"orphan_min_age_hours"` // 早于该时长写入的对象才视为孤立
+}
+
+// CreateStorageScrub 校验参数并登记一个完整性巡检任务
+func (s *MaintenanceService) CreateStorageScrub(params StorageScrubParams) (*model.MaintenanceJob, error) {
+	factory := NewStorageFactory(s.cfg, s.log)
+	params.Backend = strings.ToLower(strings.TrimSpace(params.Backend))
+	if params.Backend == "" {
+		params.Backend = string(factory.GetStorageTypeFromConfig())
+	}
+	params.Orphans = strings.ToLower(strings.TrimSpace(params.Orphans))
+	switch params.Orphans {
+	case "":
+		params.Orphans = ScrubOrphanReport
+	case ScrubOrphanReport, ScrubOrphanQuarantine, ScrubOrphanDelete:
+	default:
+		return nil, fmt.Errorf("%w: orphans must be report, quarantine or delete", ErrInvalidJobParams)
+	}
+	if params.OrphanMinAgeHours <= 0 {
+		params.OrphanMinAgeHours = defaultScrubOrphanMinAgeHours
+	}
+	if params.Orphans == ScrubOrphanQuarantine && s.cfg.ScrubQuarantineDir == "" {
+		return nil, fmt.Errorf("%w: quarantine directory is not configured", ErrInvalidJobParams)
+	}
+
+	st, err := factory.CreateStorage(StorageType(params.Backend))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidJobParams, err)
+	}
+	defer closeStorage(st)
+	if _, ok := st.(ListableStorage); !ok {
+		return nil, fmt.Errorf("%w: storage %s does not support listing", ErrInvalidJobParams, params.Backend)
+	}
+	return s.createJob(model.MaintenanceKindStorageScrub, params)
+}
+
+// runStorageScrub 分两个阶段巡检：先按图片 ID 回读记录引用的文件并校验大小与 SHA-256，
+// 再按路径遍历存储中的全部对象，找出没有任何记录引用的孤立对象
+func (s *MaintenanceService) runStorageScrub(ctx context.Context, job *model.MaintenanceJob, checkpoint func() error) error {
+	var params StorageScrubParams
+	if err := json.Unmarshal(job.Params, &params); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidJobParams, err)
+	}
+	st, err := NewStorageFactory(s.cfg, s.log).CreateStorage(StorageType(params.Backend))
+	if err != nil {
+		return fmt.Errorf("open storage failed: %w", err)
+	}
+	defer closeStorage(st)
+	lister, ok := st.(ListableStorage)
+	if !ok {
+		return fmt.Errorf("%w: storage %s does not support listing", ErrInvalidJobParams, params.Backend)
+	}
+
+	if job.Stage == "" {
+		// 从头开始（包括失败后重试）时清掉上一轮的结果
+		if err := s.db.WithContext(ctx).Where("job_id = ?", job.ID).Delete(&model.ScrubFinding{}).Error; err != nil {
+			return err
+		}
+		job.Stage = scrubStageImages
+	}
+	if job.Stage == scrubStageImages {
+		if err := s.scrubImages(ctx, job, st, params, checkpoint); err != nil {
+			return err
+		}
+		job.Stage = scrubStageObjects
+		job.LastKey = ""
+		if err := checkpoint(); err != nil {
+			return err
+		}
+	}
+	return s.scrubObjects(ctx, job, lister, params, checkpoint)
+}
+
+// scrubImages 校验记录在该后端上的原图，包括以该后端为副本且状态正常的图片
+func (s *MaintenanceService) scrubImages(ctx context.Context, job *model.MaintenanceJob, st Storage, params StorageScrubParams, checkpoint func() error) error {
+	pending := s.db.WithContext(ctx).Model(&model.Image{}).
+		Where("storage_backend = ? OR id IN (?)", params.Backend,
+			s.db.Model(&model.ImageReplica{}).Select("image_id").
+				Where("backend = ? AND status = ?", params.Backend, model.ReplicaStatusOK))
+	var remaining int64
+	if err := pending.Session(&gorm.Session{}).Where("id > ?", job.LastID).Count(&remaining).Error; err != nil {
+		return err
+	}
+	job.Total = job.Processed + remaining
+	if err := checkpoint(); err != nil {
+		return err
+	}
+
+	for {
+		var batch []model.Image
+		if err := pending.Session(&gorm.Session{}).Where("id > ?", job.LastID).
+			Order("id ASC").Limit(storageScrubBatch).Find(&batch).Error; err != nil {
+			return err
+		}
+		if len(batch) == 0 {
+			return nil
+		}
+		for i := range batch {
+			img := &batch[i]
+			finding, err := s.scrubImage(ctx, st, img)
+			if err == nil && finding != nil {
+				finding.JobID = job.ID
+				finding.Backend = params.Backend
+				err = s.recordScrubFinding(ctx, finding)
+			}
+			if err != nil {
+				if errors.Is(err, context.Canceled) {
+					return ErrJobCancelled
+				}
+				job.Failed++
+				job.LastError = fmt.Sprintf("%s: %v", img.Hash, err)
+				s.log.Warnf("Storage scrub failed for %s: %v", img.Hash, err)
+			}
+			job.LastID = img.ID
+			job.Processed++
+			if err := checkpoint(); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// scrubImage 回读原图并与记录比对，文件完好时返回 nil
+func (s *MaintenanceService) scrubImage(ctx context.Context, st Storage, img *model.Image) (*model.ScrubFinding, error) {
+	imageID := img.ID
+	gotSize, gotHash, err := hashObject(ctx, st, img.Path)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		// 打开失败时再确认一次文件是否真的不存在，其他错误按检查失败处理
+		exists, existsErr := st.Exists(ctx, img.Path)
+		if existsErr != nil || exists {
+			return nil, err
+		}
+		return &model.ScrubFinding{
+			Kind:    model.ScrubFindingMissing,
+			Path:    img.Path,
+			ImageID: &imageID,
+			Size:    img.Size,
+		}, nil
+	}
+	if gotSize == img.Size && gotHash == img.Hash {
+		return nil, nil
+	}
+	return &model.ScrubFinding{
+		Kind:    model.ScrubFindingCorrupt,
+		Path:    img.Path,
+		ImageID: &imageID,
+		Size:    gotSize,
+		Detail:  fmt.Sprintf("size %d/%d, hash %s", gotSize, img.Size, gotHash),
+	}, nil
+}
+
+// scrubObjects 遍历存储中的对象，按批查询引用并处理孤立对象
+func (s *MaintenanceService) scrubObjects(ctx context.Context, job *model.MaintenanceJob, st ListableStorage, params StorageScrubParams, checkpoint func() error) error {
+	cutoff := time.Now().Add(-time.Duration(params.OrphanMinAgeHours) * time.Hour)
+	batch := make([]StorageObject, 0, storageScrubListBatch)
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		if err := s.scrubObjectBatch(ctx, job, st, params, batch, cutoff); err != nil {
+			return err
+		}
+		job.LastKey = batch[len(batch)-1].Path
+		job.Total += int64(len(batch))
+		job.Processed += int64(len(batch))
+		batch = batch[:0]
+		return checkpoint()
+	}
+
+	err := st.List(ctx, job.LastKey, func(obj StorageObject) error {
+		batch = append(batch, obj)
+		if len(batch) < storageScrubListBatch {
+			return nil
+		}
+		return flush()
+	})
+	if err == nil {
+		err = flush()
+	}
+	if errors.Is(err, context.Canceled) {
+		return ErrJobCancelled
+	}
+	return err
+}
+
+// scrubObjectBatch 找出一批对象中的孤立对象，记录并按参数隔离或删除
+func (s *MaintenanceService) scrubObjectBatch(ctx context.Context, job *model.MaintenanceJob, st Storage, params StorageScrubParams, objects []StorageObject, cutoff time.Time) error {
+	referenced, err := s.referencedPaths(ctx, params.Backend, objects)
+	if err != nil {
+		return err
+	}
+	for _, obj := range objects {
+		if referenced[obj.Path] || obj.ModTime.After(cutoff) {
+			continue
+		}
+		finding := &model.ScrubFinding{
+			JobID:   job.ID,
+			Kind:    model.ScrubFindingOrphan,
+			Backend: params.Backend,
+			Path:    obj.Path,
+			Size:    obj.Size,
+		}
+		if err := s.handleOrphan(ctx, job, st, params.Orphans, finding); err != nil {
+			if errors.Is(err, context.Canceled) {
+				return err
+			}
+			job.Failed++
+			job.LastError = fmt.Sprintf("%s: %v", obj.Path, err)
+			s.log.Warnf("Failed to %s orphan %s: %v", params.Orphans, obj.Path, err)
+		}
+		if err := s.recordScrubFinding(ctx, finding); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// referencedPaths 返回一批对象中被记录引用的路径：该后端上的原图及其缩略图，以及变换缓存文件
+func (s *MaintenanceService) referencedPaths(ctx context.Context, backend string, objects []StorageObject) (map[string]bool, error) {
+	thumbs := allThumbnailFiles(s.cfg)
+	paths := make([]string, 0, len(objects))
+	candidates := make([]string, 0, len(objects))
+	for _, obj := range objects {
+		paths = append(paths, obj.Path)
+		candidates = append(candidates, obj.Path)
+		for _, thumb := range thumbs {
+			if base, ok := strings.CutSuffix(obj.Path, thumb.suffix); ok {
+				candidates = append(candidates, base)
+			}
+		}
+	}
+
+	var imagePaths []string
+	if err := s.db.WithContext(ctx).Model(&model.Image{}).
+		Where("storage_path IN ?", candidates).
+		Where("storage_backend = ? OR id IN (?)", backend,
+			s.db.Model(&model.ImageReplica{}).Select("image_id").Where("backend = ?", backend)).
+		Pluck("storage_path", &imagePaths).Error; err != nil {
+		return nil, err
+	}
+	var variantPaths []string
+	if err := s.db.WithContext(ctx).Model(&model.ImageVariant{}).
+		Where("storage_path IN ?", paths).
+		Pluck("storage_path", &variantPaths).Error; err != nil {
+		return nil, err
+	}
+
+	images := make(map[string]bool, len(imagePaths))
+	for _, p := range imagePaths {
+		images[p] = true
+	}
+	referenced := make(map[string]bool, len(objects))
+	for _, p := range variantPaths {
+		referenced[p] = true
+	}
+	for _, obj := range objects {
+		if images[obj.Path] {
+			referenced[obj.Path] = true
+			continue
+		}
+		for _, thumb := range thumbs {
+			if base, ok := strings.CutSuffix(obj.Path, thumb.suffix); ok && images[base] {
+				referenced[obj.Path] = true
+			}
+		}
+	}
+	return referenced, nil
+}
+
+// handleOrphan 按参数处理孤立对象，处理结果写入 finding.Action
+func (s *MaintenanceService) handleOrphan(ctx context.Context, job *model.MaintenanceJob, st Storage, action string, finding *model.ScrubFinding) error {
+	switch action {
+	case ScrubOrphanQuarantine:
+		if err := s.quarantineObject(ctx, st, filepath.Join(s.cfg.ScrubQuarantineDir, job.ID), finding.Path); err != nil {
+			return err
+		}
+		finding.Action = model.ScrubActionQuarantined
+	case ScrubOrphanDelete:
+		if err := st.Delete(ctx, finding.Path); err != nil {
+			return err
+		}
+		finding.Action = model.ScrubActionDeleted
+	}
+	return nil
+}
+
+// quarantineObject 把对象复制到本地隔离目录后从存储中删除，保留原有的相对路径
+func (s *MaintenanceService) quarantineObject(ctx context.Context, st Storage, dir, relPath string) error {
+	dst := filepath.Join(dir, filepath.FromSlash(relPath))
+	if !strings.HasPrefix(dst, filepath.Clean(dir)+string(filepath.Separator)) {
+		return fmt.Errorf("invalid object path: %s", relPath)
+	}
+	if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+		return fmt.Errorf("mkdir quarantine dir failed: %w", err)
+	}
+
+	src, err := st.Open(ctx, relPath)
+	if err != nil {
+		return fmt.Errorf("open object failed: %w", err)
+	}
+	defer src.Close()
+	f, err := os.Create(dst)
+	if err != nil {
+		return fmt.Errorf("create quarantine file failed: %w", err)
+	}
+	_, err = io.Copy(f, src)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(dst)
+		return fmt.Errorf("write quarantine file failed: %w", err)
+	}
+	return st.Delete(ctx, relPath)
+}
+
+// recordScrubFinding 写入巡检结果，续跑时重复处理的对象不会产生重复记录
+func (s *MaintenanceService) recordScrubFinding(ctx context.Context, finding *model.ScrubFinding) error {
+	return s.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "job_id"}, {Name: "path"}},
+		DoUpdates: clause.AssignmentColumns([]string{"kind", "image_id", "size", "detail", "action"}),
+	}).Create(finding).Error
+}
+
+// ScrubSummary 按类型统计巡检任务发现的问题
+func (s *MaintenanceService) ScrubSummary(jobID string) (map[string]int64, error) {
+	var rows []struct {
+		Kind  string
+		Count int64
+	}
+	if err := s.db.Model(&model.ScrubFinding{}).Select("kind, COUNT(*) AS count").
+		Where("job_id = ?", jobID).Group("kind").Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+	summary := map[string]int64{
+		model.ScrubFindingMissing: 0,
+		model.ScrubFindingCorrupt: 0,
+		model.ScrubFindingOrphan:  0,
+	}
+	for _, r := range rows {
+		summary[r.Kind] = r.Count
+	}
+	return summary, nil
+}
+
+// ListScrubFindings 分页列出巡检任务发现的问题，kind 为空时不过滤
+func (s *MaintenanceService) ListScrubFindings(jobID, kind string, page, pageSize int) ([]model.ScrubFinding, int64, error) {
+	if page < 1 {
+		page = 1
+	}
+	if pageSize <= 0 || pageSize > 200 {
+		pageSize = 50
+	}
+	query := s.db.Model(&model.ScrubFinding{}).Where("job_id = ?", jobID)
+	if kind != "" {
+		query = query.Where("kind = ?", kind)
+	}
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	var findings []model.ScrubFinding
+	err := query.Order("id ASC").Offset((page - 1) * pageSize).Limit(pageSize).Find(&findings).Error
+	return findings, total, err
+}
@@ -0,0 +1,43 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"github.com/TangTangChu/AnzuImg/backend/internal/config"
+	"github.com/TangTangChu/AnzuImg/backend/internal/model"
+)
+
+func TestScrubImageDetectsMissingAndCorrupt(t *testing.T) {
+	ctx := context.Background()
+	st := NewLocalStorage(&config.Config{StorageBase: t.TempDir()}, nil)
+	s := &MaintenanceService{}
+
+	content := "scrub me"
+	sum := sha256.Sum256([]byte(content))
+	hash := hex.EncodeToString(sum[:])
+	path, _, err := st.Save(ctx, hash, strings.NewReader(content), -1, "text/plain")
+	if err != nil {
+		t.Fatalf("save failed: %v", err)
+	}
+
+	img := &model.Image{ID: 1, Hash: hash, Size: int64(len(content)), Path: path}
+	if finding, err := s.scrubImage(ctx, st, img); err != nil || finding != nil {
+		t.Fatalf("expected intact image, got %+v, %v", finding, err)
+	}
+
+	img.Hash = "ffff" + hash[4:]
+	finding, err := s.scrubImage(ctx, st, img)
+	if err != nil || finding == nil || finding.Kind != model.ScrubFindingCorrupt {
+		t.Fatalf("expected corrupt finding, got %+v, %v", finding, err)
+	}
+
+	img.Path = "ff/missing"
+	finding, err = s.scrubImage(ctx, st, img)
+	if err != nil || finding == nil || finding.Kind != model.ScrubFindingMissing {
+		t.Fatalf("expected missing finding, got %+v, %v", finding, err)
+	}
+}
@@ -0,0 +1,136 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// rangedReader 以 io.ReadSeekCloser 的形式读取远端对象，按当前读取位置发起范围请求，Seek 后重新请求
+type rangedReader struct {
+	ctx    context.Context
+	size   int64
+	offset int64
+	body   io.ReadCloser
+	// fetch 从 offset 开始读取到对象末尾
+	fetch func(ctx context.Context, offset int64) (io.ReadCloser, error)
+}
+
+func (r *rangedReader) Read(p []byte) (int, error) {
+	if r.offset >= r.size {
+		return 0, io.EOF
+	}
+	if r.body == nil {
+		body, err := r.fetch(r.ctx, r.offset)
+		if err != nil {
+			return 0, err
+		}
+		r.body = body
+	}
+	n, err := r.body.Read(p)
+	r.offset += int64(n)
+	if err == io.EOF && r.offset < r.size {
+		err = io.ErrUnexpectedEOF
+	}
+	return n, err
+}
+
+func (r *rangedReader) Seek(offset int64, whence int) (int64, error) {
+	var next int64
+	switch whence {
+	case io.SeekStart:
+		next = offset
+	case io.SeekCurrent:
+		next = r.offset + offset
+	case io.SeekEnd:
+		next = r.size + offset
+	default:
+		return 0, fmt.Errorf("invalid whence: %d", whence)
+	}
+	if next < 0 {
+		return 0, fmt.Errorf("negative position: %d", next)
+	}
+	if next != r.offset && r.body != nil {
+		_ = r.body.Close()
+		r.body = nil
+	}
+	r.offset = next
+	return next, nil
+}
+
+func (r *rangedReader) Close() error {
+	if r.body == nil {
+		return nil
+	}
+	err := r.body.Close()
+	r.body = nil
+	return err
+}
+
+// spoolToTemp 把长度未知的输入落盘到临时文件，调用方负责关闭并删除
+func spoolToTemp(r io.Reader, pattern string) (*os.File, int64, error) {
+	spool, err := os.CreateTemp("", pattern)
+	if err != nil {
+		return nil, 0, fmt.Errorf("create spool file failed: %w", err)
+	}
+	n, err := io.Copy(spool, r)
+	if err == nil {
+		_, err = spool.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		_ = spool.Close()
+		_ = os.Remove(spool.Name())
+		return nil, 0, fmt.Errorf("spool upload failed: %w", err)
+	}
+	return spool, n, nil
+}
+
+// parseByteRange 解析单段 Range 头，返回起始位置与长度。
+// 不支持多段范围，范围无法满足时返回 ErrInvalidRange。
+func parseByteRange(header string, size int64) (int64, int64, error) {
+	spec, ok := strings.CutPrefix(strings.TrimSpace(header), "bytes=")
+	if !ok || strings.Contains(spec, ",") {
+		return 0, 0, ErrInvalidRange
+	}
+	startStr, endStr, ok := strings.Cut(strings.TrimSpace(spec), "-")
+	if !ok {
+		return 0, 0, ErrInvalidRange
+	}
+
+	var start, end int64
+	if startStr == "" {
+		// bytes=-N 表示最后 N 个字节
+		n, err := strconv.ParseInt(endStr, 10, 64)
+		if err != nil || n <= 0 || size == 0 {
+			return 0, 0, ErrInvalidRange
+		}
+		if n > size {
+			n = size
+		}
+		return size - n, n, nil
+	}
+	start, err := strconv.ParseInt(startStr, 10, 64)
+	if err != nil || start < 0 || start >= size {
+		return 0, 0, ErrInvalidRange
+	}
+	end = size - 1
+	if endStr != "" {
+		end, err = strconv.ParseInt(endStr, 10, 64)
+		if err != nil || end < start {
+			return 0, 0, ErrInvalidRange
+		}
+		if end >= size {
+			end = size - 1
+		}
+	}
+	return start, end - start + 1, nil
+}
+
+// listSkipsDir 判断遍历时能否跳过整个目录：目录下所有路径都不晚于 startAfter
+func listSkipsDir(relDir, startAfter string) bool {
+	prefix := relDir + "/"
+	return prefix < startAfter && !strings.HasPrefix(startAfter, prefix)
+}
@@ -0,0 +1,239 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/TangTangChu/AnzuImg/backend/internal/model"
+)
+
+const thumbnailJobBatch = 100
+
+// 等待 worker 池处理期间刷新任务心跳的间隔，需明显短于 maintenanceStaleAfter
+const thumbnailJobHeartbeat = 30 * time.Second
+
+// 默认把 60 分钟前仍为 pending 的缩略图视为进程退出时丢失的任务
+const defaultThumbnailPendingMinAgeMinutes = 60
+
+// ThumbnailBackfillParams 缩略图补齐参数
+type ThumbnailBackfillParams struct {
+	PendingMinAgeMinutes int `json:"pending_min_age_minutes"` // pending 超过该时长才重新生成
+}
+
+// ThumbnailRegenerateParams 缩略图重新生成参数，Hash、Tag 与 All 三选一
+type ThumbnailRegenerateParams struct {
+	Hash        string `json:"hash"`
+	Tag         string `json:"tag"`
+	All         bool   `json:"all"`
+	MissingOnly bool   `json:"missing_only"` // 只生成尚不存在的规格，用于新增规格后补齐
+}
+
+// UseThumbnailPool 让缩略图维护任务在服务进程的缩略图 worker 池上执行。
+// 命令行前台运行时没有该池，首次使用时按当前设置创建一个。
+func (s *MaintenanceService) UseThumbnailPool(p *ThumbnailPool) {
+	s.mu.Lock()
+	s.thumbnails = p
+	s.mu.Unlock()
+}
+
+func (s *MaintenanceService) thumbnailPool() *ThumbnailPool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.thumbnails == nil {
+		s.thumbnails = NewThumbnailPool(s.cfg, s.db)
+	}
+	return s.thumbnails
+}
+
+// CreateThumbnailBackfill 登记一个缩略图补齐任务
+func (s *MaintenanceService) CreateThumbnailBackfill(params ThumbnailBackfillParams) (*model.MaintenanceJob, error) {
+	if params.PendingMinAgeMinutes <= 0 {
+		params.PendingMinAgeMinutes = defaultThumbnailPendingMinAgeMinutes
+	}
+	return s.createJob(model.MaintenanceKindThumbnailBackfill, params)
+}
+
+// CreateThumbnailRegenerate 校验参数并登记一个缩略图重新生成任务
+func (s *MaintenanceService) CreateThumbnailRegenerate(params ThumbnailRegenerateParams) (*model.MaintenanceJob, error) {
+	params.Hash = strings.TrimSpace(params.Hash)
+	params.Tag = strings.TrimSpace(params.Tag)
+	scopes := 0
+	for _, set := range []bool{params.Hash != "", params.Tag != "", params.All} {
+		if set {
+			scopes++
+		}
+	}
+	if scopes != 1 {
+		return nil, fmt.Errorf("%w: exactly one of hash, tag or all is required", ErrInvalidJobParams)
+	}
+	if params.Hash != "" {
+		var img model.Image
+		if err := s.db.Select("id", "mime_type").Where("hash = ?", params.Hash).First(&img).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil, fmt.Errorf("%w: image not found", ErrInvalidJobParams)
+			}
+			return nil, err
+		}
+		if !IsImageFile(img.MimeType) && !IsVideoFile(img.MimeType) {
+			return nil, fmt.Errorf("%w: media has no thumbnail", ErrInvalidJobParams)
+		}
+	}
+	return s.createJob(model.MaintenanceKindThumbnailRegenerate, params)
+}
+
+// thumbnailMediaQuery 选出需要缩略图的图片与视频
+func (s *MaintenanceService) thumbnailMediaQuery(ctx context.Context) *gorm.DB {
+	return s.db.WithContext(ctx).Model(&model.Image{}).
+		Where("mime_type LIKE ? OR mime_type LIKE ?", "image/%", "video/%")
+}
+
+// runThumbnailBackfill 为缩略图跳过、失败、长时间未完成或状态未知的图片和视频补齐缺失的规格。
+// 状态未知的历史图片缩略图已齐全时只补记状态。
+func (s *MaintenanceService) runThumbnailBackfill(ctx context.Context, job *model.MaintenanceJob, checkpoint func() error) error {
+	var params ThumbnailBackfillParams
+	if err := json.Unmarshal(job.Params, &params); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidJobParams, err)
+	}
+	cutoff := time.Now().Add(-time.Duration(params.PendingMinAgeMinutes) * time.Minute)
+	pending := s.thumbnailMediaQuery(ctx).
+		Where("thumbnail_status IN ? OR (thumbnail_status = ? AND updated_at < ?)",
+			[]string{"", model.ThumbnailStatusSkipped, model.ThumbnailStatusFailed},
+			model.ThumbnailStatusPending, cutoff)
+	return s.runThumbnailBatches(ctx, job, pending, true, checkpoint)
+}
+
+// runThumbnailRegenerate 按参数选出的图片和视频重新生成全部规格的缩略图
+func (s *MaintenanceService) runThumbnailRegenerate(ctx context.Context, job *model.MaintenanceJob, checkpoint func() error) error {
+	var params ThumbnailRegenerateParams
+	if err := json.Unmarshal(job.Params, &params); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidJobParams, err)
+	}
+	q := s.thumbnailMediaQuery(ctx)
+	switch {
+	case params.Hash != "":
+		q = q.Where("hash = ?", params.Hash)
+	case params.Tag != "":
+		tagJSON, err := json.Marshal([]string{params.Tag})
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidJobParams, err)
+		}
+		q = q.Where("tags @> ?", string(tagJSON))
+	case !params.All:
+		return fmt.Errorf("%w: exactly one of hash, tag or all is required", ErrInvalidJobParams)
+	}
+	return s.runThumbnailBatches(ctx, job, q, params.MissingOnly, checkpoint)
+}
+
+type thumbnailJobResult struct {
+	index int
+	err   error
+}
+
+// runThumbnailBatches 按图片 ID 分批把 query 选出的媒体交给缩略图 worker 池。
+// 计数按完成顺序更新，游标只推进到连续完成的位置，中断后续跑不会漏掉图片。
+func (s *MaintenanceService) runThumbnailBatches(ctx context.Context, job *model.MaintenanceJob, query *gorm.DB, missingOnly bool, checkpoint func() error) error {
+	var remaining int64
+	if err := query.Session(&gorm.Session{}).Where("id > ?", job.LastID).Count(&remaining).Error; err != nil {
+		return err
+	}
+	job.Total = job.Processed + remaining
+	if err := checkpoint(); err != nil {
+		return err
+	}
+
+	pool := s.thumbnailPool()
+	factory := NewStorageFactory(s.cfg, s.log)
+	defaultBackend := string(factory.GetStorageTypeFromConfig())
+	storages := map[string]Storage{}
+	defer func() {
+		for _, st := range storages {
+			closeStorage(st)
+		}
+	}()
+	storageFor := func(name string) (Storage, error) {
+		if name == "" {
+			name = defaultBackend
+		}
+		if st, ok := storages[name]; ok {
+			return st, nil
+		}
+		st, err := factory.CreateStorage(StorageType(name))
+		if err != nil {
+			return nil, err
+		}
+		storages[name] = st
+		return st, nil
+	}
+
+	heartbeat := time.NewTicker(thumbnailJobHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		var batch []model.Image
+		if err := query.Session(&gorm.Session{}).Where("id > ?", job.LastID).
+			Order("id ASC").Limit(thumbnailJobBatch).Find(&batch).Error; err != nil {
+			return err
+		}
+		if len(batch) == 0 {
+			return nil
+		}
+
+		// 结果通道足够容纳整批，任务中途退出时已入队的图片仍能完成
+		results := make(chan thumbnailJobResult, len(batch))
+		done := make([]bool, len(batch))
+		next, finished, cursor := 0, 0, 0
+		for finished < len(batch) {
+			for next < len(batch) {
+				i := next
+				st, err := storageFor(batch[i].StorageBackend)
+				if err != nil {
+					results <- thumbnailJobResult{index: i, err: err}
+					next++
+					continue
+				}
+				tj := thumbnailJob{
+					Storage:     st,
+					Image:       batch[i],
+					MissingOnly: missingOnly,
+					Done:        func(err error) { results <- thumbnailJobResult{index: i, err: err} },
+				}
+				if !pool.tryEnqueueBackground(tj) {
+					break
+				}
+				next++
+			}
+
+			select {
+			case <-ctx.Done():
+				return ErrJobCancelled
+			case r := <-results:
+				finished++
+				done[r.index] = true
+				if r.err != nil {
+					img := &batch[r.index]
+					job.Failed++
+					job.LastError = fmt.Sprintf("%s: %v", img.Hash, r.err)
+					s.log.Warnf("Thumbnail job failed for %s: %v", img.Hash, r.err)
+				}
+				job.Processed++
+				for cursor < len(batch) && done[cursor] {
+					job.LastID = batch[cursor].ID
+					cursor++
+				}
+				if err := checkpoint(); err != nil {
+					return err
+				}
+			case <-pool.queue.space:
+			case <-heartbeat.C:
+				if err := checkpoint(); err != nil {
+					return err
+				}
+			}
+		}
+	}
+}
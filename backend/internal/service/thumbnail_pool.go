@@ -0,0 +1,491 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/TangTangChu/AnzuImg/backend/internal/config"
+	"github.com/TangTangChu/AnzuImg/backend/internal/logger"
+	"github.com/TangTangChu/AnzuImg/backend/internal/model"
+)
+
+// 定期把因队列已满而跳过的缩略图重新入队
+const thumbnailSweepInterval = 5 * time.Minute
+
+var ErrUnknownThumbnailSize = errors.New("unknown thumbnail size")
+
+// thumbnailFile 是某个规格的缩略图文件，路径为原图路径加 suffix
+type thumbnailFile struct {
+	preset   string
+	suffix   string
+	mimeType string
+}
+
+var thumbnailFormats = map[string]struct{ ext, mimeType string }{
+	"webp": {"webp", "image/webp"},
+	"avif": {"avif", "image/avif"},
+	"jpeg": {"jpg", "image/jpeg"},
+}
+
+// legacyThumbnailFiles 是引入多规格前生成的默认缩略图，default 规格改变格式后仍可读取
+var legacyThumbnailFiles = []thumbnailFile{
+	{preset: config.DefaultThumbnailPreset, suffix: "_thumb.webp", mimeType: "image/webp"},
+	{preset: config.DefaultThumbnailPreset, suffix: "_thumb.jpg", mimeType: "image/jpeg"},
+}
+
+// thumbnailFileFor 返回媒体在某个规格下的缩略图文件。default 规格为 _thumb.<ext>，与早期文件同名，
+// 其他规格为 _thumb_<name>.<ext>；视频封面固定为 JPEG
+func thumbnailFileFor(preset config.ThumbnailPreset, mimeType string) thumbnailFile {
+	format := preset.Format
+	if IsVideoFile(mimeType) {
+		format = "jpeg"
+	}
+	f, ok := thumbnailFormats[format]
+	if !ok {
+		f = thumbnailFormats["webp"]
+	}
+	suffix := "_thumb"
+	if preset.Name != config.DefaultThumbnailPreset {
+		suffix += "_" + preset.Name
+	}
+	return thumbnailFile{preset: preset.Name, suffix: suffix + "." + f.ext, mimeType: f.mimeType}
+}
+
+// allThumbnailFiles 返回可能存在的全部缩略图文件，供删除、迁移与巡检使用
+func allThumbnailFiles(cfg *config.Config) []thumbnailFile {
+	files := append([]thumbnailFile(nil), legacyThumbnailFiles...)
+	seen := map[string]bool{}
+	for _, f := range files {
+		seen[f.suffix] = true
+	}
+	for _, preset := range cfg.ThumbnailPresets() {
+		for _, mimeType := range []string{"image/", "video/"} {
+			f := thumbnailFileFor(preset, mimeType)
+			if !seen[f.suffix] {
+				seen[f.suffix] = true
+				files = append(files, f)
+			}
+		}
+	}
+	return files
+}
+
+// initialThumbnailStatus 返回新图片入库时的缩略图状态，不需要缩略图的文件为空
+func initialThumbnailStatus(mimeType string) string {
+	if IsImageFile(mimeType) || IsVideoFile(mimeType) {
+		return model.ThumbnailStatusPending
+	}
+	return ""
+}
+
+type thumbnailJob struct {
+	Storage Storage
+	Image   model.Image // 使用 Hash、Path 与 MimeType
+	// SrcPath 为已暂存的原图，为空时由 worker 从 Storage 取回；RemoveSrc 表示处理后删除该文件
+	SrcPath   string
+	RemoveSrc bool
+	// MissingOnly 只生成尚不存在的规格
+	MissingOnly bool
+	After       func(ctx context.Context, srcPath string)
+	Done        func(err error)
+}
+
+// thumbnailQueue 是等待生成的缩略图队列，上限由入队方按当前设置传入
+type thumbnailQueue struct {
+	mu    sync.Mutex
+	jobs  []thumbnailJob
+	ready chan struct{} // 有新任务时通知空闲 worker
+	space chan struct{} // 有任务出队时通知等待入队的维护任务
+}
+
+func newThumbnailQueue() *thumbnailQueue {
+	return &thumbnailQueue{
+		ready: make(chan struct{}, maxBackgroundWorkers),
+		space: make(chan struct{}, 1),
+	}
+}
+
+// push 在队列未满时加入任务，队列已满返回 false
+func (q *thumbnailQueue) push(job thumbnailJob, limit int) bool {
+	q.mu.Lock()
+	if len(q.jobs) >= limit {
+		q.mu.Unlock()
+		return false
+	}
+	q.jobs = append(q.jobs, job)
+	q.mu.Unlock()
+	select {
+	case q.ready <- struct{}{}:
+	default:
+	}
+	return true
+}
+
+func (q *thumbnailQueue) pop() (thumbnailJob, bool) {
+	q.mu.Lock()
+	if len(q.jobs) == 0 {
+		q.mu.Unlock()
+		return thumbnailJob{}, false
+	}
+	job := q.jobs[0]
+	q.jobs[0] = thumbnailJob{}
+	q.jobs = q.jobs[1:]
+	q.mu.Unlock()
+	select {
+	case q.space <- struct{}{}:
+	default:
+	}
+	return job, true
+}
+
+func (q *thumbnailQueue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.jobs)
+}
+
+// ThumbnailPool 是缩略图生成队列与 worker，上传、定期补齐与维护任务共用。
+// worker 数与队列上限取自当前设置，由 Resize 与入队时的检查在运行时生效。
+type ThumbnailPool struct {
+	cfg *config.Config
+	db  *gorm.DB
+	log *logger.Logger
+
+	queue   *thumbnailQueue
+	workers *workerPool
+	pending sync.Map // 按需重建中的图片 hash
+}
+
+func NewThumbnailPool(cfg *config.Config, db *gorm.DB) *ThumbnailPool {
+	p := &ThumbnailPool{
+		cfg:   cfg,
+		db:    db,
+		log:   logger.Register("thumbnail"),
+		queue: newThumbnailQueue(),
+	}
+	p.workers = newWorkerPool(p.work)
+	workers := 2
+	if cfg != nil {
+		workers = cfg.Effective().ThumbnailWorkers
+	}
+	p.workers.Resize(workers)
+	return p
+}
+
+// Resize 调整 worker 数
+func (p *ThumbnailPool) Resize(n int) {
+	p.workers.Resize(n)
+}
+
+func (p *ThumbnailPool) limit() int {
+	if p.cfg != nil {
+		if n := p.cfg.Effective().ThumbnailQueueSize; n > 0 {
+			return n
+		}
+	}
+	return 64
+}
+
+// TryEnqueue 在队列未满时加入任务，队列已满返回 false
+func (p *ThumbnailPool) TryEnqueue(job thumbnailJob) bool {
+	return p.queue.push(job, p.limit())
+}
+
+// tryEnqueueBackground 供批量维护任务入队，只占用一半队列，为新上传留出空位
+func (p *ThumbnailPool) tryEnqueueBackground(job thumbnailJob) bool {
+	return p.queue.push(job, max(p.limit()/2, 1))
+}
+
+// Run 在调用方的 goroutine 中立即生成缩略图，返回记录的缩略图状态
+func (p *ThumbnailPool) Run(job thumbnailJob) string {
+	return p.process(job)
+}
+
+func (p *ThumbnailPool) work(stop <-chan struct{}) {
+	for {
+		if stopped(stop) {
+			return
+		}
+		if job, ok := p.queue.pop(); ok {
+			p.process(job)
+			continue
+		}
+		select {
+		case <-stop:
+			return
+		case <-p.queue.ready:
+		}
+	}
+}
+
+// process 生成任务指定媒体的全部规格并记录缩略图状态
+func (p *ThumbnailPool) process(job thumbnailJob) string {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+	img := &job.Image
+
+	presets := p.cfg.ThumbnailPresets()
+	if job.MissingOnly {
+		presets = missingThumbnailPresets(ctx, job.Storage, img, presets)
+	}
+
+	srcPath := job.SrcPath
+	removeSrc := job.RemoveSrc
+	var err error
+	if srcPath == "" && len(presets) > 0 {
+		srcPath, err = stageStorageFile(ctx, job.Storage, img.Path, "anzuimg-thumbnail-*")
+		removeSrc = err == nil
+	}
+	if removeSrc {
+		defer func() { _ = os.Remove(srcPath) }()
+	}
+	if err == nil {
+		err = renderThumbnails(ctx, job.Storage, img, srcPath, presets)
+	}
+
+	status := model.ThumbnailStatusReady
+	if err != nil {
+		p.log.Ctx(ctx).Warnf("Failed to generate thumbnail for %s: %v", img.Hash, err)
+		status = model.ThumbnailStatusFailed
+	}
+	p.setStatus(img.Hash, status)
+	if job.After != nil && srcPath != "" {
+		job.After(ctx, srcPath)
+	}
+	if job.Done != nil {
+		job.Done(err)
+	}
+	return status
+}
+
+func (p *ThumbnailPool) setStatus(hash, status string) {
+	if p.db == nil {
+		return
+	}
+	if err := p.db.Model(&model.Image{}).Where("hash = ?", hash).Update("thumbnail_status", status).Error; err != nil {
+		p.log.Warnf("Failed to update thumbnail status for %s: %v", hash, err)
+	}
+}
+
+// requestRebuild 在访问到缺失的缩略图时安排补生成，同一张图片同时只排队一次，队列已满时放弃
+func (p *ThumbnailPool) requestRebuild(st Storage, img *model.Image) {
+	if !IsImageFile(img.MimeType) && !IsVideoFile(img.MimeType) {
+		return
+	}
+	if _, loaded := p.pending.LoadOrStore(img.Hash, struct{}{}); loaded {
+		return
+	}
+	hash := img.Hash
+	job := thumbnailJob{
+		Storage:     st,
+		Image:       *img,
+		MissingOnly: true,
+		Done:        func(error) { p.pending.Delete(hash) },
+	}
+	if !p.TryEnqueue(job) {
+		p.pending.Delete(hash)
+	}
+}
+
+// missingThumbnailPresets 返回缩略图文件尚不存在的规格，无法确认时按缺失处理
+func missingThumbnailPresets(ctx context.Context, st Storage, img *model.Image, presets []config.ThumbnailPreset) []config.ThumbnailPreset {
+	var missing []config.ThumbnailPreset
+	for _, preset := range presets {
+		file := thumbnailFileFor(preset, img.MimeType)
+		if exists, err := st.Exists(ctx, img.Path+file.suffix); err == nil && exists {
+			continue
+		}
+		missing = append(missing, preset)
+	}
+	return missing
+}
+
+// renderThumbnails 为媒体生成各个规格的缩略图，单个规格失败不影响其他规格
+func renderThumbnails(ctx context.Context, st Storage, img *model.Image, srcPath string, presets []config.ThumbnailPreset) error {
+	if !IsImageFile(img.MimeType) && !IsVideoFile(img.MimeType) {
+		return nil
+	}
+	var errs []error
+	for _, preset := range presets {
+		if err := renderThumbnail(ctx, st, img, srcPath, preset, thumbnailFileFor(preset, img.MimeType)); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", preset.Name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// renderThumbnail 按规格生成一个缩略图并保存在原图旁
+func renderThumbnail(ctx context.Context, st Storage, img *model.Image, srcPath string, preset config.ThumbnailPreset, file thumbnailFile) error {
+	var thumbData []byte
+	if IsImageFile(img.MimeType) {
+		f, err := os.Open(srcPath)
+		if err != nil {
+			return fmt.Errorf("read thumbnail input failed: %w", err)
+		}
+		thumbData, _, err = GenerateThumbnail(f, preset.Width, preset.Height, preset.Format)
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("generate thumbnail failed: %w", err)
+		}
+	} else {
+		var err error
+		thumbData, err = GenerateVideoThumbnailFile(ctx, srcPath, preset.Width, preset.Height)
+		if err != nil {
+			return fmt.Errorf("generate video thumbnail failed: %w", err)
+		}
+	}
+	if _, _, err := st.Save(ctx, img.Hash+file.suffix, bytes.NewReader(thumbData), int64(len(thumbData)), file.mimeType); err != nil {
+		return fmt.Errorf("save thumbnail failed: %w", err)
+	}
+	return nil
+}
+
+// stageStorageFile 把存储中的文件复制到临时文件，调用方负责删除
+func stageStorageFile(ctx context.Context, st Storage, relPath, pattern string) (string, error) {
+	rc, err := st.Open(ctx, relPath)
+	if err != nil {
+		return "", fmt.Errorf("open %s failed: %w", relPath, err)
+	}
+	defer rc.Close()
+	spool, _, err := spoolToTemp(rc, pattern)
+	if err != nil {
+		return "", err
+	}
+	name := spool.Name()
+	if err := spool.Close(); err != nil {
+		_ = os.Remove(name)
+		return "", err
+	}
+	return name, nil
+}
+
+// Thumbnails 返回缩略图 worker 池，维护任务在同一个池上重新生成缩略图
+func (s *ImageService) Thumbnails() *ThumbnailPool {
+	return s.thumbnails
+}
+
+// enqueueThumbnail 复制 srcPath 后交给缩略图 worker，返回写入记录的缩略图状态
+func (s *ImageService) enqueueThumbnail(img *model.Image, srcPath string) string {
+	if !IsImageFile(img.MimeType) && !IsVideoFile(img.MimeType) {
+		return ""
+	}
+	tempPath, err := copyToTemp("anzuimg-thumbnail-*", srcPath)
+	if err != nil {
+		s.log.Warnf("Failed to stage thumbnail input: %v", err)
+		s.thumbnails.setStatus(img.Hash, model.ThumbnailStatusSkipped)
+		return model.ThumbnailStatusSkipped
+	}
+	job := s.thumbnailJob(img, tempPath)
+	job.RemoveSrc = true
+	if !s.thumbnails.TryEnqueue(job) {
+		_ = os.Remove(tempPath)
+		s.log.Warnf("Thumbnail queue full; deferred thumbnail for %s", img.Hash)
+		s.thumbnails.setStatus(img.Hash, model.ThumbnailStatusSkipped)
+		return model.ThumbnailStatusSkipped
+	}
+	return model.ThumbnailStatusPending
+}
+
+// generateThumbnail 立即生成新上传媒体的缩略图，返回记录的缩略图状态
+func (s *ImageService) generateThumbnail(img *model.Image, srcPath string) string {
+	if !IsImageFile(img.MimeType) && !IsVideoFile(img.MimeType) {
+		return ""
+	}
+	return s.thumbnails.Run(s.thumbnailJob(img, srcPath))
+}
+
+// thumbnailJob 构造新上传媒体的缩略图任务，图片生成后还会预生成自动格式变体
+func (s *ImageService) thumbnailJob(img *model.Image, srcPath string) thumbnailJob {
+	job := thumbnailJob{Storage: s.storage, Image: *img, SrcPath: srcPath}
+	if IsImageFile(img.MimeType) {
+		hash, mimeType := img.Hash, img.MimeType
+		job.After = func(ctx context.Context, srcPath string) {
+			s.pregenerateAutoFormats(ctx, hash, srcPath, mimeType)
+		}
+	}
+	return job
+}
+
+// ApplyWorkerSettings 按新的设置调整上传与缩略图 worker 数，队列上限在入队时读取无需处理
+func (s *ImageService) ApplyWorkerSettings(eff *config.Effective) {
+	if eff == nil {
+		return
+	}
+	if s.uploadPool != nil {
+		s.uploadPool.Resize(eff.UploadWorkers)
+	}
+	s.thumbnails.Resize(eff.ThumbnailWorkers)
+}
+
+// startThumbnailSweep 定期把跳过的缩略图按队列空位重新入队
+func (s *ImageService) startThumbnailSweep() {
+	if s.db == nil {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(thumbnailSweepInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			if n, err := s.requeueSkippedThumbnails(context.Background()); err != nil {
+				s.log.Warnf("Thumbnail sweep failed: %v", err)
+			} else if n > 0 {
+				s.log.Infof("Requeued %d skipped thumbnails", n)
+			}
+		}
+	}()
+}
+
+// requeueSkippedThumbnails 把跳过的缩略图重新入队，原图由 worker 从存储取回，返回入队数量。
+// 状态以条件更新切换为 pending，多个实例同时扫描时每张图片只会被一个实例处理。
+func (s *ImageService) requeueSkippedThumbnails(ctx context.Context) (int, error) {
+	room := s.thumbnails.limit() - s.thumbnails.queue.Len()
+	if room <= 0 {
+		return 0, nil
+	}
+	var images []model.Image
+	if err := s.db.WithContext(ctx).Where("thumbnail_status = ?", model.ThumbnailStatusSkipped).
+		Order("id ASC").Limit(room).Find(&images).Error; err != nil {
+		return 0, fmt.Errorf("query skipped thumbnails failed: %w", err)
+	}
+
+	queued := 0
+	for i := range images {
+		img := &images[i]
+		res := s.db.WithContext(ctx).Model(&model.Image{}).
+			Where("id = ? AND thumbnail_status = ?", img.ID, model.ThumbnailStatusSkipped).
+			Update("thumbnail_status", model.ThumbnailStatusPending)
+		if res.Error != nil {
+			return queued, fmt.Errorf("claim skipped thumbnail failed: %w", res.Error)
+		}
+		if res.RowsAffected == 0 {
+			continue
+		}
+		job := thumbnailJob{Storage: s.storageFor(img), Image: *img}
+		if !s.thumbnails.TryEnqueue(job) {
+			s.thumbnails.setStatus(img.Hash, model.ThumbnailStatusSkipped)
+			break
+		}
+		queued++
+	}
+	return queued, nil
+}
+
+// deleteThumbnails 删除媒体的全部缩略图，包括最早期无扩展名的 _thumb
+func (s *ImageService) deleteThumbnails(ctx context.Context, st Storage, relPath string) {
+	suffixes := []string{"_thumb"}
+	for _, f := range allThumbnailFiles(s.cfg) {
+		suffixes = append(suffixes, f.suffix)
+	}
+	for _, suffix := range suffixes {
+		if err := st.Delete(ctx, relPath+suffix); err != nil {
+			s.log.Ctx(ctx).Debugf("Failed to delete thumbnail %s: %v", suffix, err)
+		}
+	}
+}
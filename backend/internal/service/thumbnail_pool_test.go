@@ -0,0 +1,94 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/TangTangChu/AnzuImg/backend/internal/config"
+)
+
+func TestParseThumbnailPresets(t *testing.T) {
+	presets, err := config.ParseThumbnailPresets("small:320x240, Large:1600x1600:avif,print:2000x2000:jpg")
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+	want := []config.ThumbnailPreset{
+		{Name: "default", Width: 800, Height: 800, Format: "webp"},
+		{Name: "small", Width: 320, Height: 240, Format: "webp"},
+		{Name: "large", Width: 1600, Height: 1600, Format: "avif"},
+		{Name: "print", Width: 2000, Height: 2000, Format: "jpeg"},
+	}
+	if len(presets) != len(want) {
+		t.Fatalf("presets = %+v, want %+v", presets, want)
+	}
+	for i := range want {
+		if presets[i] != want[i] {
+			t.Fatalf("presets[%d] = %+v, want %+v", i, presets[i], want[i])
+		}
+	}
+
+	// 显式配置 default 时不再补默认规格
+	presets, err = config.ParseThumbnailPresets("default:400x400:jpeg")
+	if err != nil || len(presets) != 1 || presets[0].Width != 400 || presets[0].Format != "jpeg" {
+		t.Fatalf("presets = %+v, %v", presets, err)
+	}
+
+	for _, raw := range []string{
+		"small",
+		"small:320",
+		"small:0x320",
+		"small:9000x320",
+		"small:320x320:gif",
+		"Bad Name:320x320",
+		"small:320x320,small:640x640",
+	} {
+		if _, err := config.ParseThumbnailPresets(raw); err == nil {
+			t.Errorf("ParseThumbnailPresets(%q) should fail", raw)
+		}
+	}
+}
+
+func TestThumbnailFileFor(t *testing.T) {
+	def := config.ThumbnailPreset{Name: "default", Width: 800, Height: 800, Format: "webp"}
+	small := config.ThumbnailPreset{Name: "small", Width: 320, Height: 320, Format: "avif"}
+	cases := []struct {
+		preset   config.ThumbnailPreset
+		mimeType string
+		suffix   string
+		fileMime string
+	}{
+		// default 规格与早期缩略图同名，已有文件无需重建
+		{def, "image/png", "_thumb.webp", "image/webp"},
+		{def, "video/mp4", "_thumb.jpg", "image/jpeg"},
+		{small, "image/png", "_thumb_small.avif", "image/avif"},
+		{small, "video/mp4", "_thumb_small.jpg", "image/jpeg"},
+	}
+	for _, tc := range cases {
+		f := thumbnailFileFor(tc.preset, tc.mimeType)
+		if f.suffix != tc.suffix || f.mimeType != tc.fileMime || f.preset != tc.preset.Name {
+			t.Errorf("thumbnailFileFor(%s, %s) = %+v, want %s %s", tc.preset.Name, tc.mimeType, f, tc.suffix, tc.fileMime)
+		}
+	}
+}
+
+func TestThumbnailQueueLimit(t *testing.T) {
+	q := newThumbnailQueue()
+	if !q.push(thumbnailJob{SrcPath: "a"}, 2) || !q.push(thumbnailJob{SrcPath: "b"}, 2) {
+		t.Fatal("push below limit failed")
+	}
+	if q.push(thumbnailJob{SrcPath: "c"}, 2) {
+		t.Fatal("push over limit should be rejected")
+	}
+	// 调大上限后立即可以继续入队
+	if !q.push(thumbnailJob{SrcPath: "c"}, 3) {
+		t.Fatal("push after raising limit failed")
+	}
+	for _, want := range []string{"a", "b", "c"} {
+		job, ok := q.pop()
+		if !ok || job.SrcPath != want {
+			t.Fatalf("pop = %q, %v; want %q", job.SrcPath, ok, want)
+		}
+	}
+	if _, ok := q.pop(); ok {
+		t.Fatal("pop from empty queue should fail")
+	}
+}
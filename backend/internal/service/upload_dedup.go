@@ -0,0 +1,140 @@
+package service
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+
+	"github.com/TangTangChu/AnzuImg/backend/internal/model"
+)
+
+// ExistingUploadInput 描述一项上传前的哈希预检，内容已存在时附加路由、标签与描述
+type ExistingUploadInput struct {
+	Hash        string
+	Size        int64 // 大于 0 时还需与已有文件大小一致
+	Routes      []string
+	Tags        []string
+	Description string
+}
+
+// NormalizeContentHash 校验并规范化十六进制 SHA-256
+func NormalizeContentHash(hash string) (string, bool) {
+	hash = strings.ToLower(strings.TrimSpace(hash))
+	sum, err := hex.DecodeString(hash)
+	if err != nil || len(sum) != 32 {
+		return "", false
+	}
+	return hash, true
+}
+
+// UploadExisting 按内容哈希查找已有媒体，找到时与 Upload 的去重分支一样附加路由，
+// 并合并标签、在提供时更新描述，客户端无需再次发送内容。不存在时返回 nil。
+func (s *ImageService) UploadExisting(ctx context.Context, input ExistingUploadInput) (*UploadResult, error) {
+	hashStr, ok := NormalizeContentHash(input.Hash)
+	if !ok {
+		return nil, fmt.Errorf("invalid content hash: %q", input.Hash)
+	}
+	sum, _ := hex.DecodeString(hashStr)
+	// 与 Upload 共用内容锁，避免与同一内容的上传交错
+	contentLock := &s.uploadLocks[int(sum[0])]
+	contentLock.Lock()
+	defer contentLock.Unlock()
+
+	var existing model.Image
+	if err := s.db.Where("hash = ?", hashStr).First(&existing).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("db query failed: %w", err)
+	}
+	if input.Size > 0 && input.Size != existing.Size {
+		return nil, nil
+	}
+
+	tags, tagsChanged, err := mergeTags(existing.Tags, input.Tags)
+	if err != nil {
+		return nil, err
+	}
+	firstRoute := ""
+	if err := s.db.Transaction(func(tx *gorm.DB) error {
+		for _, rStr := range input.Routes {
+			if rStr == "" {
+				continue
+			}
+			route, err := s.normalizeRoute(rStr)
+			if err != nil {
+				return err
+			}
+			r := model.ImageRoute{ImageID: &existing.ID, Route: route}
+			if err := tx.Create(&r).Error; err != nil {
+				return fmt.Errorf("route insert failed: %w", err)
+			}
+			if firstRoute == "" {
+				firstRoute = route
+			}
+		}
+
+		var fields []string
+		if tagsChanged {
+			existing.Tags = tags
+			fields = append(fields, "Tags")
+		}
+		if input.Description != "" && input.Description != existing.Description {
+			existing.Description = input.Description
+			fields = append(fields, "Description")
+		}
+		if len(fields) == 0 {
+			return nil
+		}
+		return tx.Model(&existing).Select(fields).Updates(existing).Error
+	}); err != nil {
+		return nil, err
+	}
+
+	s.log.Ctx(ctx).Infof("Reused existing media by hash: hash=%s, routes=%d, tags=%d", hashStr, len(input.Routes), len(input.Tags))
+
+	return &UploadResult{
+		Image:    existing,
+		Reused:   true,
+		Route:    firstRoute,
+		HashURL:  "/i/" + existing.Hash,
+		RouteURL: routeURL(firstRoute),
+	}, nil
+}
+
+// mergeTags 把 add 中尚未存在的标签追加到 current 之后，返回合并结果及是否有变化
+func mergeTags(current datatypes.JSON, add []string) (datatypes.JSON, bool, error) {
+	var tags []string
+	if len(current) > 0 {
+		if err := json.Unmarshal(current, &tags); err != nil {
+			return nil, false, fmt.Errorf("decode tags failed: %w", err)
+		}
+	}
+	seen := make(map[string]struct{}, len(tags))
+	for _, t := range tags {
+		seen[t] = struct{}{}
+	}
+	changed := false
+	for _, t := range add {
+		if _, ok := seen[t]; ok || t == "" {
+			continue
+		}
+		seen[t] = struct{}{}
+		tags = append(tags, t)
+		changed = true
+	}
+	if !changed {
+		return current, false, nil
+	}
+	tagsBytes, err := json.Marshal(tags)
+	if err != nil {
+		return nil, false, fmt.Errorf("marshal tags failed: %w", err)
+	}
+	return datatypes.JSON(tagsBytes), true, nil
+}
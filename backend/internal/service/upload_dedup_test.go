@@ -0,0 +1,31 @@
+package service
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMergeTagsAppendsOnlyNewTags(t *testing.T) {
+	merged, changed, err := mergeTags([]byte(`["a","b"]`), []string{"b", "c", ""})
+	if err != nil || !changed || string(merged) != `["a","b","c"]` {
+		t.Fatalf("unexpected merge result: %s %v %v", merged, changed, err)
+	}
+	if _, changed, _ := mergeTags([]byte(`["a"]`), []string{"a"}); changed {
+		t.Fatal("expected no change for existing tags")
+	}
+	if merged, changed, _ := mergeTags(nil, []string{"x"}); !changed || string(merged) != `["x"]` {
+		t.Fatalf("unexpected merge into empty tags: %s", merged)
+	}
+}
+
+func TestNormalizeContentHash(t *testing.T) {
+	upper := "2CF24DBA5FB0A30E26E83B2AC5B9E29E1B161E5C1FA7425E73043362938B9824"
+	if got, ok := NormalizeContentHash(" " + upper); !ok || got != strings.ToLower(upper) {
+		t.Fatalf("expected normalized hash, got %q %v", got, ok)
+	}
+	for _, bad := range []string{"", "abc", upper[:62], upper[:63] + "g"} {
+		if _, ok := NormalizeContentHash(bad); ok {
+			t.Fatalf("expected %q to be rejected", bad)
+		}
+	}
+}
@@ -0,0 +1,427 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/TangTangChu/AnzuImg/backend/internal/config"
+	"github.com/TangTangChu/AnzuImg/backend/internal/model"
+)
+
+const (
+	// 单次执行的超时时间
+	uploadTaskTimeout = 5 * time.Minute
+	// running 状态超过该时长未完成视为执行它的进程已退出，可被重新认领；须大于 uploadTaskTimeout
+	uploadTaskStaleAfter = 2 * uploadTaskTimeout
+	// 没有唤醒信号时 worker 轮询数据库的间隔，用于拾取其他进程入队或到期重试的任务
+	uploadTaskPollInterval = 5 * time.Second
+)
+
+// uploadTaskPayload 是持久化在 upload_tasks.payload 中的任务参数
+type uploadTaskPayload struct {
+	Input UploadTaskInput `json:"input"`
+	Size  int64           `json:"size"`
+	Hash  string          `json:"hash"`
+}
+
+func (s *ImageService) uploadTaskMaxAttempts() int {
+	if s.cfg != nil && s.cfg.UploadTaskMaxAttempts > 0 {
+		return s.cfg.UploadTaskMaxAttempts
+	}
+	return 3
+}
+
+func (s *ImageService) uploadTaskPath(id string) string {
+	return uploadTaskFilePath(s.cfg, id)
+}
+
+func uploadTaskFilePath(cfg *config.Config, id string) string {
+	dir := "./data/tasks"
+	if cfg != nil && cfg.UploadTaskDir != "" {
+		dir = cfg.UploadTaskDir
+	}
+	return filepath.Join(dir, id)
+}
+
+// retryBackoff 返回第 attempts 次失败后的重试等待时间：从 base 起按倍数增长，最长 max
+func retryBackoff(attempts int, base, max time.Duration) time.Duration {
+	backoff := base
+	for i := 1; i < attempts && backoff < max; i++ {
+		backoff *= 2
+	}
+	if backoff > max {
+		backoff = max
+	}
+	return backoff
+}
+
+// uploadTaskBackoff 返回上传任务的重试等待时间：30s 起倍增，最长 10 分钟
+func uploadTaskBackoff(attempts int) time.Duration {
+	return retryBackoff(attempts, 30*time.Second, 10*time.Minute)
+}
+
+// moveFile 把 src 移动到 dst，跨文件系统时退化为复制后删除
+func moveFile(src, dst string) error {
+	if err := os.Rename(src, dst); err == nil {
+		return nil
+	}
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(out, in)
+	if syncErr := out.Sync(); err == nil {
+		err = syncErr
+	}
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(dst)
+		return err
+	}
+	_ = os.Remove(src)
+	return nil
+}
+
+// startUploadWorkers 按当前设置启动从数据库认领上传任务的 worker，之后由 ApplyWorkerSettings 调整。
+// 多个进程可以同时运行 worker，认领时使用 SKIP LOCKED 保证同一任务只被一个 worker 执行。
+func (s *ImageService) startUploadWorkers() {
+	s.uploadWake = make(chan struct{}, maxBackgroundWorkers)
+	if s.db == nil {
+		return
+	}
+	s.uploadPool = newWorkerPool(s.uploadWorker)
+	workers := 2
+	if s.cfg != nil {
+		workers = s.cfg.Effective().UploadWorkers
+	}
+	s.uploadPool.Resize(workers)
+}
+
+// uploadWorker 持续认领任务，收到 stop 后在当前任务结束时退出
+func (s *ImageService) uploadWorker(stop <-chan struct{}) {
+	ticker := time.NewTicker(uploadTaskPollInterval)
+	defer ticker.Stop()
+	for {
+		for !stopped(stop) && s.runNextUploadTask() {
+		}
+		select {
+		case <-stop:
+			return
+		case <-s.uploadWake:
+		case <-ticker.C:
+		}
+	}
+}
+
+// EnqueueUploadTask 把暂存文件移入任务目录并写入任务记录，由 worker 异步执行
+func (s *ImageService) EnqueueUploadTask(input UploadTaskInput) (*model.UploadTask, error) {
+	// 暂存文件的所有权转交给任务，任何返回路径都负责删除
+	if input.Staged == nil {
+		return nil, errors.New("upload task input is required")
+	}
+	tempPath := input.Staged.Path
+	payload, err := json.Marshal(uploadTaskPayload{Input: input, Size: input.Staged.Size, Hash: input.Staged.Hash})
+	if err != nil {
+		_ = os.Remove(tempPath)
+		return nil, fmt.Errorf("encode upload task payload failed: %w", err)
+	}
+
+	task := model.UploadTask{
+		ID:                uuid.NewString(),
+		Status:            model.UploadTaskStatusPending,
+		Stage:             model.UploadTaskStatusPending,
+		FileName:          input.FileName,
+		Payload:           datatypes.JSON(payload),
+		UploadedByTokenID: input.UploadedByTokenID,
+		NextAttemptAt:     time.Now(),
+	}
+	taskPath := s.uploadTaskPath(task.ID)
+	if err := os.MkdirAll(filepath.Dir(taskPath), 0o755); err != nil {
+		_ = os.Remove(tempPath)
+		return nil, fmt.Errorf("create upload task dir failed: %w", err)
+	}
+	if err := moveFile(tempPath, taskPath); err != nil {
+		_ = os.Remove(tempPath)
+		return nil, fmt.Errorf("stage upload task input failed: %w", err)
+	}
+	if err := s.db.Create(&task).Error; err != nil {
+		_ = os.Remove(taskPath)
+		return nil, fmt.Errorf("create upload task failed: %w", err)
+	}
+
+	s.publishUploadTask(&task)
+	s.wakeUploadWorkers()
+	return &task, nil
+}
+
+// publishUploadTask 把任务的最新状态推送给订阅者
+func (s *ImageService) publishUploadTask(task *model.UploadTask) {
+	if s.taskHub != nil && task != nil {
+		s.taskHub.Publish(*task)
+	}
+}
+
+// wakeUploadWorkers 通知空闲 worker 立即认领任务
+func (s *ImageService) wakeUploadWorkers() {
+	select {
+	case s.uploadWake <- struct{}{}:
+	default:
+	}
+}
+
+// claimUploadTask 认领一个到期的 pending 任务或超时未完成的 running 任务，没有可执行任务时返回 nil
+func (s *ImageService) claimUploadTask() (*model.UploadTask, error) {
+	var task model.UploadTask
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("(status = ? AND next_attempt_at <= ?) OR (status = ? AND claimed_at < ?)",
+				model.UploadTaskStatusPending, now,
+				model.UploadTaskStatusRunning, now.Add(-uploadTaskStaleAfter)).
+			Order("next_attempt_at").
+			First(&task).Error; err != nil {
+			return err
+		}
+		task.Status = model.UploadTaskStatusRunning
+		task.Stage = model.UploadTaskStatusRunning
+		task.Attempts++
+		task.ClaimedAt = &now
+		return tx.Model(&model.UploadTask{}).Where("id = ?", task.ID).Updates(map[string]interface{}{
+			"status":     task.Status,
+			"stage":      task.Stage,
+			"attempts":   task.Attempts,
+			"claimed_at": now,
+		}).Error
+	})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &task, nil
+}
+
+// runNextUploadTask 认领并执行一个任务，返回是否执行了任务
+func (s *ImageService) runNextUploadTask() bool {
+	task, err := s.claimUploadTask()
+	if err != nil {
+		s.log.Warnf("Failed to claim upload task: %v", err)
+		return false
+	}
+	if task == nil {
+		return false
+	}
+	s.publishUploadTask(task)
+	s.runUploadTask(task)
+	return true
+}
+
+// finishUploadTask 更新本次执行的结果。以 attempts 作为条件，
+// 避免已被判定超时并重新认领的任务被旧的执行结果覆盖。
+// 任务结束时在同一事务中写入 Webhook 投递记录；失败的任务保留上传内容以便手动重试，
+// 到期后随任务记录一起清理。
+func (s *ImageService) finishUploadTask(ctx context.Context, task *model.UploadTask, updates map[string]interface{}) {
+	status, _ := updates["status"].(string)
+	terminal := status == model.UploadTaskStatusSucceeded || status == model.UploadTaskStatusFailed
+	updates["stage"] = status
+
+	var affected int64
+	var final model.UploadTask
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		res := tx.Model(&model.UploadTask{}).Where("id = ? AND attempts = ?", task.ID, task.Attempts).Updates(updates)
+		if res.Error != nil {
+			return res.Error
+		}
+		affected = res.RowsAffected
+		if affected == 0 {
+			return nil
+		}
+		if err := tx.Where("id = ?", task.ID).First(&final).Error; err != nil {
+			return err
+		}
+		if !terminal || s.webhooks == nil {
+			return nil
+		}
+		return s.webhooks.enqueueUploadTask(tx, &final)
+	})
+	if err != nil {
+		s.log.Ctx(ctx).Warnf("Failed to update upload task %s: %v", task.ID, err)
+		return
+	}
+	if affected == 0 {
+		s.log.Ctx(ctx).Warnf("Upload task %s was reclaimed by another worker; result discarded", task.ID)
+		return
+	}
+	s.publishUploadTask(&final)
+	if status == model.UploadTaskStatusSucceeded {
+		_ = os.Remove(s.uploadTaskPath(task.ID))
+	}
+	if terminal {
+		if s.webhooks != nil {
+			s.webhooks.notify()
+		}
+	}
+}
+
+func (s *ImageService) failUploadTask(ctx context.Context, task *model.UploadTask, code, message string) {
+	now := time.Now()
+	s.finishUploadTask(ctx, task, map[string]interface{}{
+		"status":        model.UploadTaskStatusFailed,
+		"error_code":    code,
+		"error_message": message,
+		"completed_at":  &now,
+	})
+}
+
+// retryUploadTask 在未达到最大执行次数时按退避时间重新排队，否则置为失败
+func (s *ImageService) retryUploadTask(ctx context.Context, task *model.UploadTask, code, message string) {
+	if task.Attempts >= s.uploadTaskMaxAttempts() {
+		s.failUploadTask(ctx, task, code, message)
+		return
+	}
+	s.finishUploadTask(ctx, task, map[string]interface{}{
+		"status":          model.UploadTaskStatusPending,
+		"error_code":      code,
+		"error_message":   message,
+		"next_attempt_at": time.Now().Add(uploadTaskBackoff(task.Attempts)),
+	})
+}
+
+// permanentUploadError 识别由上传输入本身导致、重试也不会成功的错误，返回任务的错误码与信息
+func permanentUploadError(err error) (string, string, bool) {
+	switch {
+	case errors.Is(err, ErrInvalidRoute):
+		return "invalid_route", err.Error(), true
+	case errors.Is(err, ErrInvalidVisibility):
+		return "invalid_visibility", "visibility must be public, unlisted or private", true
+	case errors.Is(err, ErrMediaDimensionsTooLarge):
+		return "media_dimensions_too_large", "media dimensions exceed limit", true
+	case errors.Is(err, ErrRouteExists):
+		return "route_exists", "route already exists", true
+	}
+	return "", "", false
+}
+
+// setUploadTaskStage 记录执行中任务进入的阶段，同样以 attempts 为条件
+func (s *ImageService) setUploadTaskStage(ctx context.Context, task *model.UploadTask, stage string) {
+	res := s.db.Model(&model.UploadTask{}).
+		Where("id = ? AND attempts = ? AND status = ?", task.ID, task.Attempts, model.UploadTaskStatusRunning).
+		Update("stage", stage)
+	if res.Error != nil {
+		s.log.Ctx(ctx).Warnf("Failed to update upload task %s stage: %v", task.ID, res.Error)
+		return
+	}
+	if res.RowsAffected == 0 {
+		return
+	}
+	task.Stage = stage
+	task.UpdatedAt = time.Now()
+	s.publishUploadTask(task)
+}
+
+func (s *ImageService) runUploadTask(task *model.UploadTask) {
+	ctx, cancel := context.WithTimeout(context.Background(), uploadTaskTimeout)
+	defer cancel()
+	ctx = withUploadStageReporter(ctx, func(stage string) {
+		s.setUploadTaskStage(ctx, task, stage)
+	})
+
+	// 超时重新认领的任务可能已超过最大执行次数
+	if task.Attempts > s.uploadTaskMaxAttempts() {
+		s.failUploadTask(ctx, task, "max_attempts_exceeded", "upload task exceeded max attempts")
+		s.log.Ctx(ctx).Warnf("Upload task %s exceeded max attempts", task.ID)
+		return
+	}
+
+	var payload uploadTaskPayload
+	if err := json.Unmarshal(task.Payload, &payload); err != nil {
+		s.failUploadTask(ctx, task, "upload_input_unavailable", "upload input unavailable")
+		s.log.Ctx(ctx).Warnf("Failed to decode upload task payload %s: %v", task.ID, err)
+		return
+	}
+	input := payload.Input
+	input.Staged = &StagedUpload{Path: s.uploadTaskPath(task.ID), Size: payload.Size, Hash: payload.Hash}
+	if _, statErr := os.Stat(input.Staged.Path); statErr != nil {
+		s.failUploadTask(ctx, task, "upload_input_unavailable", "upload input unavailable")
+		s.log.Ctx(ctx).Warnf("Failed to read upload task input %s: %v", task.ID, statErr)
+		return
+	}
+
+	res, err := s.Upload(
+		ctx,
+		input.Staged,
+		input.FileName,
+		input.Routes,
+		input.Description,
+		input.Tags,
+		input.Visibility,
+		input.MimeType,
+		input.Width,
+		input.Height,
+		input.Convert,
+		input.TargetFormat,
+		input.Quality,
+		input.Effort,
+		input.UploadedByTokenID,
+		input.UploadedByTokenName,
+		input.UploadedByTokenType,
+	)
+	if err != nil {
+		s.log.Ctx(ctx).Warnf("Upload task %s failed (attempt %d): %v", task.ID, task.Attempts, err)
+		if code, message, ok := permanentUploadError(err); ok {
+			s.failUploadTask(ctx, task, code, message)
+			return
+		}
+		s.retryUploadTask(ctx, task, "upload_failed", "upload processing failed")
+		return
+	}
+
+	if input.UploadedByTokenID != nil {
+		tokenSvc := NewAPITokenService(s.cfg, s.db)
+		_ = tokenSvc.RecordLog(&model.APITokenLog{
+			TokenID:   *input.UploadedByTokenID,
+			TokenName: input.UploadedByTokenName,
+			TokenType: input.UploadedByTokenType,
+			Action:    "image_upload",
+			Method:    input.RequestMethod,
+			Path:      input.RequestPath,
+			IPAddress: input.IPAddress,
+			UserAgent: input.UserAgent,
+			ImageHash: res.Image.Hash,
+		})
+	}
+
+	resultBytes, err := json.Marshal(res.Response())
+	if err != nil {
+		s.failUploadTask(ctx, task, "result_encode_failed", "failed to encode upload result")
+		return
+	}
+
+	now := time.Now()
+	s.finishUploadTask(ctx, task, map[string]interface{}{
+		"status":        model.UploadTaskStatusSucceeded,
+		"result":        datatypes.JSON(resultBytes),
+		"error_code":    "",
+		"error_message": "",
+		"completed_at":  &now,
+	})
+}
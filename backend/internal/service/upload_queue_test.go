@@ -0,0 +1,140 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/TangTangChu/AnzuImg/backend/internal/model"
+)
+
+func TestUploadTaskBackoff(t *testing.T) {
+	cases := map[int]time.Duration{
+		1:  30 * time.Second,
+		2:  time.Minute,
+		3:  2 * time.Minute,
+		10: 10 * time.Minute,
+	}
+	for attempts, want := range cases {
+		if got := uploadTaskBackoff(attempts); got != want {
+			t.Errorf("attempts %d: expected %s, got %s", attempts, want, got)
+		}
+	}
+}
+
+func TestUploadTaskPayloadOmitsStagedPath(t *testing.T) {
+	tokenID := uint(7)
+	input := UploadTaskInput{
+		Staged:            &StagedUpload{Path: "/tmp/anzuimg-upload-1", Size: 5, Hash: "abc"},
+		FileName:          "a.png",
+		Routes:            []string{"r"},
+		UploadedByTokenID: &tokenID,
+	}
+	data, err := json.Marshal(uploadTaskPayload{Input: input, Size: input.Staged.Size, Hash: input.Staged.Hash})
+	if err != nil {
+		t.Fatalf("marshal payload: %v", err)
+	}
+	if strings.Contains(string(data), "anzuimg-upload-1") {
+		t.Fatalf("payload should not contain the temp path: %s", data)
+	}
+
+	var decoded uploadTaskPayload
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("unmarshal payload: %v", err)
+	}
+	if decoded.Input.FileName != "a.png" || decoded.Input.Routes[0] != "r" || *decoded.Input.UploadedByTokenID != 7 || decoded.Size != 5 || decoded.Hash != "abc" {
+		t.Fatalf("unexpected decoded payload: %+v", decoded)
+	}
+}
+
+func TestPermanentUploadError(t *testing.T) {
+	cases := map[error]string{
+		fmt.Errorf("%w: bad", ErrInvalidRoute):                      "invalid_route",
+		fmt.Errorf("%w: \"x\"", ErrInvalidVisibility):               "invalid_visibility",
+		ErrMediaDimensionsTooLarge:                                  "media_dimensions_too_large",
+		fmt.Errorf("%w: a/b", ErrRouteExists):                       "route_exists",
+		fmt.Errorf("open staged upload failed: %w", os.ErrNotExist): "",
+	}
+	for err, want := range cases {
+		code, _, ok := permanentUploadError(err)
+		if ok != (want != "") || code != want {
+			t.Errorf("%v: expected %q, got %q (permanent=%v)", err, want, code, ok)
+		}
+	}
+}
+
+func TestMoveFile(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src")
+	dst := filepath.Join(dir, "tasks", "dst")
+	if err := os.WriteFile(src, []byte("payload"), 0o600); err != nil {
+		t.Fatalf("write source: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+		t.Fatalf("create dir: %v", err)
+	}
+	if err := moveFile(src, dst); err != nil {
+		t.Fatalf("move file: %v", err)
+	}
+	if data, err := os.ReadFile(dst); err != nil || string(data) != "payload" {
+		t.Fatalf("unexpected destination content: %q %v", data, err)
+	}
+	if _, err := os.Stat(src); !os.IsNotExist(err) {
+		t.Fatalf("expected source to be removed, got %v", err)
+	}
+}
+
+func TestSplitCommaList(t *testing.T) {
+	got := splitCommaList(" pending, ,failed,")
+	if len(got) != 2 || got[0] != "pending" || got[1] != "failed" {
+		t.Fatalf("unexpected statuses: %q", got)
+	}
+	if got := splitCommaList(""); len(got) != 0 {
+		t.Fatalf("expected no statuses, got %q", got)
+	}
+}
+
+func TestUploadTaskHubFilter(t *testing.T) {
+	hub := NewUploadTaskHub()
+	owner := uint(7)
+	other := uint(8)
+	all := hub.Subscribe(UploadTaskStreamFilter{}, 4)
+	defer all.Close()
+	mine := hub.Subscribe(UploadTaskStreamFilter{TokenID: &owner}, 4)
+	defer mine.Close()
+	byID := hub.Subscribe(UploadTaskStreamFilter{IDs: map[string]struct{}{"b": {}}}, 4)
+	defer byID.Close()
+
+	hub.Publish(model.UploadTask{ID: "a", UploadedByTokenID: &owner})
+	hub.Publish(model.UploadTask{ID: "b", UploadedByTokenID: &other})
+	hub.Publish(model.UploadTask{ID: "c"})
+
+	if len(all.Ch) != 3 || len(mine.Ch) != 1 || len(byID.Ch) != 1 {
+		t.Fatalf("unexpected deliveries: all=%d mine=%d ids=%d", len(all.Ch), len(mine.Ch), len(byID.Ch))
+	}
+	if task := <-mine.Ch; task.ID != "a" {
+		t.Fatalf("token subscriber received %q", task.ID)
+	}
+	if task := <-byID.Ch; task.ID != "b" {
+		t.Fatalf("id subscriber received %q", task.ID)
+	}
+}
+
+func TestUploadStageReporter(t *testing.T) {
+	reportUploadStage(context.Background(), model.UploadTaskStageStoring)
+
+	var stages []string
+	ctx := withUploadStageReporter(context.Background(), func(stage string) {
+		stages = append(stages, stage)
+	})
+	reportUploadStage(ctx, model.UploadTaskStageConverting)
+	reportUploadStage(ctx, model.UploadTaskStageStoring)
+	if strings.Join(stages, ",") != "converting,storing" {
+		t.Fatalf("unexpected stages: %v", stages)
+	}
+}
@@ -0,0 +1,117 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// ErrUploadTooLarge 表示暂存内容超过大小上限
+var ErrUploadTooLarge = errors.New("upload exceeds size limit")
+
+// StagedUpload 是已落盘到临时文件的上传内容，写入时同步计算哈希，
+// 后续处理直接读取文件，避免整份内容驻留内存
+type StagedUpload struct {
+	Path string
+	Size int64
+	Hash string // 十六进制 SHA-256
+}
+
+// StageUpload 将 r 流式写入临时文件并计算 SHA-256。
+// maxBytes 大于 0 时超出即中止并返回 ErrUploadTooLarge。
+func StageUpload(r io.Reader, maxBytes int64) (*StagedUpload, error) {
+	tmp, err := os.CreateTemp("", "anzuimg-upload-*")
+	if err != nil {
+		return nil, fmt.Errorf("create staging file failed: %w", err)
+	}
+	path := tmp.Name()
+
+	src := r
+	if maxBytes > 0 {
+		src = io.LimitReader(r, maxBytes+1)
+	}
+	hasher := sha256.New()
+	n, err := io.Copy(io.MultiWriter(tmp, hasher), src)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(path)
+		return nil, fmt.Errorf("write staging file failed: %w", err)
+	}
+	if maxBytes > 0 && n > maxBytes {
+		_ = os.Remove(path)
+		return nil, ErrUploadTooLarge
+	}
+
+	return &StagedUpload{
+		Path: path,
+		Size: n,
+		Hash: hex.EncodeToString(hasher.Sum(nil)),
+	}, nil
+}
+
+// Open 打开暂存文件用于读取
+func (u *StagedUpload) Open() (*os.File, error) {
+	return os.Open(u.Path)
+}
+
+// ReadAll 读取完整内容，仅用于必须整块处理的场景（如格式转换）
+func (u *StagedUpload) ReadAll() ([]byte, error) {
+	return os.ReadFile(u.Path)
+}
+
+// Remove 删除暂存文件
+func (u *StagedUpload) Remove() {
+	if u == nil || u.Path == "" {
+		return
+	}
+	_ = os.Remove(u.Path)
+}
+
+// Copy 复制暂存文件，副本可独立转交给上传任务
+func (u *StagedUpload) Copy() (*StagedUpload, error) {
+	path, err := copyToTemp("anzuimg-upload-*", u.Path)
+	if err != nil {
+		return nil, fmt.Errorf("copy staging file failed: %w", err)
+	}
+	return &StagedUpload{Path: path, Size: u.Size, Hash: u.Hash}, nil
+}
+
+// copyToTemp 将已有文件复制为新的临时文件，供异步任务独立持有
+func copyToTemp(pattern string, srcPath string) (string, error) {
+	src, err := os.Open(srcPath)
+	if err != nil {
+		return "", err
+	}
+	defer src.Close()
+
+	tmp, err := os.CreateTemp("", pattern)
+	if err != nil {
+		return "", err
+	}
+	path := tmp.Name()
+	_, err = io.Copy(tmp, src)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(path)
+		return "", err
+	}
+	return path, nil
+}
+
+// readStorageFile 读取存储中文件的完整内容
+func readStorageFile(ctx context.Context, storage Storage, relPath string) ([]byte, error) {
+	f, err := storage.Open(ctx, relPath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return io.ReadAll(f)
+}
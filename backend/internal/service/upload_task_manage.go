@@ -0,0 +1,202 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/TangTangChu/AnzuImg/backend/internal/config"
+	"github.com/TangTangChu/AnzuImg/backend/internal/model"
+)
+
+var (
+	ErrUploadTaskNotFound       = errors.New("upload task not found")
+	ErrUploadTaskNotCancellable = errors.New("only pending upload tasks can be cancelled")
+	ErrUploadTaskNotRetryable   = errors.New("only failed upload tasks can be retried")
+	ErrUploadTaskInputMissing   = errors.New("upload task input is no longer available")
+)
+
+// uploadTaskFinishedStatuses 是已结束任务的状态，保留期满后清理
+var uploadTaskFinishedStatuses = []string{
+	model.UploadTaskStatusSucceeded,
+	model.UploadTaskStatusFailed,
+	model.UploadTaskStatusCancelled,
+}
+
+// UploadTaskFilter 是任务列表的筛选条件。Status 可用逗号分隔多个状态，时间按创建时间筛选
+type UploadTaskFilter struct {
+	Status    string
+	StartDate string
+	EndDate   string
+}
+
+// scopeUploadTasks 限定为 tokenID 创建的任务；tokenID 为空表示管理员会话，可以访问全部任务
+func scopeUploadTasks(q *gorm.DB, tokenID *uint) *gorm.DB {
+	if tokenID != nil {
+		q = q.Where("uploaded_by_token_id = ?", *tokenID)
+	}
+	return q
+}
+
+// ListUploadTasks 按创建时间倒序分页查询任务
+func (s *ImageService) ListUploadTasks(filter UploadTaskFilter, tokenID *uint, page, size int) ([]model.UploadTask, int64, error) {
+	page, size = clampPage(page, size)
+	q := scopeUploadTasks(s.db.Model(&model.UploadTask{}), tokenID)
+	if statuses := splitCommaList(filter.Status); len(statuses) > 0 {
+		q = q.Where("status IN ?", statuses)
+	}
+	q = applyTimeBounds(q, LogFilter{StartDate: filter.StartDate, EndDate: filter.EndDate})
+
+	var total int64
+	if err := q.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	var tasks []model.UploadTask
+	if err := q.Order("created_at DESC").Order("id").Limit(size).Offset((page - 1) * size).Find(&tasks).Error; err != nil {
+		return nil, 0, err
+	}
+	return tasks, total, nil
+}
+
+func splitCommaList(raw string) []string {
+	var out []string
+	for _, v := range strings.Split(raw, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+// GetUploadTask 返回单个任务，不存在或不属于 tokenID 时返回 ErrUploadTaskNotFound
+func (s *ImageService) GetUploadTask(id string, tokenID *uint) (*model.UploadTask, error) {
+	var task model.UploadTask
+	if err := scopeUploadTasks(s.db.Where("id = ?", id), tokenID).First(&task).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrUploadTaskNotFound
+		}
+		return nil, err
+	}
+	return &task, nil
+}
+
+// GetUploadTasks 批量查询任务，不存在或无权访问的 ID 不出现在结果中
+func (s *ImageService) GetUploadTasks(ids []string, tokenID *uint) ([]model.UploadTask, error) {
+	var tasks []model.UploadTask
+	if len(ids) == 0 {
+		return tasks, nil
+	}
+	if err := scopeUploadTasks(s.db.Where("id IN ?", ids), tokenID).Find(&tasks).Error; err != nil {
+		return nil, err
+	}
+	return tasks, nil
+}
+
+// CancelUploadTask 取消尚未被认领的任务并删除其上传内容。
+// 状态以条件更新切换，与 worker 的认领互斥，已开始执行的任务返回 ErrUploadTaskNotCancellable。
+func (s *ImageService) CancelUploadTask(id string, tokenID *uint) (*model.UploadTask, error) {
+	now := time.Now()
+	res := scopeUploadTasks(s.db.Model(&model.UploadTask{}).Where("id = ? AND status = ?", id, model.UploadTaskStatusPending), tokenID).
+		Updates(map[string]interface{}{
+			"status":        model.UploadTaskStatusCancelled,
+			"stage":         model.UploadTaskStatusCancelled,
+			"error_code":    "cancelled",
+			"error_message": "upload task cancelled",
+			"completed_at":  &now,
+		})
+	if res.Error != nil {
+		return nil, fmt.Errorf("cancel upload task failed: %w", res.Error)
+	}
+	if res.RowsAffected == 0 {
+		task, err := s.GetUploadTask(id, tokenID)
+		if err != nil {
+			return nil, err
+		}
+		return task, ErrUploadTaskNotCancellable
+	}
+	_ = os.Remove(s.uploadTaskPath(id))
+	task, err := s.GetUploadTask(id, tokenID)
+	if err != nil {
+		return nil, err
+	}
+	s.publishUploadTask(task)
+	return task, nil
+}
+
+// RetryUploadTask 把失败的任务重新排队，执行次数从零开始计算
+func (s *ImageService) RetryUploadTask(id string, tokenID *uint) (*model.UploadTask, error) {
+	task, err := s.GetUploadTask(id, tokenID)
+	if err != nil {
+		return nil, err
+	}
+	if task.Status != model.UploadTaskStatusFailed {
+		return task, ErrUploadTaskNotRetryable
+	}
+	if _, err := os.Stat(s.uploadTaskPath(id)); err != nil {
+		return task, ErrUploadTaskInputMissing
+	}
+
+	res := s.db.Model(&model.UploadTask{}).Where("id = ? AND status = ?", id, model.UploadTaskStatusFailed).
+		Updates(map[string]interface{}{
+			"status":          model.UploadTaskStatusPending,
+			"stage":           model.UploadTaskStatusPending,
+			"attempts":        0,
+			"next_attempt_at": time.Now(),
+			"claimed_at":      nil,
+			"completed_at":    nil,
+			"result":          nil,
+			"error_code":      "",
+			"error_message":   "",
+		})
+	if res.Error != nil {
+		return nil, fmt.Errorf("retry upload task failed: %w", res.Error)
+	}
+	if res.RowsAffected == 0 {
+		return task, ErrUploadTaskNotRetryable
+	}
+	if task, err = s.GetUploadTask(id, tokenID); err != nil {
+		return nil, err
+	}
+	s.publishUploadTask(task)
+	s.wakeUploadWorkers()
+	return task, nil
+}
+
+// CleanupUploadTasksBefore 删除 cutoff 之前结束的任务及其残留的上传内容，返回删除的任务数。
+// Webhook 投递记录随任务级联删除。
+func CleanupUploadTasksBefore(cfg *config.Config, db *gorm.DB, cutoff time.Time) (int64, error) {
+	const batchSize = 500
+	var removed int64
+	for {
+		var ids []string
+		if err := db.Model(&model.UploadTask{}).
+			Where("status IN ? AND completed_at < ?", uploadTaskFinishedStatuses, cutoff).
+			Order("completed_at").Limit(batchSize).
+			Pluck("id", &ids).Error; err != nil {
+			return removed, fmt.Errorf("query finished upload tasks failed: %w", err)
+		}
+		if len(ids) == 0 {
+			return removed, nil
+		}
+
+		// 查询后可能有任务被重新排队，只删除仍满足条件的记录，并只清理这些记录的文件
+		var deleted []model.UploadTask
+		if err := db.Clauses(clause.Returning{Columns: []clause.Column{{Name: "id"}}}).
+			Where("id IN ? AND status IN ? AND completed_at < ?", ids, uploadTaskFinishedStatuses, cutoff).
+			Delete(&deleted).Error; err != nil {
+			return removed, fmt.Errorf("delete finished upload tasks failed: %w", err)
+		}
+		for _, task := range deleted {
+			_ = os.Remove(uploadTaskFilePath(cfg, task.ID))
+		}
+		removed += int64(len(deleted))
+		if len(ids) < batchSize {
+			return removed, nil
+		}
+	}
+}
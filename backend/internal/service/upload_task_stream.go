@@ -0,0 +1,118 @@
+package service
+
+import (
+	"context"
+	"sync"
+
+	"github.com/TangTangChu/AnzuImg/backend/internal/model"
+)
+
+// UploadTaskHub 把上传任务的状态与阶段变化 fan-out 给 SSE 订阅者。
+// 只覆盖本进程执行或修改的任务；多实例部署时由订阅端按任务 ID 轮询数据库补齐。
+// 与 LogStreamHub 一样，订阅者缓冲满时直接丢弃，不拖慢执行任务的 worker。
+type UploadTaskHub struct {
+	mu          sync.RWMutex
+	subscribers map[*uploadTaskSubscription]struct{}
+}
+
+type UploadTaskSubscriber struct {
+	Ch    <-chan model.UploadTask
+	close func()
+}
+
+func (s *UploadTaskSubscriber) Close() {
+	if s.close != nil {
+		s.close()
+	}
+}
+
+// UploadTaskStreamFilter 是订阅条件。TokenID 非空时只推送该令牌创建的任务，IDs 非空时只推送列出的任务
+type UploadTaskStreamFilter struct {
+	TokenID *uint
+	IDs     map[string]struct{}
+}
+
+type uploadTaskSubscription struct {
+	ch     chan model.UploadTask
+	filter UploadTaskStreamFilter
+}
+
+func NewUploadTaskHub() *UploadTaskHub {
+	return &UploadTaskHub{subscribers: map[*uploadTaskSubscription]struct{}{}}
+}
+
+func (h *UploadTaskHub) Subscribe(filter UploadTaskStreamFilter, buffer int) *UploadTaskSubscriber {
+	if buffer <= 0 {
+		buffer = 64
+	}
+	sub := &uploadTaskSubscription{ch: make(chan model.UploadTask, buffer), filter: filter}
+	h.mu.Lock()
+	h.subscribers[sub] = struct{}{}
+	h.mu.Unlock()
+	return &UploadTaskSubscriber{
+		Ch: sub.ch,
+		close: func() {
+			h.mu.Lock()
+			if _, ok := h.subscribers[sub]; ok {
+				delete(h.subscribers, sub)
+				close(sub.ch)
+			}
+			h.mu.Unlock()
+		},
+	}
+}
+
+func (h *UploadTaskHub) Publish(task model.UploadTask) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	for sub := range h.subscribers {
+		if !matchUploadTaskFilter(sub.filter, &task) {
+			continue
+		}
+		select {
+		case sub.ch <- task:
+		default:
+		}
+	}
+}
+
+func matchUploadTaskFilter(f UploadTaskStreamFilter, task *model.UploadTask) bool {
+	if f.TokenID != nil && (task.UploadedByTokenID == nil || *task.UploadedByTokenID != *f.TokenID) {
+		return false
+	}
+	if len(f.IDs) > 0 {
+		if _, ok := f.IDs[task.ID]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// IsUploadTaskFinished 判断任务是否已结束，不会再有状态变化
+func IsUploadTaskFinished(status string) bool {
+	for _, s := range uploadTaskFinishedStatuses {
+		if status == s {
+			return true
+		}
+	}
+	return false
+}
+
+type uploadStageKey struct{}
+
+// withUploadStageReporter 让 Upload 在进入转换、存储、缩略图阶段时回调 report
+func withUploadStageReporter(ctx context.Context, report func(stage string)) context.Context {
+	return context.WithValue(ctx, uploadStageKey{}, report)
+}
+
+// uploadStageReporter 返回上下文中的阶段回调，同步上传时为 nil
+func uploadStageReporter(ctx context.Context) func(stage string) {
+	report, _ := ctx.Value(uploadStageKey{}).(func(stage string))
+	return report
+}
+
+func reportUploadStage(ctx context.Context, stage string) {
+	if report := uploadStageReporter(ctx); report != nil {
+		report(stage)
+	}
+}
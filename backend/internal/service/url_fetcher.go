@@ -4,7 +4,6 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"io"
 	"net"
 	"net/http"
 	"net/url"
@@ -41,8 +40,9 @@ func NewURLFetcher(cfg *config.Config) *URLFetcher {
 	}
 }
 
+// FetchResult 是抓取结果，内容已暂存到 Upload，调用者负责删除
 type FetchResult struct {
-	Body     []byte
+	Upload   *StagedUpload
 	MimeHint string
 	FinalURL string
 	Filename string
@@ -99,14 +99,13 @@ func (f *URLFetcher) Fetch(ctx context.Context, rawURL string, requestMaxBytes i
 		return nil, ErrURLTooLarge
 	}
 
-	limited := io.LimitReader(resp.Body, maxBytes+1)
-	buf, err := io.ReadAll(limited)
+	staged, err := StageUpload(resp.Body, maxBytes)
 	if err != nil {
+		if errors.Is(err, ErrUploadTooLarge) {
+			return nil, ErrURLTooLarge
+		}
 		return nil, fmt.Errorf("%w: %v", ErrURLFetchFailed, err)
 	}
-	if int64(len(buf)) > maxBytes {
-		return nil, ErrURLTooLarge
-	}
 
 	ctype := resp.Header.Get("Content-Type")
 	if idx := strings.Index(ctype, ";"); idx >= 0 {
@@ -125,7 +124,7 @@ func (f *URLFetcher) Fetch(ctx context.Context, rawURL string, requestMaxBytes i
 	}
 
 	return &FetchResult{
-		Body:     buf,
+		Upload:   staged,
 		MimeHint: ctype,
 		FinalURL: finalURL,
 		Filename: filename,
@@ -60,7 +60,11 @@ func ProbeVideoInfo(parent context.Context, data []byte) (*VideoInfo, error) {
 		return nil, fmt.Errorf("create temp video failed: %w", err)
 	}
 	defer cleanup()
+	return ProbeVideoFile(parent, tmpPath)
+}
 
+// ProbeVideoFile 直接探测磁盘上的视频文件
+func ProbeVideoFile(parent context.Context, tmpPath string) (*VideoInfo, error) {
 	ctx, cancel := context.WithTimeout(parent, 10*time.Second)
 	defer cancel()
 
@@ -123,7 +127,11 @@ func GenerateVideoThumbnail(parent context.Context, data []byte, width, height i
 		return nil, fmt.Errorf("create temp input video failed: %w", err)
 	}
 	defer cleanupIn()
+	return GenerateVideoThumbnailFile(parent, tmpIn, width, height)
+}
 
+// GenerateVideoThumbnailFile 从磁盘上的视频文件截取首帧作为缩略图
+func GenerateVideoThumbnailFile(parent context.Context, tmpIn string, width, height int) ([]byte, error) {
 	tmpOut, err := os.CreateTemp("", "anzuimg-video-thumb-*.jpg")
 	if err != nil {
 		return nil, fmt.Errorf("create temp output image failed: %w", err)
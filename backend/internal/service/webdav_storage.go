@@ -0,0 +1,200 @@
+package service
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/TangTangChu/AnzuImg/backend/internal/config"
+	"github.com/TangTangChu/AnzuImg/backend/internal/logger"
+)
+
+const propfindBody = `<?xml version="1.0" encoding="utf-8"?>
+<D:propfind xmlns:D="DAV:"><D:prop><D:resourcetype/><D:getcontentlength/><D:getlastmodified/></D:prop></D:propfind>`
+
+// WebDAVStorage WebDAV 存储，写入前逐级创建目录，按 PROPFIND 遍历对象
+type WebDAVStorage struct {
+	*httpObjectStore
+
+	// 已确认存在的目录，避免每次上传都发送 MKCOL
+	collections sync.Map
+}
+
+// NewWebDAVStorage 创建 WebDAV 存储实例
+func NewWebDAVStorage(cfg *config.Config, log *logger.Logger) (*WebDAVStorage, error) {
+	store, err := newHTTPObjectStore(string(StorageTypeWebDAV), cfg.WebDAVURL, cfg.WebDAVPublicURL, log)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.WebDAVUsername != "" {
+		username, password := cfg.WebDAVUsername, cfg.WebDAVPassword
+		store.authorize = func(req *http.Request) {
+			req.SetBasicAuth(username, password)
+		}
+	}
+	s := &WebDAVStorage{httpObjectStore: store}
+	store.beforePut = s.ensureCollections
+
+	log.Infof("Initializing webdav storage: url=%s, delivery=%s", store.base.Host+store.base.Path, store.DeliveryMode())
+	store.ping("PROPFIND", http.Header{"Depth": {"0"}})
+	return s, nil
+}
+
+// collectionURL 返回目录地址，WebDAV 目录地址以斜杠结尾
+func (s *WebDAVStorage) collectionURL(relDir string) string {
+	u := *s.base
+	u.Path = strings.TrimSuffix(s.base.Path+"/"+relDir, "/") + "/"
+	return u.String()
+}
+
+// ensureCollections 创建 relPath 的父目录，结果缓存以免每次上传都发送 MKCOL
+func (s *WebDAVStorage) ensureCollections(ctx context.Context, relPath string) error {
+	dir := path.Dir(relPath)
+	if _, ok := s.collections.Load(dir); ok {
+		return nil
+	}
+	if err := s.mkcol(ctx, path.Join(s.base.Path, dir)); err != nil {
+		return err
+	}
+	s.collections.Store(dir, true)
+	return nil
+}
+
+// mkcol 创建目录，已存在时服务端返回 405 视为成功；父目录不存在时返回 409，先逐级创建父目录
+func (s *WebDAVStorage) mkcol(ctx context.Context, absDir string) error {
+	u := *s.base
+	u.Path = strings.TrimSuffix(absDir, "/") + "/"
+	resp, err := s.request(ctx, "MKCOL", u.String(), nil, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create webdav collection %s: %w", absDir, err)
+	}
+	switch resp.StatusCode {
+	case http.StatusCreated, http.StatusMethodNotAllowed:
+		_ = resp.Body.Close()
+		return nil
+	case http.StatusConflict:
+		_ = resp.Body.Close()
+		parent := path.Dir(strings.TrimSuffix(absDir, "/"))
+		if parent == "/" || parent == "." {
+			return fmt.Errorf("failed to create webdav collection %s: parent does not exist", absDir)
+		}
+		if err := s.mkcol(ctx, parent); err != nil {
+			return err
+		}
+		return s.mkcol(ctx, absDir)
+	default:
+		return s.statusError("MKCOL", absDir, resp)
+	}
+}
+
+// davMultistatus 是 PROPFIND 响应中用到的部分
+type davMultistatus struct {
+	Responses []struct {
+		Href     string `xml:"href"`
+		Propstat []struct {
+			Status string `xml:"status"`
+			Prop   struct {
+				ResourceType struct {
+					Collection *struct{} `xml:"collection"`
+				} `xml:"resourcetype"`
+				ContentLength int64  `xml:"getcontentlength"`
+				LastModified  string `xml:"getlastmodified"`
+			} `xml:"prop"`
+		} `xml:"propstat"`
+	} `xml:"response"`
+}
+
+type davEntry struct {
+	name  string
+	isDir bool
+	obj   StorageObject
+}
+
+// readCollection 列出目录下的直接子项，按名称排序
+func (s *WebDAVStorage) readCollection(ctx context.Context, relDir string) ([]davEntry, error) {
+	header := http.Header{"Depth": {"1"}, "Content-Type": {"application/xml; charset=utf-8"}}
+	resp, err := s.request(ctx, "PROPFIND", s.collectionURL(relDir), strings.NewReader(propfindBody), header)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list webdav collection %s: %w", relDir, err)
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		_ = resp.Body.Close()
+		return nil, nil
+	}
+	if resp.StatusCode != http.StatusMultiStatus {
+		return nil, s.statusError("PROPFIND", relDir, resp)
+	}
+	defer resp.Body.Close()
+
+	var ms davMultistatus
+	if err := xml.NewDecoder(io.LimitReader(resp.Body, 32<<20)).Decode(&ms); err != nil {
+		return nil, fmt.Errorf("failed to parse webdav listing %s: %w", relDir, err)
+	}
+
+	basePath := strings.TrimSuffix(s.base.Path, "/")
+	var entries []davEntry
+	for _, r := range ms.Responses {
+		href, err := url.Parse(r.Href)
+		if err != nil {
+			continue
+		}
+		rel := strings.Trim(strings.TrimPrefix(strings.TrimSuffix(href.Path, "/"), basePath), "/")
+		// Depth: 1 的响应包含目录自身
+		if rel == relDir {
+			continue
+		}
+		e := davEntry{name: path.Base(rel), obj: StorageObject{Path: rel}}
+		for _, ps := range r.Propstat {
+			if !strings.Contains(ps.Status, " 200 ") {
+				continue
+			}
+			if ps.Prop.ResourceType.Collection != nil {
+				e.isDir = true
+			}
+			e.obj.Size = ps.Prop.ContentLength
+			if t, err := http.ParseTime(ps.Prop.LastModified); err == nil {
+				e.obj.ModTime = t
+			}
+		}
+		entries = append(entries, e)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].name < entries[j].name })
+	return entries, nil
+}
+
+// List 按路径字典序递归遍历 startAfter 之后的对象
+func (s *WebDAVStorage) List(ctx context.Context, startAfter string, fn func(StorageObject) error) error {
+	var walk func(relDir string) error
+	walk = func(relDir string) error {
+		entries, err := s.readCollection(ctx, relDir)
+		if err != nil {
+			return err
+		}
+		for _, e := range entries {
+			if e.isDir {
+				if listSkipsDir(e.obj.Path, startAfter) {
+					continue
+				}
+				if err := walk(e.obj.Path); err != nil {
+					return err
+				}
+				continue
+			}
+			if e.obj.Path <= startAfter {
+				continue
+			}
+			if err := fn(e.obj); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return walk("")
+}
@@ -0,0 +1,301 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/TangTangChu/AnzuImg/backend/internal/config"
+	"github.com/TangTangChu/AnzuImg/backend/internal/logger"
+	"github.com/TangTangChu/AnzuImg/backend/internal/model"
+)
+
+// ErrWebhookNotConfigured 表示未配置签名密钥，不能接受回调地址
+var ErrWebhookNotConfigured = errors.New("webhook secret is not configured")
+
+const (
+	webhookTimeout      = 10 * time.Second
+	webhookStaleAfter   = 6 * webhookTimeout
+	webhookPollInterval = 5 * time.Second
+)
+
+// Webhook 请求头
+const (
+	WebhookHeaderEvent     = "X-AnzuImg-Event"
+	WebhookHeaderDelivery  = "X-AnzuImg-Delivery"
+	WebhookHeaderTimestamp = "X-AnzuImg-Timestamp"
+	WebhookHeaderSignature = "X-AnzuImg-Signature"
+)
+
+// WebhookService 在上传任务结束时向回调地址与全局 Webhook 投递签名通知。
+// 投递记录与任务状态在同一事务中写入，由后台 worker 认领发送，失败后按退避时间重试。
+type WebhookService struct {
+	cfg *config.Config
+	db  *gorm.DB
+	log *logger.Logger
+
+	client *http.Client
+	wake   chan struct{}
+}
+
+func NewWebhookService(cfg *config.Config, db *gorm.DB) *WebhookService {
+	s := &WebhookService{
+		cfg:  cfg,
+		db:   db,
+		log:  logger.Register("webhook"),
+		wake: make(chan struct{}, 1),
+	}
+	s.client = s.buildClient()
+	if len(cfg.WebhookURLs) > 0 && cfg.WebhookSecret == "" {
+		s.log.Warnf("ANZUIMG_WEBHOOK_URLS is set but ANZUIMG_WEBHOOK_SECRET is empty; webhooks are disabled")
+	}
+	if db != nil {
+		go s.runWorker()
+	}
+	return s
+}
+
+// buildClient 与 URLFetcher 相同，在建立连接前校验目标 IP，阻止投递到内网地址；不跟随重定向
+func (s *WebhookService) buildClient() *http.Client {
+	allowPrivate := s.cfg.WebhookAllowPrivate
+	dialer := &net.Dialer{
+		Timeout: 5 * time.Second,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			return verifyDialAddress(network, address, allowPrivate)
+		},
+	}
+	return &http.Client{
+		Timeout: webhookTimeout,
+		Transport: &http.Transport{
+			DialContext:            dialer.DialContext,
+			TLSHandshakeTimeout:    5 * time.Second,
+			ResponseHeaderTimeout:  webhookTimeout,
+			DisableKeepAlives:      true,
+			MaxResponseHeaderBytes: 1 << 16,
+		},
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+func (s *WebhookService) maxAttempts() int {
+	if s.cfg.WebhookMaxAttempts > 0 {
+		return s.cfg.WebhookMaxAttempts
+	}
+	return 6
+}
+
+// ValidateCallbackURL 校验客户端提交的回调地址。地址为 IP 时直接检查，域名在投递连接时检查。
+func (s *WebhookService) ValidateCallbackURL(raw string) error {
+	if s.cfg.WebhookSecret == "" {
+		return ErrWebhookNotConfigured
+	}
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" || len(raw) > 2048 {
+		return ErrURLInvalid
+	}
+	if ip := net.ParseIP(u.Hostname()); ip != nil && !s.cfg.WebhookAllowPrivate && !isPublicIP(ip) {
+		return ErrURLBlocked
+	}
+	return nil
+}
+
+// signWebhook 计算 HMAC-SHA256(secret, "<timestamp>.<body>")
+func signWebhook(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// enqueueUploadTask 为已结束的任务写入投递记录，须在更新任务状态的事务中调用
+func (s *WebhookService) enqueueUploadTask(tx *gorm.DB, task *model.UploadTask) error {
+	if s.cfg.WebhookSecret == "" {
+		return nil
+	}
+	var targets []string
+	var payload uploadTaskPayload
+	if len(task.Payload) > 0 && json.Unmarshal(task.Payload, &payload) == nil && payload.Input.CallbackURL != "" {
+		targets = append(targets, payload.Input.CallbackURL)
+	}
+	targets = append(targets, s.cfg.WebhookURLs...)
+	if len(targets) == 0 {
+		return nil
+	}
+
+	event := model.WebhookEventUploadTaskSucceeded
+	if task.Status == model.UploadTaskStatusFailed {
+		event = model.WebhookEventUploadTaskFailed
+	}
+	body, err := json.Marshal(map[string]interface{}{
+		"event":      event,
+		"created_at": time.Now().UTC(),
+		"task":       task,
+	})
+	if err != nil {
+		return fmt.Errorf("encode webhook payload failed: %w", err)
+	}
+
+	now := time.Now()
+	deliveries := make([]model.WebhookDelivery, 0, len(targets))
+	for _, target := range targets {
+		deliveries = append(deliveries, model.WebhookDelivery{
+			TaskID:        task.ID,
+			Event:         event,
+			URL:           target,
+			Payload:       datatypes.JSON(body),
+			Status:        model.WebhookDeliveryPending,
+			NextAttemptAt: now,
+		})
+	}
+	if err := tx.Create(&deliveries).Error; err != nil {
+		return fmt.Errorf("create webhook deliveries failed: %w", err)
+	}
+	return nil
+}
+
+// notify 唤醒投递 worker
+func (s *WebhookService) notify() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// ListDeliveries 返回任务的全部投递记录
+func (s *WebhookService) ListDeliveries(taskID string) ([]model.WebhookDelivery, error) {
+	var deliveries []model.WebhookDelivery
+	if err := s.db.Where("task_id = ?", taskID).Order("id").Find(&deliveries).Error; err != nil {
+		return nil, err
+	}
+	return deliveries, nil
+}
+
+func (s *WebhookService) runWorker() {
+	ticker := time.NewTicker(webhookPollInterval)
+	defer ticker.Stop()
+	for {
+		for s.deliverNext() {
+		}
+		select {
+		case <-s.wake:
+		case <-ticker.C:
+		}
+	}
+}
+
+// claim 认领一个到期的投递
+func (s *WebhookService) claim() (*model.WebhookDelivery, error) {
+	var d model.WebhookDelivery
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("status = ? AND next_attempt_at <= ?", model.WebhookDeliveryPending, now).
+			Order("next_attempt_at").
+			First(&d).Error; err != nil {
+			return err
+		}
+		d.Attempts++
+		d.ClaimedAt = &now
+		// 投递期间推迟 next_attempt_at，避免被其他 worker 重复认领；进程中途退出时到期后重新投递
+		d.NextAttemptAt = now.Add(webhookStaleAfter)
+		return tx.Model(&model.WebhookDelivery{}).Where("id = ?", d.ID).Updates(map[string]interface{}{
+			"attempts":        d.Attempts,
+			"claimed_at":      now,
+			"next_attempt_at": d.NextAttemptAt,
+		}).Error
+	})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &d, nil
+}
+
+func (s *WebhookService) deliverNext() bool {
+	d, err := s.claim()
+	if err != nil {
+		s.log.Warnf("Failed to claim webhook delivery: %v", err)
+		return false
+	}
+	if d == nil {
+		return false
+	}
+
+	statusCode, sendErr := s.send(d)
+	updates := map[string]interface{}{"last_status_code": statusCode}
+	switch {
+	case sendErr == nil:
+		now := time.Now()
+		updates["status"] = model.WebhookDeliverySucceeded
+		updates["last_error"] = ""
+		updates["delivered_at"] = &now
+	case errors.Is(sendErr, ErrURLBlocked) || d.Attempts >= s.maxAttempts():
+		updates["status"] = model.WebhookDeliveryFailed
+		updates["last_error"] = sendErr.Error()
+	default:
+		updates["last_error"] = sendErr.Error()
+		updates["next_attempt_at"] = time.Now().Add(retryBackoff(d.Attempts, 30*time.Second, time.Hour))
+	}
+	if sendErr != nil {
+		s.log.Warnf("Webhook delivery %d to %s failed (attempt %d): %v", d.ID, d.URL, d.Attempts, sendErr)
+	}
+	if err := s.db.Model(&model.WebhookDelivery{}).Where("id = ? AND attempts = ?", d.ID, d.Attempts).Updates(updates).Error; err != nil {
+		s.log.Warnf("Failed to update webhook delivery %d: %v", d.ID, err)
+	}
+	return true
+}
+
+// send 发送一次投递，2xx 视为成功
+func (s *WebhookService) send(d *model.WebhookDelivery) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), webhookTimeout)
+	defer cancel()
+
+	body := []byte(d.Payload)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, fmt.Errorf("%w: %v", ErrURLInvalid, err)
+	}
+	timestamp := time.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "AnzuImg-Webhook/1.0")
+	req.Header.Set(WebhookHeaderEvent, d.Event)
+	req.Header.Set(WebhookHeaderDelivery, strconv.FormatUint(d.ID, 10))
+	req.Header.Set(WebhookHeaderTimestamp, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(WebhookHeaderSignature, signWebhook(s.cfg.WebhookSecret, timestamp, body))
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		if isBlockedDialErr(err) {
+			return 0, ErrURLBlocked
+		}
+		return 0, err
+	}
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	_ = resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return resp.StatusCode, fmt.Errorf("unexpected status %s", strings.TrimSpace(resp.Status))
+	}
+	return resp.StatusCode, nil
+}
@@ -0,0 +1,69 @@
+package service
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/TangTangChu/AnzuImg/backend/internal/config"
+	"github.com/TangTangChu/AnzuImg/backend/internal/model"
+)
+
+func TestValidateCallbackURL(t *testing.T) {
+	s := NewWebhookService(&config.Config{WebhookSecret: "k"}, nil)
+	if err := s.ValidateCallbackURL("https://ci.example.com/hook"); err != nil {
+		t.Fatalf("expected public url to be accepted: %v", err)
+	}
+	if err := s.ValidateCallbackURL("ftp://ci.example.com/hook"); !errors.Is(err, ErrURLInvalid) {
+		t.Fatalf("expected invalid scheme, got %v", err)
+	}
+	if err := s.ValidateCallbackURL("http://169.254.169.254/latest"); !errors.Is(err, ErrURLBlocked) {
+		t.Fatalf("expected metadata address to be blocked, got %v", err)
+	}
+
+	unsigned := NewWebhookService(&config.Config{}, nil)
+	if err := unsigned.ValidateCallbackURL("https://ci.example.com/hook"); !errors.Is(err, ErrWebhookNotConfigured) {
+		t.Fatalf("expected callbacks to require a secret, got %v", err)
+	}
+}
+
+func TestWebhookSendSignsPayload(t *testing.T) {
+	var gotSignature, gotTimestamp, gotEvent string
+	var gotBody []byte
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotSignature = r.Header.Get(WebhookHeaderSignature)
+		gotTimestamp = r.Header.Get(WebhookHeaderTimestamp)
+		gotEvent = r.Header.Get(WebhookHeaderEvent)
+		gotBody, _ = io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	d := &model.WebhookDelivery{ID: 1, Event: model.WebhookEventUploadTaskSucceeded, URL: srv.URL, Payload: []byte(`{"event":"upload_task.succeeded"}`)}
+
+	s := NewWebhookService(&config.Config{WebhookSecret: "k", WebhookAllowPrivate: true}, nil)
+	if code, err := s.send(d); err != nil || code != http.StatusNoContent {
+		t.Fatalf("unexpected send result: %d %v", code, err)
+	}
+	ts, _ := strconv.ParseInt(gotTimestamp, 10, 64)
+	if gotEvent != d.Event || string(gotBody) != string(d.Payload) || gotSignature != signWebhook("k", ts, gotBody) {
+		t.Fatalf("unexpected delivery: event=%q sig=%q body=%s", gotEvent, gotSignature, gotBody)
+	}
+
+	// 默认不允许投递到回环地址
+	blocked := NewWebhookService(&config.Config{WebhookSecret: "k"}, nil)
+	if _, err := blocked.send(d); !errors.Is(err, ErrURLBlocked) {
+		t.Fatalf("expected loopback delivery to be blocked, got %v", err)
+	}
+}
+
+func TestSignWebhook(t *testing.T) {
+	// printf '1700000000.{}' | openssl dgst -sha256 -hmac secret
+	want := "sha256=b8569b78799ff9e3cbff0fc2d63a33a2b57f3282abd07c37ae5e8e7d79a5f163"
+	if got := signWebhook("secret", 1700000000, []byte("{}")); got != want {
+		t.Fatalf("unexpected signature: %s", got)
+	}
+}
@@ -0,0 +1,62 @@
+package service
+
+import "sync"
+
+// maxBackgroundWorkers 是单类后台 worker 数的上限，与设置项的最大值一致
+const maxBackgroundWorkers = 32
+
+// workerPool 是可在运行时调整并发数的一组 worker。
+// 每个 worker 持有自己的 stop 通道，缩容时关闭多出的通道，worker 完成手上的工作后退出。
+type workerPool struct {
+	mu    sync.Mutex
+	stops []chan struct{}
+	run   func(stop <-chan struct{})
+}
+
+func newWorkerPool(run func(stop <-chan struct{})) *workerPool {
+	return &workerPool{run: run}
+}
+
+// Resize 把 worker 数调整为 n，n 会被限制在 [1, maxBackgroundWorkers]
+func (p *workerPool) Resize(n int) {
+	n = clampWorkerCount(n)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for len(p.stops) < n {
+		stop := make(chan struct{})
+		p.stops = append(p.stops, stop)
+		go p.run(stop)
+	}
+	for len(p.stops) > n {
+		last := len(p.stops) - 1
+		close(p.stops[last])
+		p.stops = p.stops[:last]
+	}
+}
+
+// Size 返回当前的目标 worker 数，缩容时已通知退出的 worker 不计入
+func (p *workerPool) Size() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.stops)
+}
+
+func clampWorkerCount(n int) int {
+	if n < 1 {
+		return 1
+	}
+	if n > maxBackgroundWorkers {
+		return maxBackgroundWorkers
+	}
+	return n
+}
+
+// stopped 非阻塞地检查 worker 是否已被通知退出
+func stopped(stop <-chan struct{}) bool {
+	select {
+	case <-stop:
+		return true
+	default:
+		return false
+	}
+}
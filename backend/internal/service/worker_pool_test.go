@@ -0,0 +1,38 @@
+package service
+
+import (
+	"testing"
+	"time"
+)
+
+func TestWorkerPoolResize(t *testing.T) {
+	exited := make(chan struct{}, maxBackgroundWorkers)
+	pool := newWorkerPool(func(stop <-chan struct{}) {
+		<-stop
+		exited <- struct{}{}
+	})
+
+	pool.Resize(3)
+	if pool.Size() != 3 {
+		t.Fatalf("size = %d, want 3", pool.Size())
+	}
+	pool.Resize(1)
+	for i := 0; i < 2; i++ {
+		select {
+		case <-exited:
+		case <-time.After(time.Second):
+			t.Fatal("worker did not stop after shrink")
+		}
+	}
+	if pool.Size() != 1 {
+		t.Fatalf("size = %d, want 1", pool.Size())
+	}
+	pool.Resize(0)
+	if pool.Size() != 1 {
+		t.Fatalf("size = %d, want at least 1", pool.Size())
+	}
+	pool.Resize(maxBackgroundWorkers + 10)
+	if pool.Size() != maxBackgroundWorkers {
+		t.Fatalf("size = %d, want %d", pool.Size(), maxBackgroundWorkers)
+	}
+}